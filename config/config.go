@@ -4,6 +4,7 @@ import (
 	"github.com/kkyr/fig"
 	"log"
 	"os"
+	"time"
 )
 
 // Config structure for all settings of application
@@ -14,9 +15,112 @@ type Config struct {
 		TypeOfServer     string `fig:"typeOfServer" default:"stdlib"`        // type of server: (stdlib, gin, gorilla, fasthttp)
 		TypeOfRepository string `fig:"typeOfRepository" default:"in-memory"` // type of repository: (in-memory, PostrgreSQL, MySQL)
 	} `fig:"server"`
+	GRPC struct {
+		Enabled   bool `fig:"enabled"`             // serve gRPC API
+		Port      int  `fig:"port" default:"4113"` // port of gRPC server, address is the same as for REST server
+		Multiplex bool `fig:"multiplex"`           // serve gRPC on the port of stdlib server instead of own port
+	} `fig:"grpc"`
+	Subtasks struct {
+		Policy string `fig:"policy" default:"reject"` // deleting and completing of task having open subtasks: (reject, cascade)
+	} `fig:"subtasks"`
+	Webhooks struct {
+		MaxAttempts     int           `fig:"maxAttempts" default:"5"`     // attempts of delivery before it goes to dead letters
+		InitialBackoff  time.Duration `fig:"initialBackoff" default:"1s"` // delay before second attempt, doubled for each next one
+		MaxBackoff      time.Duration `fig:"maxBackoff" default:"5m"`     // max delay between attempts
+		Timeout         time.Duration `fig:"timeout" default:"10s"`       // timeout of one request to receiver
+		HistorySize     int           `fig:"historySize" default:"1000"`  // count of last deliveries kept for history and dead letters
+		AllowedNetworks []string      `fig:"allowedNetworks"`             // CIDRs of local or private networks allowed for receivers, e.g. 10.1.0.0/16
+	} `fig:"webhooks"`
+	Scheduler struct {
+		Reminders   []time.Duration `fig:"reminders" default:"[1h,0s]"`       // reminders before due date of task, 0s means at due date
+		Notifiers   []string        `fig:"notifiers" default:"[log,webhook]"` // notifiers of reminders: (log, webhook, smtp)
+		StateFile   string          `fig:"stateFile"`                         // file of fired reminders surviving restarts, empty means in memory
+		MissedGrace time.Duration   `fig:"missedGrace" default:"1h"`          // missed reminders not older than it are fired after start
+		SMTP        struct {
+			Address string        `fig:"address" default:"localhost:1025"` // SMTP server without auth and TLS, e.g. MailHog
+			From    string        `fig:"from" default:"tasks@localhost"`
+			To      []string      `fig:"to"`
+			Timeout time.Duration `fig:"timeout" default:"10s"` // timeout of sending of one mail
+		} `fig:"smtp"`
+	} `fig:"scheduler"`
+	Attachments struct {
+		Dir     string   `fig:"dir" default:"attachments"`                                            // directory of content of attached files
+		MaxSize int64    `fig:"maxSize" default:"10485760"`                                           // max size of attached file in bytes
+		Types   []string `fig:"types" default:"[image/*,application/pdf,text/plain,application/zip]"` // allowed types sniffed from content, "*/*" allows any type
+	} `fig:"attachments"`
+	Trash struct {
+		Retention     time.Duration `fig:"retention" default:"720h"`   // tasks stay in trash for it before they are purged, negative keeps them forever
+		PurgeInterval time.Duration `fig:"purgeInterval" default:"1h"` // interval of purging of trash
+		HardDelete    []string      `fig:"hardDelete"`                 // authenticated users permitted to delete tasks permanently with ?hard=true
+		HardByActor   bool          `fig:"hardDeleteByActor"`          // without authentication trust actor of X-Actor header for hardDelete, e.g. in development
+	} `fig:"trash"`
+	BulkDelete struct {
+		Disabled bool          `fig:"disabled"`              // reject DELETE /task/, e.g. in production
+		TokenTTL time.Duration `fig:"tokenTTL" default:"5m"` // confirmation token of dry run expires after it
+	} `fig:"bulkDelete"`
+	Auth struct {
+		Users []User `fig:"users"` // users identified by static bearer tokens, no users and no JWT means no authentication
+		JWT   struct {
+			Algorithms     []string      `fig:"algorithms" default:"[HS256,RS256,ES256]"` // accepted algorithms of signatures: (HS256, RS256, ES256)
+			Secret         string        `fig:"secret"`                                   // key of HS256 signatures
+			JWKSFile       string        `fig:"jwksFile"`                                 // JSON Web Key Set with RS256 and ES256 keys, loaded at start
+			JWKSURL        string        `fig:"jwksURL"`                                  // JSON Web Key Set with RS256 and ES256 keys, e.g. of identity provider
+			JWKSCacheTTL   time.Duration `fig:"jwksCacheTTL" default:"10m"`               // keys loaded by URL are reloaded after it or for unknown key id
+			Issuer         string        `fig:"issuer"`                                   // expected "iss" claim, empty accepts any issuer
+			Audience       string        `fig:"audience"`                                 // expected in "aud" claim, empty accepts any audience
+			Leeway         time.Duration `fig:"leeway" default:"30s"`                     // allowed clock skew of "exp" and "nbf" claims
+			PrincipalClaim string        `fig:"principalClaim" default:"sub"`             // claim naming user of request
+		} `fig:"jwt"` // JWT bearer tokens are accepted if secret or JWKS is set
+		Login struct {
+			Issuer     string        `fig:"issuer" default:"tasks"`    // "iss" claim of issued access tokens
+			AccessTTL  time.Duration `fig:"accessTTL" default:"15m"`   // lifetime of access token
+			RefreshTTL time.Duration `fig:"refreshTTL" default:"720h"` // lifetime of refresh token, each refresh issues a new one
+			Keys       []Key         `fig:"keys"`                      // keys of HS256 signatures of access tokens: the first one signs, all verify
+		} `fig:"login"` // POST /auth/login issues tokens to users with password hash if keys are set
+		OIDC []Provider `fig:"oidc"` // OpenID Connect providers of login at /auth/oidc/<name>/login, requires login keys
+	} `fig:"auth"`
+	Tenants struct {
+		Resolve    string `fig:"resolve"`    // resolution of tenant of request: (header, subdomain, path), empty serves only default tenant
+		Domain     string `fig:"domain"`     // base domain of subdomains of tenants, e.g. tasks.example.com for team.tasks.example.com, required by subdomain
+		MaxTasks   int    `fig:"maxTasks"`   // quota of tasks of tenant created without own quota, 0 means no quota
+		AdminToken string `fig:"adminToken"` // bearer token of admin endpoints /admin/tenants, empty disables them
+	} `fig:"tenants"`
 	ErrorLogger *log.Logger // logger for use, don't load from configuration file
 }
 
+// User structure it's a user of service with static bearer token or password of login.
+type User struct {
+	Name         string `fig:"name"`
+	Token        string `fig:"token"`
+	PasswordHash string `fig:"passwordHash"` // bcrypt or argon2id hash of password, e.g. by htpasswd -bnBC 10 "" <password>
+}
+
+// Key structure it's a key of signatures of issued tokens, id of key is kept in tokens, so keys can be rotated:
+// a new key is added first and the old one is removed after tokens signed by it are expired.
+type Key struct {
+	Id     string `fig:"id"`
+	Secret string `fig:"secret"` // at least 32 bytes
+}
+
+// Provider structure it's an OpenID Connect provider of login by authorization code flow with PKCE: claim of ID
+// token of provider is mapped to local user, e.g. {claim: email, users: [{value: alice@example.com, user: alice}]}.
+type Provider struct {
+	Name         string      `fig:"name"`         // name of provider in path of login
+	Issuer       string      `fig:"issuer"`       // URL of provider, endpoints are discovered by <issuer>/.well-known/openid-configuration
+	ClientID     string      `fig:"clientID"`     // id of service registered at provider
+	ClientSecret string      `fig:"clientSecret"` // empty for public client
+	RedirectURL  string      `fig:"redirectURL"`  // URL of /auth/oidc/<name>/callback of service registered at provider
+	Scopes       []string    `fig:"scopes"`       // scopes requested in addition to openid, e.g. [email]
+	Claim        string      `fig:"claim"`        // claim of ID token mapped to local user, empty means "sub"
+	Users        []ClaimUser `fig:"users"`        // local users by values of claim, ID tokens of other values are rejected
+}
+
+// ClaimUser structure it's a local user mapped to value of claim of ID token.
+type ClaimUser struct {
+	Value string `fig:"value"`
+	User  string `fig:"user"`
+}
+
 // Init function for initialize Config structure
 func Init() (*Config, error) {
 	var cfg = Config{}
@@ -1,93 +1,411 @@
 package fasth
 
 import (
-	"encoding/json"
+	"bufio"
+	"bytes"
+	"errors"
 	"fmt"
 	"github.com/White-AK111/REST/config"
+	grpcApi "github.com/White-AK111/REST/grpc-api"
+	"github.com/White-AK111/REST/internal/activity"
+	"github.com/White-AK111/REST/internal/attachment"
+	"github.com/White-AK111/REST/internal/auth"
+	"github.com/White-AK111/REST/internal/bulk"
+	"github.com/White-AK111/REST/internal/codec"
+	"github.com/White-AK111/REST/internal/events"
+	"github.com/White-AK111/REST/internal/gql"
+	"github.com/White-AK111/REST/internal/ical"
 	"github.com/White-AK111/REST/internal/models"
 	"github.com/White-AK111/REST/internal/models/inmemory"
+	"github.com/White-AK111/REST/internal/oidc"
+	"github.com/White-AK111/REST/internal/ownership"
+	"github.com/White-AK111/REST/internal/recurrence"
+	"github.com/White-AK111/REST/internal/session"
+	"github.com/White-AK111/REST/internal/tenant"
+	"github.com/White-AK111/REST/internal/transfer"
+	"github.com/White-AK111/REST/internal/trash"
+	"github.com/White-AK111/REST/internal/webhook"
+	"github.com/White-AK111/REST/internal/ws"
 	"github.com/White-AK111/REST/middleware"
 	"github.com/fasthttp/router"
+	"github.com/fasthttp/websocket"
 	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttpadaptor"
+	"io"
+	"log"
 	"mime"
+	"net"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 )
 
 // taskServer struct for server of task/
 type taskServer struct {
-	store models.Repository
+	store   models.Repository
+	bus     *events.Bus
+	files   *attachment.Attachments
+	trash   *trash.Trash
+	guard   *bulk.Guard
+	users   *auth.Users
+	tenants *tenant.Tenants
+
+	principal string         // authenticated user of request
+	tenant    *tenant.Tenant // tenant of request
 }
 
-// NewTaskServerInmemory function initialize a new taskServer.
-func NewTaskServerInmemory() *taskServer {
-	store := inmemory.NewStorage()
-	return &taskServer{store: store}
+// NewTaskServerInmemory function initialize a new taskServer, tenants serve tasks of each tenant by own in-memory
+// storage, policy defines deleting and completing of tasks having open subtasks, content of attachments of default
+// tenant is kept by files, bin purges deleted tasks and permits hard delete, guard confirms bulk delete, users
+// authenticate requests.
+func NewTaskServerInmemory(policy models.SubtaskPolicy, files *attachment.Attachments, bin *trash.Trash, guard *bulk.Guard, users *auth.Users, tenants *tenant.Tenants) (*taskServer, error) {
+	t, err := tenants.Open(files, func() models.Repository { return inmemory.NewStorage(policy) })
+	if err != nil {
+		return nil, err
+	}
+	return &taskServer{store: t.Store(), bus: t.Bus(), files: files, trash: bin, guard: guard, users: users, tenants: tenants}, nil
 }
 
-// renderJSON renders 'v' as JSON and writes it as a response into w.
-func renderJSONFast(c *fasthttp.RequestCtx, v interface{}) {
-	js, err := json.Marshal(v)
+// renderFast renders 'v' in format negotiated by Accept header and writes it as a response into c.
+func renderFast(c *fasthttp.RequestCtx, v interface{}) {
+	enc, err := codec.Negotiate(string(c.Request.Header.Peek("Accept")))
+	if err != nil {
+		c.Error(err.Error(), http.StatusNotAcceptable)
+		return
+	}
+	data, err := enc.Marshal(v)
 	if err != nil {
 		c.Error(err.Error(), http.StatusInternalServerError)
 		return
 	}
-	c.SetContentType("application/json")
-	_, err = c.Write(js)
+	c.SetContentType(enc.ContentType())
+	_, err = c.Write(data)
 	if err != nil {
 		c.Error(err.Error(), http.StatusInternalServerError)
 		return
 	}
 }
 
-// getAllTasksHandler handler for GET method without id.
+// decodeBodyFast decodes request body into 'v' by Content-Type. On error writes response and returns false.
+func decodeBodyFast(c *fasthttp.RequestCtx, v interface{}) bool {
+	dec, err := codec.ForContentType(string(c.Request.Header.ContentType()))
+	if errors.Is(err, codec.ErrUnsupportedMediaType) {
+		c.Error(err.Error(), http.StatusUnsupportedMediaType)
+		return false
+	}
+	if err != nil {
+		c.Error(err.Error(), http.StatusBadRequest)
+		return false
+	}
+
+	if err = dec.Decode(bytes.NewReader(c.PostBody()), v); err != nil {
+		c.Error(err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// getAllTasksHandler handler for GET method without id, ?order=dependency sorts blockers before tasks blocked by them.
 func (ts *taskServer) getAllTasksHandler(c *fasthttp.RequestCtx) {
 	allTasks := ts.store.GetAllTasks()
-	renderJSONFast(c, allTasks)
+	switch order := string(c.QueryArgs().Peek("order")); order {
+	case "":
+	case "dependency":
+		allTasks = models.OrderByDependency(allTasks)
+	default:
+		c.Error(fmt.Sprintf("unknown order %q, expect dependency", order), http.StatusBadRequest)
+		return
+	}
+	renderFast(c, allTasks)
+}
+
+// setProjectHandler handler for PUT method with id, moves task to another project: {"projectId":<id>}, 0 takes it out of project.
+func (ts *taskServer) setProjectHandler(c *fasthttp.RequestCtx) {
+	type RequestTaskProject struct {
+		ProjectId int `json:"projectId" xml:"projectId" yaml:"projectId"`
+	}
+
+	var rp RequestTaskProject
+	if !decodeBodyFast(c, &rp) {
+		return
+	}
+
+	id, _ := strconv.Atoi(c.UserValue("id").(string))
+	task, err := ts.store.GetTask(id)
+	if err != nil {
+		c.Error(err.Error(), errorStatus(err))
+		return
+	}
+	task.ProjectId = rp.ProjectId
+	if err = ts.store.UpdateTask(task); err != nil {
+		c.Error(err.Error(), errorStatus(err))
+		return
+	}
+
+	ts.getTaskHandler(c)
+}
+
+// withActor returns handler which authenticates request and serves it by server of principal of request:
+// changes of tasks are logged in activity log with the principal as actor and tasks are scoped to the principal
+// and to tenant of request.
+func (ts *taskServer) withActor(h func(*taskServer, *fasthttp.RequestCtx)) fasthttp.RequestHandler {
+	return func(c *fasthttp.RequestCtx) {
+		claims, _ := middleware.ClaimsFast(c)
+		principal, err := ts.users.Authenticate(string(c.Request.Header.Peek(auth.Header)), string(c.Request.Header.Peek(activity.Header)), claims)
+		if err != nil {
+			c.Response.Header.Set("WWW-Authenticate", auth.Challenge)
+			c.Error(err.Error(), http.StatusUnauthorized)
+			return
+		}
+		t, err := ts.tenants.Tenant(string(c.Request.Header.Peek(tenant.Header)))
+		if err != nil {
+			c.Error(err.Error(), http.StatusNotFound)
+			return
+		}
+		h(&taskServer{store: ts.users.Repository(t.Store(), principal), bus: t.Bus(), files: t.Files(), trash: ts.trash, guard: ts.guard, users: ts.users, tenants: ts.tenants, principal: principal, tenant: t}, c)
+	}
+}
+
+// attachmentsHandler handler for GET method with id, responds with attachments of task.
+func (ts *taskServer) attachmentsHandler(c *fasthttp.RequestCtx) {
+	id, _ := strconv.Atoi(c.UserValue("id").(string))
+	attachments, err := ts.store.GetAttachments(id)
+	if err != nil {
+		c.Error(err.Error(), errorStatus(err))
+		return
+	}
+
+	renderFast(c, attachments)
+}
+
+// uploadAttachmentHandler handler for POST method with id, attaches file from field "file" of multipart form to task.
+// Size of request body is limited by server.
+func (ts *taskServer) uploadAttachmentHandler(c *fasthttp.RequestCtx) {
+	id, _ := strconv.Atoi(c.UserValue("id").(string))
+	header, err := c.FormFile(attachment.Field)
+	if err != nil {
+		c.Error(fmt.Sprintf("expect file in field %q of multipart form: %s", attachment.Field, err), http.StatusBadRequest)
+		return
+	}
+	file, err := header.Open()
+	if err != nil {
+		c.Error(err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+
+	uploaded, err := ts.files.Upload(ts.store, id, header.Filename, header.Size, file)
+	if err != nil {
+		c.Error(err.Error(), errorStatus(err))
+		return
+	}
+
+	renderFast(c, uploaded)
+}
+
+// getAttachmentHandler handler for GET method with id of task and attachment, responds with content of attachment,
+// Range requests with single range are supported.
+func (ts *taskServer) getAttachmentHandler(c *fasthttp.RequestCtx) {
+	id, _ := strconv.Atoi(c.UserValue("id").(string))
+	attachmentId, _ := strconv.Atoi(c.UserValue("attachment").(string))
+	attached, content, err := ts.files.Open(ts.store, id, attachmentId)
+	if err != nil {
+		c.Error(err.Error(), errorStatus(err))
+		return
+	}
+
+	size := int(attached.Size)
+	c.Response.Header.Set("Accept-Ranges", "bytes")
+	c.Response.Header.SetLastModified(attached.Time)
+	byteRange := c.Request.Header.Peek("Range")
+	if len(byteRange) == 0 {
+		c.SetContentType(attached.ContentType)
+		c.Response.Header.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": attached.Name}))
+		// Stream is closed by fasthttp after the response is sent.
+		c.SetBodyStream(content, size)
+		return
+	}
+
+	start, end, err := fasthttp.ParseByteRange(byteRange, size)
+	if err == nil {
+		_, err = content.Seek(int64(start), io.SeekStart)
+	}
+	if err != nil {
+		content.Close()
+		c.Response.Header.Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+		c.Error(err.Error(), http.StatusRequestedRangeNotSatisfiable)
+		return
+	}
+	c.SetStatusCode(http.StatusPartialContent)
+	c.SetContentType(attached.ContentType)
+	c.Response.Header.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": attached.Name}))
+	c.Response.Header.SetContentRange(start, end, size)
+	c.SetBodyStream(struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(content, int64(end-start+1)), content}, end-start+1)
+}
+
+// deleteAttachmentHandler handler for DELETE method with id of task and attachment.
+func (ts *taskServer) deleteAttachmentHandler(c *fasthttp.RequestCtx) {
+	id, _ := strconv.Atoi(c.UserValue("id").(string))
+	attachmentId, _ := strconv.Atoi(c.UserValue("attachment").(string))
+	if err := ts.files.Delete(ts.store, id, attachmentId); err != nil {
+		c.Error(err.Error(), errorStatus(err))
+	}
 }
 
-// deleteAllTasksHandler handler for DELETE method without id.
+// commentsHandler handler for GET method with id, responds with page of comments of task: ?offset=<n>&limit=<n>.
+func (ts *taskServer) commentsHandler(c *fasthttp.RequestCtx) {
+	type ResponseComments struct {
+		Total    int              `json:"total" xml:"total" yaml:"total"`
+		Comments []models.Comment `json:"comments" xml:"comments>comment" yaml:"comments"`
+	}
+
+	id, _ := strconv.Atoi(c.UserValue("id").(string))
+	offset, limit, err := models.ParsePage(string(c.QueryArgs().Peek("offset")), string(c.QueryArgs().Peek("limit")))
+	if err != nil {
+		c.Error(err.Error(), http.StatusBadRequest)
+		return
+	}
+	comments, total, err := ts.store.GetComments(id, offset, limit)
+	if err != nil {
+		c.Error(err.Error(), errorStatus(err))
+		return
+	}
+
+	renderFast(c, ResponseComments{Total: total, Comments: comments})
+}
+
+// addCommentHandler handler for POST method with id, adds comment of actor of request to task: {"text":"<text>"}.
+func (ts *taskServer) addCommentHandler(c *fasthttp.RequestCtx) {
+	type RequestComment struct {
+		Text string `json:"text" xml:"text" yaml:"text"`
+	}
+
+	id, _ := strconv.Atoi(c.UserValue("id").(string))
+	var rc RequestComment
+	if !decodeBodyFast(c, &rc) {
+		return
+	}
+	if strings.TrimSpace(rc.Text) == "" {
+		c.Error("expect text of comment", http.StatusBadRequest)
+		return
+	}
+
+	comment, err := ts.store.AddComment(models.Comment{TaskId: id, Author: ts.principal, Text: rc.Text})
+	if err != nil {
+		c.Error(err.Error(), errorStatus(err))
+		return
+	}
+
+	renderFast(c, comment)
+}
+
+// activityHandler handler for GET method with id, responds with page of activity log of task: ?offset=<n>&limit=<n>.
+func (ts *taskServer) activityHandler(c *fasthttp.RequestCtx) {
+	type ResponseActivity struct {
+		Total    int               `json:"total" xml:"total" yaml:"total"`
+		Activity []models.Activity `json:"activity" xml:"activity>entry" yaml:"activity"`
+	}
+
+	id, _ := strconv.Atoi(c.UserValue("id").(string))
+	offset, limit, err := models.ParsePage(string(c.QueryArgs().Peek("offset")), string(c.QueryArgs().Peek("limit")))
+	if err != nil {
+		c.Error(err.Error(), http.StatusBadRequest)
+		return
+	}
+	entries, total, err := ts.store.GetActivity(id, offset, limit)
+	if err != nil {
+		c.Error(err.Error(), errorStatus(err))
+		return
+	}
+
+	renderFast(c, ResponseActivity{Total: total, Activity: entries})
+}
+
+// deleteAllTasksHandler handler for DELETE method without id, moves tasks selected by ?tag=<tag>&due=<date>
+// to trash, all tasks without filter, ?hard=true deletes them permanently. Request with ?dryRun=true responds
+// with tasks to be deleted and confirmation token, they are deleted by request with the same filter and
+// ?confirm=<token>.
 func (ts *taskServer) deleteAllTasksHandler(c *fasthttp.RequestCtx) {
-	err := ts.store.DeleteAllTasks()
+	hard, ok := ts.parseHard(c)
+	if !ok {
+		return
+	}
+	args := c.QueryArgs()
+	filter := bulk.Filter{Tag: string(args.Peek("tag")), Due: string(args.Peek("due")), Hard: hard}
+	if filter.Tag != "" && string(args.Peek("recursive")) == "true" {
+		filter.Tag = models.TagTree(filter.Tag)
+	}
+	if ts.users.Enabled() {
+		filter.Owner = ts.principal
+	}
+
+	if string(args.Peek("dryRun")) == "true" {
+		preview, err := ts.guard.DryRun(ts.store, filter)
+		if err != nil {
+			c.Error(err.Error(), errorStatus(err))
+			return
+		}
+		renderFast(c, preview)
+		return
+	}
+
+	result, err := ts.guard.Delete(ts.store, filter, string(args.Peek("confirm")))
 	if err != nil {
-		c.Error(err.Error(), http.StatusNotFound)
+		c.Error(err.Error(), errorStatus(err))
+		return
 	}
+	renderFast(c, result)
 }
 
 // createTaskHandler handler for POST method do create task.
 func (ts *taskServer) createTaskHandler(c *fasthttp.RequestCtx) {
 	// Types used internally in this handler to (de-)serialize the request and response from/to JSON.
 	type RequestTask struct {
-		Text string    `json:"text"`
-		Tags []string  `json:"tags"`
-		Due  time.Time `json:"due"`
+		Text      string    `json:"text" xml:"text" yaml:"text"`
+		Tags      []string  `json:"tags" xml:"tags>tag" yaml:"tags"`
+		Due       time.Time `json:"due" xml:"due" yaml:"due"`
+		RRule     string    `json:"rrule" xml:"rrule" yaml:"rrule"`
+		ParentId  int       `json:"parentId" xml:"parentId" yaml:"parentId"`
+		ProjectId int       `json:"projectId" xml:"projectId" yaml:"projectId"`
 	}
 
 	type ResponseId struct {
-		Id int `json:"id"`
+		Id int `json:"id" xml:"id" yaml:"id"`
 	}
 
-	// Enforce a JSON Content-Type.
-	contentType := c.Request.Header.Peek("Content-Type")
-	mediaType, _, err := mime.ParseMediaType(string(contentType))
-	if err != nil {
-		c.Error(err.Error(), http.StatusBadRequest)
-		return
-	}
-	if mediaType != "application/json" {
-		c.Error("expect application/json Content-Type", http.StatusUnsupportedMediaType)
+	var rt RequestTask
+	if !decodeBodyFast(c, &rt) {
 		return
 	}
 
-	var rt RequestTask
-	if err := json.Unmarshal(c.PostBody(), &rt); err != nil {
+	if err := recurrence.Validate(rt.RRule, rt.Due); err != nil {
 		c.Error(err.Error(), http.StatusBadRequest)
 		return
 	}
+	if rt.ParentId != 0 {
+		if _, err := ts.store.GetTask(rt.ParentId); err != nil {
+			c.Error("parent "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if rt.ProjectId != 0 {
+		if _, err := ts.store.GetProject(rt.ProjectId); err != nil {
+			c.Error(err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
 
-	id := ts.store.CreateTask(rt.Text, rt.Tags, rt.Due)
-	renderJSONFast(c, ResponseId{Id: id})
+	id, err := ts.store.CreateTask(models.Task{Text: rt.Text, Tags: rt.Tags, Due: rt.Due, RRule: rt.RRule, ParentId: rt.ParentId, ProjectId: rt.ProjectId})
+	if err != nil {
+		c.Error(err.Error(), errorStatus(err))
+		return
+	}
+	renderFast(c, ResponseId{Id: id})
 }
 
 // getTaskHandler handler for GET method with id.
@@ -99,23 +417,391 @@ func (ts *taskServer) getTaskHandler(c *fasthttp.RequestCtx) {
 		return
 	}
 
-	renderJSONFast(c, task)
+	renderFast(c, task)
 }
 
-// deleteTaskHandler handler for DELETE method with id.
+// parseHard parses query parameter "hard" and checks permission of actor of request for hard delete.
+// On error writes response and returns false.
+func (ts *taskServer) parseHard(c *fasthttp.RequestCtx) (hard bool, ok bool) {
+	hard, err := trash.ParseHard(string(c.QueryArgs().Peek("hard")))
+	if err != nil {
+		c.Error(err.Error(), http.StatusBadRequest)
+		return false, false
+	}
+	if hard {
+		if err = ts.trash.Permit(ts.principal, ts.users.Enabled()); err != nil {
+			c.Error(err.Error(), errorStatus(err))
+			return false, false
+		}
+	}
+	return hard, true
+}
+
+// deleteTaskHandler handler for DELETE method with id, moves task with its subtasks to trash, ?hard=true deletes
+// them permanently.
 func (ts *taskServer) deleteTaskHandler(c *fasthttp.RequestCtx) {
+	hard, ok := ts.parseHard(c)
+	if !ok {
+		return
+	}
+
 	id, _ := strconv.Atoi(c.UserValue("id").(string))
-	err := ts.store.DeleteTask(id)
+	var err error
+	if hard {
+		err = ts.store.DeleteTask(id)
+	} else {
+		err = ts.store.TrashTask(id)
+	}
 	if err != nil {
-		c.Error(err.Error(), http.StatusNotFound)
+		c.Error(err.Error(), errorStatus(err))
+	}
+}
+
+// restoreTaskHandler handler for POST method with id, restores task with its subtasks from trash and responds with it.
+func (ts *taskServer) restoreTaskHandler(c *fasthttp.RequestCtx) {
+	id, _ := strconv.Atoi(c.UserValue("id").(string))
+	if _, err := ts.store.RestoreTask(id); err != nil {
+		c.Error(err.Error(), errorStatus(err))
+		return
+	}
+
+	ts.getTaskHandler(c)
+}
+
+// trashHandler handler for GET method, responds with all tasks in trash.
+func (ts *taskServer) trashHandler(c *fasthttp.RequestCtx) {
+	renderFast(c, ts.store.GetTrash())
+}
+
+// completeTaskHandler handler for POST method with id, completes task and responds with the next occurrence of recurring task.
+func (ts *taskServer) completeTaskHandler(c *fasthttp.RequestCtx) {
+	type ResponseNext struct {
+		Next *models.Task `json:"next,omitempty" xml:"next,omitempty" yaml:"next,omitempty"`
+	}
+
+	id, _ := strconv.Atoi(c.UserValue("id").(string))
+	next, ok, err := recurrence.Complete(ts.store, id)
+	if err != nil {
+		c.Error(err.Error(), errorStatus(err))
+		return
+	}
+
+	var rn ResponseNext
+	if ok {
+		rn.Next = &next
+	}
+	renderFast(c, rn)
+}
+
+// childrenHandler handler for GET method with id, responds with subtasks of task.
+func (ts *taskServer) childrenHandler(c *fasthttp.RequestCtx) {
+	id, _ := strconv.Atoi(c.UserValue("id").(string))
+	children, err := ts.store.GetChildren(id)
+	if err != nil {
+		c.Error(err.Error(), errorStatus(err))
+		return
+	}
+
+	renderFast(c, children)
+}
+
+// addDependenciesHandler handler for POST method with id, makes task blocked by other tasks: {"blockedBy":[<id>,...]}.
+func (ts *taskServer) addDependenciesHandler(c *fasthttp.RequestCtx) {
+	type RequestDependencies struct {
+		BlockedBy []int `json:"blockedBy" xml:"blockedBy>id" yaml:"blockedBy"`
+	}
+
+	var rd RequestDependencies
+	if !decodeBodyFast(c, &rd) {
+		return
+	}
+
+	id, _ := strconv.Atoi(c.UserValue("id").(string))
+	if err := ts.store.AddDependencies(id, rd.BlockedBy); err != nil {
+		c.Error(err.Error(), errorStatus(err))
+		return
+	}
+
+	ts.getTaskHandler(c)
+}
+
+// removeDependencyHandler handler for DELETE method with id and id of blocker, task isn't blocked by it anymore.
+func (ts *taskServer) removeDependencyHandler(c *fasthttp.RequestCtx) {
+	id, _ := strconv.Atoi(c.UserValue("id").(string))
+	blocker, _ := strconv.Atoi(c.UserValue("blocker").(string))
+	if err := ts.store.RemoveDependency(id, blocker); err != nil {
+		c.Error(err.Error(), errorStatus(err))
+		return
+	}
+
+	ts.getTaskHandler(c)
+}
+
+// setParentHandler handler for PUT method with id, moves task under another parent: {"parentId":<id>}, 0 makes it top level.
+func (ts *taskServer) setParentHandler(c *fasthttp.RequestCtx) {
+	type RequestParent struct {
+		ParentId int `json:"parentId" xml:"parentId" yaml:"parentId"`
+	}
+
+	var rp RequestParent
+	if !decodeBodyFast(c, &rp) {
+		return
+	}
+
+	id, _ := strconv.Atoi(c.UserValue("id").(string))
+	task, err := ts.store.GetTask(id)
+	if err != nil {
+		c.Error(err.Error(), errorStatus(err))
+		return
 	}
+	task.ParentId = rp.ParentId
+	if err = ts.store.UpdateTask(task); err != nil {
+		c.Error(err.Error(), errorStatus(err))
+		return
+	}
+
+	ts.getTaskHandler(c)
+}
+
+// shareTaskHandler handler for PUT method with id, replaces users whom task is shared with and responds with task:
+// {"shares":[{"user":"<user>","access":"read|write"}]}.
+func (ts *taskServer) shareTaskHandler(c *fasthttp.RequestCtx) {
+	type RequestShares struct {
+		Shares []models.Share `json:"shares" xml:"shares>share" yaml:"shares"`
+	}
+
+	var rs RequestShares
+	if !decodeBodyFast(c, &rs) {
+		return
+	}
+	if err := models.ValidateShares(rs.Shares); err != nil {
+		c.Error(err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	id, _ := strconv.Atoi(c.UserValue("id").(string))
+	if err := ts.store.ShareTask(id, rs.Shares); err != nil {
+		c.Error(err.Error(), errorStatus(err))
+		return
+	}
+
+	ts.getTaskHandler(c)
+}
+
+// tagParam returns hierarchical tag of catch-all "tag" parameter, like "work/backend/api".
+func tagParam(c *fasthttp.RequestCtx) string {
+	return strings.Trim(c.UserValue("tag").(string), "/")
 }
 
 // tagHandler handler for "tag" path.
 func (ts *taskServer) tagHandler(c *fasthttp.RequestCtx) {
-	tag := c.UserValue("tag").(string)
+	tag := tagParam(c)
+	if string(c.QueryArgs().Peek("recursive")) == "true" {
+		tag = models.TagTree(tag)
+	}
 	tasks := ts.store.GetTasksByTag(tag)
-	renderJSONFast(c, tasks)
+	renderFast(c, tasks)
+}
+
+// ResponseUpdated it's a response with ids of tasks changed by tag operation.
+type ResponseUpdated struct {
+	Updated []int `json:"updated" xml:"updated>id" yaml:"updated"`
+}
+
+// errorStatus returns HTTP status code of error of repository operation.
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, models.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, models.ErrConflict), errors.Is(err, models.ErrHasSubtasks), errors.Is(err, models.ErrCycle),
+		errors.Is(err, models.ErrBlocked):
+		return http.StatusConflict
+	case errors.Is(err, trash.ErrForbidden), errors.Is(err, bulk.ErrDisabled), errors.Is(err, ownership.ErrForbidden),
+		errors.Is(err, tenant.ErrQuota):
+		return http.StatusForbidden
+	case errors.Is(err, bulk.ErrBadFilter):
+		return http.StatusBadRequest
+	case errors.Is(err, bulk.ErrNoToken):
+		return http.StatusPreconditionRequired
+	case errors.Is(err, bulk.ErrInvalidToken):
+		return http.StatusPreconditionFailed
+	case errors.Is(err, attachment.ErrTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, attachment.ErrUnsupportedType):
+		return http.StatusUnsupportedMediaType
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// renderUpdated renders ids of changed tasks or writes error of tag operation.
+func renderUpdated(c *fasthttp.RequestCtx, ids []int, err error) {
+	if err != nil {
+		c.Error(err.Error(), errorStatus(err))
+		return
+	}
+	if ids == nil {
+		ids = []int{}
+	}
+	renderFast(c, ResponseUpdated{Updated: ids})
+}
+
+// getAllTagsHandler handler for GET method without tag, lists all tags with counts of tasks.
+func (ts *taskServer) getAllTagsHandler(c *fasthttp.RequestCtx) {
+	tags := ts.store.GetAllTags()
+	renderFast(c, tags)
+}
+
+// renameTagHandler handler for PUT method with tag, renames tag in all tasks: {"name":"<new tag>"}.
+func (ts *taskServer) renameTagHandler(c *fasthttp.RequestCtx) {
+	type RequestRename struct {
+		Name string `json:"name" xml:"name" yaml:"name"`
+	}
+
+	var rr RequestRename
+	if !decodeBodyFast(c, &rr) {
+		return
+	}
+	if rr.Name == "" {
+		c.Error("expect new name of tag", http.StatusBadRequest)
+		return
+	}
+
+	ids, err := ts.store.RenameTag(tagParam(c), rr.Name)
+	renderUpdated(c, ids, err)
+}
+
+// deleteTagHandler handler for DELETE method with tag, strips tag from all tasks.
+func (ts *taskServer) deleteTagHandler(c *fasthttp.RequestCtx) {
+	ids, err := ts.store.DeleteTag(tagParam(c))
+	renderUpdated(c, ids, err)
+}
+
+// mergeTagsHandler handler for POST method at "tag/merge", replaces tags by one tag: {"tags":["a","b"],"into":"c"}.
+func (ts *taskServer) mergeTagsHandler(c *fasthttp.RequestCtx) {
+	type RequestMerge struct {
+		Tags []string `json:"tags" xml:"tags>tag" yaml:"tags"`
+		Into string   `json:"into" xml:"into" yaml:"into"`
+	}
+
+	var rm RequestMerge
+	if !decodeBodyFast(c, &rm) {
+		return
+	}
+	if len(rm.Tags) == 0 || rm.Into == "" {
+		c.Error("expect tags to merge and target tag 'into'", http.StatusBadRequest)
+		return
+	}
+
+	ids, err := ts.store.MergeTags(rm.Tags, rm.Into)
+	renderUpdated(c, ids, err)
+}
+
+// RequestProject it's a request to create or to update project.
+type RequestProject struct {
+	Name     string `json:"name" xml:"name" yaml:"name"`
+	Archived bool   `json:"archived" xml:"archived" yaml:"archived"`
+}
+
+// createProjectHandler handler for POST method do create project: {"name":"<name>"}.
+func (ts *taskServer) createProjectHandler(c *fasthttp.RequestCtx) {
+	type ResponseId struct {
+		Id int `json:"id" xml:"id" yaml:"id"`
+	}
+
+	var rp RequestProject
+	if !decodeBodyFast(c, &rp) {
+		return
+	}
+	if rp.Name == "" {
+		c.Error("expect name of project", http.StatusBadRequest)
+		return
+	}
+
+	id := ts.store.CreateProject(models.Project{Name: rp.Name, Archived: rp.Archived})
+	renderFast(c, ResponseId{Id: id})
+}
+
+// getAllProjectsHandler handler for GET method without id, lists all projects.
+func (ts *taskServer) getAllProjectsHandler(c *fasthttp.RequestCtx) {
+	projects := ts.store.GetAllProjects()
+	renderFast(c, projects)
+}
+
+// getProjectHandler handler for GET method with id.
+func (ts *taskServer) getProjectHandler(c *fasthttp.RequestCtx) {
+	id, _ := strconv.Atoi(c.UserValue("id").(string))
+	project, err := ts.store.GetProject(id)
+	if err != nil {
+		c.Error(err.Error(), errorStatus(err))
+		return
+	}
+
+	renderFast(c, project)
+}
+
+// updateProjectHandler handler for PUT method with id, renames and archives project: {"name":"<name>","archived":true}.
+func (ts *taskServer) updateProjectHandler(c *fasthttp.RequestCtx) {
+	var rp RequestProject
+	if !decodeBodyFast(c, &rp) {
+		return
+	}
+	if rp.Name == "" {
+		c.Error("expect name of project", http.StatusBadRequest)
+		return
+	}
+
+	id, _ := strconv.Atoi(c.UserValue("id").(string))
+	if err := ts.store.UpdateProject(models.Project{Id: id, Name: rp.Name, Archived: rp.Archived}); err != nil {
+		c.Error(err.Error(), errorStatus(err))
+		return
+	}
+
+	ts.getProjectHandler(c)
+}
+
+// deleteProjectHandler handler for DELETE method with id, tasks of project stay without project.
+func (ts *taskServer) deleteProjectHandler(c *fasthttp.RequestCtx) {
+	id, _ := strconv.Atoi(c.UserValue("id").(string))
+	ids, err := ts.store.DeleteProject(id)
+	renderUpdated(c, ids, err)
+}
+
+// projectTasksHandler handler for GET method with id of project, lists tasks of project, also of archived one.
+// Tasks are filtered by tag pattern with ?tag=<tag>[&recursive=true] or by due date with ?due=<yyyy-mm-dd>.
+func (ts *taskServer) projectTasksHandler(c *fasthttp.RequestCtx) {
+	id, _ := strconv.Atoi(c.UserValue("id").(string))
+	tag, due := string(c.QueryArgs().Peek("tag")), string(c.QueryArgs().Peek("due"))
+
+	var (
+		tasks []models.Task
+		err   error
+	)
+	switch {
+	case tag != "" && due != "":
+		c.Error("expect only one of 'tag' and 'due'", http.StatusBadRequest)
+		return
+	case tag != "":
+		if string(c.QueryArgs().Peek("recursive")) == "true" {
+			tag = models.TagTree(tag)
+		}
+		tasks, err = ts.store.GetProjectTasksByTag(id, tag)
+	case due != "":
+		date, parseErr := time.Parse(models.DateLayout, due)
+		if parseErr != nil {
+			c.Error(fmt.Sprintf("bad 'due': %s", parseErr), http.StatusBadRequest)
+			return
+		}
+		tasks, err = ts.store.GetProjectTasksByDueDate(id, date.Year(), date.Month(), date.Day())
+	default:
+		tasks, err = ts.store.GetProjectTasks(id)
+	}
+	if err != nil {
+		c.Error(err.Error(), errorStatus(err))
+		return
+	}
+
+	renderFast(c, tasks)
 }
 
 // dueHandler handler for "due" path.
@@ -124,7 +810,11 @@ func (ts *taskServer) dueHandler(c *fasthttp.RequestCtx) {
 		c.Error(fmt.Sprintf("expect /due/<year>/<month>/<day>, got %v", string(c.Path())), http.StatusBadRequest)
 	}
 
-	year, _ := strconv.Atoi(c.UserValue("year").(string))
+	year, err := strconv.Atoi(c.UserValue("year").(string))
+	if err != nil || year < models.MinYear || year > models.MaxYear {
+		badRequestError()
+		return
+	}
 	month, _ := strconv.Atoi(c.UserValue("month").(string))
 	if month < int(time.January) || month > int(time.December) {
 		badRequestError()
@@ -133,43 +823,306 @@ func (ts *taskServer) dueHandler(c *fasthttp.RequestCtx) {
 	day, _ := strconv.Atoi(c.UserValue("day").(string))
 
 	tasks := ts.store.GetTasksByDueDate(year, time.Month(month), day)
-	renderJSONFast(c, tasks)
+	renderFast(c, tasks)
+}
+
+// dueRangeHandler handler for "due" path with range of due dates in RFC 3339 format: /due/?from=<time>&to=<time>.
+func (ts *taskServer) dueRangeHandler(c *fasthttp.RequestCtx) {
+	from, err := time.Parse(time.RFC3339, string(c.QueryArgs().Peek("from")))
+	if err != nil {
+		c.Error(fmt.Sprintf("bad 'from': %s", err), http.StatusBadRequest)
+		return
+	}
+	to, err := time.Parse(time.RFC3339, string(c.QueryArgs().Peek("to")))
+	if err != nil {
+		c.Error(fmt.Sprintf("bad 'to': %s", err), http.StatusBadRequest)
+		return
+	}
+	if to.Before(from) {
+		c.Error("'to' must not be before 'from'", http.StatusBadRequest)
+		return
+	}
+
+	tasks := ts.store.GetTasksByDueRange(from, to)
+	renderFast(c, tasks)
+}
+
+// searchHandler handler for "search" path, full-text search over text and tags of tasks: /search?q=<words>.
+func (ts *taskServer) searchHandler(c *fasthttp.RequestCtx) {
+	query := string(c.QueryArgs().Peek("q"))
+	if strings.TrimSpace(query) == "" {
+		c.Error("expect search query 'q'", http.StatusBadRequest)
+		return
+	}
+
+	tasks := ts.store.SearchTasks(query)
+	renderFast(c, tasks)
+}
+
+// exportHandler handler for "export" path, streams all tasks in format from query parameter.
+func (ts *taskServer) exportHandler(c *fasthttp.RequestCtx) {
+	format, err := transfer.ParseFormat(string(c.QueryArgs().Peek("format")))
+	if err != nil {
+		c.Error(err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	c.SetContentType(format.ContentType())
+	c.Response.Header.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", format.FileName()))
+	c.SetBodyStreamWriter(func(w *bufio.Writer) {
+		if err := transfer.Export(w, ts.store, format); err != nil {
+			log.Printf("error on export tasks: %s", err)
+		}
+	})
+}
+
+// importHandler handler for "import" path, loads tasks from request body.
+func (ts *taskServer) importHandler(c *fasthttp.RequestCtx) {
+	args := c.QueryArgs()
+	format, opts, err := transfer.ParseImportParams(string(args.Peek("format")), string(c.Request.Header.ContentType()), string(args.Peek("preserveIds")), string(args.Peek("onConflict")))
+	if err != nil {
+		c.Error(err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tasks, err := transfer.Decode(bytes.NewReader(c.PostBody()), format)
+	if err != nil {
+		c.Error(err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err = ts.tenant.Admit(len(tasks)); err != nil {
+		c.Error(err.Error(), errorStatus(err))
+		return
+	}
+
+	result, err := transfer.Load(ts.store, tasks, opts)
+	if err != nil {
+		c.Error(err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	renderFast(c, result)
+}
+
+// getCalendarHandler handler for GET method, renders tasks with due date (optionally filtered by tag) as iCalendar feed.
+func (ts *taskServer) getCalendarHandler(c *fasthttp.RequestCtx) {
+	component, err := ical.ParseComponent(string(c.QueryArgs().Peek("component")))
+	if err != nil {
+		c.Error(err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var tasks []models.Task
+	if tag := string(c.QueryArgs().Peek("tag")); tag != "" {
+		tasks = ts.store.GetTasksByTag(tag)
+	} else {
+		tasks = ts.store.GetAllTasks()
+	}
+
+	c.SetContentType(ical.ContentType)
+	if err = ical.Encode(c, tasks, ical.Options{Component: component, Name: "Tasks"}); err != nil {
+		log.Printf("error on render calendar: %s", err)
+	}
+}
+
+// importCalendarHandler handler for POST method, creates tasks from .ics file in request body.
+func (ts *taskServer) importCalendarHandler(c *fasthttp.RequestCtx) {
+	tasks, err := ical.Decode(bytes.NewReader(c.PostBody()))
+	if err != nil {
+		c.Error(err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err = ts.tenant.Admit(len(tasks)); err != nil {
+		c.Error(err.Error(), errorStatus(err))
+		return
+	}
+
+	result, err := transfer.Load(ts.store, tasks, transfer.ImportOptions{})
+	if err != nil {
+		c.Error(err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	renderFast(c, result)
+}
+
+// eventsHandler handler for "events" path, streams changes of tasks which principal sees as Server-Sent Events.
+func (ts *taskServer) eventsHandler(c *fasthttp.RequestCtx) {
+	lastSeq, resume, err := events.ParseLastEventId(string(c.Request.Header.Peek("Last-Event-ID")), string(c.QueryArgs().Peek("lastEventId")))
+	if err != nil {
+		c.Error(err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	events.SetSSEHeaders(c.Response.Header.Set)
+	done := c.Done()
+	c.SetBodyStreamWriter(func(w *bufio.Writer) {
+		// Error means that client has gone or is too slow, stream is just finished.
+		_ = events.StreamSSE(w, w.Flush, ts.bus, lastSeq, resume, ts.users.Visible(ts.principal), done)
+	})
+}
+
+// upgrader upgrades connections to WebSocket, only same origin requests are allowed.
+var upgrader = websocket.FastHTTPUpgrader{ReadBufferSize: 1024, WriteBufferSize: 1024}
+
+// wsHandler handler for "ws" path, runs WebSocket subscription session.
+func (ts *taskServer) wsHandler(c *fasthttp.RequestCtx) {
+	err := upgrader.Upgrade(c, func(conn *websocket.Conn) {
+		ws.Serve(conn, ts.store, ts.bus, ts.users.Visible(ts.principal))
+	})
+	if err != nil {
+		log.Printf("error on upgrade to websocket: %s", err)
+	}
 }
 
 func (ts *taskServer) panicHandler(c *fasthttp.RequestCtx) {
 	panic("test panic")
 }
 
+// errorHandlerFast writes response for request which server failed to read, like default handler of fasthttp,
+// but with status 413 for too large body, e.g. upload of too large attachment.
+func errorHandlerFast(c *fasthttp.RequestCtx, err error) {
+	var netErr *net.OpError
+	var smallBufferErr *fasthttp.ErrSmallBuffer
+	switch {
+	case errors.Is(err, fasthttp.ErrBodyTooLarge):
+		c.Error(err.Error(), http.StatusRequestEntityTooLarge)
+	case errors.As(err, &smallBufferErr):
+		c.Error("Too big request header", http.StatusRequestHeaderFieldsTooLarge)
+	case errors.As(err, &netErr) && netErr.Timeout():
+		c.Error("Request timeout", http.StatusRequestTimeout)
+	default:
+		c.Error("Error when parsing request", http.StatusBadRequest)
+	}
+}
+
+// resolveTenant returns handler which resolves tenant of request before next handler, like tenant.Handler
+// for net/http based servers.
+func resolveTenant(tenants *tenant.Tenants, next fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(c *fasthttp.RequestCtx) {
+		name, path := tenants.Resolve(string(c.Host()), string(c.Path()), string(c.Request.Header.Peek(tenant.Header)))
+		c.Request.Header.Del(tenant.Header)
+		if name != "" {
+			c.Request.Header.Set(tenant.Header, name)
+		}
+		if path != string(c.Path()) {
+			c.URI().SetPath(path)
+		}
+		next(c)
+	}
+}
+
 // Init function do initialize a new server with parameters from config.yaml.
 func Init(cfg *config.Config) {
 	r := router.New()
 	var server *taskServer
+	policy, err := models.ParseSubtaskPolicy(cfg.Subtasks.Policy)
+	if err != nil {
+		cfg.ErrorLogger.Fatalf("Error on parse subtasks policy: %s\n", err)
+	}
+
+	files, err := attachment.NewFromConfig(cfg)
+	if err != nil {
+		cfg.ErrorLogger.Fatalf("Error on create store of attachments: %s\n", err)
+	}
+
+	bin := trash.New(cfg)
+	guard := bulk.New(cfg)
+	users, err := auth.New(cfg)
+	if err != nil {
+		cfg.ErrorLogger.Fatalf("Error on create authentication: %s\n", err)
+	}
+	tenants, err := tenant.New(cfg)
+	if err != nil {
+		cfg.ErrorLogger.Fatalf("Error on parse tenants resolution: %s\n", err)
+	}
 
 	switch cfg.Server.TypeOfRepository {
 	case "in-memory":
-		server = NewTaskServerInmemory()
+		server, err = NewTaskServerInmemory(policy, files, bin, guard, users, tenants)
+		if err != nil {
+			cfg.ErrorLogger.Fatalf("Error on start tenant: %s\n", err)
+		}
 	default:
 		cfg.ErrorLogger.Fatal("Unknown repository type.")
 	}
 
-	r.POST("/task/", server.createTaskHandler)
-	r.GET("/task/", server.getAllTasksHandler)
-	r.DELETE("/task/", server.deleteAllTasksHandler)
-	r.GET("/task/{id:[0-9]+}", server.getTaskHandler)
-	r.DELETE("/task/{id:[0-9]+}", server.deleteTaskHandler)
-	r.GET("/tag/{tag}", server.tagHandler)
-	r.GET("/due/{year:[0-9]+}/{month:[0-9]+}/{day:[0-9]+}", server.dueHandler)
+	go bin.RunAll(tenants.Stores)
+
+	// JWT bearer tokens are verified for all routes except admin and login ones
+	jwtAuth := func(h fasthttp.RequestHandler) fasthttp.RequestHandler {
+		return middleware.JWTFast(users.Verifier(), users.Local, h)
+	}
+	r.POST("/task/", jwtAuth(server.withActor((*taskServer).createTaskHandler)))
+	r.GET("/task/", jwtAuth(server.withActor((*taskServer).getAllTasksHandler)))
+	r.DELETE("/task/", jwtAuth(server.withActor((*taskServer).deleteAllTasksHandler)))
+	r.GET("/task/{id:[0-9]+}", jwtAuth(server.withActor((*taskServer).getTaskHandler)))
+	r.DELETE("/task/{id:[0-9]+}", jwtAuth(server.withActor((*taskServer).deleteTaskHandler)))
+	r.POST("/task/{id:[0-9]+}/complete", jwtAuth(server.withActor((*taskServer).completeTaskHandler)))
+	r.POST("/task/{id:[0-9]+}/restore", jwtAuth(server.withActor((*taskServer).restoreTaskHandler)))
+	r.GET("/task/{id:[0-9]+}/children", jwtAuth(server.withActor((*taskServer).childrenHandler)))
+	r.PUT("/task/{id:[0-9]+}/parent", jwtAuth(server.withActor((*taskServer).setParentHandler)))
+	r.PUT("/task/{id:[0-9]+}/shares", jwtAuth(server.withActor((*taskServer).shareTaskHandler)))
+	r.POST("/task/{id:[0-9]+}/dependencies", jwtAuth(server.withActor((*taskServer).addDependenciesHandler)))
+	r.DELETE("/task/{id:[0-9]+}/dependencies/{blocker:[0-9]+}", jwtAuth(server.withActor((*taskServer).removeDependencyHandler)))
+	r.PUT("/task/{id:[0-9]+}/project", jwtAuth(server.withActor((*taskServer).setProjectHandler)))
+	r.GET("/task/{id:[0-9]+}/comments", jwtAuth(server.withActor((*taskServer).commentsHandler)))
+	r.POST("/task/{id:[0-9]+}/comments", jwtAuth(server.withActor((*taskServer).addCommentHandler)))
+	r.GET("/task/{id:[0-9]+}/activity", jwtAuth(server.withActor((*taskServer).activityHandler)))
+	r.GET("/task/{id:[0-9]+}/attachments", jwtAuth(server.withActor((*taskServer).attachmentsHandler)))
+	r.POST("/task/{id:[0-9]+}/attachments", jwtAuth(server.withActor((*taskServer).uploadAttachmentHandler)))
+	r.GET("/task/{id:[0-9]+}/attachments/{attachment:[0-9]+}", jwtAuth(server.withActor((*taskServer).getAttachmentHandler)))
+	r.DELETE("/task/{id:[0-9]+}/attachments/{attachment:[0-9]+}", jwtAuth(server.withActor((*taskServer).deleteAttachmentHandler)))
+	r.POST("/project/", jwtAuth(server.withActor((*taskServer).createProjectHandler)))
+	r.GET("/project/", jwtAuth(server.withActor((*taskServer).getAllProjectsHandler)))
+	r.GET("/project/{id:[0-9]+}", jwtAuth(server.withActor((*taskServer).getProjectHandler)))
+	r.PUT("/project/{id:[0-9]+}", jwtAuth(server.withActor((*taskServer).updateProjectHandler)))
+	r.DELETE("/project/{id:[0-9]+}", jwtAuth(server.withActor((*taskServer).deleteProjectHandler)))
+	r.GET("/project/{id:[0-9]+}/task/", jwtAuth(server.withActor((*taskServer).projectTasksHandler)))
+	r.GET("/tag/", jwtAuth(server.withActor((*taskServer).getAllTagsHandler)))
+	r.POST("/tag/merge", jwtAuth(server.withActor((*taskServer).mergeTagsHandler)))
+	r.GET("/tag/{tag:*}", jwtAuth(server.withActor((*taskServer).tagHandler)))
+	r.PUT("/tag/{tag:*}", jwtAuth(server.withActor((*taskServer).renameTagHandler)))
+	r.DELETE("/tag/{tag:*}", jwtAuth(server.withActor((*taskServer).deleteTagHandler)))
+	r.GET("/due/", jwtAuth(server.withActor((*taskServer).dueRangeHandler)))
+	r.GET("/trash", jwtAuth(server.withActor((*taskServer).trashHandler)))
+	r.GET("/search", jwtAuth(server.withActor((*taskServer).searchHandler)))
+	r.GET("/due/{year:[0-9]+}/{month:[0-9]+}/{day:[0-9]+}", jwtAuth(server.withActor((*taskServer).dueHandler)))
+	r.GET("/export", jwtAuth(server.withActor((*taskServer).exportHandler)))
+	r.POST("/import", jwtAuth(server.withActor((*taskServer).importHandler)))
+	r.GET("/calendar.ics", jwtAuth(server.withActor((*taskServer).getCalendarHandler)))
+	r.POST("/calendar.ics", jwtAuth(server.withActor((*taskServer).importCalendarHandler)))
+	graphqlHandler := tenants.PerTenant(func(t *tenant.Tenant) (http.Handler, error) { return gql.NewHandler(t.Store(), users) })
+	webhookHandler := tenants.PerTenant(func(t *tenant.Tenant) (http.Handler, error) { return webhook.Handler(t.Hooks(), users), nil })
+	r.GET("/graphql", jwtAuth(fasthttpadaptor.NewFastHTTPHandler(middleware.ClaimsAdapted(graphqlHandler))))
+	r.POST("/graphql", jwtAuth(fasthttpadaptor.NewFastHTTPHandler(middleware.ClaimsAdapted(graphqlHandler))))
+	r.GET("/events", jwtAuth(server.withActor((*taskServer).eventsHandler)))
+	r.GET("/ws", jwtAuth(server.withActor((*taskServer).wsHandler)))
+	r.ANY("/webhooks", jwtAuth(fasthttpadaptor.NewFastHTTPHandler(middleware.ClaimsAdapted(webhookHandler))))
+	r.ANY("/webhooks/{path:*}", jwtAuth(fasthttpadaptor.NewFastHTTPHandler(middleware.ClaimsAdapted(webhookHandler))))
+	r.ANY("/admin/tenants", fasthttpadaptor.NewFastHTTPHandler(tenant.Handler(tenants)))
+	r.ANY("/admin/tenants/{path:*}", fasthttpadaptor.NewFastHTTPHandler(tenant.Handler(tenants)))
+	r.ANY("/auth/{path:*}", fasthttpadaptor.NewFastHTTPHandler(oidc.Handler(users.Providers(), session.Handler(users.Sessions()))))
 	// For test panic
 	r.GET("/panic", server.panicHandler)
 
+	grpcApi.Start(cfg, tenants, users)
+
 	cfg.ErrorLogger.Printf("Start server %s with storage %s on: %s\n", cfg.Server.TypeOfServer, cfg.Server.TypeOfRepository, cfg.Server.ServerAddress+":"+strconv.Itoa(cfg.Server.ServerPort))
 
+	maxBodySize := fasthttp.DefaultMaxRequestBodySize
+	if size := int(files.MaxBodySize()); size > maxBodySize {
+		maxBodySize = size
+	}
 	s := &fasthttp.Server{
-		Handler: middleware.LoggerAndPanicRecover(r.Handler),
-		Name:    "fastHttpWithLoggerAndPanicRecover",
+		Handler:            middleware.LoggerAndPanicRecover(resolveTenant(tenants, r.Handler)),
+		Name:               "fastHttpWithLoggerAndPanicRecover",
+		MaxRequestBodySize: maxBodySize,
+		ErrorHandler:       errorHandlerFast,
 	}
 
-	err := s.ListenAndServe(cfg.Server.ServerAddress + ":" + strconv.Itoa(cfg.Server.ServerPort))
+	err = s.ListenAndServe(cfg.Server.ServerAddress + ":" + strconv.Itoa(cfg.Server.ServerPort))
 	if err != nil {
 		cfg.ErrorLogger.Fatalf("Error on start server: %s\n", err)
 	}
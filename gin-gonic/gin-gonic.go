@@ -1,11 +1,34 @@
 package gin_gonic
 
 import (
+	"errors"
+	"fmt"
 	"github.com/White-AK111/REST/config"
+	grpcApi "github.com/White-AK111/REST/grpc-api"
+	"github.com/White-AK111/REST/internal/attachment"
+	"github.com/White-AK111/REST/internal/auth"
+	"github.com/White-AK111/REST/internal/bulk"
+	"github.com/White-AK111/REST/internal/codec"
+	"github.com/White-AK111/REST/internal/events"
+	"github.com/White-AK111/REST/internal/gql"
+	"github.com/White-AK111/REST/internal/ical"
 	"github.com/White-AK111/REST/internal/models"
 	"github.com/White-AK111/REST/internal/models/inmemory"
+	"github.com/White-AK111/REST/internal/oidc"
+	"github.com/White-AK111/REST/internal/ownership"
+	"github.com/White-AK111/REST/internal/recurrence"
+	"github.com/White-AK111/REST/internal/session"
+	"github.com/White-AK111/REST/internal/tenant"
+	"github.com/White-AK111/REST/internal/transfer"
+	"github.com/White-AK111/REST/internal/trash"
+	"github.com/White-AK111/REST/internal/webhook"
+	"github.com/White-AK111/REST/internal/ws"
+	"github.com/White-AK111/REST/middleware"
+	"log"
+	"mime"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -13,44 +36,388 @@ import (
 
 // taskServer struct for server of task/
 type taskServer struct {
-	store models.Repository
+	store   models.Repository
+	bus     *events.Bus
+	files   *attachment.Attachments
+	trash   *trash.Trash
+	guard   *bulk.Guard
+	users   *auth.Users
+	tenants *tenant.Tenants
+
+	principal string         // authenticated user of request
+	tenant    *tenant.Tenant // tenant of request
+}
+
+// NewTaskServerInmemory function initialize a new taskServer, tenants serve tasks of each tenant by own in-memory
+// storage, policy defines deleting and completing of tasks having open subtasks, content of attachments of default
+// tenant is kept by files, bin purges deleted tasks and permits hard delete, guard confirms bulk delete, users
+// authenticate requests.
+func NewTaskServerInmemory(policy models.SubtaskPolicy, files *attachment.Attachments, bin *trash.Trash, guard *bulk.Guard, users *auth.Users, tenants *tenant.Tenants) (*taskServer, error) {
+	t, err := tenants.Open(files, func() models.Repository { return inmemory.NewStorage(policy) })
+	if err != nil {
+		return nil, err
+	}
+	return &taskServer{store: t.Store(), bus: t.Bus(), files: files, trash: bin, guard: guard, users: users, tenants: tenants}, nil
 }
 
-// NewTaskServerInmemory function initialize a new taskServer.
-func NewTaskServerInmemory() *taskServer {
-	store := inmemory.NewStorage()
-	return &taskServer{store: store}
+// render renders 'v' in format negotiated by Accept header and writes it as a response with status code.
+func render(c *gin.Context, code int, v interface{}) {
+	enc, err := codec.Negotiate(c.GetHeader("Accept"))
+	if err != nil {
+		c.String(http.StatusNotAcceptable, err.Error())
+		return
+	}
+	data, err := enc.Marshal(v)
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.Data(code, enc.ContentType(), data)
 }
 
-// getAllTasksHandler handler for GET method without id.
+// decodeBody decodes request body into 'v' by Content-Type. On error writes response and returns false.
+func decodeBody(c *gin.Context, v interface{}) bool {
+	dec, err := codec.ForContentType(c.GetHeader("Content-Type"))
+	if errors.Is(err, codec.ErrUnsupportedMediaType) {
+		c.String(http.StatusUnsupportedMediaType, err.Error())
+		return false
+	}
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return false
+	}
+
+	if err = dec.Decode(c.Request.Body, v); err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return false
+	}
+	return true
+}
+
+// getAllTasksHandler handler for GET method without id, ?order=dependency sorts blockers before tasks blocked by them.
 func (ts *taskServer) getAllTasksHandler(c *gin.Context) {
 	allTasks := ts.store.GetAllTasks()
-	c.JSON(http.StatusOK, allTasks)
+	switch order := c.Query("order"); order {
+	case "":
+	case "dependency":
+		allTasks = models.OrderByDependency(allTasks)
+	default:
+		c.String(http.StatusBadRequest, fmt.Sprintf("unknown order %q, expect dependency", order))
+		return
+	}
+	render(c, http.StatusOK, allTasks)
+}
+
+// setProjectHandler handler for PUT method with id, moves task to another project: {"projectId":<id>}, 0 takes it out of project.
+func (ts *taskServer) setProjectHandler(c *gin.Context) {
+	type RequestTaskProject struct {
+		ProjectId int `json:"projectId" xml:"projectId" yaml:"projectId"`
+	}
+
+	id, err := strconv.Atoi(c.Params.ByName("id"))
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var rp RequestTaskProject
+	if !decodeBody(c, &rp) {
+		return
+	}
+
+	task, err := ts.store.GetTask(id)
+	if err != nil {
+		c.String(errorStatus(err), err.Error())
+		return
+	}
+	task.ProjectId = rp.ProjectId
+	if err = ts.store.UpdateTask(task); err != nil {
+		c.String(errorStatus(err), err.Error())
+		return
+	}
+
+	ts.getTaskHandler(c)
+}
+
+// withActor returns handler which authenticates request and serves it by server of principal of request:
+// changes of tasks are logged in activity log with the principal as actor and tasks are scoped to the principal
+// and to tenant of request.
+func (ts *taskServer) withActor(h func(*taskServer, *gin.Context)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, err := ts.users.AuthenticateRequest(c.Request)
+		if err != nil {
+			c.Header("WWW-Authenticate", auth.Challenge)
+			c.String(http.StatusUnauthorized, err.Error())
+			return
+		}
+		t, err := ts.tenants.Tenant(c.GetHeader(tenant.Header))
+		if err != nil {
+			c.String(http.StatusNotFound, err.Error())
+			return
+		}
+		h(&taskServer{store: ts.users.Repository(t.Store(), principal), bus: t.Bus(), files: t.Files(), trash: ts.trash, guard: ts.guard, users: ts.users, tenants: ts.tenants, principal: principal, tenant: t}, c)
+	}
+}
+
+// attachmentsHandler handler for GET method with id, responds with attachments of task.
+func (ts *taskServer) attachmentsHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Params.ByName("id"))
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	attachments, err := ts.store.GetAttachments(id)
+	if err != nil {
+		c.String(errorStatus(err), err.Error())
+		return
+	}
+
+	render(c, http.StatusOK, attachments)
+}
+
+// uploadAttachmentHandler handler for POST method with id, attaches file from field "file" of multipart form to task.
+func (ts *taskServer) uploadAttachmentHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Params.ByName("id"))
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if c.Request.ContentLength > ts.files.MaxBodySize() {
+		c.String(http.StatusRequestEntityTooLarge, attachment.ErrTooLarge.Error())
+		return
+	}
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, ts.files.MaxBodySize())
+	header, err := c.FormFile(attachment.Field)
+	if err != nil {
+		c.String(http.StatusBadRequest, fmt.Sprintf("expect file in field %q of multipart form: %s", attachment.Field, err))
+		return
+	}
+	file, err := header.Open()
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer file.Close()
+
+	uploaded, err := ts.files.Upload(ts.store, id, header.Filename, header.Size, file)
+	if err != nil {
+		c.String(errorStatus(err), err.Error())
+		return
+	}
+
+	render(c, http.StatusOK, uploaded)
+}
+
+// getAttachmentHandler handler for GET method with id of task and attachment, responds with content of attachment,
+// Range requests are supported.
+func (ts *taskServer) getAttachmentHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Params.ByName("id"))
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+	attachmentId, err := strconv.Atoi(c.Params.ByName("attachment"))
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	attached, content, err := ts.files.Open(ts.store, id, attachmentId)
+	if err != nil {
+		c.String(errorStatus(err), err.Error())
+		return
+	}
+	defer content.Close()
+
+	c.Header("Content-Type", attached.ContentType)
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": attached.Name}))
+	http.ServeContent(c.Writer, c.Request, attached.Name, attached.Time, content)
+}
+
+// deleteAttachmentHandler handler for DELETE method with id of task and attachment.
+func (ts *taskServer) deleteAttachmentHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Params.ByName("id"))
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+	attachmentId, err := strconv.Atoi(c.Params.ByName("attachment"))
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err = ts.files.Delete(ts.store, id, attachmentId); err != nil {
+		c.String(errorStatus(err), err.Error())
+	}
+}
+
+// commentsHandler handler for GET method with id, responds with page of comments of task: ?offset=<n>&limit=<n>.
+func (ts *taskServer) commentsHandler(c *gin.Context) {
+	type ResponseComments struct {
+		Total    int              `json:"total" xml:"total" yaml:"total"`
+		Comments []models.Comment `json:"comments" xml:"comments>comment" yaml:"comments"`
+	}
+
+	id, err := strconv.Atoi(c.Params.ByName("id"))
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	offset, limit, err := models.ParsePage(c.Query("offset"), c.Query("limit"))
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+	comments, total, err := ts.store.GetComments(id, offset, limit)
+	if err != nil {
+		c.String(errorStatus(err), err.Error())
+		return
+	}
+
+	render(c, http.StatusOK, ResponseComments{Total: total, Comments: comments})
+}
+
+// addCommentHandler handler for POST method with id, adds comment of actor of request to task: {"text":"<text>"}.
+func (ts *taskServer) addCommentHandler(c *gin.Context) {
+	type RequestComment struct {
+		Text string `json:"text" xml:"text" yaml:"text"`
+	}
+
+	id, err := strconv.Atoi(c.Params.ByName("id"))
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var rc RequestComment
+	if !decodeBody(c, &rc) {
+		return
+	}
+	if strings.TrimSpace(rc.Text) == "" {
+		c.String(http.StatusBadRequest, "expect text of comment")
+		return
+	}
+
+	comment, err := ts.store.AddComment(models.Comment{TaskId: id, Author: ts.principal, Text: rc.Text})
+	if err != nil {
+		c.String(errorStatus(err), err.Error())
+		return
+	}
+
+	render(c, http.StatusOK, comment)
+}
+
+// activityHandler handler for GET method with id, responds with page of activity log of task: ?offset=<n>&limit=<n>.
+func (ts *taskServer) activityHandler(c *gin.Context) {
+	type ResponseActivity struct {
+		Total    int               `json:"total" xml:"total" yaml:"total"`
+		Activity []models.Activity `json:"activity" xml:"activity>entry" yaml:"activity"`
+	}
+
+	id, err := strconv.Atoi(c.Params.ByName("id"))
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	offset, limit, err := models.ParsePage(c.Query("offset"), c.Query("limit"))
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+	entries, total, err := ts.store.GetActivity(id, offset, limit)
+	if err != nil {
+		c.String(errorStatus(err), err.Error())
+		return
+	}
+
+	render(c, http.StatusOK, ResponseActivity{Total: total, Activity: entries})
 }
 
-// deleteAllTasksHandler handler for DELETE method without id.
+// deleteAllTasksHandler handler for DELETE method without id, moves tasks selected by ?tag=<tag>&due=<date>
+// to trash, all tasks without filter, ?hard=true deletes them permanently. Request with ?dryRun=true responds
+// with tasks to be deleted and confirmation token, they are deleted by request with the same filter and
+// ?confirm=<token>.
 func (ts *taskServer) deleteAllTasksHandler(c *gin.Context) {
-	err := ts.store.DeleteAllTasks()
+	hard, ok := ts.parseHard(c)
+	if !ok {
+		return
+	}
+	filter := bulk.Filter{Tag: c.Query("tag"), Due: c.Query("due"), Hard: hard}
+	if filter.Tag != "" && c.Query("recursive") == "true" {
+		filter.Tag = models.TagTree(filter.Tag)
+	}
+	if ts.users.Enabled() {
+		filter.Owner = ts.principal
+	}
+
+	if c.Query("dryRun") == "true" {
+		preview, err := ts.guard.DryRun(ts.store, filter)
+		if err != nil {
+			c.String(errorStatus(err), err.Error())
+			return
+		}
+		render(c, http.StatusOK, preview)
+		return
+	}
+
+	result, err := ts.guard.Delete(ts.store, filter, c.Query("confirm"))
 	if err != nil {
-		c.String(http.StatusNotFound, err.Error())
+		c.String(errorStatus(err), err.Error())
+		return
 	}
+	render(c, http.StatusOK, result)
 }
 
 // createTaskHandler handler for POST method do create task.
 func (ts *taskServer) createTaskHandler(c *gin.Context) {
+	// Types used internally in this handler to (de-)serialize the request and response.
 	type RequestTask struct {
-		Text string    `json:"text"`
-		Tags []string  `json:"tags"`
-		Due  time.Time `json:"due"`
+		Text      string    `json:"text" xml:"text" yaml:"text"`
+		Tags      []string  `json:"tags" xml:"tags>tag" yaml:"tags"`
+		Due       time.Time `json:"due" xml:"due" yaml:"due"`
+		RRule     string    `json:"rrule" xml:"rrule" yaml:"rrule"`
+		ParentId  int       `json:"parentId" xml:"parentId" yaml:"parentId"`
+		ProjectId int       `json:"projectId" xml:"projectId" yaml:"projectId"`
+	}
+
+	type ResponseId struct {
+		Id int `json:"id" xml:"id" yaml:"id"`
 	}
 
 	var rt RequestTask
-	if err := c.ShouldBindJSON(&rt); err != nil {
+	if !decodeBody(c, &rt) {
+		return
+	}
+
+	if err := recurrence.Validate(rt.RRule, rt.Due); err != nil {
 		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+	if rt.ParentId != 0 {
+		if _, err := ts.store.GetTask(rt.ParentId); err != nil {
+			c.String(http.StatusBadRequest, "parent "+err.Error())
+			return
+		}
+	}
+
+	if rt.ProjectId != 0 {
+		if _, err := ts.store.GetProject(rt.ProjectId); err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
 	}
 
-	id := ts.store.CreateTask(rt.Text, rt.Tags, rt.Due)
-	c.JSON(http.StatusOK, gin.H{"Id": id})
+	id, err := ts.store.CreateTask(models.Task{Text: rt.Text, Tags: rt.Tags, Due: rt.Due, RRule: rt.RRule, ParentId: rt.ParentId, ProjectId: rt.ProjectId})
+	if err != nil {
+		c.String(errorStatus(err), err.Error())
+		return
+	}
+	render(c, http.StatusOK, ResponseId{Id: id})
 }
 
 // getTaskHandler handler for GET method with id.
@@ -67,10 +434,28 @@ func (ts *taskServer) getTaskHandler(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, task)
+	render(c, http.StatusOK, task)
 }
 
-// deleteTaskHandler handler for DELETE method with id.
+// parseHard parses query parameter "hard" and checks permission of actor of request for hard delete.
+// On error writes response and returns false.
+func (ts *taskServer) parseHard(c *gin.Context) (hard bool, ok bool) {
+	hard, err := trash.ParseHard(c.Query("hard"))
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return false, false
+	}
+	if hard {
+		if err = ts.trash.Permit(ts.principal, ts.users.Enabled()); err != nil {
+			c.String(errorStatus(err), err.Error())
+			return false, false
+		}
+	}
+	return hard, true
+}
+
+// deleteTaskHandler handler for DELETE method with id, moves task with its subtasks to trash, ?hard=true deletes
+// them permanently.
 func (ts *taskServer) deleteTaskHandler(c *gin.Context) {
 	id, err := strconv.Atoi(c.Params.ByName("id"))
 	if err != nil {
@@ -78,16 +463,426 @@ func (ts *taskServer) deleteTaskHandler(c *gin.Context) {
 		return
 	}
 
-	if err = ts.store.DeleteTask(id); err != nil {
-		c.String(http.StatusNotFound, err.Error())
+	hard, ok := ts.parseHard(c)
+	if !ok {
+		return
+	}
+
+	if hard {
+		err = ts.store.DeleteTask(id)
+	} else {
+		err = ts.store.TrashTask(id)
+	}
+	if err != nil {
+		c.String(errorStatus(err), err.Error())
+	}
+}
+
+// restoreTaskHandler handler for POST method with id, restores task with its subtasks from trash and responds with it.
+func (ts *taskServer) restoreTaskHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Params.ByName("id"))
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if _, err = ts.store.RestoreTask(id); err != nil {
+		c.String(errorStatus(err), err.Error())
+		return
+	}
+
+	ts.getTaskHandler(c)
+}
+
+// trashHandler handler for GET method, responds with all tasks in trash.
+func (ts *taskServer) trashHandler(c *gin.Context) {
+	render(c, http.StatusOK, ts.store.GetTrash())
+}
+
+// completeTaskHandler handler for POST method with id, completes task and responds with the next occurrence of recurring task.
+func (ts *taskServer) completeTaskHandler(c *gin.Context) {
+	type ResponseNext struct {
+		Next *models.Task `json:"next,omitempty" xml:"next,omitempty" yaml:"next,omitempty"`
+	}
+
+	id, err := strconv.Atoi(c.Params.ByName("id"))
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	next, ok, err := recurrence.Complete(ts.store, id)
+	if err != nil {
+		c.String(errorStatus(err), err.Error())
+		return
+	}
+
+	var rn ResponseNext
+	if ok {
+		rn.Next = &next
+	}
+	render(c, http.StatusOK, rn)
+}
+
+// childrenHandler handler for GET method with id, responds with subtasks of task.
+func (ts *taskServer) childrenHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Params.ByName("id"))
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	children, err := ts.store.GetChildren(id)
+	if err != nil {
+		c.String(errorStatus(err), err.Error())
+		return
+	}
+
+	render(c, http.StatusOK, children)
+}
+
+// addDependenciesHandler handler for POST method with id, makes task blocked by other tasks: {"blockedBy":[<id>,...]}.
+func (ts *taskServer) addDependenciesHandler(c *gin.Context) {
+	type RequestDependencies struct {
+		BlockedBy []int `json:"blockedBy" xml:"blockedBy>id" yaml:"blockedBy"`
+	}
+
+	id, err := strconv.Atoi(c.Params.ByName("id"))
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
 	}
+
+	var rd RequestDependencies
+	if !decodeBody(c, &rd) {
+		return
+	}
+
+	if err = ts.store.AddDependencies(id, rd.BlockedBy); err != nil {
+		c.String(errorStatus(err), err.Error())
+		return
+	}
+
+	ts.getTaskHandler(c)
+}
+
+// removeDependencyHandler handler for DELETE method with id and id of blocker, task isn't blocked by it anymore.
+func (ts *taskServer) removeDependencyHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Params.ByName("id"))
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+	blocker, err := strconv.Atoi(c.Params.ByName("blocker"))
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err = ts.store.RemoveDependency(id, blocker); err != nil {
+		c.String(errorStatus(err), err.Error())
+		return
+	}
+
+	ts.getTaskHandler(c)
+}
+
+// setParentHandler handler for PUT method with id, moves task under another parent: {"parentId":<id>}, 0 makes it top level.
+func (ts *taskServer) setParentHandler(c *gin.Context) {
+	type RequestParent struct {
+		ParentId int `json:"parentId" xml:"parentId" yaml:"parentId"`
+	}
+
+	id, err := strconv.Atoi(c.Params.ByName("id"))
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var rp RequestParent
+	if !decodeBody(c, &rp) {
+		return
+	}
+
+	task, err := ts.store.GetTask(id)
+	if err != nil {
+		c.String(errorStatus(err), err.Error())
+		return
+	}
+	task.ParentId = rp.ParentId
+	if err = ts.store.UpdateTask(task); err != nil {
+		c.String(errorStatus(err), err.Error())
+		return
+	}
+
+	ts.getTaskHandler(c)
 }
 
-// tagHandler handler for "tag" path.
+// shareTaskHandler handler for PUT method with id, replaces users whom task is shared with and responds with task:
+// {"shares":[{"user":"<user>","access":"read|write"}]}.
+func (ts *taskServer) shareTaskHandler(c *gin.Context) {
+	type RequestShares struct {
+		Shares []models.Share `json:"shares" xml:"shares>share" yaml:"shares"`
+	}
+
+	id, err := strconv.Atoi(c.Params.ByName("id"))
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var rs RequestShares
+	if !decodeBody(c, &rs) {
+		return
+	}
+	if err = models.ValidateShares(rs.Shares); err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err = ts.store.ShareTask(id, rs.Shares); err != nil {
+		c.String(errorStatus(err), err.Error())
+		return
+	}
+
+	ts.getTaskHandler(c)
+}
+
+// tagParam returns hierarchical tag of catch-all "tag" parameter, like "work/backend/api".
+func tagParam(c *gin.Context) string {
+	return strings.Trim(c.Params.ByName("tag"), "/")
+}
+
+// tagHandler handler for "tag" path, plain "/tag/" lists all tags.
 func (ts *taskServer) tagHandler(c *gin.Context) {
-	tag := c.Params.ByName("tag")
+	tag := tagParam(c)
+	if tag == "" {
+		ts.getAllTagsHandler(c)
+		return
+	}
+	if c.Query("recursive") == "true" {
+		tag = models.TagTree(tag)
+	}
 	tasks := ts.store.GetTasksByTag(tag)
-	c.JSON(http.StatusOK, tasks)
+	render(c, http.StatusOK, tasks)
+}
+
+// ResponseUpdated it's a response with ids of tasks changed by tag operation.
+type ResponseUpdated struct {
+	Updated []int `json:"updated" xml:"updated>id" yaml:"updated"`
+}
+
+// errorStatus returns HTTP status code of error of repository operation.
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, models.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, models.ErrConflict), errors.Is(err, models.ErrHasSubtasks), errors.Is(err, models.ErrCycle),
+		errors.Is(err, models.ErrBlocked):
+		return http.StatusConflict
+	case errors.Is(err, trash.ErrForbidden), errors.Is(err, bulk.ErrDisabled), errors.Is(err, ownership.ErrForbidden),
+		errors.Is(err, tenant.ErrQuota):
+		return http.StatusForbidden
+	case errors.Is(err, bulk.ErrBadFilter):
+		return http.StatusBadRequest
+	case errors.Is(err, bulk.ErrNoToken):
+		return http.StatusPreconditionRequired
+	case errors.Is(err, bulk.ErrInvalidToken):
+		return http.StatusPreconditionFailed
+	case errors.Is(err, attachment.ErrTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, attachment.ErrUnsupportedType):
+		return http.StatusUnsupportedMediaType
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// renderUpdated renders ids of changed tasks or writes error of tag operation.
+func renderUpdated(c *gin.Context, ids []int, err error) {
+	if err != nil {
+		c.String(errorStatus(err), err.Error())
+		return
+	}
+	if ids == nil {
+		ids = []int{}
+	}
+	render(c, http.StatusOK, ResponseUpdated{Updated: ids})
+}
+
+// getAllTagsHandler handler for GET method without tag, lists all tags with counts of tasks.
+func (ts *taskServer) getAllTagsHandler(c *gin.Context) {
+	tags := ts.store.GetAllTags()
+	render(c, http.StatusOK, tags)
+}
+
+// renameTagHandler handler for PUT method with tag, renames tag in all tasks: {"name":"<new tag>"}.
+func (ts *taskServer) renameTagHandler(c *gin.Context) {
+	type RequestRename struct {
+		Name string `json:"name" xml:"name" yaml:"name"`
+	}
+
+	var rr RequestRename
+	if !decodeBody(c, &rr) {
+		return
+	}
+	if rr.Name == "" {
+		c.String(http.StatusBadRequest, "expect new name of tag")
+		return
+	}
+
+	ids, err := ts.store.RenameTag(tagParam(c), rr.Name)
+	renderUpdated(c, ids, err)
+}
+
+// deleteTagHandler handler for DELETE method with tag, strips tag from all tasks.
+func (ts *taskServer) deleteTagHandler(c *gin.Context) {
+	ids, err := ts.store.DeleteTag(tagParam(c))
+	renderUpdated(c, ids, err)
+}
+
+// mergeTagsHandler handler for POST method at "tag/merge", replaces tags by one tag: {"tags":["a","b"],"into":"c"}.
+func (ts *taskServer) mergeTagsHandler(c *gin.Context) {
+	type RequestMerge struct {
+		Tags []string `json:"tags" xml:"tags>tag" yaml:"tags"`
+		Into string   `json:"into" xml:"into" yaml:"into"`
+	}
+
+	var rm RequestMerge
+	if !decodeBody(c, &rm) {
+		return
+	}
+	if len(rm.Tags) == 0 || rm.Into == "" {
+		c.String(http.StatusBadRequest, "expect tags to merge and target tag 'into'")
+		return
+	}
+
+	ids, err := ts.store.MergeTags(rm.Tags, rm.Into)
+	renderUpdated(c, ids, err)
+}
+
+// RequestProject it's a request to create or to update project.
+type RequestProject struct {
+	Name     string `json:"name" xml:"name" yaml:"name"`
+	Archived bool   `json:"archived" xml:"archived" yaml:"archived"`
+}
+
+// createProjectHandler handler for POST method do create project: {"name":"<name>"}.
+func (ts *taskServer) createProjectHandler(c *gin.Context) {
+	type ResponseId struct {
+		Id int `json:"id" xml:"id" yaml:"id"`
+	}
+
+	var rp RequestProject
+	if !decodeBody(c, &rp) {
+		return
+	}
+	if rp.Name == "" {
+		c.String(http.StatusBadRequest, "expect name of project")
+		return
+	}
+
+	id := ts.store.CreateProject(models.Project{Name: rp.Name, Archived: rp.Archived})
+	render(c, http.StatusOK, ResponseId{Id: id})
+}
+
+// getAllProjectsHandler handler for GET method without id, lists all projects.
+func (ts *taskServer) getAllProjectsHandler(c *gin.Context) {
+	projects := ts.store.GetAllProjects()
+	render(c, http.StatusOK, projects)
+}
+
+// getProjectHandler handler for GET method with id.
+func (ts *taskServer) getProjectHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Params.ByName("id"))
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	project, err := ts.store.GetProject(id)
+	if err != nil {
+		c.String(errorStatus(err), err.Error())
+		return
+	}
+
+	render(c, http.StatusOK, project)
+}
+
+// updateProjectHandler handler for PUT method with id, renames and archives project: {"name":"<name>","archived":true}.
+func (ts *taskServer) updateProjectHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Params.ByName("id"))
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var rp RequestProject
+	if !decodeBody(c, &rp) {
+		return
+	}
+	if rp.Name == "" {
+		c.String(http.StatusBadRequest, "expect name of project")
+		return
+	}
+
+	if err = ts.store.UpdateProject(models.Project{Id: id, Name: rp.Name, Archived: rp.Archived}); err != nil {
+		c.String(errorStatus(err), err.Error())
+		return
+	}
+
+	ts.getProjectHandler(c)
+}
+
+// deleteProjectHandler handler for DELETE method with id, tasks of project stay without project.
+func (ts *taskServer) deleteProjectHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Params.ByName("id"))
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ids, err := ts.store.DeleteProject(id)
+	renderUpdated(c, ids, err)
+}
+
+// projectTasksHandler handler for GET method with id of project, lists tasks of project, also of archived one.
+// Tasks are filtered by tag pattern with ?tag=<tag>[&recursive=true] or by due date with ?due=<yyyy-mm-dd>.
+func (ts *taskServer) projectTasksHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Params.ByName("id"))
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	tag, due := c.Query("tag"), c.Query("due")
+
+	var tasks []models.Task
+	switch {
+	case tag != "" && due != "":
+		c.String(http.StatusBadRequest, "expect only one of 'tag' and 'due'")
+		return
+	case tag != "":
+		if c.Query("recursive") == "true" {
+			tag = models.TagTree(tag)
+		}
+		tasks, err = ts.store.GetProjectTasksByTag(id, tag)
+	case due != "":
+		date, parseErr := time.Parse(models.DateLayout, due)
+		if parseErr != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("bad 'due': %s", parseErr))
+			return
+		}
+		tasks, err = ts.store.GetProjectTasksByDueDate(id, date.Year(), date.Month(), date.Day())
+	default:
+		tasks, err = ts.store.GetProjectTasks(id)
+	}
+	if err != nil {
+		c.String(errorStatus(err), err.Error())
+		return
+	}
+
+	render(c, http.StatusOK, tasks)
 }
 
 // dueHandler handler for "due" path.
@@ -97,7 +892,7 @@ func (ts *taskServer) dueHandler(c *gin.Context) {
 	}
 
 	year, err := strconv.Atoi(c.Params.ByName("year"))
-	if err != nil {
+	if err != nil || year < models.MinYear || year > models.MaxYear {
 		badRequestError()
 		return
 	}
@@ -115,31 +910,222 @@ func (ts *taskServer) dueHandler(c *gin.Context) {
 	}
 
 	tasks := ts.store.GetTasksByDueDate(year, time.Month(month), day)
-	c.JSON(http.StatusOK, tasks)
+	render(c, http.StatusOK, tasks)
+}
+
+// dueRangeHandler handler for "due" path with range of due dates in RFC 3339 format: /due/?from=<time>&to=<time>.
+func (ts *taskServer) dueRangeHandler(c *gin.Context) {
+	from, err := time.Parse(time.RFC3339, c.Query("from"))
+	if err != nil {
+		c.String(http.StatusBadRequest, "bad 'from': %s", err)
+		return
+	}
+	to, err := time.Parse(time.RFC3339, c.Query("to"))
+	if err != nil {
+		c.String(http.StatusBadRequest, "bad 'to': %s", err)
+		return
+	}
+	if to.Before(from) {
+		c.String(http.StatusBadRequest, "'to' must not be before 'from'")
+		return
+	}
+
+	tasks := ts.store.GetTasksByDueRange(from, to)
+	render(c, http.StatusOK, tasks)
+}
+
+// searchHandler handler for "search" path, full-text search over text and tags of tasks: /search?q=<words>.
+func (ts *taskServer) searchHandler(c *gin.Context) {
+	query := c.Query("q")
+	if strings.TrimSpace(query) == "" {
+		c.String(http.StatusBadRequest, "expect search query 'q'")
+		return
+	}
+
+	tasks := ts.store.SearchTasks(query)
+	render(c, http.StatusOK, tasks)
+}
+
+// exportHandler handler for "export" path, streams all tasks in format from query parameter.
+func (ts *taskServer) exportHandler(c *gin.Context) {
+	format, err := transfer.ParseFormat(c.Query("format"))
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	c.Header("Content-Type", format.ContentType())
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", format.FileName()))
+	c.Status(http.StatusOK)
+	if err = transfer.Export(c.Writer, ts.store, format); err != nil {
+		log.Printf("error on export tasks: %s", err)
+	}
+}
+
+// importHandler handler for "import" path, loads tasks from request body.
+func (ts *taskServer) importHandler(c *gin.Context) {
+	format, opts, err := transfer.ParseImportParams(c.Query("format"), c.GetHeader("Content-Type"), c.Query("preserveIds"), c.Query("onConflict"))
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	tasks, err := transfer.Decode(c.Request.Body, format)
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+	if err = ts.tenant.Admit(len(tasks)); err != nil {
+		c.String(errorStatus(err), err.Error())
+		return
+	}
+
+	result, err := transfer.Load(ts.store, tasks, opts)
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	render(c, http.StatusOK, result)
+}
+
+// getCalendarHandler handler for GET method, renders tasks with due date (optionally filtered by tag) as iCalendar feed.
+func (ts *taskServer) getCalendarHandler(c *gin.Context) {
+	component, err := ical.ParseComponent(c.Query("component"))
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var tasks []models.Task
+	if tag := c.Query("tag"); tag != "" {
+		tasks = ts.store.GetTasksByTag(tag)
+	} else {
+		tasks = ts.store.GetAllTasks()
+	}
+
+	c.Header("Content-Type", ical.ContentType)
+	c.Status(http.StatusOK)
+	if err = ical.Encode(c.Writer, tasks, ical.Options{Component: component, Name: "Tasks"}); err != nil {
+		log.Printf("error on render calendar: %s", err)
+	}
+}
+
+// importCalendarHandler handler for POST method, creates tasks from .ics file in request body.
+func (ts *taskServer) importCalendarHandler(c *gin.Context) {
+	tasks, err := ical.Decode(c.Request.Body)
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err = ts.tenant.Admit(len(tasks)); err != nil {
+		c.String(errorStatus(err), err.Error())
+		return
+	}
+
+	result, err := transfer.Load(ts.store, tasks, transfer.ImportOptions{})
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	render(c, http.StatusOK, result)
 }
 
 // Init function do initialize a new server with parameters from config.yaml.
 func Init(cfg *config.Config) {
 	router := gin.Default()
 	var server *taskServer
+	policy, err := models.ParseSubtaskPolicy(cfg.Subtasks.Policy)
+	if err != nil {
+		cfg.ErrorLogger.Fatalf("Error on parse subtasks policy: %s\n", err)
+	}
+
+	files, err := attachment.NewFromConfig(cfg)
+	if err != nil {
+		cfg.ErrorLogger.Fatalf("Error on create store of attachments: %s\n", err)
+	}
+
+	bin := trash.New(cfg)
+	guard := bulk.New(cfg)
+	users, err := auth.New(cfg)
+	if err != nil {
+		cfg.ErrorLogger.Fatalf("Error on create authentication: %s\n", err)
+	}
+	tenants, err := tenant.New(cfg)
+	if err != nil {
+		cfg.ErrorLogger.Fatalf("Error on parse tenants resolution: %s\n", err)
+	}
 
 	switch cfg.Server.TypeOfRepository {
 	case "in-memory":
-		server = NewTaskServerInmemory()
+		server, err = NewTaskServerInmemory(policy, files, bin, guard, users, tenants)
+		if err != nil {
+			cfg.ErrorLogger.Fatalf("Error on start tenant: %s\n", err)
+		}
 	default:
 		cfg.ErrorLogger.Fatal("Unknown repository type.")
 	}
 
-	router.POST("/task/", server.createTaskHandler)
-	router.GET("/task/", server.getAllTasksHandler)
-	router.DELETE("/task/", server.deleteAllTasksHandler)
-	router.GET("/task/:id", server.getTaskHandler)
-	router.DELETE("/task/:id", server.deleteTaskHandler)
-	router.GET("/tag/:tag", server.tagHandler)
-	router.GET("/due/:year/:month/:day", server.dueHandler)
+	go bin.RunAll(tenants.Stores)
+
+	// JWT bearer tokens are verified for all routes except admin and login ones
+	api := router.Group("/", middleware.JWTGin(users.Verifier(), users.Local))
+	api.POST("/task/", server.withActor((*taskServer).createTaskHandler))
+	api.GET("/task/", server.withActor((*taskServer).getAllTasksHandler))
+	api.DELETE("/task/", server.withActor((*taskServer).deleteAllTasksHandler))
+	api.GET("/task/:id", server.withActor((*taskServer).getTaskHandler))
+	api.DELETE("/task/:id", server.withActor((*taskServer).deleteTaskHandler))
+	api.POST("/task/:id/complete", server.withActor((*taskServer).completeTaskHandler))
+	api.POST("/task/:id/restore", server.withActor((*taskServer).restoreTaskHandler))
+	api.GET("/task/:id/children", server.withActor((*taskServer).childrenHandler))
+	api.PUT("/task/:id/parent", server.withActor((*taskServer).setParentHandler))
+	api.PUT("/task/:id/shares", server.withActor((*taskServer).shareTaskHandler))
+	api.POST("/task/:id/dependencies", server.withActor((*taskServer).addDependenciesHandler))
+	api.DELETE("/task/:id/dependencies/:blocker", server.withActor((*taskServer).removeDependencyHandler))
+	api.PUT("/task/:id/project", server.withActor((*taskServer).setProjectHandler))
+	api.GET("/task/:id/comments", server.withActor((*taskServer).commentsHandler))
+	api.POST("/task/:id/comments", server.withActor((*taskServer).addCommentHandler))
+	api.GET("/task/:id/activity", server.withActor((*taskServer).activityHandler))
+	api.GET("/task/:id/attachments", server.withActor((*taskServer).attachmentsHandler))
+	api.POST("/task/:id/attachments", server.withActor((*taskServer).uploadAttachmentHandler))
+	api.GET("/task/:id/attachments/:attachment", server.withActor((*taskServer).getAttachmentHandler))
+	api.DELETE("/task/:id/attachments/:attachment", server.withActor((*taskServer).deleteAttachmentHandler))
+	api.POST("/project/", server.withActor((*taskServer).createProjectHandler))
+	api.GET("/project/", server.withActor((*taskServer).getAllProjectsHandler))
+	api.GET("/project/:id", server.withActor((*taskServer).getProjectHandler))
+	api.PUT("/project/:id", server.withActor((*taskServer).updateProjectHandler))
+	api.DELETE("/project/:id", server.withActor((*taskServer).deleteProjectHandler))
+	api.GET("/project/:id/task/", server.withActor((*taskServer).projectTasksHandler))
+	api.POST("/tag/merge", server.withActor((*taskServer).mergeTagsHandler))
+	api.GET("/tag/*tag", server.withActor((*taskServer).tagHandler))
+	api.PUT("/tag/*tag", server.withActor((*taskServer).renameTagHandler))
+	api.DELETE("/tag/*tag", server.withActor((*taskServer).deleteTagHandler))
+	api.GET("/due/", server.withActor((*taskServer).dueRangeHandler))
+	api.GET("/trash", server.withActor((*taskServer).trashHandler))
+	api.GET("/search", server.withActor((*taskServer).searchHandler))
+	api.GET("/due/:year/:month/:day", server.withActor((*taskServer).dueHandler))
+	api.GET("/export", server.withActor((*taskServer).exportHandler))
+	api.POST("/import", server.withActor((*taskServer).importHandler))
+	api.GET("/calendar.ics", server.withActor((*taskServer).getCalendarHandler))
+	api.POST("/calendar.ics", server.withActor((*taskServer).importCalendarHandler))
+	graphqlHandler := tenants.PerTenant(func(t *tenant.Tenant) (http.Handler, error) { return gql.NewHandler(t.Store(), users) })
+	webhookHandler := tenants.PerTenant(func(t *tenant.Tenant) (http.Handler, error) { return webhook.Handler(t.Hooks(), users), nil })
+	api.GET("/graphql", gin.WrapH(graphqlHandler))
+	api.POST("/graphql", gin.WrapH(graphqlHandler))
+	api.GET("/events", gin.WrapH(tenants.PerTenant(func(t *tenant.Tenant) (http.Handler, error) { return events.SSEHandler(t.Bus(), users), nil })))
+	api.GET("/ws", gin.WrapH(tenants.PerTenant(func(t *tenant.Tenant) (http.Handler, error) { return ws.Handler(t.Store(), t.Bus(), users), nil })))
+	api.Any("/webhooks", gin.WrapH(webhookHandler))
+	api.Any("/webhooks/*path", gin.WrapH(webhookHandler))
+	router.Any("/admin/tenants", gin.WrapH(tenant.Handler(tenants)))
+	router.Any("/admin/tenants/*path", gin.WrapH(tenant.Handler(tenants)))
+	router.Any("/auth/*path", gin.WrapH(oidc.Handler(users.Providers(), session.Handler(users.Sessions()))))
+
+	grpcApi.Start(cfg, tenants, users)
 
 	cfg.ErrorLogger.Printf("Start server %s with storage %s on: %s\n", cfg.Server.TypeOfServer, cfg.Server.TypeOfRepository, cfg.Server.ServerAddress+":"+strconv.Itoa(cfg.Server.ServerPort))
-	err := router.Run(cfg.Server.ServerAddress + ":" + strconv.Itoa(cfg.Server.ServerPort))
+	err = http.ListenAndServe(cfg.Server.ServerAddress+":"+strconv.Itoa(cfg.Server.ServerPort), tenants.Handler(router))
 	if err != nil {
 		cfg.ErrorLogger.Fatalf("Error on start server: %s\n", err)
 	}
@@ -0,0 +1,313 @@
+// Package grpc_api it's a gRPC server for tasks, it shares repository with REST server.
+// Server is started on its own port or multiplexed with the stdlib server on one port.
+// Calls are authenticated by bearer token in "authorization" metadata and see only tasks of principal, tenant
+// of call is named by "x-tenant" metadata.
+package grpc_api
+
+import (
+	"context"
+	"errors"
+	"github.com/White-AK111/REST/api/taskspb"
+	"github.com/White-AK111/REST/config"
+	"github.com/White-AK111/REST/internal/activity"
+	"github.com/White-AK111/REST/internal/auth"
+	"github.com/White-AK111/REST/internal/events"
+	"github.com/White-AK111/REST/internal/models"
+	"github.com/White-AK111/REST/internal/ownership"
+	"github.com/White-AK111/REST/internal/recurrence"
+	"github.com/White-AK111/REST/internal/tenant"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// watchBuffer count of events buffered for each WatchTasks stream.
+const watchBuffer = 64
+
+// taskServer struct for gRPC server of tasks.
+type taskServer struct {
+	taskspb.UnimplementedTasksServer
+	tenants *tenant.Tenants
+	users   *auth.Users
+}
+
+// NewServer function initialize a new gRPC server with Tasks service and reflection, calls are authenticated
+// by users and served by tenants.
+func NewServer(tenants *tenant.Tenants, users *auth.Users) *grpc.Server {
+	s := grpc.NewServer(
+		grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			ctx, err := authenticate(ctx, tenants, users)
+			if err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			ctx, err := authenticate(stream.Context(), tenants, users)
+			if err != nil {
+				return err
+			}
+			return handler(srv, &principalStream{ServerStream: stream, ctx: ctx})
+		}),
+	)
+	taskspb.RegisterTasksServer(s, &taskServer{tenants: tenants, users: users})
+	reflection.Register(s)
+	return s
+}
+
+// tenantKey it's a key of tenant of call in context.
+type tenantKey struct{}
+
+// authenticate returns context with principal of call by "authorization" and "x-actor" metadata and with tenant
+// of call by "x-tenant" metadata.
+func authenticate(ctx context.Context, tenants *tenant.Tenants, users *auth.Users) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	first := func(key string) string {
+		if values := md.Get(key); len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+	principal, err := users.Authenticate(first(auth.Header), first(activity.Header), nil)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	t, err := tenants.Tenant(strings.ToLower(first(tenant.Header)))
+	if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	return context.WithValue(activity.WithActor(ctx, principal), tenantKey{}, t), nil
+}
+
+// principalStream it's a server stream with principal of call in context.
+type principalStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context returns context of stream with principal.
+func (s *principalStream) Context() context.Context {
+	return s.ctx
+}
+
+// tenant returns tenant of call.
+func (ts *taskServer) tenant(ctx context.Context) *tenant.Tenant {
+	return ctx.Value(tenantKey{}).(*tenant.Tenant)
+}
+
+// repo returns repository of principal of call in tenant of call.
+func (ts *taskServer) repo(ctx context.Context) models.Repository {
+	return ts.users.Repository(ts.tenant(ctx).Store(), activity.ActorFrom(ctx))
+}
+
+// toProto converts task to protobuf message.
+func toProto(task models.Task) *taskspb.Task {
+	t := &taskspb.Task{
+		Id:        int64(task.Id),
+		Text:      task.Text,
+		Tags:      task.Tags,
+		Rrule:     task.RRule,
+		Virtual:   task.Virtual,
+		ParentId:  int64(task.ParentId),
+		Done:      task.Done,
+		Blocked:   task.Blocked,
+		ProjectId: int64(task.ProjectId),
+		Owner:     task.Owner,
+	}
+	for _, share := range task.Shares {
+		t.Shares = append(t.Shares, &taskspb.Share{User: share.User, Access: string(share.Access)})
+	}
+	for _, blocker := range task.BlockedBy {
+		t.BlockedBy = append(t.BlockedBy, int64(blocker))
+	}
+	if !task.Due.IsZero() {
+		t.Due = timestamppb.New(task.Due)
+	}
+	if task.Progress != nil {
+		t.Progress = &taskspb.Progress{Done: int32(task.Progress.Done), Total: int32(task.Progress.Total)}
+	}
+	return t
+}
+
+// eventTypes maps event types to protobuf enum.
+var eventTypes = map[events.Type]taskspb.TaskEvent_Type{
+	events.Created: taskspb.TaskEvent_TYPE_CREATED,
+	events.Updated: taskspb.TaskEvent_TYPE_UPDATED,
+	events.Deleted: taskspb.TaskEvent_TYPE_DELETED,
+	events.Cleared: taskspb.TaskEvent_TYPE_CLEARED,
+}
+
+// CreateTask creates a new task.
+func (ts *taskServer) CreateTask(ctx context.Context, req *taskspb.CreateTaskRequest) (*taskspb.CreateTaskResponse, error) {
+	var due time.Time
+	if req.Due != nil {
+		if err := req.Due.CheckValid(); err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		due = req.Due.AsTime()
+	}
+	repo := ts.repo(ctx)
+	if err := recurrence.Validate(req.Rrule, due); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if req.ParentId != 0 {
+		if _, err := repo.GetTask(int(req.ParentId)); err != nil {
+			return nil, status.Error(codes.InvalidArgument, "parent "+err.Error())
+		}
+	}
+	if req.ProjectId != 0 {
+		if _, err := repo.GetProject(int(req.ProjectId)); err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+
+	id, err := repo.CreateTask(models.Task{Text: req.Text, Tags: req.Tags, Due: due, RRule: req.Rrule, ParentId: int(req.ParentId), ProjectId: int(req.ProjectId)})
+	if err != nil {
+		if errors.Is(err, tenant.ErrQuota) {
+			return nil, status.Error(codes.ResourceExhausted, err.Error())
+		}
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &taskspb.CreateTaskResponse{Id: int64(id)}, nil
+}
+
+// GetTask returns a task by id.
+func (ts *taskServer) GetTask(ctx context.Context, req *taskspb.GetTaskRequest) (*taskspb.Task, error) {
+	task, err := ts.repo(ctx).GetTask(int(req.Id))
+	if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	return toProto(task), nil
+}
+
+// DeleteTask moves a task by id to trash.
+func (ts *taskServer) DeleteTask(ctx context.Context, req *taskspb.DeleteTaskRequest) (*emptypb.Empty, error) {
+	if err := ts.repo(ctx).TrashTask(int(req.Id)); err != nil {
+		if errors.Is(err, models.ErrHasSubtasks) {
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		}
+		if errors.Is(err, ownership.ErrForbidden) {
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	return &emptypb.Empty{}, nil
+}
+
+// DeleteAllTasks moves all tasks of caller to trash.
+func (ts *taskServer) DeleteAllTasks(ctx context.Context, req *emptypb.Empty) (*emptypb.Empty, error) {
+	if err := ts.repo(ctx).TrashAllTasks(); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &emptypb.Empty{}, nil
+}
+
+// ListTasks streams tasks sorted by id, filtered by tag or due date if filter is set.
+func (ts *taskServer) ListTasks(req *taskspb.ListTasksRequest, stream taskspb.Tasks_ListTasksServer) error {
+	repo := ts.repo(stream.Context())
+	var tasks []models.Task
+	switch filter := req.Filter.(type) {
+	case *taskspb.ListTasksRequest_Tag:
+		tasks = repo.GetTasksByTag(filter.Tag)
+	case *taskspb.ListTasksRequest_Due:
+		month := time.Month(filter.Due.GetMonth())
+		if month < time.January || month > time.December {
+			return status.Errorf(codes.InvalidArgument, "month must be in 1..12, got %d", month)
+		}
+		tasks = repo.GetTasksByDueDate(int(filter.Due.GetYear()), month, int(filter.Due.GetDay()))
+	case *taskspb.ListTasksRequest_ParentId:
+		var err error
+		if tasks, err = repo.GetChildren(int(filter.ParentId)); err != nil {
+			return status.Error(codes.NotFound, err.Error())
+		}
+	default:
+		tasks = repo.GetAllTasks()
+	}
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].Id < tasks[j].Id })
+
+	for _, task := range tasks {
+		if err := stream.Send(toProto(task)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WatchTasks streams changes of tasks until client cancels the call.
+func (ts *taskServer) WatchTasks(req *taskspb.WatchTasksRequest, stream taskspb.Tasks_WatchTasksServer) error {
+	sub := ts.tenant(stream.Context()).Bus().Subscribe(watchBuffer)
+	defer sub.Close()
+	visible := ts.users.Visible(activity.ActorFrom(stream.Context()))
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case e, ok := <-sub.C:
+			if !ok {
+				return status.Error(codes.ResourceExhausted, "client is too slow to receive events")
+			}
+			if visible != nil && !visible(e.Task) {
+				continue
+			}
+			err := stream.Send(&taskspb.TaskEvent{
+				Seq:  e.Seq,
+				Type: eventTypes[e.Type],
+				Task: toProto(e.Task),
+				Time: timestamppb.New(e.Time),
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Multiplex returns handler which passes gRPC requests (HTTP/2 with application/grpc Content-Type) to gRPC
+// server and others to next handler. HTTP/2 without TLS (h2c) is accepted for gRPC clients.
+func Multiplex(grpcServer *grpc.Server, next http.Handler) http.Handler {
+	return h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.ProtoMajor == 2 && strings.HasPrefix(req.Header.Get("Content-Type"), "application/grpc") {
+			grpcServer.ServeHTTP(w, req)
+			return
+		}
+		next.ServeHTTP(w, req)
+	}), &http2.Server{})
+}
+
+// Start function starts gRPC server on its own port in background if it's enabled in config, users authenticate
+// requests, tenants serve them.
+func Start(cfg *config.Config, tenants *tenant.Tenants, users *auth.Users) {
+	if !cfg.GRPC.Enabled {
+		return
+	}
+	if cfg.GRPC.Multiplex {
+		cfg.ErrorLogger.Printf("gRPC multiplexing is supported only by stdlib server, serve gRPC on own port\n")
+	}
+
+	address := cfg.Server.ServerAddress + ":" + strconv.Itoa(cfg.GRPC.Port)
+	lis, err := net.Listen("tcp", address)
+	if err != nil {
+		cfg.ErrorLogger.Fatalf("Error on start gRPC server: %s\n", err)
+	}
+
+	cfg.ErrorLogger.Printf("Start gRPC server on: %s\n", address)
+	go func() {
+		if err := NewServer(tenants, users).Serve(lis); err != nil {
+			cfg.ErrorLogger.Fatalf("Error on serve gRPC: %s\n", err)
+		}
+	}()
+}
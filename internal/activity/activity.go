@@ -0,0 +1,352 @@
+// Package activity provides activity log of tasks. Track decorates models.Repository and records every change
+// of tasks made through it into the log of repository: who created, updated or deleted task, when, and which
+// fields were changed with old and new values.
+package activity
+
+import (
+	"context"
+	"github.com/White-AK111/REST/internal/models"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Actions of activity log entries, task moved to trash is logged as deleted with changed deletedAt.
+const (
+	Created  = "created"
+	Updated  = "updated"
+	Deleted  = "deleted"
+	Restored = "restored"
+)
+
+// Actors of changes made without known user.
+const (
+	System    = "system"    // changes made by server itself, like rolling of recurring tasks by scheduler
+	Anonymous = "anonymous" // changes made by request without actor
+)
+
+// Header it's a header of request with name of actor who makes changes.
+const Header = "X-Actor"
+
+// Actor function returns actor by value of Header, Anonymous for empty value.
+func Actor(header string) string {
+	if actor := strings.TrimSpace(header); actor != "" {
+		return actor
+	}
+	return Anonymous
+}
+
+// actorKey it's a key of actor in context.
+type actorKey struct{}
+
+// WithActor function returns context with actor, for handlers which get repository before request.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFrom function returns actor from context, Anonymous if context has no actor.
+func ActorFrom(ctx context.Context) string {
+	if actor, ok := ctx.Value(actorKey{}).(string); ok {
+		return actor
+	}
+	return Anonymous
+}
+
+// trackedRepository decorates models.Repository and records changes of tasks made by actor.
+type trackedRepository struct {
+	models.Repository
+	actor string
+}
+
+// Track function returns repository which records changes of tasks made by actor. If repo records changes
+// itself, the returned one records changes of the same repository made by another actor.
+func Track(repo models.Repository, actor string) models.Repository {
+	if tracked, ok := repo.(*trackedRepository); ok {
+		repo = tracked.Repository
+	}
+	return &trackedRepository{Repository: repo, actor: actor}
+}
+
+// fieldNames names of tracked fields of task in order of changes of log entry.
+var fieldNames = []string{"text", "tags", "due", "rrule", "parentId", "done", "projectId", "blockedBy", "deletedAt"}
+
+// formatId returns id as text, empty for zero id.
+func formatId(id int) string {
+	if id == 0 {
+		return ""
+	}
+	return strconv.Itoa(id)
+}
+
+// fields returns values of tracked fields of task formatted as text.
+func fields(task models.Task) map[string]string {
+	due := ""
+	if !task.Due.IsZero() {
+		due = task.Due.Format(time.RFC3339)
+	}
+	deletedAt := ""
+	if task.DeletedAt != nil {
+		deletedAt = task.DeletedAt.Format(time.RFC3339)
+	}
+	blockers := make([]string, len(task.BlockedBy))
+	for i, blocker := range task.BlockedBy {
+		blockers[i] = strconv.Itoa(blocker)
+	}
+	return map[string]string{
+		"text":      task.Text,
+		"tags":      strings.Join(task.Tags, ","),
+		"due":       due,
+		"rrule":     task.RRule,
+		"parentId":  formatId(task.ParentId),
+		"done":      strconv.FormatBool(task.Done),
+		"projectId": formatId(task.ProjectId),
+		"blockedBy": strings.Join(blockers, ","),
+		"deletedAt": deletedAt,
+	}
+}
+
+// diff returns changes of tracked fields between old and new state of task, zero task means missing task.
+func diff(old, new models.Task) []models.Change {
+	oldFields, newFields := fields(old), fields(new)
+	var changes []models.Change
+	for _, field := range fieldNames {
+		if oldFields[field] != newFields[field] {
+			changes = append(changes, models.Change{Field: field, Old: oldFields[field], New: newFields[field]})
+		}
+	}
+	return changes
+}
+
+// record adds entry of change of task to activity log, update which doesn't change tracked fields isn't logged.
+func (r *trackedRepository) record(action string, id int, old, new models.Task) {
+	changes := diff(old, new)
+	if action == Updated && len(changes) == 0 {
+		return
+	}
+	_ = r.Repository.AddActivity(models.Activity{TaskId: id, Actor: r.actor, Action: action, Changes: changes})
+}
+
+// recordChanges logs changes of tasks from their states before change, deleted tasks are logged as deleted.
+func (r *trackedRepository) recordChanges(before []models.Task) {
+	for _, old := range before {
+		if task, err := r.Repository.GetTask(old.Id); err == nil {
+			r.record(Updated, old.Id, old, task)
+		} else {
+			r.record(Deleted, old.Id, old, models.Task{})
+		}
+	}
+}
+
+// trash returns tasks in trash by id.
+func (r *trackedRepository) trash() map[int]models.Task {
+	trash := make(map[int]models.Task)
+	for _, task := range r.Repository.GetTrash() {
+		trash[task.Id] = task
+	}
+	return trash
+}
+
+// recordTrashed logs tasks moved to trash from their states before deletion as deleted.
+func (r *trackedRepository) recordTrashed(before []models.Task) {
+	trash := r.trash()
+	for _, old := range before {
+		if task, ok := trash[old.Id]; ok {
+			r.record(Deleted, old.Id, old, task)
+		}
+	}
+}
+
+// subtree returns task with the given id and all its subtasks.
+func (r *trackedRepository) subtree(id int) []models.Task {
+	task, err := r.Repository.GetTask(id)
+	if err != nil {
+		return nil
+	}
+	tasks := []models.Task{task}
+	children, _ := r.Repository.GetChildren(id)
+	for _, child := range children {
+		tasks = append(tasks, r.subtree(child.Id)...)
+	}
+	return tasks
+}
+
+// task returns task with the given id, if it exists.
+func (r *trackedRepository) task(id int) []models.Task {
+	if task, err := r.Repository.GetTask(id); err == nil {
+		return []models.Task{task}
+	}
+	return nil
+}
+
+// changed returns tasks with ids from tasks.
+func changed(tasks []models.Task, ids []int) []models.Task {
+	byId := make(map[int]models.Task, len(tasks))
+	for _, task := range tasks {
+		byId[task.Id] = task
+	}
+	var result []models.Task
+	for _, id := range ids {
+		if task, ok := byId[id]; ok {
+			result = append(result, task)
+		}
+	}
+	return result
+}
+
+// CreateTask creates a new task and logs it as created.
+func (r *trackedRepository) CreateTask(task models.Task) (int, error) {
+	id, err := r.Repository.CreateTask(task)
+	if err != nil {
+		return 0, err
+	}
+	if stored, err := r.Repository.GetTask(id); err == nil {
+		r.record(Created, id, models.Task{}, stored)
+	}
+	return id, nil
+}
+
+// InsertTask stores a task under its own id and logs it as created.
+func (r *trackedRepository) InsertTask(task models.Task) error {
+	if err := r.Repository.InsertTask(task); err != nil {
+		return err
+	}
+	if stored, err := r.Repository.GetTask(task.Id); err == nil {
+		r.record(Created, task.Id, models.Task{}, stored)
+	}
+	return nil
+}
+
+// UpdateTask replaces the task and logs changes of it and of its subtasks marked done with it.
+func (r *trackedRepository) UpdateTask(task models.Task) error {
+	before := r.subtree(task.Id)
+	if err := r.Repository.UpdateTask(task); err != nil {
+		return err
+	}
+	r.recordChanges(before)
+	return nil
+}
+
+// DeleteTask deletes the task and logs it and its subtasks deleted with it as deleted.
+func (r *trackedRepository) DeleteTask(id int) error {
+	before := r.subtree(id)
+	if err := r.Repository.DeleteTask(id); err != nil {
+		return err
+	}
+	r.recordChanges(before)
+	return nil
+}
+
+// DeleteAllTasks deletes all tasks and logs them as deleted.
+func (r *trackedRepository) DeleteAllTasks() error {
+	before := models.AllTasks(r.Repository)
+	if err := r.Repository.DeleteAllTasks(); err != nil {
+		return err
+	}
+	r.recordChanges(before)
+	return nil
+}
+
+// TrashTask moves the task to trash and logs it and its subtasks deleted with it as deleted.
+func (r *trackedRepository) TrashTask(id int) error {
+	before := r.subtree(id)
+	if err := r.Repository.TrashTask(id); err != nil {
+		return err
+	}
+	r.recordTrashed(before)
+	return nil
+}
+
+// TrashAllTasks moves all tasks to trash and logs them as deleted.
+func (r *trackedRepository) TrashAllTasks() error {
+	before := models.AllTasks(r.Repository)
+	if err := r.Repository.TrashAllTasks(); err != nil {
+		return err
+	}
+	r.recordTrashed(before)
+	return nil
+}
+
+// RestoreTask restores the task from trash and logs restored tasks as restored.
+func (r *trackedRepository) RestoreTask(id int) ([]int, error) {
+	trash := r.trash()
+	ids, err := r.Repository.RestoreTask(id)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		if task, err := r.Repository.GetTask(id); err == nil {
+			r.record(Restored, id, trash[id], task)
+		}
+	}
+	return ids, nil
+}
+
+// PurgeTrash permanently deletes tasks from trash and logs them as deleted.
+func (r *trackedRepository) PurgeTrash(before time.Time) []int {
+	trash := r.trash()
+	ids := r.Repository.PurgeTrash(before)
+	for _, id := range ids {
+		r.record(Deleted, id, trash[id], models.Task{})
+	}
+	return ids
+}
+
+// AddDependencies adds blockers of the task and logs changed blockers.
+func (r *trackedRepository) AddDependencies(id int, blockers []int) error {
+	before := r.task(id)
+	if err := r.Repository.AddDependencies(id, blockers); err != nil {
+		return err
+	}
+	r.recordChanges(before)
+	return nil
+}
+
+// RemoveDependency removes blocker of the task and logs changed blockers.
+func (r *trackedRepository) RemoveDependency(id, blocker int) error {
+	before := r.task(id)
+	if err := r.Repository.RemoveDependency(id, blocker); err != nil {
+		return err
+	}
+	r.recordChanges(before)
+	return nil
+}
+
+// RenameTag renames the tag and logs changed tags of tasks.
+func (r *trackedRepository) RenameTag(tag, newTag string) ([]int, error) {
+	before := models.AllTasks(r.Repository)
+	ids, err := r.Repository.RenameTag(tag, newTag)
+	r.recordChanges(changed(before, ids))
+	return ids, err
+}
+
+// MergeTags merges the tags and logs changed tags of tasks.
+func (r *trackedRepository) MergeTags(tags []string, into string) ([]int, error) {
+	before := models.AllTasks(r.Repository)
+	ids, err := r.Repository.MergeTags(tags, into)
+	r.recordChanges(changed(before, ids))
+	return ids, err
+}
+
+// DeleteTag strips the tag and logs changed tags of tasks.
+func (r *trackedRepository) DeleteTag(tag string) ([]int, error) {
+	before := models.AllTasks(r.Repository)
+	ids, err := r.Repository.DeleteTag(tag)
+	r.recordChanges(changed(before, ids))
+	return ids, err
+}
+
+// ReplaceTags replaces the tags in the tasks and logs changed tags of tasks.
+func (r *trackedRepository) ReplaceTags(ids []int, tags []string, into string) []int {
+	before := models.AllTasks(r.Repository)
+	ids = r.Repository.ReplaceTags(ids, tags, into)
+	r.recordChanges(changed(before, ids))
+	return ids
+}
+
+// DeleteProject deletes the project and logs its tasks left without project.
+func (r *trackedRepository) DeleteProject(id int) ([]int, error) {
+	before, _ := r.Repository.GetProjectTasks(id)
+	ids, err := r.Repository.DeleteProject(id)
+	r.recordChanges(changed(before, ids))
+	return ids, err
+}
@@ -0,0 +1,230 @@
+// Package attachment provides files attached to tasks: metadata of attachments is kept in models.Repository
+// and their content in blob.Store. Uploads are limited by size and by content type sniffed from content,
+// content of attachments is deleted from blob store with their tasks by repository returned by Cleanup,
+// content of tasks in trash is kept until they are purged.
+package attachment
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/White-AK111/REST/config"
+	"github.com/White-AK111/REST/internal/blob"
+	"github.com/White-AK111/REST/internal/models"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Field it's a name of field of multipart form with uploaded file.
+const Field = "file"
+
+// multipartOverhead it's an allowance for headers and boundaries of multipart form over the max size of file.
+const multipartOverhead = 64 << 10
+
+// Errors of uploads.
+var (
+	ErrTooLarge        = errors.New("file is too large")
+	ErrUnsupportedType = errors.New("type of file isn't allowed")
+)
+
+// Limits of uploaded files.
+type Limits struct {
+	MaxSize int64    // max size of file in bytes
+	Types   []string // allowed content types, "image/*" allows all images, empty list allows any type
+}
+
+// Attachments uploads, opens and deletes attachments of tasks. Repository is given to each method, so changes
+// are made through repository of request.
+type Attachments struct {
+	blobs  blob.Store
+	limits Limits
+}
+
+// New function initialize a new Attachments with content in blobs.
+func New(blobs blob.Store, limits Limits) *Attachments {
+	return &Attachments{blobs: blobs, limits: limits}
+}
+
+// NewFromConfig function initialize a new Attachments with content in directory and limits from config.
+func NewFromConfig(cfg *config.Config) (*Attachments, error) {
+	blobs, err := blob.NewFS(cfg.Attachments.Dir)
+	if err != nil {
+		return nil, err
+	}
+	return New(blobs, Limits{MaxSize: cfg.Attachments.MaxSize, Types: cfg.Attachments.Types}), nil
+}
+
+// MaxBodySize returns max size of request body with multipart form of uploaded file.
+func (a *Attachments) MaxBodySize() int64 {
+	return a.limits.MaxSize + multipartOverhead
+}
+
+// key returns key of content of attachment in blob store.
+func key(id int) string {
+	return strconv.Itoa(id)
+}
+
+// allowed reports whether content type is allowed by limits.
+func (a *Attachments) allowed(contentType string) bool {
+	if len(a.limits.Types) == 0 {
+		return true
+	}
+	for _, pattern := range a.limits.Types {
+		if ok, _ := path.Match(pattern, contentType); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Upload stores file with name and size read from r as attachment of task, returns stored attachment.
+// Content type of attachment is sniffed from content, the one given by client isn't trusted.
+func (a *Attachments) Upload(repo models.Repository, taskId int, name string, size int64, r io.Reader) (models.Attachment, error) {
+	if size > a.limits.MaxSize {
+		return models.Attachment{}, fmt.Errorf("%w: %d bytes, max %d bytes", ErrTooLarge, size, a.limits.MaxSize)
+	}
+	if _, err := repo.GetTask(taskId); err != nil {
+		return models.Attachment{}, err
+	}
+
+	var content bytes.Buffer
+	n, err := content.ReadFrom(io.LimitReader(r, a.limits.MaxSize+1))
+	if err != nil {
+		return models.Attachment{}, err
+	}
+	if n > a.limits.MaxSize {
+		return models.Attachment{}, fmt.Errorf("%w: max %d bytes", ErrTooLarge, a.limits.MaxSize)
+	}
+	contentType, _, _ := mime.ParseMediaType(http.DetectContentType(content.Bytes()))
+	if !a.allowed(contentType) {
+		return models.Attachment{}, fmt.Errorf("%w: %s", ErrUnsupportedType, contentType)
+	}
+
+	name = filepath.Base(strings.ReplaceAll(name, `\`, "/"))
+	if name == "." || name == "/" {
+		name = "file"
+	}
+	attachment, err := repo.AddAttachment(models.Attachment{TaskId: taskId, Name: name, ContentType: contentType, Size: n})
+	if err != nil {
+		return models.Attachment{}, err
+	}
+	if err = a.blobs.Put(key(attachment.Id), &content); err != nil {
+		_ = repo.DeleteAttachment(taskId, attachment.Id)
+		return models.Attachment{}, err
+	}
+	return attachment, nil
+}
+
+// Open returns attachment of task by id and its content, content must be closed by caller.
+func (a *Attachments) Open(repo models.Repository, taskId, id int) (models.Attachment, io.ReadSeekCloser, error) {
+	attachment, err := repo.GetAttachment(taskId, id)
+	if err != nil {
+		return models.Attachment{}, nil, err
+	}
+	content, err := a.blobs.Open(key(id))
+	if err != nil {
+		return models.Attachment{}, nil, err
+	}
+	return attachment, content, nil
+}
+
+// Delete deletes attachment of task by id with its content.
+func (a *Attachments) Delete(repo models.Repository, taskId, id int) error {
+	if err := repo.DeleteAttachment(taskId, id); err != nil {
+		return err
+	}
+	return a.blobs.Delete(key(id))
+}
+
+// cleanedRepository decorates models.Repository and deletes content of attachments of deleted tasks.
+type cleanedRepository struct {
+	models.Repository
+	attachments *Attachments
+}
+
+// Cleanup returns repository which deletes content of attachments from blob store when their tasks are deleted.
+func (a *Attachments) Cleanup(repo models.Repository) models.Repository {
+	return &cleanedRepository{Repository: repo, attachments: a}
+}
+
+// attached returns attachments of tasks.
+func (r *cleanedRepository) attached(tasks []models.Task) []models.Attachment {
+	var attachments []models.Attachment
+	for _, task := range tasks {
+		taskAttachments, _ := r.Repository.GetAttachments(task.Id)
+		attachments = append(attachments, taskAttachments...)
+	}
+	return attachments
+}
+
+// subtree returns task with the given id and all its subtasks.
+func (r *cleanedRepository) subtree(id int) []models.Task {
+	task, err := r.Repository.GetTask(id)
+	if err != nil {
+		return nil
+	}
+	tasks := []models.Task{task}
+	children, _ := r.Repository.GetChildren(id)
+	for _, child := range children {
+		tasks = append(tasks, r.subtree(child.Id)...)
+	}
+	return tasks
+}
+
+// clean deletes content of attachments whose tasks don't exist anymore.
+func (r *cleanedRepository) clean(attachments []models.Attachment) {
+	for _, attachment := range attachments {
+		if _, err := r.Repository.GetTask(attachment.TaskId); err == nil {
+			continue
+		}
+		if err := r.attachments.blobs.Delete(key(attachment.Id)); err != nil {
+			log.Printf("error on delete content of attachment with id=%d: %s", attachment.Id, err)
+		}
+	}
+}
+
+// DeleteTask deletes the task and content of attachments of it and of its subtasks deleted with it.
+func (r *cleanedRepository) DeleteTask(id int) error {
+	attachments := r.attached(r.subtree(id))
+	if err := r.Repository.DeleteTask(id); err != nil {
+		return err
+	}
+	r.clean(attachments)
+	return nil
+}
+
+// PurgeTrash permanently deletes tasks from trash and content of their attachments.
+func (r *cleanedRepository) PurgeTrash(before time.Time) []int {
+	attachments := r.attached(r.Repository.GetTrash())
+	ids := r.Repository.PurgeTrash(before)
+
+	purged := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		purged[id] = true
+	}
+	var deleted []models.Attachment
+	for _, attachment := range attachments {
+		if purged[attachment.TaskId] {
+			deleted = append(deleted, attachment)
+		}
+	}
+	r.clean(deleted)
+	return ids
+}
+
+// DeleteAllTasks deletes all tasks and content of their attachments.
+func (r *cleanedRepository) DeleteAllTasks() error {
+	attachments := r.attached(models.AllTasks(r.Repository))
+	if err := r.Repository.DeleteAllTasks(); err != nil {
+		return err
+	}
+	r.clean(attachments)
+	return nil
+}
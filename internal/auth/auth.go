@@ -0,0 +1,181 @@
+// Package auth provides authentication of requests. Users of config are identified by static bearer tokens
+// in Authorization header or by access tokens issued by session.Sessions on login by password or by OpenID
+// Connect provider of oidc.Providers, other users by JWT bearer tokens verified by jwt.Verifier of config with user
+// named by claim of token. Authenticated user is the principal of request: changes are logged in activity log
+// with the principal as actor and tasks are scoped to the principal by ownership.Scope. Without users and JWT
+// in config requests aren't authenticated, the principal is the actor of X-Actor header and tasks aren't scoped.
+package auth
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"github.com/White-AK111/REST/config"
+	"github.com/White-AK111/REST/internal/activity"
+	"github.com/White-AK111/REST/internal/jwt"
+	"github.com/White-AK111/REST/internal/models"
+	"github.com/White-AK111/REST/internal/oidc"
+	"github.com/White-AK111/REST/internal/ownership"
+	"github.com/White-AK111/REST/internal/session"
+	"net/http"
+)
+
+// Header it's a header of request with bearer token.
+const Header = "Authorization"
+
+// Challenge it's a value of WWW-Authenticate header of response to unauthenticated request.
+const Challenge = `Bearer realm="tasks"`
+
+// ErrUnauthorized it's an error of request without valid bearer token.
+var ErrUnauthorized = errors.New("valid bearer token is required")
+
+// Users authenticates requests by static bearer tokens of users, by access tokens of sessions and by JWT
+// bearer tokens.
+type Users struct {
+	users     []config.User
+	sessions  *session.Sessions // nil if login is disabled
+	providers *oidc.Providers   // nil if there are no OpenID Connect providers
+	verifier  *jwt.Verifier     // nil if JWT isn't accepted
+	claim     string            // claim of JWT naming user
+}
+
+// New function initialize a new Users with users, sessions, providers and verifier of JWT from config.
+func New(cfg *config.Config) (*Users, error) {
+	sessions, err := session.New(cfg)
+	if err != nil {
+		return nil, err
+	}
+	providers, err := oidc.New(cfg, sessions)
+	if err != nil {
+		return nil, err
+	}
+	verifier, err := jwt.NewFromConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &Users{
+		users:     cfg.Auth.Users,
+		sessions:  sessions,
+		providers: providers,
+		verifier:  verifier,
+		claim:     cfg.Auth.JWT.PrincipalClaim,
+	}, nil
+}
+
+// Enabled reports whether requests are authenticated.
+func (u *Users) Enabled() bool {
+	return len(u.users) > 0 || u.sessions != nil || u.verifier != nil
+}
+
+// Sessions returns sessions of users logged in by password, nil if login is disabled.
+func (u *Users) Sessions() *session.Sessions {
+	return u.sessions
+}
+
+// Providers returns OpenID Connect providers of login, nil if there are no providers.
+func (u *Users) Providers() *oidc.Providers {
+	return u.providers
+}
+
+// Verifier returns verifier of JWT bearer tokens, nil if JWT isn't accepted.
+func (u *Users) Verifier() *jwt.Verifier {
+	return u.verifier
+}
+
+// Local reports whether bearer token is authenticated without verifier of JWT: it's a static token of user or
+// a token signed by keys of sessions. JWT middleware passes requests with such tokens on to Authenticate.
+func (u *Users) Local(token string) bool {
+	if u.static(token) != "" {
+		return true
+	}
+	if u.sessions == nil {
+		return false
+	}
+	_, err := u.sessions.Verify(token)
+	return !(errors.Is(err, jwt.ErrAlgorithm) || errors.Is(err, jwt.ErrUnknownKey))
+}
+
+// static returns user of static bearer token, empty if there's no such user.
+func (u *Users) static(token string) string {
+	for _, user := range u.users {
+		if user.Token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(user.Token)) == 1 {
+			return user.Name
+		}
+	}
+	return ""
+}
+
+// Authenticate returns principal of request by claims of JWT verified by middleware, without claims by values
+// of Authorization and X-Actor headers.
+func (u *Users) Authenticate(authorization, actor string, claims jwt.Claims) (string, error) {
+	if !u.Enabled() {
+		return activity.Actor(actor), nil
+	}
+	if claims != nil {
+		return u.principal(claims)
+	}
+
+	token := jwt.Bearer(authorization)
+	if token == "" {
+		return "", ErrUnauthorized
+	}
+	if user := u.static(token); user != "" {
+		return user, nil
+	}
+	if u.sessions != nil {
+		principal, err := u.sessions.Verify(token)
+		if err == nil {
+			return principal, nil
+		}
+		// token isn't issued by sessions if it's signed by another algorithm or key
+		if u.verifier == nil || !(errors.Is(err, jwt.ErrAlgorithm) || errors.Is(err, jwt.ErrUnknownKey)) {
+			return "", fmt.Errorf("%w: %s", ErrUnauthorized, err)
+		}
+	}
+	if u.verifier == nil {
+		return "", ErrUnauthorized
+	}
+
+	claims, err := u.verifier.Verify(token)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", ErrUnauthorized, err)
+	}
+	return u.principal(claims)
+}
+
+// AuthenticateRequest returns principal of net/http request by claims in its context and by its headers,
+// see Authenticate.
+func (u *Users) AuthenticateRequest(req *http.Request) (string, error) {
+	claims, _ := jwt.ClaimsFrom(req.Context())
+	return u.Authenticate(req.Header.Get(Header), req.Header.Get(activity.Header), claims)
+}
+
+// principal returns user named by claim of verified JWT.
+func (u *Users) principal(claims jwt.Claims) (string, error) {
+	principal := claims.String(u.claim)
+	if principal == "" {
+		return "", fmt.Errorf("%w: token has no %q claim", ErrUnauthorized, u.claim)
+	}
+	return principal, nil
+}
+
+// Repository returns repository of principal: changes made through it are logged with principal as actor,
+// tasks are scoped to principal if requests are authenticated.
+func (u *Users) Repository(repo models.Repository, principal string) models.Repository {
+	repo = activity.Track(repo, principal)
+	if u.Enabled() {
+		repo = ownership.Scope(repo, principal)
+	}
+	return repo
+}
+
+// Visible returns filter of tasks which principal sees, nil if requests aren't authenticated and all tasks
+// are seen.
+func (u *Users) Visible(principal string) func(models.Task) bool {
+	if !u.Enabled() {
+		return nil
+	}
+	return func(task models.Task) bool {
+		return ownership.Visible(task, principal)
+	}
+}
@@ -0,0 +1,100 @@
+// Package blob provides stores of binary content by key, like files attached to tasks. Store is an interface,
+// so content can be kept in local filesystem by FS or in another storage, like S3, by own implementation.
+package blob
+
+import (
+	"fmt"
+	"github.com/White-AK111/REST/internal/models"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Store interface for all blob store methods, methods are safe to call concurrently.
+type Store interface {
+	// Put stores content read from r under key, content stored under key before is replaced.
+	Put(key string, r io.Reader) error
+	// Open returns content stored under key, it can be read from any offset for range requests.
+	Open(key string) (io.ReadSeekCloser, error)
+	// Delete deletes content stored under key, deleting of missing key isn't an error.
+	Delete(key string) error
+}
+
+// FS it's a Store which keeps content in files of directory, one file per key.
+type FS struct {
+	dir string
+}
+
+// NewFS function initialize a new FS in directory dir, directory is created if it doesn't exist.
+func NewFS(dir string) (*FS, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FS{dir: dir}, nil
+}
+
+// path returns path of file of key, keys are single names so they can't point outside of directory.
+func (fs *FS) path(key string) (string, error) {
+	if key == "" || key == "." || key == ".." || strings.ContainsAny(key, `/\`) {
+		return "", fmt.Errorf("invalid blob key %q", key)
+	}
+	return filepath.Join(fs.dir, key), nil
+}
+
+// Put writes content to temporary file and renames it to file of key, so readers never see partial content.
+func (fs *FS) Put(key string, r io.Reader) error {
+	path, err := fs.path(key)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(fs.dir, ".upload-*")
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// Open opens file of key.
+func (fs *FS) Open(key string) (io.ReadSeekCloser, error) {
+	path, err := fs.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("blob %q %w", key, models.ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Delete removes file of key.
+func (fs *FS) Delete(key string) error {
+	path, err := fs.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err = os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,234 @@
+// Package bulk guards bulk delete of tasks: a dry run reports tasks matching a filter with a confirmation token,
+// and only a request with the same filter and the token deletes them. Tasks created after the dry run aren't
+// deleted, so the count confirmed by client is the count of deleted tasks at most.
+package bulk
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/White-AK111/REST/config"
+	"github.com/White-AK111/REST/internal/models"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Errors of bulk delete.
+var (
+	ErrDisabled     = errors.New("bulk delete is disabled")
+	ErrBadFilter    = errors.New("bad filter of bulk delete")
+	ErrNoToken      = errors.New("bulk delete must be confirmed by token of dry run, request it with ?dryRun=true")
+	ErrInvalidToken = errors.New("confirmation token is invalid, expired or was issued for another filter")
+)
+
+// Filter selects tasks of bulk delete, empty filter selects all tasks.
+type Filter struct {
+	Tag   string // tag pattern of GetTasksByTag
+	Due   string // due date in models.DateLayout
+	Hard  bool   // delete permanently instead of moving to trash
+	Owner string // owner of tasks, empty for tasks of all users
+}
+
+// Preview it's a result of dry run of bulk delete.
+type Preview struct {
+	Count     int       `json:"count" xml:"count" yaml:"count"`
+	Ids       []int     `json:"ids" xml:"ids>id" yaml:"ids"`
+	Token     string    `json:"token" xml:"token" yaml:"token"`
+	ExpiresAt time.Time `json:"expiresAt" xml:"expiresAt" yaml:"expiresAt"`
+}
+
+// Result it's a result of confirmed bulk delete.
+type Result struct {
+	Deleted []int `json:"deleted" xml:"deleted>id" yaml:"deleted"`
+}
+
+// pending it's a dry run waiting for confirmation.
+type pending struct {
+	filter    Filter
+	tasks     []models.Task
+	expiresAt time.Time
+}
+
+// Guard issues and checks confirmation tokens of bulk delete, each token can be used once.
+type Guard struct {
+	sync.Mutex
+	disabled bool
+	ttl      time.Duration
+	pending  map[string]pending
+}
+
+// New function initialize a new Guard with parameters from config.
+func New(cfg *config.Config) *Guard {
+	return &Guard{
+		disabled: cfg.BulkDelete.Disabled,
+		ttl:      cfg.BulkDelete.TokenTTL,
+		pending:  make(map[string]pending),
+	}
+}
+
+// match returns tasks of repo selected by filter.
+func match(repo models.Repository, filter Filter) ([]models.Task, error) {
+	tasks, err := byTagAndDue(repo, filter)
+	if err != nil || filter.Owner == "" {
+		return tasks, err
+	}
+	owned := make([]models.Task, 0, len(tasks))
+	for _, task := range tasks {
+		if task.Owner == filter.Owner {
+			owned = append(owned, task)
+		}
+	}
+	return owned, nil
+}
+
+// byTagAndDue returns tasks of repo selected by tag and due date of filter.
+func byTagAndDue(repo models.Repository, filter Filter) ([]models.Task, error) {
+	var due time.Time
+	if filter.Due != "" {
+		var err error
+		if due, err = time.Parse(models.DateLayout, filter.Due); err != nil {
+			return nil, fmt.Errorf("%w: 'due': %s", ErrBadFilter, err)
+		}
+	}
+
+	switch {
+	case filter.Tag != "" && filter.Due != "":
+		byDue := make(map[int]bool)
+		for _, task := range dueOn(repo, due) {
+			byDue[task.Id] = true
+		}
+		var tasks []models.Task
+		for _, task := range repo.GetTasksByTag(filter.Tag) {
+			if byDue[task.Id] {
+				tasks = append(tasks, task)
+			}
+		}
+		return tasks, nil
+	case filter.Tag != "":
+		return repo.GetTasksByTag(filter.Tag), nil
+	case filter.Due != "":
+		return dueOn(repo, due), nil
+	default:
+		return models.AllTasks(repo), nil
+	}
+}
+
+// dueOn returns stored tasks of repo due on date of due. Virtual occurrences of recurring tasks are skipped: they
+// have id of the recurring task, which is due on another date, so deleting by their ids would delete the series.
+func dueOn(repo models.Repository, due time.Time) []models.Task {
+	var tasks []models.Task
+	for _, task := range repo.GetTasksByDueDate(due.Year(), due.Month(), due.Day()) {
+		if !task.Virtual {
+			tasks = append(tasks, task)
+		}
+	}
+	return tasks
+}
+
+// ids returns sorted ids of tasks.
+func ids(tasks []models.Task) []int {
+	ids := make([]int, 0, len(tasks))
+	for _, task := range tasks {
+		ids = append(ids, task.Id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// newToken returns a random token.
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// DryRun reports tasks of repo which would be deleted by filter and issues a token confirming their deletion.
+func (g *Guard) DryRun(repo models.Repository, filter Filter) (Preview, error) {
+	if g.disabled {
+		return Preview{}, ErrDisabled
+	}
+	tasks, err := match(repo, filter)
+	if err != nil {
+		return Preview{}, err
+	}
+	token, err := newToken()
+	if err != nil {
+		return Preview{}, err
+	}
+
+	g.Lock()
+	defer g.Unlock()
+
+	now := time.Now()
+	for t, p := range g.pending {
+		if now.After(p.expiresAt) {
+			delete(g.pending, t)
+		}
+	}
+	expiresAt := now.Add(g.ttl)
+	g.pending[token] = pending{filter: filter, tasks: tasks, expiresAt: expiresAt}
+	return Preview{Count: len(tasks), Ids: ids(tasks), Token: token, ExpiresAt: expiresAt}, nil
+}
+
+// take removes pending dry run of token and returns its tasks if token was issued for filter and isn't expired.
+func (g *Guard) take(token string, filter Filter) ([]models.Task, error) {
+	g.Lock()
+	defer g.Unlock()
+
+	p, ok := g.pending[token]
+	if !ok || p.filter != filter || time.Now().After(p.expiresAt) {
+		return nil, ErrInvalidToken
+	}
+	delete(g.pending, token)
+	return p.tasks, nil
+}
+
+// Delete deletes tasks reported by dry run with token, filter must be the same as of dry run. Subtasks are deleted
+// before their parents, tasks already deleted since dry run are skipped. Returns sorted ids of deleted tasks,
+// on error tasks deleted before it stay deleted.
+func (g *Guard) Delete(repo models.Repository, filter Filter, token string) (Result, error) {
+	if g.disabled {
+		return Result{}, ErrDisabled
+	}
+	if token == "" {
+		return Result{}, ErrNoToken
+	}
+	tasks, err := g.take(token, filter)
+	if err != nil {
+		return Result{}, err
+	}
+
+	parents := make(map[int]int, len(tasks))
+	for _, task := range tasks {
+		parents[task.Id] = task.ParentId
+	}
+	depth := func(id int) int {
+		d := 0
+		for parent, ok := parents[id]; ok && parent != 0; parent, ok = parents[parent] {
+			d++
+		}
+		return d
+	}
+	sort.SliceStable(tasks, func(i, j int) bool { return depth(tasks[i].Id) > depth(tasks[j].Id) })
+
+	deleted := make([]models.Task, 0, len(tasks))
+	for _, task := range tasks {
+		if filter.Hard {
+			err = repo.DeleteTask(task.Id)
+		} else {
+			err = repo.TrashTask(task.Id)
+		}
+		if errors.Is(err, models.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return Result{Deleted: ids(deleted)}, err
+		}
+		deleted = append(deleted, task)
+	}
+	return Result{Deleted: ids(deleted)}, nil
+}
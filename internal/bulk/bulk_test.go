@@ -0,0 +1,89 @@
+package bulk
+
+import (
+	"github.com/White-AK111/REST/config"
+	"github.com/White-AK111/REST/internal/models"
+	"github.com/White-AK111/REST/internal/models/inmemory"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// create creates task in repo and returns its id.
+func create(t *testing.T, repo models.Repository, task models.Task) int {
+	t.Helper()
+	id, err := repo.CreateTask(task)
+	if err != nil {
+		t.Fatalf("CreateTask: %s", err)
+	}
+	return id
+}
+
+func TestDueFilterSkipsRecurringOccurrences(t *testing.T) {
+	repo := inmemory.NewStorage(models.RejectSubtasks)
+	series := create(t, repo, models.Task{
+		Text:  "standup",
+		Tags:  []string{"work"},
+		Due:   time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC),
+		RRule: "FREQ=DAILY",
+	})
+	single := create(t, repo, models.Task{
+		Text: "report",
+		Tags: []string{"work"},
+		Due:  time.Date(2024, 1, 3, 12, 0, 0, 0, time.UTC),
+	})
+
+	occurrences := repo.GetTasksByDueDate(2024, time.January, 3)
+	if len(occurrences) != 2 {
+		t.Fatalf("GetTasksByDueDate returned %d tasks, want the task and an occurrence of the series", len(occurrences))
+	}
+
+	cfg := &config.Config{}
+	cfg.BulkDelete.TokenTTL = time.Minute
+	g := New(cfg)
+
+	for _, filter := range []Filter{{Due: "2024-01-03"}, {Tag: "work", Due: "2024-01-03"}} {
+		preview, err := g.DryRun(repo, filter)
+		if err != nil {
+			t.Fatalf("DryRun(%+v): %s", filter, err)
+		}
+		if !reflect.DeepEqual(preview.Ids, []int{single}) {
+			t.Errorf("DryRun(%+v) matched %v, want [%d]", filter, preview.Ids, single)
+		}
+	}
+
+	filter := Filter{Due: "2024-01-03", Hard: true}
+	preview, err := g.DryRun(repo, filter)
+	if err != nil {
+		t.Fatalf("DryRun: %s", err)
+	}
+	result, err := g.Delete(repo, filter, preview.Token)
+	if err != nil {
+		t.Fatalf("Delete: %s", err)
+	}
+	if !reflect.DeepEqual(result.Deleted, []int{single}) {
+		t.Errorf("Delete deleted %v, want [%d]", result.Deleted, single)
+	}
+	if _, err = repo.GetTask(series); err != nil {
+		t.Errorf("recurring task %d is deleted by due filter of its occurrence: %s", series, err)
+	}
+}
+
+func TestDueFilterMatchesCurrentOccurrence(t *testing.T) {
+	repo := inmemory.NewStorage(models.RejectSubtasks)
+	series := create(t, repo, models.Task{
+		Text:  "standup",
+		Due:   time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC),
+		RRule: "FREQ=DAILY",
+	})
+
+	cfg := &config.Config{}
+	cfg.BulkDelete.TokenTTL = time.Minute
+	preview, err := New(cfg).DryRun(repo, Filter{Due: "2024-01-01"})
+	if err != nil {
+		t.Fatalf("DryRun: %s", err)
+	}
+	if !reflect.DeepEqual(preview.Ids, []int{series}) {
+		t.Errorf("DryRun matched %v, want [%d]", preview.Ids, series)
+	}
+}
@@ -0,0 +1,256 @@
+// Package codec provides a registry of encoders for content negotiation: responses are encoded in format
+// chosen by the Accept header and request bodies are decoded by their Content-Type.
+// Supported media types: application/json, application/xml, application/yaml and application/msgpack.
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	ErrNotAcceptable        = errors.New("not acceptable")
+	ErrUnsupportedMediaType = errors.New("unsupported media type")
+)
+
+// Codec it's an encoder and decoder for one media type.
+type Codec interface {
+	// ContentType returns media type for Content-Type header of response.
+	ContentType() string
+	// Marshal encodes v.
+	Marshal(v interface{}) ([]byte, error)
+	// Decode decodes body from r into v, unknown fields are rejected where format allows it.
+	Decode(r io.Reader, v interface{}) error
+}
+
+// Registry it's a set of codecs, first registered codec is default.
+type Registry struct {
+	codecs []Codec
+	byType map[string]Codec
+}
+
+// NewRegistry function initialize empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{byType: make(map[string]Codec)}
+}
+
+// Register adds codec for its media type and aliases.
+func (r *Registry) Register(c Codec, aliases ...string) {
+	r.codecs = append(r.codecs, c)
+	r.byType[c.ContentType()] = c
+	for _, alias := range aliases {
+		r.byType[alias] = c
+	}
+}
+
+// Default registry with all supported codecs, JSON is default.
+var Default = func() *Registry {
+	r := NewRegistry()
+	r.Register(JSON{}, "text/json")
+	r.Register(XML{}, "text/xml")
+	r.Register(YAML{}, "application/x-yaml", "text/yaml", "text/x-yaml")
+	r.Register(MsgPack{}, "application/x-msgpack", "application/vnd.msgpack")
+	return r
+}()
+
+// Negotiate returns codec by the Accept header, empty header means default codec.
+func Negotiate(accept string) (Codec, error) {
+	return Default.Negotiate(accept)
+}
+
+// ForContentType returns codec by the Content-Type header of request.
+func ForContentType(contentType string) (Codec, error) {
+	return Default.ForContentType(contentType)
+}
+
+// acceptRange it's one media range from Accept header.
+type acceptRange struct {
+	mediaType string
+	q         float64
+	order     int
+}
+
+// Negotiate returns codec by the Accept header, media ranges are tried by quality value and then by order.
+func (r *Registry) Negotiate(accept string) (Codec, error) {
+	if strings.TrimSpace(accept) == "" {
+		return r.codecs[0], nil
+	}
+
+	var ranges []acceptRange
+	for i, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		if q > 0 {
+			ranges = append(ranges, acceptRange{mediaType: mediaType, q: q, order: i})
+		}
+	}
+	sort.SliceStable(ranges, func(i, j int) bool { return ranges[i].q > ranges[j].q })
+
+	for _, ar := range ranges {
+		switch {
+		case ar.mediaType == "*/*":
+			return r.codecs[0], nil
+		case strings.HasSuffix(ar.mediaType, "/*"):
+			prefix := strings.TrimSuffix(ar.mediaType, "*")
+			for _, c := range r.codecs {
+				if strings.HasPrefix(c.ContentType(), prefix) {
+					return c, nil
+				}
+			}
+		default:
+			if c, ok := r.byType[ar.mediaType]; ok {
+				return c, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("%w: expect one of %s, got %q", ErrNotAcceptable, strings.Join(r.contentTypes(), ", "), accept)
+}
+
+// ForContentType returns codec by the Content-Type header of request.
+func (r *Registry) ForContentType(contentType string) (Codec, error) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, err
+	}
+	if c, ok := r.byType[mediaType]; ok {
+		return c, nil
+	}
+	return nil, fmt.Errorf("%w: expect Content-Type one of %s, got %q", ErrUnsupportedMediaType, strings.Join(r.contentTypes(), ", "), mediaType)
+}
+
+// contentTypes returns media types of all codecs.
+func (r *Registry) contentTypes() []string {
+	types := make([]string, len(r.codecs))
+	for i, c := range r.codecs {
+		types[i] = c.ContentType()
+	}
+	return types
+}
+
+// JSON codec for application/json.
+type JSON struct{}
+
+func (JSON) ContentType() string { return "application/json" }
+
+func (JSON) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSON) Decode(r io.Reader, v interface{}) error {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+// XML codec for application/xml. Root element is named by type of value in lower camel case,
+// slices are wrapped into root element with plural name, e.g. <tasks><task>...</task></tasks>.
+type XML struct{}
+
+func (XML) ContentType() string { return "application/xml" }
+
+func (XML) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	enc := xml.NewEncoder(&buf)
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array {
+		item := elementName(rv.Type().Elem())
+		root := xml.StartElement{Name: xml.Name{Local: item + "s"}}
+		if err := enc.EncodeToken(root); err != nil {
+			return nil, err
+		}
+		for i := 0; i < rv.Len(); i++ {
+			if err := enc.EncodeElement(rv.Index(i).Interface(), xml.StartElement{Name: xml.Name{Local: item}}); err != nil {
+				return nil, err
+			}
+		}
+		if err := enc.EncodeToken(root.End()); err != nil {
+			return nil, err
+		}
+	} else if err := enc.EncodeElement(v, xml.StartElement{Name: xml.Name{Local: elementName(rv.Type())}}); err != nil {
+		return nil, err
+	}
+
+	if err := enc.Flush(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (XML) Decode(r io.Reader, v interface{}) error {
+	return xml.NewDecoder(r).Decode(v)
+}
+
+// elementName returns name of type in lower camel case for XML element.
+func elementName(t reflect.Type) string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	name := t.Name()
+	if name == "" {
+		return "item"
+	}
+	runes := []rune(name)
+	runes[0] = unicode.ToLower(runes[0])
+	return string(runes)
+}
+
+// YAML codec for application/yaml.
+type YAML struct{}
+
+func (YAML) ContentType() string { return "application/yaml" }
+
+func (YAML) Marshal(v interface{}) ([]byte, error) {
+	return yaml.Marshal(v)
+}
+
+func (YAML) Decode(r io.Reader, v interface{}) error {
+	dec := yaml.NewDecoder(r)
+	dec.SetStrict(true)
+	return dec.Decode(v)
+}
+
+// MsgPack codec for application/msgpack, field names are taken from json tags.
+type MsgPack struct{}
+
+func (MsgPack) ContentType() string { return "application/msgpack" }
+
+func (MsgPack) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (MsgPack) Decode(r io.Reader, v interface{}) error {
+	dec := msgpack.NewDecoder(r)
+	dec.SetCustomStructTag("json")
+	dec.DisallowUnknownFields(true)
+	return dec.Decode(v)
+}
@@ -0,0 +1,343 @@
+// Package events provides a bus of task change events. The bus is fed by Observe, a decorator of
+// models.Repository, so every change made through any server or API is published to subscribers.
+package events
+
+import (
+	"github.com/White-AK111/REST/internal/models"
+	"sync"
+	"time"
+)
+
+// Type it's a type of task change.
+type Type string
+
+const (
+	Created Type = "created"
+	Updated Type = "updated"
+	Deleted Type = "deleted"
+	Cleared Type = "cleared" // all tasks deleted, event has empty task
+)
+
+// Event it's a change of task, Seq is increased by one for each published event.
+type Event struct {
+	Seq  uint64      `json:"seq"`
+	Type Type        `json:"type"`
+	Task models.Task `json:"task"`
+	Time time.Time   `json:"time"`
+}
+
+// Subscription receives events from the bus. If subscriber doesn't read events and its buffer
+// is full, subscription is closed by the bus, so slow consumers don't block publishers.
+type Subscription struct {
+	C      <-chan Event
+	c      chan Event
+	bus    *Bus
+	id     int
+	closed bool
+}
+
+// Close unsubscribes from the bus, channel C is closed.
+func (s *Subscription) Close() {
+	s.bus.Lock()
+	defer s.bus.Unlock()
+
+	s.bus.unsubscribe(s)
+}
+
+// historySize count of last events kept by the bus for resuming of subscriptions.
+const historySize = 1024
+
+// Bus it's a publisher of task events; Bus methods are safe to call concurrently.
+type Bus struct {
+	sync.Mutex
+	seq     uint64
+	nextId  int
+	subs    map[int]*Subscription
+	history []Event // ring buffer of last events, history[seq % historySize]
+}
+
+// NewBus function initialize a new Bus.
+func NewBus() *Bus {
+	return &Bus{
+		subs:    make(map[int]*Subscription),
+		history: make([]Event, historySize),
+	}
+}
+
+// Publish sends event to all subscribers and returns it.
+func (b *Bus) Publish(t Type, task models.Task) Event {
+	b.Lock()
+	defer b.Unlock()
+
+	b.seq++
+	e := Event{Seq: b.seq, Type: t, Task: task, Time: time.Now()}
+	b.history[e.Seq%historySize] = e
+	for _, s := range b.subs {
+		select {
+		case s.c <- e:
+		default:
+			// Subscriber is too slow, drop it.
+			b.unsubscribe(s)
+		}
+	}
+	return e
+}
+
+// Subscribe returns a new subscription with buffer for given count of events.
+func (b *Bus) Subscribe(buffer int) *Subscription {
+	b.Lock()
+	defer b.Unlock()
+
+	return b.subscribe(buffer)
+}
+
+// SubscribeAfter returns a new subscription and events published after event with sequence number lastSeq,
+// so a client can resume receiving without gaps. Only last historySize events are kept, older are lost.
+func (b *Bus) SubscribeAfter(lastSeq uint64, buffer int) (*Subscription, []Event) {
+	b.Lock()
+	defer b.Unlock()
+
+	var missed []Event
+	if lastSeq < b.seq {
+		first := lastSeq + 1
+		if b.seq-lastSeq > historySize {
+			first = b.seq - historySize + 1
+		}
+		for seq := first; seq <= b.seq; seq++ {
+			missed = append(missed, b.history[seq%historySize])
+		}
+	}
+
+	return b.subscribe(buffer), missed
+}
+
+// subscribe adds a new subscription, must be called with lock held.
+func (b *Bus) subscribe(buffer int) *Subscription {
+	c := make(chan Event, buffer)
+	s := &Subscription{C: c, c: c, bus: b, id: b.nextId}
+	b.subs[s.id] = s
+	b.nextId++
+	return s
+}
+
+// unsubscribe removes subscription, must be called with lock held.
+func (b *Bus) unsubscribe(s *Subscription) {
+	if s.closed {
+		return
+	}
+	s.closed = true
+	delete(b.subs, s.id)
+	close(s.c)
+}
+
+// observedRepository decorates models.Repository and publishes changes to the bus.
+type observedRepository struct {
+	models.Repository
+	bus *Bus
+}
+
+// Observe function returns repository which publishes every change of tasks to the bus.
+func Observe(repo models.Repository, bus *Bus) models.Repository {
+	return &observedRepository{Repository: repo, bus: bus}
+}
+
+// CreateTask creates a new task and publishes Created event.
+func (r *observedRepository) CreateTask(task models.Task) (int, error) {
+	id, err := r.Repository.CreateTask(task)
+	if err != nil {
+		return 0, err
+	}
+	if task, err := r.Repository.GetTask(id); err == nil {
+		r.bus.Publish(Created, task)
+	}
+	return id, nil
+}
+
+// InsertTask stores a task under its own id and publishes Created event.
+func (r *observedRepository) InsertTask(task models.Task) error {
+	if err := r.Repository.InsertTask(task); err != nil {
+		return err
+	}
+	if stored, err := r.Repository.GetTask(task.Id); err == nil {
+		r.bus.Publish(Created, stored)
+	}
+	return nil
+}
+
+// UpdateTask replaces the task and publishes Updated event, also for subtasks marked done with the task.
+func (r *observedRepository) UpdateTask(task models.Task) error {
+	subtasks := r.subtasks(task.Id)
+	if err := r.Repository.UpdateTask(task); err != nil {
+		return err
+	}
+	for _, subtask := range subtasks {
+		if stored, err := r.Repository.GetTask(subtask.Id); err == nil && stored.Done != subtask.Done {
+			r.bus.Publish(Updated, stored)
+		}
+	}
+	if stored, err := r.Repository.GetTask(task.Id); err == nil {
+		r.bus.Publish(Updated, stored)
+	}
+	return nil
+}
+
+// ShareTask replaces shares of the task and publishes Updated event.
+func (r *observedRepository) ShareTask(id int, shares []models.Share) error {
+	if err := r.Repository.ShareTask(id, shares); err != nil {
+		return err
+	}
+	if stored, err := r.Repository.GetTask(id); err == nil {
+		r.bus.Publish(Updated, stored)
+	}
+	return nil
+}
+
+// DeleteTask deletes the task and publishes Deleted event with deleted task, also for subtasks deleted with it.
+func (r *observedRepository) DeleteTask(id int) error {
+	task, err := r.Repository.GetTask(id)
+	if err != nil {
+		return err
+	}
+	subtasks := r.subtasks(id)
+	if err = r.Repository.DeleteTask(id); err != nil {
+		return err
+	}
+	for _, subtask := range subtasks {
+		if _, err = r.Repository.GetTask(subtask.Id); err != nil {
+			r.bus.Publish(Deleted, subtask)
+		}
+	}
+	r.bus.Publish(Deleted, task)
+	return nil
+}
+
+// TrashTask moves the task to trash and publishes Deleted event with task in trash, also for subtasks deleted with it.
+func (r *observedRepository) TrashTask(id int) error {
+	task, err := r.Repository.GetTask(id)
+	if err != nil {
+		return err
+	}
+	subtasks := r.subtasks(id)
+	if err = r.Repository.TrashTask(id); err != nil {
+		return err
+	}
+
+	trash := make(map[int]models.Task)
+	for _, trashed := range r.Repository.GetTrash() {
+		trash[trashed.Id] = trashed
+	}
+	for _, subtask := range append(subtasks, task) {
+		if trashed, ok := trash[subtask.Id]; ok {
+			r.bus.Publish(Deleted, trashed)
+		}
+	}
+	return nil
+}
+
+// TrashAllTasks moves all tasks to trash and publishes Cleared event.
+func (r *observedRepository) TrashAllTasks() error {
+	if err := r.Repository.TrashAllTasks(); err != nil {
+		return err
+	}
+	r.bus.Publish(Cleared, models.Task{})
+	return nil
+}
+
+// RestoreTask restores the task from trash and publishes Created events of restored tasks.
+func (r *observedRepository) RestoreTask(id int) ([]int, error) {
+	ids, err := r.Repository.RestoreTask(id)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		if task, err := r.Repository.GetTask(id); err == nil {
+			r.bus.Publish(Created, task)
+		}
+	}
+	return ids, nil
+}
+
+// subtasks returns all subtasks of task, subtasks go before their parents.
+func (r *observedRepository) subtasks(id int) []models.Task {
+	children, err := r.Repository.GetChildren(id)
+	if err != nil {
+		return nil
+	}
+	var subtasks []models.Task
+	for _, child := range children {
+		subtasks = append(subtasks, r.subtasks(child.Id)...)
+		subtasks = append(subtasks, child)
+	}
+	return subtasks
+}
+
+// RenameTag renames the tag and publishes Updated events of changed tasks.
+func (r *observedRepository) RenameTag(tag, newTag string) ([]int, error) {
+	ids, err := r.Repository.RenameTag(tag, newTag)
+	r.publishUpdated(ids)
+	return ids, err
+}
+
+// MergeTags merges the tags and publishes Updated events of changed tasks.
+func (r *observedRepository) MergeTags(tags []string, into string) ([]int, error) {
+	ids, err := r.Repository.MergeTags(tags, into)
+	r.publishUpdated(ids)
+	return ids, err
+}
+
+// DeleteTag strips the tag and publishes Updated events of changed tasks.
+func (r *observedRepository) DeleteTag(tag string) ([]int, error) {
+	ids, err := r.Repository.DeleteTag(tag)
+	r.publishUpdated(ids)
+	return ids, err
+}
+
+// ReplaceTags replaces the tags in the tasks and publishes Updated events of changed tasks.
+func (r *observedRepository) ReplaceTags(ids []int, tags []string, into string) []int {
+	ids = r.Repository.ReplaceTags(ids, tags, into)
+	r.publishUpdated(ids)
+	return ids
+}
+
+// AddDependencies adds blockers of the task and publishes Updated event.
+func (r *observedRepository) AddDependencies(id int, blockers []int) error {
+	if err := r.Repository.AddDependencies(id, blockers); err != nil {
+		return err
+	}
+	r.publishUpdated([]int{id})
+	return nil
+}
+
+// RemoveDependency removes blocker of the task and publishes Updated event.
+func (r *observedRepository) RemoveDependency(id, blocker int) error {
+	if err := r.Repository.RemoveDependency(id, blocker); err != nil {
+		return err
+	}
+	r.publishUpdated([]int{id})
+	return nil
+}
+
+// DeleteProject deletes the project and publishes Updated events of its tasks left without project.
+func (r *observedRepository) DeleteProject(id int) ([]int, error) {
+	ids, err := r.Repository.DeleteProject(id)
+	r.publishUpdated(ids)
+	return ids, err
+}
+
+// publishUpdated publishes Updated events of tasks with ids.
+func (r *observedRepository) publishUpdated(ids []int) {
+	for _, id := range ids {
+		if task, err := r.Repository.GetTask(id); err == nil {
+			r.bus.Publish(Updated, task)
+		}
+	}
+}
+
+// DeleteAllTasks deletes all tasks and publishes Cleared event.
+func (r *observedRepository) DeleteAllTasks() error {
+	if err := r.Repository.DeleteAllTasks(); err != nil {
+		return err
+	}
+	r.bus.Publish(Cleared, models.Task{})
+	return nil
+}
@@ -0,0 +1,148 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/White-AK111/REST/internal/auth"
+	"github.com/White-AK111/REST/internal/models"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	sseBuffer    = 256              // count of events buffered for each SSE client
+	sseHeartbeat = 15 * time.Second // interval of comments keeping idle connection alive
+	sseRetry     = 3000             // reconnection time for client in milliseconds
+)
+
+// SetSSEHeaders sets headers of Server-Sent Events response.
+func SetSSEHeaders(header func(key, value string)) {
+	header("Content-Type", "text/event-stream")
+	header("Cache-Control", "no-cache")
+	header("X-Accel-Buffering", "no")
+}
+
+// ParseLastEventId returns sequence number of last received event from Last-Event-ID header,
+// or from lastEventId query parameter because EventSource can't set headers. ok is false if both are empty,
+// then client receives only events published from now.
+func ParseLastEventId(header, query string) (seq uint64, ok bool, err error) {
+	value := header
+	if value == "" {
+		value = query
+	}
+	if value == "" {
+		return 0, false, nil
+	}
+	seq, err = strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("bad Last-Event-ID %q: %w", value, err)
+	}
+	return seq, true, nil
+}
+
+// writeEvent writes event in SSE format with sequence number as id and type as event name.
+func writeEvent(w io.Writer, e Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.Seq, e.Type, data)
+	return err
+}
+
+// StreamSSE writes events to w until done is closed, writing fails or the bus drops the subscription: events
+// published after lastSeq if resume is true, otherwise events published from now. flush is called after each
+// write to send data to client. Only events of tasks accepted by visible are written, nil visible accepts all tasks.
+func StreamSSE(w io.Writer, flush func() error, bus *Bus, lastSeq uint64, resume bool, visible func(models.Task) bool, done <-chan struct{}) error {
+	var sub *Subscription
+	var missed []Event
+	if resume {
+		sub, missed = bus.SubscribeAfter(lastSeq, sseBuffer)
+	} else {
+		sub = bus.Subscribe(sseBuffer)
+	}
+	defer sub.Close()
+
+	if _, err := fmt.Fprintf(w, "retry: %d\n\n", sseRetry); err != nil {
+		return err
+	}
+	for _, e := range missed {
+		if visible != nil && !visible(e.Task) {
+			continue
+		}
+		if err := writeEvent(w, e); err != nil {
+			return err
+		}
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-done:
+			return nil
+		case <-heartbeat.C:
+			if _, err := io.WriteString(w, ": ping\n\n"); err != nil {
+				return err
+			}
+		case e, ok := <-sub.C:
+			if !ok {
+				return fmt.Errorf("client is too slow to receive events")
+			}
+			if visible != nil && !visible(e.Task) {
+				continue
+			}
+			if err := writeEvent(w, e); err != nil {
+				return err
+			}
+		}
+		if err := flush(); err != nil {
+			return err
+		}
+	}
+}
+
+// SSEHandler returns handler of Server-Sent Events stream of task changes for net/http based servers,
+// principal of request receives events of tasks which the principal sees.
+func SSEHandler(bus *Bus, users *auth.Users) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			http.Error(w, fmt.Sprintf("expect method GET /events, got %v", req.Method), http.StatusMethodNotAllowed)
+			return
+		}
+
+		principal, err := users.AuthenticateRequest(req)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", auth.Challenge)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+			return
+		}
+
+		lastSeq, resume, err := ParseLastEventId(req.Header.Get("Last-Event-ID"), req.URL.Query().Get("lastEventId"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		SetSSEHeaders(w.Header().Set)
+		w.WriteHeader(http.StatusOK)
+		flush := func() error {
+			flusher.Flush()
+			return nil
+		}
+		// Error means that client has gone or is too slow, stream is just finished.
+		_ = StreamSSE(w, flush, bus, lastSeq, resume, users.Visible(principal), req.Context().Done())
+	})
+}
@@ -0,0 +1,857 @@
+// Package gql provides GraphQL endpoint over the task repository with playground page.
+// Queries mirror GetAllTasks, GetTask, GetTasksByTag, GetTasksByDueDate, GetTasksByDueRange, SearchTasks,
+// GetChildren, queries of projects, attachments, comments, activity log and trash, mutations create, complete,
+// move, delete to trash, restore and share tasks, manage dependencies, projects and comments. Changes are logged
+// in activity log with principal of request, queries and mutations see only tasks of principal.
+package gql
+
+import (
+	"context"
+	"fmt"
+	"github.com/White-AK111/REST/internal/activity"
+	"github.com/White-AK111/REST/internal/auth"
+	"github.com/White-AK111/REST/internal/models"
+	"github.com/White-AK111/REST/internal/recurrence"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/handler"
+)
+
+// NewHandler function returns handler of GraphQL endpoint, GET request from browser shows playground page.
+// Requests are authenticated by users.
+func NewHandler(store models.Repository, users *auth.Users) (http.Handler, error) {
+	schema, err := NewSchema(store)
+	if err != nil {
+		return nil, err
+	}
+
+	h := handler.New(&handler.Config{
+		Schema:     &schema,
+		Pretty:     false,
+		Playground: true,
+	})
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		principal, err := users.AuthenticateRequest(req)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", auth.Challenge)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		ctx := activity.WithActor(req.Context(), principal)
+		ctx = context.WithValue(ctx, repositoryKey{}, users.Repository(store, principal))
+		h.ServeHTTP(w, req.WithContext(ctx))
+	}), nil
+}
+
+// repositoryKey it's a key of repository of principal of request in context.
+type repositoryKey struct{}
+
+// repository returns repository of principal of request from context of resolver, store tracked with actor
+// of context if context has no repository.
+func repository(p graphql.ResolveParams, store models.Repository) models.Repository {
+	if repo, ok := p.Context.Value(repositoryKey{}).(models.Repository); ok {
+		return repo
+	}
+	return activity.Track(store, activity.ActorFrom(p.Context))
+}
+
+// taskType GraphQL type for models.Task.
+var taskType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Task",
+	Fields: graphql.Fields{
+		"id":   &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		"text": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"tags": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(graphql.String))),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				tags := p.Source.(models.Task).Tags
+				if tags == nil {
+					tags = []string{}
+				}
+				return tags, nil
+			},
+		},
+		"due": &graphql.Field{
+			Type:        graphql.DateTime,
+			Description: "Due date in RFC 3339 format, null if task has no due date.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				due := p.Source.(models.Task).Due
+				if due.IsZero() {
+					return nil, nil
+				}
+				return due, nil
+			},
+		},
+		"rrule": &graphql.Field{
+			Type:        graphql.String,
+			Description: "Recurrence rule of RFC 5545, null if task doesn't recur.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				rrule := p.Source.(models.Task).RRule
+				if rrule == "" {
+					return nil, nil
+				}
+				return rrule, nil
+			},
+		},
+		"virtual": &graphql.Field{
+			Type:        graphql.NewNonNull(graphql.Boolean),
+			Description: "True for future occurrence of recurring task, it has id of the recurring task.",
+		},
+		"parentId": &graphql.Field{
+			Type:        graphql.Int,
+			Description: "Id of parent task of subtask, null for top level task.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				parentId := p.Source.(models.Task).ParentId
+				if parentId == 0 {
+					return nil, nil
+				}
+				return parentId, nil
+			},
+		},
+		"done": &graphql.Field{
+			Type:        graphql.NewNonNull(graphql.Boolean),
+			Description: "True for completed subtask.",
+		},
+		"progress": &graphql.Field{
+			Type:        progressType,
+			Description: "Rollup of all subtasks, null if task has no subtasks.",
+		},
+		"blockedBy": &graphql.Field{
+			Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(graphql.Int))),
+			Description: "Ids of tasks blocking task.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				blockedBy := p.Source.(models.Task).BlockedBy
+				if blockedBy == nil {
+					blockedBy = []int{}
+				}
+				return blockedBy, nil
+			},
+		},
+		"blocked": &graphql.Field{
+			Type:        graphql.NewNonNull(graphql.Boolean),
+			Description: "True if some of tasks blocking task are not done.",
+		},
+		"projectId": &graphql.Field{
+			Type:        graphql.Int,
+			Description: "Id of project of task, null if task isn't in project.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				projectId := p.Source.(models.Task).ProjectId
+				if projectId == 0 {
+					return nil, nil
+				}
+				return projectId, nil
+			},
+		},
+		"deletedAt": &graphql.Field{
+			Type:        graphql.DateTime,
+			Description: "Time of deletion of task in trash, null for task which isn't deleted.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				deletedAt := p.Source.(models.Task).DeletedAt
+				if deletedAt == nil {
+					return nil, nil
+				}
+				return *deletedAt, nil
+			},
+		},
+		"owner": &graphql.Field{Type: graphql.String, Description: "User who created task."},
+		"shares": &graphql.Field{
+			Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(shareType))),
+			Description: "Users whom owner shared task with.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				shares := p.Source.(models.Task).Shares
+				if shares == nil {
+					shares = []models.Share{}
+				}
+				return shares, nil
+			},
+		},
+	},
+})
+
+// shareType GraphQL type for models.Share.
+var shareType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Share",
+	Fields: graphql.Fields{
+		"user": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"access": &graphql.Field{
+			Type:        graphql.NewNonNull(graphql.String),
+			Description: "Access of user: read or write.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return string(p.Source.(models.Share).Access), nil
+			},
+		},
+	},
+})
+
+// shareInputType GraphQL input type for models.Share.
+var shareInputType = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name: "ShareInput",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"user":   &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+		"access": &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+	},
+})
+
+// progressType GraphQL type for models.Progress.
+var progressType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Progress",
+	Fields: graphql.Fields{
+		"done":  &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		"total": &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+	},
+})
+
+// projectType GraphQL type for models.Project.
+var projectType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Project",
+	Fields: graphql.Fields{
+		"id":   &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		"name": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"archived": &graphql.Field{
+			Type:        graphql.NewNonNull(graphql.Boolean),
+			Description: "Tasks of archived project are hidden from other queries of tasks.",
+		},
+		"owner": &graphql.Field{Type: graphql.String, Description: "User who created project, only owner changes it."},
+	},
+})
+
+// attachmentType GraphQL type for models.Attachment, content is downloaded by REST API.
+var attachmentType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Attachment",
+	Fields: graphql.Fields{
+		"id":          &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		"taskId":      &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		"name":        &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"contentType": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"size":        &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		"time":        &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime)},
+	},
+})
+
+// commentType GraphQL type for models.Comment.
+var commentType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Comment",
+	Fields: graphql.Fields{
+		"id":     &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		"taskId": &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		"author": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"text":   &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"time":   &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime)},
+	},
+})
+
+// changeType GraphQL type for models.Change.
+var changeType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Change",
+	Fields: graphql.Fields{
+		"field": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"old":   &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"new":   &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+	},
+})
+
+// activityType GraphQL type for models.Activity.
+var activityType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Activity",
+	Fields: graphql.Fields{
+		"id":     &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		"taskId": &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		"actor":  &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"action": &graphql.Field{
+			Type:        graphql.NewNonNull(graphql.String),
+			Description: "One of created, updated or deleted.",
+		},
+		"changes": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(changeType))),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				changes := p.Source.(models.Activity).Changes
+				if changes == nil {
+					changes = []models.Change{}
+				}
+				return changes, nil
+			},
+		},
+		"time": &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime)},
+	},
+})
+
+// commentPage page of comments with total count of comments of task.
+type commentPage struct {
+	Total    int              `json:"total"`
+	Comments []models.Comment `json:"comments"`
+}
+
+// commentPageType GraphQL type for commentPage.
+var commentPageType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "CommentPage",
+	Fields: graphql.Fields{
+		"total":    &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		"comments": &graphql.Field{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(commentType)))},
+	},
+})
+
+// activityPage page of activity log with total count of entries of task.
+type activityPage struct {
+	Total    int               `json:"total"`
+	Activity []models.Activity `json:"activity"`
+}
+
+// activityPageType GraphQL type for activityPage.
+var activityPageType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "ActivityPage",
+	Fields: graphql.Fields{
+		"total":    &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		"activity": &graphql.Field{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(activityType)))},
+	},
+})
+
+// pageArgs arguments of paginated queries.
+var pageArgs = graphql.FieldConfigArgument{
+	"id":     &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+	"offset": &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 0},
+	"limit":  &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: models.DefaultPageLimit},
+}
+
+// pageArg returns offset and limit of page from arguments.
+func pageArg(p graphql.ResolveParams) (int, int, error) {
+	offset, limit := p.Args["offset"].(int), p.Args["limit"].(int)
+	if offset < 0 {
+		return 0, 0, fmt.Errorf("offset must be non-negative, got %d", offset)
+	}
+	if limit < 1 || limit > models.MaxPageLimit {
+		return 0, 0, fmt.Errorf("limit must be in 1..%d, got %d", models.MaxPageLimit, limit)
+	}
+	return offset, limit, nil
+}
+
+// sorted returns tasks sorted by id.
+func sorted(tasks []models.Task) []models.Task {
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].Id < tasks[j].Id })
+	return tasks
+}
+
+// sortedByDue returns tasks sorted by due date, then by id.
+func sortedByDue(tasks []models.Task) []models.Task {
+	sort.Slice(tasks, func(i, j int) bool {
+		if tasks[i].Due.Equal(tasks[j].Due) {
+			return tasks[i].Id < tasks[j].Id
+		}
+		return tasks[i].Due.Before(tasks[j].Due)
+	})
+	return tasks
+}
+
+// dateTimeArg returns value of DateTime argument, zero time if argument is missing.
+func dateTimeArg(arg interface{}) time.Time {
+	if v, ok := arg.(*time.Time); ok && v != nil {
+		return *v
+	} else if v, ok := arg.(time.Time); ok {
+		return v
+	}
+	return time.Time{}
+}
+
+// NewSchema function returns GraphQL schema with resolvers using repository.
+func NewSchema(store models.Repository) (graphql.Schema, error) {
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"tasks": &graphql.Field{
+				Type:        graphql.NewList(graphql.NewNonNull(taskType)),
+				Description: "All tasks sorted by id, order \"dependency\" sorts blockers before tasks blocked by them.",
+				Args: graphql.FieldConfigArgument{
+					"order": &graphql.ArgumentConfig{Type: graphql.String},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					switch order, _ := p.Args["order"].(string); order {
+					case "":
+						return sorted(repository(p, store).GetAllTasks()), nil
+					case "dependency":
+						return models.OrderByDependency(repository(p, store).GetAllTasks()), nil
+					default:
+						return nil, fmt.Errorf("unknown order %q, expect dependency", order)
+					}
+				},
+			},
+			"task": &graphql.Field{
+				Type:        taskType,
+				Description: "Task by id.",
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					task, err := repository(p, store).GetTask(p.Args["id"].(int))
+					if err != nil {
+						return nil, err
+					}
+					return task, nil
+				},
+			},
+			"tasksByTag": &graphql.Field{
+				Type:        graphql.NewList(graphql.NewNonNull(taskType)),
+				Description: "Tasks which have a tag matching the given tag pattern, sorted by id.",
+				Args: graphql.FieldConfigArgument{
+					"tag": &graphql.ArgumentConfig{
+						Type:        graphql.NewNonNull(graphql.String),
+						Description: `Tag pattern: "*" matches any characters within one level of tag, "**" matches any levels.`,
+					},
+					"recursive": &graphql.ArgumentConfig{
+						Type:         graphql.Boolean,
+						DefaultValue: false,
+						Description:  "Include descendants of the tag, like work/backend for work.",
+					},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					tag := p.Args["tag"].(string)
+					if p.Args["recursive"].(bool) {
+						tag = models.TagTree(tag)
+					}
+					return sorted(repository(p, store).GetTasksByTag(tag)), nil
+				},
+			},
+			"tasksByDueDate": &graphql.Field{
+				Type:        graphql.NewList(graphql.NewNonNull(taskType)),
+				Description: "Tasks which have the given due date, sorted by id.",
+				Args: graphql.FieldConfigArgument{
+					"year":  &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+					"month": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+					"day":   &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					month := p.Args["month"].(int)
+					if month < int(time.January) || month > int(time.December) {
+						return nil, fmt.Errorf("month must be in 1..12, got %d", month)
+					}
+					return sorted(repository(p, store).GetTasksByDueDate(p.Args["year"].(int), time.Month(month), p.Args["day"].(int))), nil
+				},
+			},
+			"tasksByDueRange": &graphql.Field{
+				Type:        graphql.NewList(graphql.NewNonNull(taskType)),
+				Description: "Tasks which have due date in range, sorted by due date.",
+				Args: graphql.FieldConfigArgument{
+					"from": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.DateTime)},
+					"to":   &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.DateTime)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					from, to := dateTimeArg(p.Args["from"]), dateTimeArg(p.Args["to"])
+					if to.Before(from) {
+						return nil, fmt.Errorf("'to' must not be before 'from'")
+					}
+					return sortedByDue(repository(p, store).GetTasksByDueRange(from, to)), nil
+				},
+			},
+			"children": &graphql.Field{
+				Type:        graphql.NewList(graphql.NewNonNull(taskType)),
+				Description: "Subtasks of task by id, sorted by id.",
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return repository(p, store).GetChildren(p.Args["id"].(int))
+				},
+			},
+			"projects": &graphql.Field{
+				Type:        graphql.NewList(graphql.NewNonNull(projectType)),
+				Description: "All projects sorted by id.",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return repository(p, store).GetAllProjects(), nil
+				},
+			},
+			"project": &graphql.Field{
+				Type:        projectType,
+				Description: "Project by id.",
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return repository(p, store).GetProject(p.Args["id"].(int))
+				},
+			},
+			"projectTasks": &graphql.Field{
+				Type:        graphql.NewList(graphql.NewNonNull(taskType)),
+				Description: "Tasks of project by id sorted by id, filtered by tag pattern or by due date \"yyyy-mm-dd\".",
+				Args: graphql.FieldConfigArgument{
+					"id":        &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+					"tag":       &graphql.ArgumentConfig{Type: graphql.String},
+					"recursive": &graphql.ArgumentConfig{Type: graphql.Boolean, DefaultValue: false},
+					"due":       &graphql.ArgumentConfig{Type: graphql.String},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					id := p.Args["id"].(int)
+					tag, _ := p.Args["tag"].(string)
+					due, _ := p.Args["due"].(string)
+
+					var (
+						tasks []models.Task
+						err   error
+					)
+					switch {
+					case tag != "" && due != "":
+						return nil, fmt.Errorf("expect only one of 'tag' and 'due'")
+					case tag != "":
+						if p.Args["recursive"].(bool) {
+							tag = models.TagTree(tag)
+						}
+						tasks, err = repository(p, store).GetProjectTasksByTag(id, tag)
+					case due != "":
+						date, parseErr := time.Parse(models.DateLayout, due)
+						if parseErr != nil {
+							return nil, fmt.Errorf("bad 'due': %w", parseErr)
+						}
+						tasks, err = repository(p, store).GetProjectTasksByDueDate(id, date.Year(), date.Month(), date.Day())
+					default:
+						tasks, err = repository(p, store).GetProjectTasks(id)
+					}
+					if err != nil {
+						return nil, err
+					}
+					return sorted(tasks), nil
+				},
+			},
+			"attachments": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(attachmentType))),
+				Description: "Attachments of task by id in order of upload.",
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return repository(p, store).GetAttachments(p.Args["id"].(int))
+				},
+			},
+			"comments": &graphql.Field{
+				Type:        graphql.NewNonNull(commentPageType),
+				Description: "Page of comments of task by id in chronological order.",
+				Args:        pageArgs,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					offset, limit, err := pageArg(p)
+					if err != nil {
+						return nil, err
+					}
+					comments, total, err := repository(p, store).GetComments(p.Args["id"].(int), offset, limit)
+					if err != nil {
+						return nil, err
+					}
+					return commentPage{Total: total, Comments: comments}, nil
+				},
+			},
+			"activity": &graphql.Field{
+				Type:        graphql.NewNonNull(activityPageType),
+				Description: "Page of activity log of task by id in chronological order.",
+				Args:        pageArgs,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					offset, limit, err := pageArg(p)
+					if err != nil {
+						return nil, err
+					}
+					entries, total, err := repository(p, store).GetActivity(p.Args["id"].(int), offset, limit)
+					if err != nil {
+						return nil, err
+					}
+					return activityPage{Total: total, Activity: entries}, nil
+				},
+			},
+			"searchTasks": &graphql.Field{
+				Type:        graphql.NewList(graphql.NewNonNull(taskType)),
+				Description: "Tasks whose text and tags match all words of the query by prefix, ordered by relevance.",
+				Args: graphql.FieldConfigArgument{
+					"q": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return repository(p, store).SearchTasks(p.Args["q"].(string)), nil
+				},
+			},
+			"trash": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(taskType))),
+				Description: "Deleted tasks in trash sorted by id.",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return repository(p, store).GetTrash(), nil
+				},
+			},
+		},
+	})
+
+	mutation := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Mutation",
+		Fields: graphql.Fields{
+			"createTask": &graphql.Field{
+				Type:        graphql.NewNonNull(taskType),
+				Description: "Creates a new task and returns it.",
+				Args: graphql.FieldConfigArgument{
+					"text":      &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+					"tags":      &graphql.ArgumentConfig{Type: graphql.NewList(graphql.NewNonNull(graphql.String))},
+					"due":       &graphql.ArgumentConfig{Type: graphql.DateTime},
+					"rrule":     &graphql.ArgumentConfig{Type: graphql.String},
+					"parentId":  &graphql.ArgumentConfig{Type: graphql.Int},
+					"projectId": &graphql.ArgumentConfig{Type: graphql.Int},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					repo := repository(p, store)
+					var tags []string
+					if list, ok := p.Args["tags"].([]interface{}); ok {
+						for _, tag := range list {
+							tags = append(tags, tag.(string))
+						}
+					}
+					due := dateTimeArg(p.Args["due"])
+					rrule, _ := p.Args["rrule"].(string)
+					if err := recurrence.Validate(rrule, due); err != nil {
+						return nil, err
+					}
+					parentId, _ := p.Args["parentId"].(int)
+					if parentId != 0 {
+						if _, err := repo.GetTask(parentId); err != nil {
+							return nil, fmt.Errorf("parent %w", err)
+						}
+					}
+					projectId, _ := p.Args["projectId"].(int)
+					if projectId != 0 {
+						if _, err := repo.GetProject(projectId); err != nil {
+							return nil, err
+						}
+					}
+
+					id, err := repo.CreateTask(models.Task{Text: p.Args["text"].(string), Tags: tags, Due: due, RRule: rrule, ParentId: parentId, ProjectId: projectId})
+					if err != nil {
+						return nil, err
+					}
+					task, err := repo.GetTask(id)
+					if err != nil {
+						return nil, err
+					}
+					return task, nil
+				},
+			},
+			"completeTask": &graphql.Field{
+				Type:        taskType,
+				Description: "Completes task by id, returns the next occurrence of recurring task or null.",
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					repo := repository(p, store)
+					next, ok, err := recurrence.Complete(repo, p.Args["id"].(int))
+					if err != nil || !ok {
+						return nil, err
+					}
+					return next, nil
+				},
+			},
+			"setParent": &graphql.Field{
+				Type:        graphql.NewNonNull(taskType),
+				Description: "Moves task by id under another parent, null parent makes it top level task.",
+				Args: graphql.FieldConfigArgument{
+					"id":       &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+					"parentId": &graphql.ArgumentConfig{Type: graphql.Int},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					repo := repository(p, store)
+					task, err := repo.GetTask(p.Args["id"].(int))
+					if err != nil {
+						return nil, err
+					}
+					task.ParentId, _ = p.Args["parentId"].(int)
+					if err = repo.UpdateTask(task); err != nil {
+						return nil, err
+					}
+					return repo.GetTask(task.Id)
+				},
+			},
+			"setProject": &graphql.Field{
+				Type:        graphql.NewNonNull(taskType),
+				Description: "Moves task by id to another project, null project takes it out of project.",
+				Args: graphql.FieldConfigArgument{
+					"id":        &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+					"projectId": &graphql.ArgumentConfig{Type: graphql.Int},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					repo := repository(p, store)
+					task, err := repo.GetTask(p.Args["id"].(int))
+					if err != nil {
+						return nil, err
+					}
+					task.ProjectId, _ = p.Args["projectId"].(int)
+					if err = repo.UpdateTask(task); err != nil {
+						return nil, err
+					}
+					return repo.GetTask(task.Id)
+				},
+			},
+			"createProject": &graphql.Field{
+				Type:        graphql.NewNonNull(projectType),
+				Description: "Creates a new project.",
+				Args: graphql.FieldConfigArgument{
+					"name": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					repo := repository(p, store)
+					name := p.Args["name"].(string)
+					if name == "" {
+						return nil, fmt.Errorf("expect name of project")
+					}
+					return repo.GetProject(repo.CreateProject(models.Project{Name: name}))
+				},
+			},
+			"updateProject": &graphql.Field{
+				Type:        graphql.NewNonNull(projectType),
+				Description: "Renames project by id and archives it, archiving hides tasks of project.",
+				Args: graphql.FieldConfigArgument{
+					"id":       &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+					"name":     &graphql.ArgumentConfig{Type: graphql.String},
+					"archived": &graphql.ArgumentConfig{Type: graphql.Boolean},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					repo := repository(p, store)
+					project, err := repo.GetProject(p.Args["id"].(int))
+					if err != nil {
+						return nil, err
+					}
+					if name, ok := p.Args["name"].(string); ok && name != "" {
+						project.Name = name
+					}
+					if archived, ok := p.Args["archived"].(bool); ok {
+						project.Archived = archived
+					}
+					if err = repo.UpdateProject(project); err != nil {
+						return nil, err
+					}
+					return project, nil
+				},
+			},
+			"deleteProject": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.Boolean),
+				Description: "Deletes project by id, its tasks stay without project.",
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					repo := repository(p, store)
+					if _, err := repo.DeleteProject(p.Args["id"].(int)); err != nil {
+						return false, err
+					}
+					return true, nil
+				},
+			},
+			"addDependencies": &graphql.Field{
+				Type:        graphql.NewNonNull(taskType),
+				Description: "Makes task by id blocked by other tasks.",
+				Args: graphql.FieldConfigArgument{
+					"id":        &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+					"blockedBy": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(graphql.Int)))},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					repo := repository(p, store)
+					var blockers []int
+					for _, blocker := range p.Args["blockedBy"].([]interface{}) {
+						blockers = append(blockers, blocker.(int))
+					}
+					id := p.Args["id"].(int)
+					if err := repo.AddDependencies(id, blockers); err != nil {
+						return nil, err
+					}
+					return repo.GetTask(id)
+				},
+			},
+			"removeDependency": &graphql.Field{
+				Type:        graphql.NewNonNull(taskType),
+				Description: "Makes task by id not blocked by another task.",
+				Args: graphql.FieldConfigArgument{
+					"id":      &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+					"blocker": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					repo := repository(p, store)
+					id := p.Args["id"].(int)
+					if err := repo.RemoveDependency(id, p.Args["blocker"].(int)); err != nil {
+						return nil, err
+					}
+					return repo.GetTask(id)
+				},
+			},
+			"addComment": &graphql.Field{
+				Type:        graphql.NewNonNull(commentType),
+				Description: "Adds comment of actor of request to task by id.",
+				Args: graphql.FieldConfigArgument{
+					"id":   &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+					"text": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					repo := repository(p, store)
+					text := p.Args["text"].(string)
+					if strings.TrimSpace(text) == "" {
+						return nil, fmt.Errorf("expect text of comment")
+					}
+					return repo.AddComment(models.Comment{TaskId: p.Args["id"].(int), Author: activity.ActorFrom(p.Context), Text: text})
+				},
+			},
+			"deleteTask": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.Boolean),
+				Description: "Moves task by id with its subtasks to trash.",
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					repo := repository(p, store)
+					if err := repo.TrashTask(p.Args["id"].(int)); err != nil {
+						return false, err
+					}
+					return true, nil
+				},
+			},
+			"restoreTask": &graphql.Field{
+				Type:        graphql.NewNonNull(taskType),
+				Description: "Restores task by id with its subtasks from trash.",
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					repo := repository(p, store)
+					if _, err := repo.RestoreTask(p.Args["id"].(int)); err != nil {
+						return nil, err
+					}
+					return repo.GetTask(p.Args["id"].(int))
+				},
+			},
+			"shareTask": &graphql.Field{
+				Type:        graphql.NewNonNull(taskType),
+				Description: "Replaces users whom task by id is shared with, only owner shares task.",
+				Args: graphql.FieldConfigArgument{
+					"id":     &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+					"shares": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(shareInputType)))},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					repo := repository(p, store)
+					var shares []models.Share
+					for _, share := range p.Args["shares"].([]interface{}) {
+						fields := share.(map[string]interface{})
+						shares = append(shares, models.Share{User: fields["user"].(string), Access: models.Access(fields["access"].(string))})
+					}
+					if err := models.ValidateShares(shares); err != nil {
+						return nil, err
+					}
+					id := p.Args["id"].(int)
+					if err := repo.ShareTask(id, shares); err != nil {
+						return nil, err
+					}
+					return repo.GetTask(id)
+				},
+			},
+			"deleteAllTasks": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.Boolean),
+				Description: "Moves all tasks to trash.",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					repo := repository(p, store)
+					if err := repo.TrashAllTasks(); err != nil {
+						return false, err
+					}
+					return true, nil
+				},
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{Query: query, Mutation: mutation})
+}
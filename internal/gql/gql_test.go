@@ -0,0 +1,218 @@
+package gql
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/White-AK111/REST/config"
+	"github.com/White-AK111/REST/internal/auth"
+	"github.com/White-AK111/REST/internal/models"
+	"github.com/White-AK111/REST/internal/models/inmemory"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// response it's a response of GraphQL endpoint.
+type response struct {
+	Data   map[string]json.RawMessage `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// newHandler returns handler of GraphQL endpoint over in-memory store with users alice and bob authenticated
+// by tokens "alice-token" and "bob-token".
+func newHandler(t *testing.T) http.Handler {
+	t.Helper()
+	cfg := &config.Config{}
+	cfg.Auth.Users = []config.User{{Name: "alice", Token: "alice-token"}, {Name: "bob", Token: "bob-token"}}
+	users, err := auth.New(cfg)
+	if err != nil {
+		t.Fatalf("auth.New: %s", err)
+	}
+	h, err := NewHandler(inmemory.NewStorage(models.RejectSubtasks), users)
+	if err != nil {
+		t.Fatalf("NewHandler: %s", err)
+	}
+	return h
+}
+
+// do posts query with variables to handler on behalf of user and returns response.
+func do(t *testing.T, h http.Handler, user, query string, variables map[string]interface{}) response {
+	t.Helper()
+	body, _ := json.Marshal(map[string]interface{}{"query": query, "variables": variables})
+	req := httptest.NewRequest(http.MethodPost, "/graphql", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+user+"-token")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("query got %d: %s", rec.Code, rec.Body)
+	}
+	var resp response
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("bad response %s: %s", rec.Body, err)
+	}
+	return resp
+}
+
+// data posts query which must succeed and decodes field of its data into v.
+func data(t *testing.T, h http.Handler, user, query string, variables map[string]interface{}, field string, v interface{}) {
+	t.Helper()
+	resp := do(t, h, user, query, variables)
+	if len(resp.Errors) != 0 {
+		t.Fatalf("query %s returned errors %+v", query, resp.Errors)
+	}
+	if err := json.Unmarshal(resp.Data[field], v); err != nil {
+		t.Fatalf("bad %s %s: %s", field, resp.Data[field], err)
+	}
+}
+
+// fails posts query which must fail with error containing message.
+func fails(t *testing.T, h http.Handler, user, query string, variables map[string]interface{}, message string) {
+	t.Helper()
+	resp := do(t, h, user, query, variables)
+	if len(resp.Errors) == 0 || !strings.Contains(resp.Errors[0].Message, message) {
+		t.Errorf("query %s returned errors %+v, want error %q", query, resp.Errors, message)
+	}
+}
+
+// task it's a task in response.
+type task struct {
+	Id        int      `json:"id"`
+	Text      string   `json:"text"`
+	Tags      []string `json:"tags"`
+	Due       *string  `json:"due"`
+	RRule     *string  `json:"rrule"`
+	ParentId  *int     `json:"parentId"`
+	Done      bool     `json:"done"`
+	BlockedBy []int    `json:"blockedBy"`
+	Blocked   bool     `json:"blocked"`
+	Owner     string   `json:"owner"`
+}
+
+const create = `mutation($text: String!, $tags: [String!], $due: DateTime, $rrule: String, $parentId: Int) {
+	createTask(text: $text, tags: $tags, due: $due, rrule: $rrule, parentId: $parentId) {
+		id text tags due rrule parentId done blockedBy blocked owner
+	}
+}`
+
+func TestTasks(t *testing.T) {
+	h := newHandler(t)
+	var standup, report task
+	data(t, h, "alice", create, map[string]interface{}{
+		"text": "standup", "tags": []string{"work"}, "due": "2030-01-01T09:00:00Z", "rrule": "FREQ=DAILY;COUNT=2",
+	}, "createTask", &standup)
+	if standup.Text != "standup" || standup.Owner != "alice" || standup.Due == nil || *standup.Due != "2030-01-01T09:00:00Z" ||
+		standup.RRule == nil || standup.ParentId != nil || len(standup.BlockedBy) != 0 {
+		t.Errorf("created task is %+v", standup)
+	}
+	data(t, h, "alice", create, map[string]interface{}{"text": "report", "tags": []string{"work/docs"}}, "createTask", &report)
+
+	var tasks []task
+	data(t, h, "alice", `{ tasksByTag(tag: "work", recursive: true) { id } }`, nil, "tasksByTag", &tasks)
+	if len(tasks) != 2 || tasks[0].Id != standup.Id || tasks[1].Id != report.Id {
+		t.Errorf("tasks by tag are %+v, want both tasks by id", tasks)
+	}
+	data(t, h, "alice", `{ tasksByDueDate(year: 2030, month: 1, day: 1) { id } }`, nil, "tasksByDueDate", &tasks)
+	if len(tasks) != 1 || tasks[0].Id != standup.Id {
+		t.Errorf("tasks by due date are %+v, want %d", tasks, standup.Id)
+	}
+
+	var next task
+	data(t, h, "alice", `mutation($id: Int!) { completeTask(id: $id) { id due rrule } }`,
+		map[string]interface{}{"id": standup.Id}, "completeTask", &next)
+	if next.Id == standup.Id || next.Due == nil || *next.Due != "2030-01-02T09:00:00Z" || next.RRule != nil {
+		t.Errorf("next occurrence is %+v, want the last occurrence due day after", next)
+	}
+	var completed task
+	data(t, h, "alice", `query($id: Int!) { task(id: $id) { done rrule } }`,
+		map[string]interface{}{"id": standup.Id}, "task", &completed)
+	if !completed.Done || completed.RRule != nil {
+		t.Errorf("completed task is %+v, want it done without rule", completed)
+	}
+
+	fails(t, h, "alice", create, map[string]interface{}{"text": "bad", "rrule": "FREQ=HOURLY", "due": "2030-01-01T09:00:00Z"}, "FREQ")
+	fails(t, h, "alice", create, map[string]interface{}{"text": "orphan", "parentId": 100}, "parent")
+	fails(t, h, "alice", `{ tasksByDueDate(year: 2030, month: 13, day: 1) { id } }`, nil, "month")
+	fails(t, h, "alice", `{ tasks(order: "random") { id } }`, nil, "unknown order")
+}
+
+func TestSubtasksAndDependencies(t *testing.T) {
+	h := newHandler(t)
+	var release, changelog, review task
+	data(t, h, "alice", create, map[string]interface{}{"text": "release"}, "createTask", &release)
+	data(t, h, "alice", create, map[string]interface{}{"text": "changelog", "parentId": release.Id}, "createTask", &changelog)
+	data(t, h, "alice", create, map[string]interface{}{"text": "review"}, "createTask", &review)
+	if changelog.ParentId == nil || *changelog.ParentId != release.Id {
+		t.Errorf("subtask is %+v, want parent %d", changelog, release.Id)
+	}
+
+	var blocked task
+	data(t, h, "alice", `mutation($id: Int!, $blockers: [Int!]!) { addDependencies(id: $id, blockedBy: $blockers) { blockedBy blocked } }`,
+		map[string]interface{}{"id": release.Id, "blockers": []int{review.Id}}, "addDependencies", &blocked)
+	if !blocked.Blocked || len(blocked.BlockedBy) != 1 || blocked.BlockedBy[0] != review.Id {
+		t.Errorf("blocked task is %+v, want it blocked by %d", blocked, review.Id)
+	}
+	var ordered []task
+	data(t, h, "alice", `{ tasks(order: "dependency") { id } }`, nil, "tasks", &ordered)
+	if len(ordered) != 3 || ordered[0].Id == release.Id {
+		t.Errorf("tasks in order of dependencies are %+v, want blocker before blocked task", ordered)
+	}
+
+	complete := `mutation($id: Int!) { completeTask(id: $id) { id } }`
+	fails(t, h, "alice", complete, map[string]interface{}{"id": release.Id}, "")
+	data(t, h, "alice", complete, map[string]interface{}{"id": review.Id}, "completeTask", new(*task))
+	fails(t, h, "alice", complete, map[string]interface{}{"id": release.Id}, "")
+	data(t, h, "alice", complete, map[string]interface{}{"id": changelog.Id}, "completeTask", new(*task))
+	data(t, h, "alice", complete, map[string]interface{}{"id": release.Id}, "completeTask", new(*task))
+
+	var children []task
+	data(t, h, "alice", `query($id: Int!) { children(id: $id) { id done } }`,
+		map[string]interface{}{"id": release.Id}, "children", &children)
+	if len(children) != 1 || children[0].Id != changelog.Id || !children[0].Done {
+		t.Errorf("children of completed task are %+v, want done subtask kept", children)
+	}
+}
+
+func TestScoping(t *testing.T) {
+	h := newHandler(t)
+	var report task
+	data(t, h, "alice", create, map[string]interface{}{"text": "report"}, "createTask", &report)
+	var project struct {
+		Id    int    `json:"id"`
+		Owner string `json:"owner"`
+	}
+	data(t, h, "alice", `mutation { createProject(name: "home") { id owner } }`, nil, "createProject", &project)
+	if project.Owner != "alice" {
+		t.Errorf("project is owned by %q, want alice", project.Owner)
+	}
+
+	var tasks []task
+	data(t, h, "bob", `{ tasks { id } }`, nil, "tasks", &tasks)
+	if len(tasks) != 0 {
+		t.Errorf("bob sees tasks %+v, want none", tasks)
+	}
+	id := map[string]interface{}{"id": report.Id}
+	fails(t, h, "bob", `mutation($id: Int!) { completeTask(id: $id) { id } }`, id, "")
+	fails(t, h, "bob", `mutation($id: Int!) { deleteTask(id: $id) }`, id, "")
+	fails(t, h, "bob", `mutation($id: Int!) { updateProject(id: $id, name: "mine") { id } }`,
+		map[string]interface{}{"id": project.Id}, "")
+
+	data(t, h, "alice", `mutation($id: Int!) { shareTask(id: $id, shares: [{user: "bob", access: "read"}]) { id } }`,
+		id, "shareTask", new(task))
+	data(t, h, "bob", `{ tasks { id owner } }`, nil, "tasks", &tasks)
+	if len(tasks) != 1 || tasks[0].Id != report.Id || tasks[0].Owner != "alice" {
+		t.Errorf("bob sees tasks %+v, want task shared by alice", tasks)
+	}
+	fails(t, h, "bob", `mutation($id: Int!) { completeTask(id: $id) { id } }`, id, "")
+
+	req := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(`{"query":"{ tasks { id } }"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized || rec.Header().Get("WWW-Authenticate") != auth.Challenge {
+		t.Errorf("query without token got %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
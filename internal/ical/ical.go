@@ -0,0 +1,343 @@
+// Package ical provides rendering of tasks as iCalendar (RFC 5545) feed and parsing of .ics files into tasks.
+// Tasks are rendered as VTODO (or VEVENT) components with stable UIDs derived from task ids.
+package ical
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/White-AK111/REST/internal/models"
+	"io"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	ComponentTodo  = "VTODO"  // task with DUE property
+	ComponentEvent = "VEVENT" // event with DTSTART property
+)
+
+const (
+	ContentType   = "text/calendar; charset=utf-8"
+	DefaultDomain = "rest.tasks" // right part of UID
+	prodId        = "-//White-AK111//REST tasks//EN"
+	dateTimeUTC   = "20060102T150405Z"
+	dateTimeLocal = "20060102T150405"
+	date          = "20060102"
+	maxLineOctets = 75
+)
+
+// Options options of rendering feed.
+type Options struct {
+	Component string    // ComponentTodo or ComponentEvent, default ComponentTodo
+	Domain    string    // domain part of UIDs, default DefaultDomain
+	Name      string    // name of calendar shown by calendar apps
+	Stamp     time.Time // value of DTSTAMP, default current time
+}
+
+// ParseComponent function returns component by name from query, empty name means VTODO.
+func ParseComponent(name string) (string, error) {
+	switch strings.ToUpper(name) {
+	case "", "VTODO", "TODO":
+		return ComponentTodo, nil
+	case "VEVENT", "EVENT":
+		return ComponentEvent, nil
+	default:
+		return "", fmt.Errorf("unknown component %q, expect vtodo or vevent", name)
+	}
+}
+
+// UID returns stable unique identifier of task in calendar.
+func UID(id int, domain string) string {
+	if domain == "" {
+		domain = DefaultDomain
+	}
+	return fmt.Sprintf("task-%d@%s", id, domain)
+}
+
+// Encode writes calendar with tasks which have due date into w, tasks are sorted by id.
+func Encode(w io.Writer, tasks []models.Task, opts Options) error {
+	if opts.Component == "" {
+		opts.Component = ComponentTodo
+	}
+	if opts.Stamp.IsZero() {
+		opts.Stamp = time.Now()
+	}
+	stamp := opts.Stamp.UTC().Format(dateTimeUTC)
+
+	sorted := make([]models.Task, 0, len(tasks))
+	for _, task := range tasks {
+		if !task.Due.IsZero() {
+			sorted = append(sorted, task)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Id < sorted[j].Id })
+
+	lw := &lineWriter{w: bufio.NewWriter(w)}
+	lw.line("BEGIN:VCALENDAR")
+	lw.line("VERSION:2.0")
+	lw.line("PRODID:" + prodId)
+	lw.line("CALSCALE:GREGORIAN")
+	if opts.Name != "" {
+		lw.line("X-WR-CALNAME:" + escapeText(opts.Name))
+	}
+	for _, task := range sorted {
+		due := task.Due.UTC().Format(dateTimeUTC)
+		lw.line("BEGIN:" + opts.Component)
+		lw.line("UID:" + UID(task.Id, opts.Domain))
+		lw.line("DTSTAMP:" + stamp)
+		lw.line("SUMMARY:" + escapeText(task.Text))
+		if len(task.Tags) > 0 {
+			categories := make([]string, len(task.Tags))
+			for i, tag := range task.Tags {
+				categories[i] = escapeText(tag)
+			}
+			lw.line("CATEGORIES:" + strings.Join(categories, ","))
+		}
+		if opts.Component == ComponentEvent {
+			lw.line("DTSTART:" + due)
+		} else {
+			if task.RRule != "" {
+				// Recurrence set of VTODO is defined by DTSTART.
+				lw.line("DTSTART:" + due)
+			}
+			lw.line("DUE:" + due)
+		}
+		if task.RRule != "" {
+			lw.line("RRULE:" + task.RRule)
+		}
+		if task.ParentId != 0 {
+			lw.line("RELATED-TO;RELTYPE=PARENT:" + UID(task.ParentId, opts.Domain))
+		}
+		for _, blocker := range task.BlockedBy {
+			lw.line("RELATED-TO;RELTYPE=DEPENDS-ON:" + UID(blocker, opts.Domain))
+		}
+		if task.Done && opts.Component == ComponentTodo {
+			lw.line("STATUS:COMPLETED")
+		}
+		lw.line("END:" + opts.Component)
+	}
+	lw.line("END:VCALENDAR")
+
+	if lw.err != nil {
+		return lw.err
+	}
+	return lw.w.Flush()
+}
+
+// lineWriter writes content lines folded to 75 octets and terminated by CRLF.
+type lineWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+// line writes one content line, long lines are folded without splitting of UTF-8 characters.
+func (lw *lineWriter) line(s string) {
+	if lw.err != nil {
+		return
+	}
+
+	limit := maxLineOctets
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		if _, lw.err = lw.w.WriteString(s[:cut] + "\r\n "); lw.err != nil {
+			return
+		}
+		s = s[cut:]
+		// continuation line starts with space, it's part of the limit
+		limit = maxLineOctets - 1
+	}
+	_, lw.err = lw.w.WriteString(s + "\r\n")
+}
+
+// escapeText escapes TEXT value by RFC 5545 section 3.3.11.
+func escapeText(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+	return r.Replace(s)
+}
+
+// unescapeText reverts escapeText.
+func unescapeText(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+			switch s[i] {
+			case 'n', 'N':
+				b.WriteByte('\n')
+			default:
+				b.WriteByte(s[i])
+			}
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// splitList splits TEXT list by unescaped commas.
+func splitList(s string) []string {
+	var (
+		parts []string
+		start int
+	)
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case ',':
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// property it's a parsed content line.
+type property struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+// parseProperty parses content line "NAME;PARAM=VALUE:value".
+func parseProperty(line string) (property, error) {
+	var p property
+
+	// Colon inside quoted parameter value doesn't end the name part.
+	inQuotes := false
+	colon := -1
+	for i := 0; i < len(line) && colon < 0; i++ {
+		switch line[i] {
+		case '"':
+			inQuotes = !inQuotes
+		case ':':
+			if !inQuotes {
+				colon = i
+			}
+		}
+	}
+	if colon < 0 {
+		return p, fmt.Errorf("bad content line %q", line)
+	}
+
+	p.value = line[colon+1:]
+	parts := strings.Split(line[:colon], ";")
+	p.name = strings.ToUpper(parts[0])
+	p.params = make(map[string]string, len(parts)-1)
+	for _, param := range parts[1:] {
+		kv := strings.SplitN(param, "=", 2)
+		if len(kv) == 2 {
+			p.params[strings.ToUpper(kv[0])] = strings.Trim(kv[1], `"`)
+		}
+	}
+	return p, nil
+}
+
+// parseDateTime parses DATE or DATE-TIME value, TZID parameter is used for local times.
+func parseDateTime(p property) (time.Time, error) {
+	value := strings.TrimSpace(p.value)
+	if p.params["VALUE"] == "DATE" || len(value) == len(date) {
+		return time.ParseInLocation(date, value, time.UTC)
+	}
+	if strings.HasSuffix(value, "Z") {
+		return time.Parse(dateTimeUTC, value)
+	}
+
+	loc := time.UTC
+	if tzid := p.params["TZID"]; tzid != "" {
+		l, err := time.LoadLocation(tzid)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("unknown TZID %q: %w", tzid, err)
+		}
+		loc = l
+	}
+	return time.ParseInLocation(dateTimeLocal, value, loc)
+}
+
+// Decode reads .ics file and returns tasks from VTODO and VEVENT components without ids.
+// DUE of VTODO or DTSTART of VEVENT become due of task, CATEGORIES become tags, RRULE becomes rule of task,
+// STATUS:COMPLETED of VTODO marks task done.
+func Decode(r io.Reader) ([]models.Task, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		tasks     []models.Task
+		current   *models.Task
+		component string
+		calendar  bool
+	)
+	for n, line := range lines {
+		if line == "" {
+			continue
+		}
+		p, err := parseProperty(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n+1, err)
+		}
+		value := strings.ToUpper(strings.TrimSpace(p.value))
+
+		switch {
+		case p.name == "BEGIN" && value == "VCALENDAR":
+			calendar = true
+		case p.name == "BEGIN" && (value == ComponentTodo || value == ComponentEvent) && current == nil:
+			current = &models.Task{}
+			component = value
+		case p.name == "END" && value == component && current != nil:
+			tasks = append(tasks, *current)
+			current = nil
+			component = ""
+		case current == nil:
+			continue
+		case p.name == "SUMMARY":
+			current.Text = unescapeText(p.value)
+		case p.name == "CATEGORIES":
+			for _, tag := range splitList(p.value) {
+				if tag = strings.TrimSpace(unescapeText(tag)); tag != "" {
+					current.Tags = append(current.Tags, tag)
+				}
+			}
+		case p.name == "DUE" || (p.name == "DTSTART" && component == ComponentEvent):
+			due, err := parseDateTime(p)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: bad %s: %w", n+1, p.name, err)
+			}
+			current.Due = due
+		case p.name == "RRULE":
+			current.RRule = strings.TrimSpace(p.value)
+		case p.name == "STATUS" && component == ComponentTodo:
+			current.Done = value == "COMPLETED"
+		}
+	}
+
+	if !calendar {
+		return nil, fmt.Errorf("expect BEGIN:VCALENDAR")
+	}
+	if current != nil {
+		return nil, fmt.Errorf("component %s is not closed", component)
+	}
+	return tasks, nil
+}
+
+// unfold reads content lines and joins folded lines.
+func unfold(r io.Reader) ([]string, error) {
+	var lines []string
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for sc.Scan() {
+		line := strings.TrimRight(sc.Text(), "\r")
+		if len(line) > 0 && (line[0] == ' ' || line[0] == '\t') && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, sc.Err()
+}
@@ -0,0 +1,190 @@
+package ical
+
+import (
+	"bytes"
+	"github.com/White-AK111/REST/internal/models"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+// stamp it's a DTSTAMP of rendered feeds.
+var stamp = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+// encode renders tasks with options and returns feed.
+func encode(t *testing.T, tasks []models.Task, opts Options) string {
+	t.Helper()
+	opts.Stamp = stamp
+	var buf bytes.Buffer
+	if err := Encode(&buf, tasks, opts); err != nil {
+		t.Fatalf("Encode: %s", err)
+	}
+	return buf.String()
+}
+
+// decode parses feed which must be valid.
+func decode(t *testing.T, feed string) []models.Task {
+	t.Helper()
+	tasks, err := Decode(strings.NewReader(feed))
+	if err != nil {
+		t.Fatalf("Decode: %s", err)
+	}
+	return tasks
+}
+
+// calendar returns calendar of content lines terminated by CRLF.
+func calendar(lines ...string) string {
+	return strings.Join(lines, "\r\n") + "\r\n"
+}
+
+func TestEncode(t *testing.T) {
+	due := time.Date(2024, 3, 1, 12, 30, 0, 0, time.FixedZone("MSK", 3*60*60))
+	tasks := []models.Task{
+		{Id: 3, Text: "standup", Due: due, RRule: "FREQ=DAILY;COUNT=5"},
+		{Id: 2, Text: "review; part 1, part 2", Tags: []string{"work", "a,b"}, Due: due, ParentId: 1, BlockedBy: []int{3}, Done: true},
+		{Id: 1, Text: "someday"},
+	}
+
+	want := calendar(
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:"+prodId,
+		"CALSCALE:GREGORIAN",
+		"X-WR-CALNAME:tasks\\, home",
+		"BEGIN:VTODO",
+		"UID:task-2@example.com",
+		"DTSTAMP:20240102T030405Z",
+		"SUMMARY:review\\; part 1\\, part 2",
+		"CATEGORIES:work,a\\,b",
+		"DUE:20240301T093000Z",
+		"RELATED-TO;RELTYPE=PARENT:task-1@example.com",
+		"RELATED-TO;RELTYPE=DEPENDS-ON:task-3@example.com",
+		"STATUS:COMPLETED",
+		"END:VTODO",
+		"BEGIN:VTODO",
+		"UID:task-3@example.com",
+		"DTSTAMP:20240102T030405Z",
+		"SUMMARY:standup",
+		"DTSTART:20240301T093000Z",
+		"DUE:20240301T093000Z",
+		"RRULE:FREQ=DAILY;COUNT=5",
+		"END:VTODO",
+		"END:VCALENDAR",
+	)
+	if got := encode(t, tasks, Options{Domain: "example.com", Name: "tasks, home"}); got != want {
+		t.Errorf("feed is\n%s\nwant\n%s", got, want)
+	}
+
+	events := encode(t, tasks, Options{Component: ComponentEvent})
+	if !strings.Contains(events, "BEGIN:VEVENT\r\nUID:task-2@"+DefaultDomain) || strings.Contains(events, "DUE:") ||
+		strings.Contains(events, "STATUS:") || strings.Count(events, "DTSTART:20240301T093000Z") != 2 {
+		t.Errorf("feed of events is\n%s\nwant events with DTSTART and without DUE and STATUS", events)
+	}
+}
+
+func TestEncodeFoldsLongLines(t *testing.T) {
+	text := strings.Repeat("задача ", 30)
+	feed := encode(t, []models.Task{{Id: 1, Text: text, Due: stamp}}, Options{})
+
+	for _, line := range strings.Split(strings.TrimSuffix(feed, "\r\n"), "\r\n") {
+		if len(line) > maxLineOctets {
+			t.Errorf("line %q has %d octets, want at most %d", line, len(line), maxLineOctets)
+		}
+		if !utf8.ValidString(line) {
+			t.Errorf("line %q splits UTF-8 character", line)
+		}
+	}
+	if tasks := decode(t, feed); len(tasks) != 1 || tasks[0].Text != text {
+		t.Errorf("decoded tasks are %+v, want folded summary unfolded", tasks)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	due := time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC)
+	tasks := []models.Task{
+		{Id: 1, Text: "review\nof \"code\"; \\ and, more", Tags: []string{"work", "a,b"}, Due: due, Done: true},
+		{Id: 2, Text: "standup", Due: due, RRule: "FREQ=WEEKLY;BYDAY=MO,WE"},
+	}
+	got := decode(t, encode(t, tasks, Options{}))
+	for i := range tasks {
+		tasks[i].Id = 0
+	}
+	if !reflect.DeepEqual(got, tasks) {
+		t.Errorf("decoded tasks are\n%+v\nwant\n%+v", got, tasks)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	moscow, err := time.LoadLocation("Europe/Moscow")
+	if err != nil {
+		t.Skipf("no time zone database: %s", err)
+	}
+	feed := calendar(
+		"BEGIN:VCALENDAR",
+		"BEGIN:VTODO",
+		"SUMMARY:local due",
+		"DUE;TZID=Europe/Moscow:20240301T093000",
+		"STATUS:NEEDS-ACTION",
+		"END:VTODO",
+		"BEGIN:VTODO",
+		"SUMMARY;LANGUAGE=en:all-day",
+		"DUE;VALUE=DATE:20240302",
+		"status:completed",
+		"END:VTODO",
+		"BEGIN:VEVENT",
+		"SUMMARY:meet",
+		"ing",
+		"DTSTART;X-NOTE=\"a:b\":20240303T100000Z",
+		"RRULE:FREQ=MONTHLY",
+		"STATUS:COMPLETED",
+		"END:VEVENT",
+		"BEGIN:VJOURNAL",
+		"SUMMARY:journal",
+		"END:VJOURNAL",
+		"END:VCALENDAR",
+	)
+	// continuation of folded line starts with space or tab
+	feed = strings.Replace(feed, "\r\ning", "\r\n\ting", 1)
+
+	want := []models.Task{
+		{Text: "local due", Due: time.Date(2024, 3, 1, 9, 30, 0, 0, moscow)},
+		{Text: "all-day", Due: time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC), Done: true},
+		{Text: "meeting", Due: time.Date(2024, 3, 3, 10, 0, 0, 0, time.UTC), RRule: "FREQ=MONTHLY"},
+	}
+	got := decode(t, feed)
+	if len(got) != len(want) {
+		t.Fatalf("decoded tasks are %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i].Text != want[i].Text || !got[i].Due.Equal(want[i].Due) || got[i].RRule != want[i].RRule || got[i].Done != want[i].Done {
+			t.Errorf("decoded task is %+v, want %+v", got[i], want[i])
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	for name, feed := range map[string]string{
+		"no calendar":      calendar("BEGIN:VTODO", "SUMMARY:task", "END:VTODO"),
+		"unclosed todo":    calendar("BEGIN:VCALENDAR", "BEGIN:VTODO", "SUMMARY:task", "END:VCALENDAR"),
+		"bad due":          calendar("BEGIN:VCALENDAR", "BEGIN:VTODO", "DUE:tomorrow", "END:VTODO", "END:VCALENDAR"),
+		"unknown TZID":     calendar("BEGIN:VCALENDAR", "BEGIN:VTODO", "DUE;TZID=Mars/Olympus:20240301T093000", "END:VTODO", "END:VCALENDAR"),
+		"bad content line": calendar("BEGIN:VCALENDAR", "BEGIN:VTODO", "SUMMARY", "END:VTODO", "END:VCALENDAR"),
+	} {
+		if _, err := Decode(strings.NewReader(feed)); err == nil {
+			t.Errorf("Decode of calendar with %s returned no error", name)
+		}
+	}
+}
+
+func TestParseComponent(t *testing.T) {
+	for name, want := range map[string]string{"": ComponentTodo, "todo": ComponentTodo, "VTODO": ComponentTodo, "event": ComponentEvent, "vevent": ComponentEvent} {
+		if got, err := ParseComponent(name); err != nil || got != want {
+			t.Errorf("ParseComponent(%q) returned %q, %v, want %q", name, got, err, want)
+		}
+	}
+	if _, err := ParseComponent("vjournal"); err == nil {
+		t.Errorf("ParseComponent accepted vjournal")
+	}
+}
@@ -0,0 +1,250 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// maxKeySetSize it's a max size of JSON Web Key Set loaded by URL.
+const maxKeySetSize = 1 << 20
+
+// minRefresh it's a min interval of loading of JSON Web Key Set by URL, so tokens with random key ids or
+// unavailable identity provider can't make service to load keys for each request.
+const minRefresh = 10 * time.Second
+
+// jwk it's a JSON Web Key (RFC 7517) of RSA or EC public key.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// key it's a parsed public key of set.
+type key struct {
+	kid    string
+	alg    string
+	public crypto.PublicKey
+}
+
+// KeySet it's a JSON Web Key Set of public keys of signatures. Keys of set loaded by URL are cached for TTL
+// and reloaded sooner if token has unknown key id, e.g. after rotation of keys by identity provider. Keys are
+// loaded by one request at a time without lock of set, cached keys are served while they are loaded again.
+type KeySet struct {
+	sync.Mutex
+	url         string
+	ttl         time.Duration
+	client      *http.Client
+	keys        []key
+	loadedAt    time.Time     // time of last successful loading
+	attemptedAt time.Time     // time of last loading
+	loadErr     error         // error of last loading
+	loading     chan struct{} // closed when loading in progress is done, nil if keys aren't being loaded
+}
+
+// bigInt decodes base64url big-endian integer.
+func bigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// parse returns public key of JSON Web Key, nil key for keys not usable for RS256 and ES256 signatures.
+func (k jwk) parse() (*key, error) {
+	if k.Use != "" && k.Use != "sig" {
+		return nil, nil
+	}
+	switch k.Kty {
+	case "RSA":
+		n, err := bigInt(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: n: %s", k.Kid, err)
+		}
+		e, err := bigInt(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: e: %s", k.Kid, err)
+		}
+		if n.Sign() <= 0 || !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("key %q: invalid RSA key", k.Kid)
+		}
+		return &key{kid: k.Kid, alg: k.Alg, public: &rsa.PublicKey{N: n, E: int(e.Int64())}}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, nil
+		}
+		x, err := bigInt(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: x: %s", k.Kid, err)
+		}
+		y, err := bigInt(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: y: %s", k.Kid, err)
+		}
+		if !elliptic.P256().IsOnCurve(x, y) {
+			return nil, fmt.Errorf("key %q: point isn't on curve P-256", k.Kid)
+		}
+		return &key{kid: k.Kid, alg: k.Alg, public: &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}}, nil
+	default:
+		return nil, nil
+	}
+}
+
+// parseKeySet parses JSON Web Key Set, keys not usable for RS256 and ES256 signatures are skipped.
+func parseKeySet(data []byte) ([]key, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("invalid JWKS: %s", err)
+	}
+	keys := make([]key, 0, len(set.Keys))
+	for _, k := range set.Keys {
+		parsed, err := k.parse()
+		if err != nil {
+			return nil, fmt.Errorf("invalid JWKS: %s", err)
+		}
+		if parsed != nil {
+			keys = append(keys, *parsed)
+		}
+	}
+	return keys, nil
+}
+
+// NewKeySet function initialize a new KeySet from JSON Web Key Set.
+func NewKeySet(data []byte) (*KeySet, error) {
+	keys, err := parseKeySet(data)
+	if err != nil {
+		return nil, err
+	}
+	return &KeySet{keys: keys}, nil
+}
+
+// LoadKeySet function initialize a new KeySet from JSON Web Key Set in file.
+func LoadKeySet(file string) (*KeySet, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return NewKeySet(data)
+}
+
+// RemoteKeySet function initialize a new KeySet loaded by URL on first use and cached for ttl.
+func RemoteKeySet(url string, ttl time.Duration) *KeySet {
+	return &KeySet{url: url, ttl: ttl, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// fetch loads keys by URL.
+func (ks *KeySet) fetch() ([]key, error) {
+	resp, err := ks.client.Get(ks.url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("JWKS %s responded with status %s", ks.url, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxKeySetSize))
+	if err != nil {
+		return nil, err
+	}
+	return parseKeySet(data)
+}
+
+// load starts loading of keys by URL unless keys are being loaded already and returns channel closed when
+// loading is done, keys loaded before are kept on error. Key set must be locked.
+func (ks *KeySet) load(now time.Time) <-chan struct{} {
+	if ks.loading != nil {
+		return ks.loading
+	}
+	done := make(chan struct{})
+	ks.loading, ks.attemptedAt = done, now
+	go func() {
+		keys, err := ks.fetch()
+		ks.Lock()
+		if err == nil {
+			ks.keys, ks.loadedAt = keys, now
+		}
+		ks.loadErr, ks.loading = err, nil
+		ks.Unlock()
+		close(done)
+	}()
+	return done
+}
+
+// wait waits for loading without lock of key set, key set must be locked.
+func (ks *KeySet) wait(done <-chan struct{}) {
+	ks.Unlock()
+	<-done
+	ks.Lock()
+}
+
+// find returns key by id usable for algorithm, key of token without id is found only if it's the single one.
+func (ks *KeySet) find(kid, alg string) (crypto.PublicKey, bool) {
+	var found []crypto.PublicKey
+	for _, k := range ks.keys {
+		if (kid != "" && k.kid != kid) || (k.alg != "" && k.alg != alg) {
+			continue
+		}
+		switch k.public.(type) {
+		case *rsa.PublicKey:
+			if alg != RS256 {
+				continue
+			}
+		case *ecdsa.PublicKey:
+			if alg != ES256 {
+				continue
+			}
+		}
+		found = append(found, k.public)
+	}
+	if len(found) != 1 {
+		return nil, false
+	}
+	return found[0], true
+}
+
+// Key returns public key by id for algorithm of token. Keys of set loaded by URL are reloaded if they are older
+// than TTL, meanwhile the old keys are served; keys are reloaded and waited for if key isn't found.
+func (ks *KeySet) Key(kid, alg string) (crypto.PublicKey, error) {
+	ks.Lock()
+	defer ks.Unlock()
+
+	now := time.Now()
+	if ks.url != "" && now.Sub(ks.loadedAt) > ks.ttl && now.Sub(ks.attemptedAt) > minRefresh {
+		done := ks.load(now)
+		if ks.loadedAt.IsZero() {
+			ks.wait(done)
+		}
+	}
+	if k, ok := ks.find(kid, alg); ok {
+		return k, nil
+	}
+	if ks.url != "" && (ks.loading != nil || now.Sub(ks.attemptedAt) > minRefresh) {
+		ks.wait(ks.load(now))
+		if k, ok := ks.find(kid, alg); ok {
+			return k, nil
+		}
+	}
+	if ks.url != "" && ks.loadErr != nil {
+		return nil, fmt.Errorf("%w: %q: %s", ErrUnknownKey, kid, ks.loadErr)
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnknownKey, kid)
+}
@@ -0,0 +1,336 @@
+// Package jwt verifies JSON Web Tokens (RFC 7519) signed by HS256, RS256 or ES256: signature is checked by secret
+// or by public key of JSON Web Key Set loaded from file or URL, then issuer, audience, expiration and not before
+// claims are checked. Claims of verified token are passed to handlers in context of request.
+package jwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/White-AK111/REST/config"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// Algorithms of signatures.
+const (
+	HS256 = "HS256"
+	RS256 = "RS256"
+	ES256 = "ES256"
+)
+
+// Errors of verification of token.
+var (
+	ErrMissing      = errors.New("bearer token is required")
+	ErrMalformed    = errors.New("token is malformed")
+	ErrAlgorithm    = errors.New("algorithm of token isn't accepted")
+	ErrUnknownKey   = errors.New("key of token isn't found")
+	ErrSignature    = errors.New("signature of token is invalid")
+	ErrExpired      = errors.New("token is expired")
+	ErrNotYetValid  = errors.New("token isn't valid yet")
+	ErrIssuer       = errors.New("issuer of token isn't accepted")
+	ErrAudience     = errors.New("audience of token isn't accepted")
+	ErrNoExpiration = errors.New("token has no expiration")
+)
+
+// Claims it's a payload of verified token, numbers are float64 like in encoding/json.
+type Claims map[string]interface{}
+
+// String returns claim by name if it's a string.
+func (c Claims) String(name string) string {
+	s, _ := c[name].(string)
+	return s
+}
+
+// Subject returns "sub" claim.
+func (c Claims) Subject() string {
+	return c.String("sub")
+}
+
+// Time returns claim by name if it's NumericDate.
+func (c Claims) Time(name string) (time.Time, bool) {
+	n, ok := c[name].(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+	sec, frac := int64(n), n-float64(int64(n))
+	return time.Unix(sec, int64(frac*float64(time.Second))), true
+}
+
+// Audience returns "aud" claim, which is a string or an array of strings.
+func (c Claims) Audience() []string {
+	switch aud := c["aud"].(type) {
+	case string:
+		return []string{aud}
+	case []interface{}:
+		auds := make([]string, 0, len(aud))
+		for _, a := range aud {
+			if s, ok := a.(string); ok {
+				auds = append(auds, s)
+			}
+		}
+		return auds
+	default:
+		return nil
+	}
+}
+
+// header it's a header of token.
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid,omitempty"`
+	Typ string `json:"typ,omitempty"`
+}
+
+// Verifier verifies tokens, it's safe to call concurrently.
+type Verifier struct {
+	algorithms map[string]bool
+	secret     []byte
+	secrets    map[string][]byte
+	keys       *KeySet
+	issuer     string
+	audience   string
+	leeway     time.Duration
+	now        func() time.Time
+}
+
+// Options it's a parameters of Verifier.
+type Options struct {
+	Algorithms []string          // accepted algorithms, empty means all supported
+	Secret     []byte            // key of HS256 signatures
+	Secrets    map[string][]byte // keys of HS256 signatures by key id, e.g. rotated keys
+	Keys       *KeySet           // public keys of RS256 and ES256 signatures
+	Issuer     string            // expected "iss" claim, empty accepts any issuer
+	Audience   string            // expected in "aud" claim, empty accepts any audience
+	Leeway     time.Duration     // allowed clock skew
+}
+
+// New function initialize a new Verifier with options.
+func New(opts Options) (*Verifier, error) {
+	if len(opts.Algorithms) == 0 {
+		opts.Algorithms = []string{HS256, RS256, ES256}
+	}
+	algorithms := make(map[string]bool, len(opts.Algorithms))
+	for _, alg := range opts.Algorithms {
+		switch alg {
+		case HS256, RS256, ES256:
+			algorithms[alg] = true
+		default:
+			return nil, fmt.Errorf("unsupported algorithm %q, expect one of: %s, %s, %s", alg, HS256, RS256, ES256)
+		}
+	}
+	return &Verifier{
+		algorithms: algorithms,
+		secret:     opts.Secret,
+		secrets:    opts.Secrets,
+		keys:       opts.Keys,
+		issuer:     opts.Issuer,
+		audience:   opts.Audience,
+		leeway:     opts.Leeway,
+		now:        time.Now,
+	}, nil
+}
+
+// NewFromConfig function initialize a new Verifier with parameters from config, returns nil Verifier if neither
+// secret nor JWKS is set. JWKS of file is loaded at once, JWKS of URL is loaded on first use.
+func NewFromConfig(cfg *config.Config) (*Verifier, error) {
+	c := cfg.Auth.JWT
+	if c.Secret == "" && c.JWKSFile == "" && c.JWKSURL == "" {
+		return nil, nil
+	}
+
+	var keys *KeySet
+	switch {
+	case c.JWKSFile != "" && c.JWKSURL != "":
+		return nil, errors.New("only one of jwksFile and jwksURL can be set")
+	case c.JWKSFile != "":
+		var err error
+		if keys, err = LoadKeySet(c.JWKSFile); err != nil {
+			return nil, err
+		}
+	case c.JWKSURL != "":
+		keys = RemoteKeySet(c.JWKSURL, c.JWKSCacheTTL)
+	}
+	return New(Options{
+		Algorithms: c.Algorithms,
+		Secret:     []byte(c.Secret),
+		Keys:       keys,
+		Issuer:     c.Issuer,
+		Audience:   c.Audience,
+		Leeway:     c.Leeway,
+	})
+}
+
+// Bearer returns token of value of Authorization header with Bearer scheme, empty string if there is no such token.
+func Bearer(authorization string) string {
+	const prefix = "Bearer "
+	if len(authorization) <= len(prefix) || !strings.EqualFold(authorization[:len(prefix)], prefix) {
+		return ""
+	}
+	return strings.TrimSpace(authorization[len(prefix):])
+}
+
+// decode decodes base64url segment of token without padding.
+func decode(segment string) ([]byte, error) {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrMalformed, err)
+	}
+	return b, nil
+}
+
+// Verify verifies token in compact serialization and returns its claims.
+func (v *Verifier) Verify(token string) (Claims, error) {
+	if token == "" {
+		return nil, ErrMissing
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: expect 3 parts, got %d", ErrMalformed, len(parts))
+	}
+
+	b, err := decode(parts[0])
+	if err != nil {
+		return nil, err
+	}
+	var h header
+	if err = json.Unmarshal(b, &h); err != nil {
+		return nil, fmt.Errorf("%w: header: %s", ErrMalformed, err)
+	}
+	if !v.algorithms[h.Alg] {
+		return nil, fmt.Errorf("%w: %q", ErrAlgorithm, h.Alg)
+	}
+	signature, err := decode(parts[2])
+	if err != nil {
+		return nil, err
+	}
+	if err = v.verifySignature(h, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	if b, err = decode(parts[1]); err != nil {
+		return nil, err
+	}
+	var claims Claims
+	if err = json.Unmarshal(b, &claims); err != nil {
+		return nil, fmt.Errorf("%w: claims: %s", ErrMalformed, err)
+	}
+	if err = v.verifyClaims(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// verifySignature checks signature of signed part of token by algorithm and key of header.
+func (v *Verifier) verifySignature(h header, signed string, signature []byte) error {
+	digest := sha256.Sum256([]byte(signed))
+
+	if h.Alg == HS256 {
+		secret, ok := v.secrets[h.Kid]
+		if !ok {
+			secret = v.secret
+		}
+		if len(secret) == 0 {
+			return fmt.Errorf("%w: no secret of %s %q", ErrUnknownKey, HS256, h.Kid)
+		}
+		if !hmac.Equal(hs256(signed, secret), signature) {
+			return ErrSignature
+		}
+		return nil
+	}
+
+	if v.keys == nil {
+		return fmt.Errorf("%w: no JWKS of %s", ErrUnknownKey, h.Alg)
+	}
+	key, err := v.keys.Key(h.Kid, h.Alg)
+	if err != nil {
+		return err
+	}
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if h.Alg != RS256 || rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], signature) != nil {
+			return ErrSignature
+		}
+	case *ecdsa.PublicKey:
+		if h.Alg != ES256 || len(signature) != 64 {
+			return ErrSignature
+		}
+		r, s := new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(k, digest[:], r, s) {
+			return ErrSignature
+		}
+	default:
+		return ErrSignature
+	}
+	return nil
+}
+
+// hs256 returns HS256 signature of signed part of token.
+func hs256(signed string, secret []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signed))
+	return mac.Sum(nil)
+}
+
+// SignHS256 returns token with claims signed by HS256 with secret, kid names secret in header of token.
+func SignHS256(claims Claims, kid string, secret []byte) (string, error) {
+	h, err := json.Marshal(header{Alg: HS256, Kid: kid, Typ: "JWT"})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signed := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(hs256(signed, secret)), nil
+}
+
+// verifyClaims checks expiration, not before, issuer and audience claims.
+func (v *Verifier) verifyClaims(claims Claims) error {
+	now := v.now()
+	exp, ok := claims.Time("exp")
+	if !ok {
+		return ErrNoExpiration
+	}
+	if now.After(exp.Add(v.leeway)) {
+		return fmt.Errorf("%w at %s", ErrExpired, exp.UTC().Format(time.RFC3339))
+	}
+	if nbf, ok := claims.Time("nbf"); ok && now.Add(v.leeway).Before(nbf) {
+		return fmt.Errorf("%w before %s", ErrNotYetValid, nbf.UTC().Format(time.RFC3339))
+	}
+	if v.issuer != "" && claims.String("iss") != v.issuer {
+		return fmt.Errorf("%w: %q", ErrIssuer, claims.String("iss"))
+	}
+	if v.audience != "" {
+		for _, aud := range claims.Audience() {
+			if aud == v.audience {
+				return nil
+			}
+		}
+		return fmt.Errorf("%w: %v", ErrAudience, claims.Audience())
+	}
+	return nil
+}
+
+// claimsKey it's a key of claims in context.
+type claimsKey struct{}
+
+// WithClaims returns context carrying claims of verified token.
+func WithClaims(ctx context.Context, claims Claims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+// ClaimsFrom returns claims of verified token carried by context.
+func ClaimsFrom(ctx context.Context) (Claims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(Claims)
+	return claims, ok
+}
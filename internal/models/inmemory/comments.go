@@ -0,0 +1,148 @@
+package inmemory
+
+import (
+	"fmt"
+	"github.com/White-AK111/REST/internal/models"
+	"time"
+)
+
+// page returns bounds of page with offset and limit in list of n items. Offset is clamped before adding limit,
+// so huge offset or limit doesn't overflow.
+func page(n, offset, limit int) (from, to int) {
+	if offset > n {
+		offset = n
+	}
+	if limit > n-offset {
+		limit = n - offset
+	}
+	return offset, offset + limit
+}
+
+// AddComment adds comment to thread of its task, returns stored comment with id and time.
+// If the task doesn't exist, an error is returned.
+func (ts *TaskStore) AddComment(comment models.Comment) (models.Comment, error) {
+	ts.Lock()
+	defer ts.Unlock()
+
+	if _, ok := ts.tasks[comment.TaskId]; !ok {
+		return models.Comment{}, fmt.Errorf("task with id=%d %w", comment.TaskId, models.ErrNotFound)
+	}
+
+	comment.Id = ts.nextCommentId
+	if comment.Time.IsZero() {
+		comment.Time = time.Now()
+	}
+	ts.comments[comment.TaskId] = append(ts.comments[comment.TaskId], comment)
+	ts.nextCommentId++
+	return comment, nil
+}
+
+// GetComments returns page of comments of the task in chronological order and total count of its comments.
+// Comments of task in trash are returned too. If the task doesn't exist, an error is returned.
+func (ts *TaskStore) GetComments(taskId, offset, limit int) ([]models.Comment, int, error) {
+	ts.Lock()
+	defer ts.Unlock()
+
+	if !ts.exists(taskId) {
+		return nil, 0, fmt.Errorf("task with id=%d %w", taskId, models.ErrNotFound)
+	}
+
+	comments := ts.comments[taskId]
+	from, to := page(len(comments), offset, limit)
+	return append([]models.Comment{}, comments[from:to]...), len(comments), nil
+}
+
+// AddActivity adds entry to activity log of its task, log of deleted task is kept.
+func (ts *TaskStore) AddActivity(activity models.Activity) error {
+	ts.Lock()
+	defer ts.Unlock()
+
+	activity.Id = ts.nextActivityId
+	if activity.Time.IsZero() {
+		activity.Time = time.Now()
+	}
+	ts.activity[activity.TaskId] = append(ts.activity[activity.TaskId], activity)
+	ts.nextActivityId++
+	return nil
+}
+
+// GetActivity returns page of activity log of the task in chronological order and total count of its entries.
+// If the task doesn't exist and never existed, an error is returned.
+func (ts *TaskStore) GetActivity(taskId, offset, limit int) ([]models.Activity, int, error) {
+	ts.Lock()
+	defer ts.Unlock()
+
+	log, ok := ts.activity[taskId]
+	if !ok && !ts.exists(taskId) {
+		return nil, 0, fmt.Errorf("task with id=%d %w", taskId, models.ErrNotFound)
+	}
+
+	from, to := page(len(log), offset, limit)
+	return append([]models.Activity{}, log[from:to]...), len(log), nil
+}
+
+// AddAttachment adds attachment to the task, returns stored attachment with id and time.
+// If the task doesn't exist, an error is returned.
+func (ts *TaskStore) AddAttachment(attachment models.Attachment) (models.Attachment, error) {
+	ts.Lock()
+	defer ts.Unlock()
+
+	if _, ok := ts.tasks[attachment.TaskId]; !ok {
+		return models.Attachment{}, fmt.Errorf("task with id=%d %w", attachment.TaskId, models.ErrNotFound)
+	}
+
+	attachment.Id = ts.nextAttachmentId
+	if attachment.Time.IsZero() {
+		attachment.Time = time.Now()
+	}
+	ts.attachments[attachment.TaskId] = append(ts.attachments[attachment.TaskId], attachment)
+	ts.nextAttachmentId++
+	return attachment, nil
+}
+
+// GetAttachments returns attachments of the task in order of upload, attachments of task in trash are returned too.
+// If the task doesn't exist, an error is returned.
+func (ts *TaskStore) GetAttachments(taskId int) ([]models.Attachment, error) {
+	ts.Lock()
+	defer ts.Unlock()
+
+	if !ts.exists(taskId) {
+		return nil, fmt.Errorf("task with id=%d %w", taskId, models.ErrNotFound)
+	}
+	return append([]models.Attachment{}, ts.attachments[taskId]...), nil
+}
+
+// GetAttachment returns attachment of the task by id, also of task in trash. If the task or attachment doesn't exist,
+// an error is returned.
+func (ts *TaskStore) GetAttachment(taskId, id int) (models.Attachment, error) {
+	ts.Lock()
+	defer ts.Unlock()
+
+	if !ts.exists(taskId) {
+		return models.Attachment{}, fmt.Errorf("task with id=%d %w", taskId, models.ErrNotFound)
+	}
+	for _, attachment := range ts.attachments[taskId] {
+		if attachment.Id == id {
+			return attachment, nil
+		}
+	}
+	return models.Attachment{}, fmt.Errorf("attachment with id=%d %w", id, models.ErrNotFound)
+}
+
+// DeleteAttachment deletes attachment of the task by id. If the task or attachment doesn't exist, an error is returned.
+func (ts *TaskStore) DeleteAttachment(taskId, id int) error {
+	ts.Lock()
+	defer ts.Unlock()
+
+	if _, ok := ts.tasks[taskId]; !ok {
+		return fmt.Errorf("task with id=%d %w", taskId, models.ErrNotFound)
+	}
+	attachments := ts.attachments[taskId]
+	for i, attachment := range attachments {
+		if attachment.Id == id {
+			ts.attachments[taskId] = append(attachments[:i:i], attachments[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("attachment with id=%d %w", id, models.ErrNotFound)
+}
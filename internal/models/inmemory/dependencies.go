@@ -0,0 +1,134 @@
+package inmemory
+
+import (
+	"fmt"
+	"github.com/White-AK111/REST/internal/models"
+	"sort"
+)
+
+// indexBlockers adds task to index of dependents of its blockers, must be called with lock held.
+func (ts *TaskStore) indexBlockers(task models.Task) {
+	for _, blocker := range task.BlockedBy {
+		ids, ok := ts.dependents[blocker]
+		if !ok {
+			ids = make(map[int]bool)
+			ts.dependents[blocker] = ids
+		}
+		ids[task.Id] = true
+	}
+}
+
+// unindexBlockers deletes task from index of dependents of its blockers, must be called with lock held.
+func (ts *TaskStore) unindexBlockers(task models.Task) {
+	for _, blocker := range task.BlockedBy {
+		if ids, ok := ts.dependents[blocker]; ok {
+			delete(ids, task.Id)
+			if len(ids) == 0 {
+				delete(ts.dependents, blocker)
+			}
+		}
+	}
+}
+
+// releaseDependents deletes deleted task from blockers of tasks blocked by it, must be called with lock held.
+func (ts *TaskStore) releaseDependents(id int) {
+	for dependent := range ts.dependents[id] {
+		task := ts.tasks[dependent]
+		blockers := make([]int, 0, len(task.BlockedBy))
+		for _, blocker := range task.BlockedBy {
+			if blocker != id {
+				blockers = append(blockers, blocker)
+			}
+		}
+		task.BlockedBy = blockers
+		ts.tasks[dependent] = task
+	}
+	delete(ts.dependents, id)
+}
+
+// dependsOn reports whether task depends on task 'on' directly or through other tasks, must be called with lock held.
+func (ts *TaskStore) dependsOn(id, on int) bool {
+	seen := make(map[int]bool)
+	stack := []int{id}
+	for len(stack) > 0 {
+		current := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if current == on {
+			return true
+		}
+		if seen[current] {
+			continue
+		}
+		seen[current] = true
+		stack = append(stack, ts.tasks[current].BlockedBy...)
+	}
+	return false
+}
+
+// isBlocked reports whether task has blockers which are not done, must be called with lock held.
+func (ts *TaskStore) isBlocked(task models.Task) bool {
+	for _, blocker := range task.BlockedBy {
+		if !ts.tasks[blocker].Done {
+			return true
+		}
+	}
+	return false
+}
+
+// AddDependencies makes the task with the given id blocked by tasks with ids 'blockers'. If some of the tasks
+// doesn't exist or some dependency would make a cycle, an error is returned and nothing is changed.
+func (ts *TaskStore) AddDependencies(id int, blockers []int) error {
+	ts.Lock()
+	defer ts.Unlock()
+
+	task, ok := ts.tasks[id]
+	if !ok {
+		return fmt.Errorf("task with id=%d %w", id, models.ErrNotFound)
+	}
+
+	set := make(map[int]bool, len(task.BlockedBy)+len(blockers))
+	for _, blocker := range task.BlockedBy {
+		set[blocker] = true
+	}
+	for _, blocker := range blockers {
+		if _, ok := ts.tasks[blocker]; !ok {
+			return fmt.Errorf("blocker task with id=%d %w", blocker, models.ErrNotFound)
+		}
+		if ts.dependsOn(blocker, id) {
+			return fmt.Errorf("dependency of task with id=%d on task with id=%d %w", id, blocker, models.ErrCycle)
+		}
+		set[blocker] = true
+	}
+
+	ts.unindexBlockers(task)
+	task.BlockedBy = make([]int, 0, len(set))
+	for blocker := range set {
+		task.BlockedBy = append(task.BlockedBy, blocker)
+	}
+	sort.Ints(task.BlockedBy)
+	ts.tasks[id] = task
+	ts.indexBlockers(task)
+	return nil
+}
+
+// RemoveDependency makes the task with the given id not blocked by task with id 'blocker'.
+// If the task doesn't depend on the blocker, an error is returned.
+func (ts *TaskStore) RemoveDependency(id, blocker int) error {
+	ts.Lock()
+	defer ts.Unlock()
+
+	task, ok := ts.tasks[id]
+	if !ok {
+		return fmt.Errorf("task with id=%d %w", id, models.ErrNotFound)
+	}
+	i := sort.SearchInts(task.BlockedBy, blocker)
+	if i == len(task.BlockedBy) || task.BlockedBy[i] != blocker {
+		return fmt.Errorf("dependency of task with id=%d on task with id=%d %w", id, blocker, models.ErrNotFound)
+	}
+
+	ts.unindexBlockers(task)
+	task.BlockedBy = append(append([]int{}, task.BlockedBy[:i]...), task.BlockedBy[i+1:]...)
+	ts.tasks[id] = task
+	ts.indexBlockers(task)
+	return nil
+}
@@ -5,6 +5,7 @@ package inmemory
 import (
 	"fmt"
 	"github.com/White-AK111/REST/internal/models"
+	"github.com/White-AK111/REST/internal/recurrence"
 	"sync"
 	"time"
 )
@@ -13,32 +14,183 @@ import (
 type TaskStore struct {
 	tasks map[int]models.Task
 	sync.Mutex
-	nextId int
+	nextId      int
+	tagIndex    *tagTrie             // hierarchical tag -> ids of tasks having it
+	searchIndex *searchIndex         // term of text and tags -> ids of tasks having it
+	children    map[int]map[int]bool // id of parent -> ids of its subtasks
+	dependents  map[int]map[int]bool // id of blocker -> ids of tasks blocked by it
+	policy      models.SubtaskPolicy
+
+	projects      map[int]models.Project
+	nextProjectId int
+	projectTasks  map[int]map[int]bool // id of project -> ids of its tasks
+
+	comments       map[int][]models.Comment // id of task -> its comments in chronological order
+	nextCommentId  int
+	activity       map[int][]models.Activity // id of task -> its activity log in chronological order
+	nextActivityId int
+
+	attachments      map[int][]models.Attachment // id of task -> its attachments in order of upload
+	nextAttachmentId int
+
+	trash map[int]trashed // id of deleted task -> task in trash
 }
 
-// NewStorage function initialize new in-memory repositories.
-func NewStorage() *TaskStore {
+// NewStorage function initialize new in-memory repositories, policy defines deleting and completing
+// of tasks having open subtasks.
+func NewStorage(policy models.SubtaskPolicy) *TaskStore {
 	ts := &TaskStore{}
 	ts.tasks = make(map[int]models.Task)
 	ts.nextId = 1
+	ts.tagIndex = newTagTrie()
+	ts.searchIndex = newSearchIndex()
+	ts.children = make(map[int]map[int]bool)
+	ts.dependents = make(map[int]map[int]bool)
+	ts.policy = policy
+	ts.projects = make(map[int]models.Project)
+	ts.nextProjectId = 1
+	ts.projectTasks = make(map[int]map[int]bool)
+	ts.comments = make(map[int][]models.Comment)
+	ts.nextCommentId = 1
+	ts.activity = make(map[int][]models.Activity)
+	ts.nextActivityId = 1
+	ts.attachments = make(map[int][]models.Attachment)
+	ts.nextAttachmentId = 1
+	ts.trash = make(map[int]trashed)
 	return ts
 }
 
-// CreateTask creates a new task in the store.
-func (ts *TaskStore) CreateTask(text string, tags []string, due time.Time) int {
+// CreateTask creates a new task in the store, id and dependencies of task are ignored. Task becomes top level one
+// if its parent doesn't exist and gets no project if its project doesn't exist; subtask without project
+// goes to project of its parent.
+func (ts *TaskStore) CreateTask(task models.Task) (int, error) {
 	ts.Lock()
 	defer ts.Unlock()
 
-	task := models.Task{
-		Id:   ts.nextId,
-		Text: text,
-		Due:  due}
-	task.Tags = make([]string, len(tags))
-	copy(task.Tags, tags)
+	task.Id = ts.nextId
+	task.Virtual = false
+	task.Progress = nil
+	task.DeletedAt = nil
+	task.BlockedBy, task.Blocked = nil, false
+	if parent, ok := ts.tasks[task.ParentId]; !ok {
+		task.ParentId = 0
+	} else if task.ProjectId == 0 {
+		task.ProjectId = parent.ProjectId
+	}
+	if _, ok := ts.projects[task.ProjectId]; !ok {
+		task.ProjectId = 0
+	}
+	tags := make([]string, len(task.Tags))
+	copy(tags, task.Tags)
+	task.Tags = tags
+	task.Shares = copyShares(task.Shares)
 
 	ts.tasks[ts.nextId] = task
+	ts.index(task)
 	ts.nextId++
-	return task.Id
+	return task.Id, nil
+}
+
+// InsertTask stores a task under its own id, used to restore tasks from a backup, dependencies of task are ignored.
+// Task gets no project if its project doesn't exist. If the id is already taken by task in the store or in trash
+// or parent of task doesn't exist, an error is returned.
+func (ts *TaskStore) InsertTask(task models.Task) error {
+	ts.Lock()
+	defer ts.Unlock()
+
+	if task.Id <= 0 {
+		return fmt.Errorf("task id must be positive, got %d", task.Id)
+	}
+	if ts.exists(task.Id) {
+		return fmt.Errorf("task with id=%d %w", task.Id, models.ErrConflict)
+	}
+	if err := ts.checkParent(task); err != nil {
+		return err
+	}
+
+	task.Virtual = false
+	task.Progress = nil
+	task.DeletedAt = nil
+	task.BlockedBy, task.Blocked = nil, false
+	if _, ok := ts.projects[task.ProjectId]; !ok {
+		task.ProjectId = 0
+	}
+	tags := make([]string, len(task.Tags))
+	copy(tags, task.Tags)
+	task.Tags = tags
+	task.Shares = copyShares(task.Shares)
+
+	ts.tasks[task.Id] = task
+	ts.index(task)
+	if task.Id >= ts.nextId {
+		ts.nextId = task.Id + 1
+	}
+	return nil
+}
+
+// UpdateTask replaces the stored task with the same id keeping its dependencies, owner and shares. If no such id
+// exists, project of task doesn't exist, new parent of task doesn't exist or is its subtask, an error is returned.
+// Task having open subtasks is marked done by policy of the store: with its subtasks or not at all.
+func (ts *TaskStore) UpdateTask(task models.Task) error {
+	ts.Lock()
+	defer ts.Unlock()
+
+	old, ok := ts.tasks[task.Id]
+	if !ok {
+		return fmt.Errorf("task with id=%d %w", task.Id, models.ErrNotFound)
+	}
+	if err := ts.checkParent(task); err != nil {
+		return err
+	}
+	if _, ok := ts.projects[task.ProjectId]; !ok && task.ProjectId != 0 {
+		return fmt.Errorf("project with id=%d %w", task.ProjectId, models.ErrNotFound)
+	}
+	cascade := task.Done && !old.Done && ts.hasOpenSubtasks(task.Id)
+	if cascade && ts.policy != models.CascadeSubtasks {
+		return fmt.Errorf("task with id=%d %w", task.Id, models.ErrHasSubtasks)
+	}
+
+	task.Virtual = false
+	task.Progress = nil
+	task.DeletedAt = nil
+	task.BlockedBy, task.Blocked = old.BlockedBy, false
+	task.Owner, task.Shares = old.Owner, old.Shares
+	tags := make([]string, len(task.Tags))
+	copy(tags, task.Tags)
+	task.Tags = tags
+
+	ts.unindex(old)
+	ts.tasks[task.Id] = task
+	ts.index(task)
+
+	if cascade {
+		for _, id := range ts.descendants(task.Id) {
+			subtask := ts.tasks[id]
+			subtask.Done = true
+			ts.tasks[id] = subtask
+		}
+	}
+	return nil
+}
+
+// index adds task to indexes of tags, of search, of children, of dependents and of projects,
+// must be called with lock held.
+func (ts *TaskStore) index(task models.Task) {
+	ts.indexTags(task)
+	ts.searchIndex.add(task)
+	ts.indexParent(task)
+	ts.indexBlockers(task)
+	ts.indexProject(task)
+}
+
+// unindex deletes task from indexes of tags, of search, of children, of dependents and of projects,
+// must be called with lock held.
+func (ts *TaskStore) unindex(task models.Task) {
+	ts.unindexTags(task)
+	ts.searchIndex.remove(task)
+	ts.unindexParent(task)
+	ts.unindexBlockers(task)
+	ts.unindexProject(task)
 }
 
 // GetTask retrieves a task from the store, by id. If no such id exists, an error is returned.
@@ -48,66 +200,102 @@ func (ts *TaskStore) GetTask(id int) (models.Task, error) {
 
 	t, ok := ts.tasks[id]
 	if ok {
-		return t, nil
+		return ts.view(t), nil
 	} else {
-		return models.Task{}, fmt.Errorf("task with id=%d not found", id)
+		return models.Task{}, fmt.Errorf("task with id=%d %w", id, models.ErrNotFound)
 	}
 }
 
-// DeleteTask deletes the task with the given id. If no such id exists, an error is returned.
+// DeleteTask deletes the task with the given id and all its subtasks with their comments and attachments,
+// tasks blocked by deleted tasks aren't blocked by them anymore. If no such id exists, an error is returned.
+// Task having open subtasks is deleted by policy of the store: with its subtasks or not at all.
 func (ts *TaskStore) DeleteTask(id int) error {
 	ts.Lock()
 	defer ts.Unlock()
 
-	if _, ok := ts.tasks[id]; !ok {
-		return fmt.Errorf("task with id=%d not found", id)
+	task, ok := ts.tasks[id]
+	if !ok {
+		return fmt.Errorf("task with id=%d %w", id, models.ErrNotFound)
+	}
+	if ts.policy != models.CascadeSubtasks && ts.hasOpenSubtasks(id) {
+		return fmt.Errorf("task with id=%d %w", id, models.ErrHasSubtasks)
 	}
 
+	for _, subtask := range ts.descendants(id) {
+		ts.unindex(ts.tasks[subtask])
+		delete(ts.tasks, subtask)
+		delete(ts.comments, subtask)
+		delete(ts.attachments, subtask)
+		ts.releaseDependents(subtask)
+	}
+	ts.unindex(task)
 	delete(ts.tasks, id)
+	delete(ts.comments, id)
+	delete(ts.attachments, id)
+	ts.releaseDependents(id)
 	return nil
 }
 
-// DeleteAllTasks deletes all tasks in the store.
+// DeleteAllTasks deletes all tasks in the store with their comments and attachments, projects, activity logs
+// and tasks in trash stay.
 func (ts *TaskStore) DeleteAllTasks() error {
 	ts.Lock()
 	defer ts.Unlock()
 
 	ts.tasks = make(map[int]models.Task)
+	ts.tagIndex = newTagTrie()
+	ts.searchIndex = newSearchIndex()
+	ts.children = make(map[int]map[int]bool)
+	ts.dependents = make(map[int]map[int]bool)
+	ts.projectTasks = make(map[int]map[int]bool)
+	ts.comments = make(map[int][]models.Comment)
+	ts.attachments = make(map[int][]models.Attachment)
 	return nil
 }
 
-// GetAllTasks returns all the tasks in the store, in arbitrary order.
+// GetAllTasks returns all the tasks in the store except tasks of archived projects, in arbitrary order.
 func (ts *TaskStore) GetAllTasks() []models.Task {
 	ts.Lock()
 	defer ts.Unlock()
 
 	allTasks := make([]models.Task, 0, len(ts.tasks))
 	for _, task := range ts.tasks {
-		allTasks = append(allTasks, task)
+		if !ts.hidden(task) {
+			allTasks = append(allTasks, ts.view(task))
+		}
 	}
 	return allTasks
 }
 
-// GetTasksByTag returns all the tasks that have the given tag, in arbitrary order.
+// CountTasks returns count of all the tasks in the store, tasks of archived projects and tasks in trash included.
+func (ts *TaskStore) CountTasks() int {
+	ts.Lock()
+	defer ts.Unlock()
+
+	return len(ts.tasks) + len(ts.trash)
+}
+
+// GetTasksByTag returns all the tasks that have a tag matching the given tag pattern except tasks of archived
+// projects, in arbitrary order.
+// In pattern "*" matches any characters within one level of tag and level "**" matches any levels,
+// so "work/**" matches tag "work" and all its descendants like "work/backend/api".
 func (ts *TaskStore) GetTasksByTag(tag string) []models.Task {
 	ts.Lock()
 	defer ts.Unlock()
 
 	var tasks []models.Task
 
-taskLoop:
-	for _, task := range ts.tasks {
-		for _, taskTag := range task.Tags {
-			if taskTag == tag {
-				tasks = append(tasks, task)
-				continue taskLoop
-			}
+	for id := range ts.tagIndex.match(tag) {
+		if task := ts.tasks[id]; !ts.hidden(task) {
+			tasks = append(tasks, ts.view(task))
 		}
 	}
 	return tasks
 }
 
-// GetTasksByDueDate returns all the tasks that have the given due date, in arbitrary order.
+// GetTasksByDueDate returns all the tasks that have the given due date except tasks of archived projects,
+// in arbitrary order.
+// Future occurrences of recurring tasks on the date are included as virtual tasks.
 func (ts *TaskStore) GetTasksByDueDate(year int, month time.Month, day int) []models.Task {
 	ts.Lock()
 	defer ts.Unlock()
@@ -115,10 +303,31 @@ func (ts *TaskStore) GetTasksByDueDate(year int, month time.Month, day int) []mo
 	var tasks []models.Task
 
 	for _, task := range ts.tasks {
-		y, m, d := task.Due.Date()
-		if y == year && m == month && d == day {
-			tasks = append(tasks, task)
+		if !ts.hidden(task) {
+			tasks = append(tasks, ts.dueOn(task, year, month, day)...)
+		}
+	}
+
+	return tasks
+}
+
+// GetTasksByDueRange returns all the tasks that have due date in range [from, to] except tasks of archived
+// projects, in arbitrary order.
+// Future occurrences of recurring tasks in the range are included as virtual tasks.
+func (ts *TaskStore) GetTasksByDueRange(from, to time.Time) []models.Task {
+	ts.Lock()
+	defer ts.Unlock()
+
+	var tasks []models.Task
+
+	for _, task := range ts.tasks {
+		if ts.hidden(task) {
+			continue
+		}
+		if !task.Due.IsZero() && !task.Due.Before(from) && !task.Due.After(to) {
+			tasks = append(tasks, ts.view(task))
 		}
+		tasks = append(tasks, recurrence.Expand(task, from, to)...)
 	}
 
 	return tasks
@@ -0,0 +1,177 @@
+package inmemory
+
+import (
+	"fmt"
+	"github.com/White-AK111/REST/internal/models"
+	"github.com/White-AK111/REST/internal/recurrence"
+	"sort"
+	"time"
+)
+
+// indexProject adds task to index of tasks of its project, must be called with lock held.
+func (ts *TaskStore) indexProject(task models.Task) {
+	if task.ProjectId == 0 {
+		return
+	}
+	ids, ok := ts.projectTasks[task.ProjectId]
+	if !ok {
+		ids = make(map[int]bool)
+		ts.projectTasks[task.ProjectId] = ids
+	}
+	ids[task.Id] = true
+}
+
+// unindexProject deletes task from index of tasks of its project, must be called with lock held.
+func (ts *TaskStore) unindexProject(task models.Task) {
+	if ids, ok := ts.projectTasks[task.ProjectId]; ok {
+		delete(ids, task.Id)
+		if len(ids) == 0 {
+			delete(ts.projectTasks, task.ProjectId)
+		}
+	}
+}
+
+// hidden reports whether task belongs to archived project, must be called with lock held.
+func (ts *TaskStore) hidden(task models.Task) bool {
+	return ts.projects[task.ProjectId].Archived
+}
+
+// dueOn returns task if it has the given due date and its future occurrences on the date, must be called with lock held.
+func (ts *TaskStore) dueOn(task models.Task, year int, month time.Month, day int) []models.Task {
+	var tasks []models.Task
+	y, m, d := task.Due.Date()
+	if y == year && m == month && d == day {
+		tasks = append(tasks, ts.view(task))
+	}
+	if task.RRule != "" {
+		from := time.Date(year, month, day, 0, 0, 0, 0, task.Due.Location())
+		tasks = append(tasks, recurrence.Expand(task, from, from.AddDate(0, 0, 1).Add(-time.Nanosecond))...)
+	}
+	return tasks
+}
+
+// CreateProject creates a new project in the store, id of project is ignored.
+func (ts *TaskStore) CreateProject(project models.Project) int {
+	ts.Lock()
+	defer ts.Unlock()
+
+	project.Id = ts.nextProjectId
+	ts.projects[project.Id] = project
+	ts.nextProjectId++
+	return project.Id
+}
+
+// GetProject retrieves a project from the store, by id. If no such id exists, an error is returned.
+func (ts *TaskStore) GetProject(id int) (models.Project, error) {
+	ts.Lock()
+	defer ts.Unlock()
+
+	project, ok := ts.projects[id]
+	if !ok {
+		return models.Project{}, fmt.Errorf("project with id=%d %w", id, models.ErrNotFound)
+	}
+	return project, nil
+}
+
+// GetAllProjects returns all the projects in the store sorted by id, archived ones included.
+func (ts *TaskStore) GetAllProjects() []models.Project {
+	ts.Lock()
+	defer ts.Unlock()
+
+	projects := make([]models.Project, 0, len(ts.projects))
+	for _, project := range ts.projects {
+		projects = append(projects, project)
+	}
+	sort.Slice(projects, func(i, j int) bool { return projects[i].Id < projects[j].Id })
+	return projects
+}
+
+// UpdateProject replaces the stored project with the same id, archiving of project hides its tasks.
+// If no such id exists, an error is returned.
+func (ts *TaskStore) UpdateProject(project models.Project) error {
+	ts.Lock()
+	defer ts.Unlock()
+
+	if _, ok := ts.projects[project.Id]; !ok {
+		return fmt.Errorf("project with id=%d %w", project.Id, models.ErrNotFound)
+	}
+	ts.projects[project.Id] = project
+	return nil
+}
+
+// DeleteProject deletes the project with the given id, its tasks stay in the store without project.
+// Returns ids of changed tasks. If no such id exists, an error is returned.
+func (ts *TaskStore) DeleteProject(id int) ([]int, error) {
+	ts.Lock()
+	defer ts.Unlock()
+
+	if _, ok := ts.projects[id]; !ok {
+		return nil, fmt.Errorf("project with id=%d %w", id, models.ErrNotFound)
+	}
+
+	var ids []int
+	for taskId := range ts.projectTasks[id] {
+		task := ts.tasks[taskId]
+		task.ProjectId = 0
+		ts.tasks[taskId] = task
+		ids = append(ids, taskId)
+	}
+	sort.Ints(ids)
+	delete(ts.projectTasks, id)
+	delete(ts.projects, id)
+	return ids, nil
+}
+
+// GetProjectTasks returns all the tasks of the project with the given id, in arbitrary order.
+// Tasks of archived project are returned too. If no such id exists, an error is returned.
+func (ts *TaskStore) GetProjectTasks(id int) ([]models.Task, error) {
+	ts.Lock()
+	defer ts.Unlock()
+
+	if _, ok := ts.projects[id]; !ok {
+		return nil, fmt.Errorf("project with id=%d %w", id, models.ErrNotFound)
+	}
+
+	tasks := make([]models.Task, 0, len(ts.projectTasks[id]))
+	for taskId := range ts.projectTasks[id] {
+		tasks = append(tasks, ts.view(ts.tasks[taskId]))
+	}
+	return tasks, nil
+}
+
+// GetProjectTasksByTag returns the tasks of the project with the given id that have a tag matching the given
+// tag pattern, in arbitrary order. If no such id exists, an error is returned.
+func (ts *TaskStore) GetProjectTasksByTag(id int, tag string) ([]models.Task, error) {
+	ts.Lock()
+	defer ts.Unlock()
+
+	if _, ok := ts.projects[id]; !ok {
+		return nil, fmt.Errorf("project with id=%d %w", id, models.ErrNotFound)
+	}
+
+	tasks := []models.Task{}
+	for taskId := range ts.tagIndex.match(tag) {
+		if ts.projectTasks[id][taskId] {
+			tasks = append(tasks, ts.view(ts.tasks[taskId]))
+		}
+	}
+	return tasks, nil
+}
+
+// GetProjectTasksByDueDate returns the tasks of the project with the given id that have the given due date,
+// in arbitrary order. Future occurrences of recurring tasks on the date are included as virtual tasks.
+// If no such id exists, an error is returned.
+func (ts *TaskStore) GetProjectTasksByDueDate(id int, year int, month time.Month, day int) ([]models.Task, error) {
+	ts.Lock()
+	defer ts.Unlock()
+
+	if _, ok := ts.projects[id]; !ok {
+		return nil, fmt.Errorf("project with id=%d %w", id, models.ErrNotFound)
+	}
+
+	tasks := []models.Task{}
+	for taskId := range ts.projectTasks[id] {
+		tasks = append(tasks, ts.dueOn(ts.tasks[taskId], year, month, day)...)
+	}
+	return tasks, nil
+}
@@ -0,0 +1,139 @@
+package inmemory
+
+import (
+	"github.com/White-AK111/REST/internal/models"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Weights of occurrences of term in text and in tags of task, match in tag is more relevant.
+const (
+	textWeight = 1.0
+	tagWeight  = 2.0
+)
+
+// searchIndex it's an inverted index of terms of text and tags of tasks.
+type searchIndex struct {
+	postings map[string]map[int]float64 // term -> id of task -> weighted frequency of term in task
+	terms    []string                   // all terms in ascending order, for prefix lookup
+}
+
+// newSearchIndex function initialize an empty search index.
+func newSearchIndex() *searchIndex {
+	return &searchIndex{postings: make(map[string]map[int]float64)}
+}
+
+// tokenize splits text into lower case terms of letters and digits.
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// taskTerms returns weighted frequencies of terms of text and tags of task.
+func taskTerms(task models.Task) map[string]float64 {
+	terms := make(map[string]float64)
+	for _, term := range tokenize(task.Text) {
+		terms[term] += textWeight
+	}
+	for _, tag := range task.Tags {
+		for _, term := range tokenize(tag) {
+			terms[term] += tagWeight
+		}
+	}
+	return terms
+}
+
+// add adds terms of task to index.
+func (si *searchIndex) add(task models.Task) {
+	for term, weight := range taskTerms(task) {
+		ids, ok := si.postings[term]
+		if !ok {
+			ids = make(map[int]float64)
+			si.postings[term] = ids
+			i := sort.SearchStrings(si.terms, term)
+			si.terms = append(si.terms, "")
+			copy(si.terms[i+1:], si.terms[i:])
+			si.terms[i] = term
+		}
+		ids[task.Id] = weight
+	}
+}
+
+// remove deletes terms of task from index.
+func (si *searchIndex) remove(task models.Task) {
+	for term := range taskTerms(task) {
+		ids, ok := si.postings[term]
+		if !ok {
+			continue
+		}
+		delete(ids, task.Id)
+		if len(ids) == 0 {
+			delete(si.postings, term)
+			i := sort.SearchStrings(si.terms, term)
+			si.terms = append(si.terms[:i], si.terms[i+1:]...)
+		}
+	}
+}
+
+// search returns scores of tasks matching all terms of query, each term of query matches terms of tasks
+// starting with it. Score sums TF-IDF of terms of query, where the best matched term of task counts
+// and match by prefix of longer term scores less than exact one.
+func (si *searchIndex) search(query string, total int) map[int]float64 {
+	var scores map[int]float64
+	for _, prefix := range tokenize(query) {
+		matched := make(map[int]float64)
+		for i := sort.SearchStrings(si.terms, prefix); i < len(si.terms) && strings.HasPrefix(si.terms[i], prefix); i++ {
+			term := si.terms[i]
+			closeness := float64(len(prefix)) / float64(len(term))
+			for id, weight := range si.postings[term] {
+				if score := weight * closeness; score > matched[id] {
+					matched[id] = score
+				}
+			}
+		}
+		idf := math.Log(1 + float64(total)/float64(len(matched)))
+		for id := range matched {
+			matched[id] *= idf
+		}
+
+		if scores == nil {
+			scores = matched
+			continue
+		}
+		for id, score := range scores {
+			if extra, ok := matched[id]; ok {
+				scores[id] = score + extra
+			} else {
+				delete(scores, id)
+			}
+		}
+	}
+	return scores
+}
+
+// SearchTasks returns tasks whose text and tags match all words of the query except tasks of archived projects,
+// ordered by relevance.
+// Words of the query match words of tasks case-insensitively by prefix, matches in tags are more relevant.
+func (ts *TaskStore) SearchTasks(query string) []models.Task {
+	ts.Lock()
+	defer ts.Unlock()
+
+	scores := ts.searchIndex.search(query, len(ts.tasks))
+	tasks := make([]models.Task, 0, len(scores))
+	for id := range scores {
+		if task := ts.tasks[id]; !ts.hidden(task) {
+			tasks = append(tasks, ts.view(task))
+		}
+	}
+	sort.Slice(tasks, func(i, j int) bool {
+		si, sj := scores[tasks[i].Id], scores[tasks[j].Id]
+		if si == sj {
+			return tasks[i].Id < tasks[j].Id
+		}
+		return si > sj
+	})
+	return tasks
+}
@@ -0,0 +1,44 @@
+package inmemory
+
+import (
+	"fmt"
+	"github.com/White-AK111/REST/internal/models"
+	"sort"
+)
+
+// copyShares returns copy of shares, nil for no shares.
+func copyShares(shares []models.Share) []models.Share {
+	if len(shares) == 0 {
+		return nil
+	}
+	copied := make([]models.Share, len(shares))
+	copy(copied, shares)
+	return copied
+}
+
+// ShareTask replaces shares of the task with the given id, shares are sorted by user, the last share of user wins
+// and share with owner is ignored. If no such id exists, an error is returned.
+func (ts *TaskStore) ShareTask(id int, shares []models.Share) error {
+	ts.Lock()
+	defer ts.Unlock()
+
+	task, ok := ts.tasks[id]
+	if !ok {
+		return fmt.Errorf("task with id=%d %w", id, models.ErrNotFound)
+	}
+
+	byUser := make(map[string]models.Share, len(shares))
+	for _, share := range shares {
+		if share.User != task.Owner {
+			byUser[share.User] = share
+		}
+	}
+	task.Shares = nil
+	for _, share := range byUser {
+		task.Shares = append(task.Shares, share)
+	}
+	sort.Slice(task.Shares, func(i, j int) bool { return task.Shares[i].User < task.Shares[j].User })
+
+	ts.tasks[id] = task
+	return nil
+}
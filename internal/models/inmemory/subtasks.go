@@ -0,0 +1,101 @@
+package inmemory
+
+import (
+	"fmt"
+	"github.com/White-AK111/REST/internal/models"
+	"sort"
+)
+
+// indexParent adds task to index of children of its parent, must be called with lock held.
+func (ts *TaskStore) indexParent(task models.Task) {
+	if task.ParentId == 0 {
+		return
+	}
+	ids, ok := ts.children[task.ParentId]
+	if !ok {
+		ids = make(map[int]bool)
+		ts.children[task.ParentId] = ids
+	}
+	ids[task.Id] = true
+}
+
+// unindexParent deletes task from index of children of its parent, must be called with lock held.
+func (ts *TaskStore) unindexParent(task models.Task) {
+	if ids, ok := ts.children[task.ParentId]; ok {
+		delete(ids, task.Id)
+		if len(ids) == 0 {
+			delete(ts.children, task.ParentId)
+		}
+	}
+}
+
+// checkParent checks that parent of task exists and task isn't an ancestor of it, must be called with lock held.
+func (ts *TaskStore) checkParent(task models.Task) error {
+	if task.ParentId == 0 {
+		return nil
+	}
+	for id := task.ParentId; id != 0; id = ts.tasks[id].ParentId {
+		if id == task.Id {
+			return fmt.Errorf("parent id=%d of task with id=%d %w", task.ParentId, task.Id, models.ErrCycle)
+		}
+		if _, ok := ts.tasks[id]; !ok {
+			return fmt.Errorf("parent task with id=%d %w", id, models.ErrNotFound)
+		}
+	}
+	return nil
+}
+
+// descendants returns ids of all subtasks of task, subtasks go before their parents.
+// Must be called with lock held.
+func (ts *TaskStore) descendants(id int) []int {
+	var ids []int
+	for child := range ts.children[id] {
+		ids = append(ids, ts.descendants(child)...)
+		ids = append(ids, child)
+	}
+	return ids
+}
+
+// hasOpenSubtasks reports whether task has subtasks which are not done, must be called with lock held.
+func (ts *TaskStore) hasOpenSubtasks(id int) bool {
+	for _, child := range ts.descendants(id) {
+		if !ts.tasks[child].Done {
+			return true
+		}
+	}
+	return false
+}
+
+// view returns stored task with blocked status and rollup progress of its subtasks, must be called with lock held.
+func (ts *TaskStore) view(task models.Task) models.Task {
+	task.Blocked = ts.isBlocked(task)
+	descendants := ts.descendants(task.Id)
+	if len(descendants) == 0 {
+		return task
+	}
+	progress := &models.Progress{Total: len(descendants)}
+	for _, id := range descendants {
+		if ts.tasks[id].Done {
+			progress.Done++
+		}
+	}
+	task.Progress = progress
+	return task
+}
+
+// GetChildren returns subtasks of the task with the given id sorted by id. If no such id exists, an error is returned.
+func (ts *TaskStore) GetChildren(id int) ([]models.Task, error) {
+	ts.Lock()
+	defer ts.Unlock()
+
+	if _, ok := ts.tasks[id]; !ok {
+		return nil, fmt.Errorf("task with id=%d %w", id, models.ErrNotFound)
+	}
+
+	children := make([]models.Task, 0, len(ts.children[id]))
+	for child := range ts.children[id] {
+		children = append(children, ts.view(ts.tasks[child]))
+	}
+	sort.Slice(children, func(i, j int) bool { return children[i].Id < children[j].Id })
+	return children, nil
+}
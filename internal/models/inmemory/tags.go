@@ -0,0 +1,144 @@
+package inmemory
+
+import (
+	"fmt"
+	"github.com/White-AK111/REST/internal/models"
+	"sort"
+)
+
+// indexTags adds task to index of its tags, must be called with lock held.
+func (ts *TaskStore) indexTags(task models.Task) {
+	for _, tag := range task.Tags {
+		ts.tagIndex.add(tag, task.Id)
+	}
+}
+
+// unindexTags deletes task from index of its tags, must be called with lock held.
+func (ts *TaskStore) unindexTags(task models.Task) {
+	for _, tag := range task.Tags {
+		ts.tagIndex.remove(tag, task.Id)
+	}
+}
+
+// GetAllTags returns all the tags with counts of tasks having them, sorted by tag.
+func (ts *TaskStore) GetAllTags() []models.TagCount {
+	ts.Lock()
+	defer ts.Unlock()
+
+	return ts.tagIndex.all()
+}
+
+// RenameTag renames the tag in all the tasks having it and returns their ids in ascending order.
+// If no task has the tag, or some task already has the new tag, an error is returned and nothing is changed.
+func (ts *TaskStore) RenameTag(tag, newTag string) ([]int, error) {
+	ts.Lock()
+	defer ts.Unlock()
+
+	if ts.tagIndex.ids(tag) == nil {
+		return nil, fmt.Errorf("tag %q %w", tag, models.ErrNotFound)
+	}
+	if tag == newTag {
+		return nil, nil
+	}
+	if ts.tagIndex.ids(newTag) != nil {
+		return nil, fmt.Errorf("tag %q %w, merge tags instead", newTag, models.ErrConflict)
+	}
+
+	return ts.replaceTags(map[string]bool{tag: true}, newTag, nil), nil
+}
+
+// MergeTags replaces the tags by tag 'into' in all the tasks having any of them and returns their ids
+// in ascending order. 'into' may be a new or an existing tag. If no task has any of the tags, an error is returned.
+func (ts *TaskStore) MergeTags(tags []string, into string) ([]int, error) {
+	ts.Lock()
+	defer ts.Unlock()
+
+	from := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		if ts.tagIndex.ids(tag) != nil && tag != into {
+			from[tag] = true
+		}
+	}
+	if len(from) == 0 {
+		if ts.tagIndex.ids(into) != nil {
+			// Tasks already have only the target tag.
+			return nil, nil
+		}
+		return nil, fmt.Errorf("tags %q %w", tags, models.ErrNotFound)
+	}
+
+	return ts.replaceTags(from, into, nil), nil
+}
+
+// DeleteTag strips the tag from all the tasks having it and returns their ids in ascending order.
+// If no task has the tag, an error is returned.
+func (ts *TaskStore) DeleteTag(tag string) ([]int, error) {
+	ts.Lock()
+	defer ts.Unlock()
+
+	if ts.tagIndex.ids(tag) == nil {
+		return nil, fmt.Errorf("tag %q %w", tag, models.ErrNotFound)
+	}
+
+	return ts.replaceTags(map[string]bool{tag: true}, "", nil), nil
+}
+
+// ReplaceTags replaces the tags by tag 'into' in tasks with the ids only, empty 'into' strips the tags, and returns
+// ids of changed tasks in ascending order. Tasks are changed at once, e.g. to rename tag in tasks which user changes.
+func (ts *TaskStore) ReplaceTags(ids []int, tags []string, into string) []int {
+	ts.Lock()
+	defer ts.Unlock()
+
+	from := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		if tag != into {
+			from[tag] = true
+		}
+	}
+	only := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		only[id] = true
+	}
+
+	return ts.replaceTags(from, into, only)
+}
+
+// replaceTags replaces tags 'from' by tag 'into' in tasks keeping order of tags and without duplicates,
+// empty 'into' strips tags, nil 'only' means all the tasks. Returns ids of changed tasks in ascending order,
+// must be called with lock held.
+func (ts *TaskStore) replaceTags(from map[string]bool, into string, only map[int]bool) []int {
+	changed := make(map[int]bool)
+	for tag := range from {
+		for id := range ts.tagIndex.ids(tag) {
+			if only == nil || only[id] {
+				changed[id] = true
+			}
+		}
+	}
+
+	ids := make([]int, 0, len(changed))
+	for id := range changed {
+		task := ts.tasks[id]
+		ts.unindex(task)
+
+		tags := make([]string, 0, len(task.Tags))
+		seen := make(map[string]bool, len(task.Tags))
+		for _, tag := range task.Tags {
+			if from[tag] {
+				tag = into
+			}
+			if tag == "" || seen[tag] {
+				continue
+			}
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+		task.Tags = tags
+
+		ts.tasks[id] = task
+		ts.index(task)
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
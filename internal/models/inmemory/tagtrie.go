@@ -0,0 +1,167 @@
+package inmemory
+
+import (
+	"github.com/White-AK111/REST/internal/models"
+	"sort"
+	"strings"
+)
+
+// tagNode it's a node of tag trie, one level of hierarchical tag.
+type tagNode struct {
+	children map[string]*tagNode
+	ids      map[int]bool // ids of tasks having the tag ending at this node
+}
+
+// tagTrie it's an index of tags by levels, tag "work/backend" is a child of tag "work".
+type tagTrie struct {
+	root tagNode
+}
+
+// newTagTrie function initialize an empty tag trie.
+func newTagTrie() *tagTrie {
+	return &tagTrie{root: tagNode{children: make(map[string]*tagNode)}}
+}
+
+// add adds task id to the tag.
+func (t *tagTrie) add(tag string, id int) {
+	node := &t.root
+	for _, level := range strings.Split(tag, models.TagSeparator) {
+		child, ok := node.children[level]
+		if !ok {
+			child = &tagNode{children: make(map[string]*tagNode)}
+			node.children[level] = child
+		}
+		node = child
+	}
+	if node.ids == nil {
+		node.ids = make(map[int]bool)
+	}
+	node.ids[id] = true
+}
+
+// remove deletes task id from the tag and prunes nodes left without tasks and children.
+func (t *tagTrie) remove(tag string, id int) {
+	levels := strings.Split(tag, models.TagSeparator)
+	path := make([]*tagNode, 0, len(levels)+1)
+	node := &t.root
+	path = append(path, node)
+	for _, level := range levels {
+		child, ok := node.children[level]
+		if !ok {
+			return
+		}
+		node = child
+		path = append(path, node)
+	}
+
+	delete(node.ids, id)
+	for i := len(levels); i > 0; i-- {
+		n := path[i]
+		if len(n.ids) > 0 || len(n.children) > 0 {
+			break
+		}
+		delete(path[i-1].children, levels[i-1])
+	}
+}
+
+// ids returns ids of tasks having exactly the tag, nil if there are none.
+func (t *tagTrie) ids(tag string) map[int]bool {
+	node := &t.root
+	for _, level := range strings.Split(tag, models.TagSeparator) {
+		child, ok := node.children[level]
+		if !ok {
+			return nil
+		}
+		node = child
+	}
+	if len(node.ids) == 0 {
+		return nil
+	}
+	return node.ids
+}
+
+// match returns ids of tasks having tags matching pattern. In pattern "*" matches any characters
+// within one level and level "**" matches any number of levels, including none:
+//
+//	work           only tag "work"
+//	work/*         children of "work" like "work/backend"
+//	work/**        "work" and all its descendants
+//	**/api         tags with the last level "api"
+//	back*          top level tags starting with "back"
+func (t *tagTrie) match(pattern string) map[int]bool {
+	found := make(map[int]bool)
+	t.root.match(strings.Split(pattern, models.TagSeparator), found)
+	return found
+}
+
+// match collects ids of tasks of node descendants matching pattern levels into found.
+func (n *tagNode) match(levels []string, found map[int]bool) {
+	if len(levels) == 0 {
+		for id := range n.ids {
+			found[id] = true
+		}
+		return
+	}
+
+	level := levels[0]
+	switch {
+	case level == "**":
+		n.match(levels[1:], found)
+		for _, child := range n.children {
+			child.match(levels, found)
+		}
+	case strings.Contains(level, "*"):
+		for name, child := range n.children {
+			if matchLevel(level, name) {
+				child.match(levels[1:], found)
+			}
+		}
+	default:
+		if child, ok := n.children[level]; ok {
+			child.match(levels[1:], found)
+		}
+	}
+}
+
+// matchLevel reports whether name matches pattern where "*" matches any sequence of characters.
+func matchLevel(pattern, name string) bool {
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(name, parts[0]) {
+		return false
+	}
+	name = name[len(parts[0]):]
+	last := parts[len(parts)-1]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(name, part)
+		if i < 0 {
+			return false
+		}
+		name = name[i+len(part):]
+	}
+	return len(parts) == 1 && name == "" || len(parts) > 1 && strings.HasSuffix(name, last)
+}
+
+// all returns all tags with counts of tasks, sorted by tag.
+func (t *tagTrie) all() []models.TagCount {
+	var tags []models.TagCount
+	var walk func(n *tagNode, prefix string)
+	walk = func(n *tagNode, prefix string) {
+		if len(n.ids) > 0 {
+			tags = append(tags, models.TagCount{Tag: prefix, Count: len(n.ids)})
+		}
+		for name, child := range n.children {
+			tag := name
+			if n != &t.root {
+				tag = prefix + models.TagSeparator + name
+			}
+			walk(child, tag)
+		}
+	}
+	walk(&t.root, "")
+
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Tag < tags[j].Tag })
+	if tags == nil {
+		tags = []models.TagCount{}
+	}
+	return tags
+}
@@ -0,0 +1,191 @@
+package inmemory
+
+import (
+	"fmt"
+	"github.com/White-AK111/REST/internal/models"
+	"sort"
+	"time"
+)
+
+// trashed it's a deleted task in trash with ids of tasks which were blocked by it, dependencies are restored
+// with the task.
+type trashed struct {
+	task       models.Task
+	dependents []int
+}
+
+// exists reports whether task is in the store or in trash, must be called with lock held.
+func (ts *TaskStore) exists(id int) bool {
+	if _, ok := ts.tasks[id]; ok {
+		return true
+	}
+	_, ok := ts.trash[id]
+	return ok
+}
+
+// moveToTrash moves task from the store to trash, tasks blocked by it aren't blocked by it anymore.
+// Must be called with lock held.
+func (ts *TaskStore) moveToTrash(id int, deletedAt time.Time) {
+	task := ts.tasks[id]
+	dependents := make([]int, 0, len(ts.dependents[id]))
+	for dependent := range ts.dependents[id] {
+		dependents = append(dependents, dependent)
+	}
+	sort.Ints(dependents)
+
+	ts.unindex(task)
+	delete(ts.tasks, id)
+	ts.releaseDependents(id)
+	task.Progress, task.Blocked = nil, false
+	task.DeletedAt = &deletedAt
+	ts.trash[id] = trashed{task: task, dependents: dependents}
+}
+
+// restoreDependency makes task blocked by blocker again if both tasks are in the store and dependency doesn't
+// make a cycle. Dependency on task which is still in trash is kept in trash to be restored with it.
+// Must be called with lock held.
+func (ts *TaskStore) restoreDependency(id, blocker int) {
+	if entry, ok := ts.trash[blocker]; ok {
+		entry.dependents = append(entry.dependents, id)
+		ts.trash[blocker] = entry
+		return
+	}
+	if entry, ok := ts.trash[id]; ok {
+		entry.task.BlockedBy = append(entry.task.BlockedBy, blocker)
+		ts.trash[id] = entry
+		return
+	}
+
+	task, ok := ts.tasks[id]
+	if _, exists := ts.tasks[blocker]; !ok || !exists || ts.dependsOn(blocker, id) {
+		return
+	}
+	i := sort.SearchInts(task.BlockedBy, blocker)
+	if i < len(task.BlockedBy) && task.BlockedBy[i] == blocker {
+		return
+	}
+
+	ts.unindexBlockers(task)
+	task.BlockedBy = append(append(append([]int{}, task.BlockedBy[:i]...), blocker), task.BlockedBy[i:]...)
+	ts.tasks[id] = task
+	ts.indexBlockers(task)
+}
+
+// TrashTask moves the task with the given id and all its subtasks to trash, they are hidden from all queries
+// except GetTrash and can be restored. Tasks blocked by deleted tasks aren't blocked by them anymore.
+// If no such id exists, an error is returned. Task having open subtasks is deleted by policy of the store:
+// with its subtasks or not at all.
+func (ts *TaskStore) TrashTask(id int) error {
+	ts.Lock()
+	defer ts.Unlock()
+
+	if _, ok := ts.tasks[id]; !ok {
+		return fmt.Errorf("task with id=%d %w", id, models.ErrNotFound)
+	}
+	if ts.policy != models.CascadeSubtasks && ts.hasOpenSubtasks(id) {
+		return fmt.Errorf("task with id=%d %w", id, models.ErrHasSubtasks)
+	}
+
+	deletedAt := time.Now()
+	for _, subtask := range ts.descendants(id) {
+		ts.moveToTrash(subtask, deletedAt)
+	}
+	ts.moveToTrash(id, deletedAt)
+	return nil
+}
+
+// TrashAllTasks moves all tasks in the store to trash, tasks of archived projects included.
+func (ts *TaskStore) TrashAllTasks() error {
+	ts.Lock()
+	defer ts.Unlock()
+
+	deletedAt := time.Now()
+	for id := range ts.tasks {
+		ts.moveToTrash(id, deletedAt)
+	}
+	return nil
+}
+
+// GetTrash returns all the tasks in trash sorted by id.
+func (ts *TaskStore) GetTrash() []models.Task {
+	ts.Lock()
+	defer ts.Unlock()
+
+	tasks := make([]models.Task, 0, len(ts.trash))
+	for _, entry := range ts.trash {
+		tasks = append(tasks, entry.task)
+	}
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].Id < tasks[j].Id })
+	return tasks
+}
+
+// RestoreTask moves the task with the given id back from trash with its subtasks deleted together with it
+// and restores their dependencies. Task becomes top level one if its parent isn't in the store and gets
+// no project if its project doesn't exist. Returns sorted ids of restored tasks.
+// If no such id exists in trash, an error is returned.
+func (ts *TaskStore) RestoreTask(id int) ([]int, error) {
+	ts.Lock()
+	defer ts.Unlock()
+
+	root, ok := ts.trash[id]
+	if !ok {
+		return nil, fmt.Errorf("task with id=%d in trash %w", id, models.ErrNotFound)
+	}
+
+	// Parents are restored before their subtasks, so subtasks are indexed under restored parents.
+	var restored []trashed
+	for queue := []int{id}; len(queue) > 0; queue = queue[1:] {
+		entry := ts.trash[queue[0]]
+		restored = append(restored, entry)
+		for childId, child := range ts.trash {
+			if child.task.ParentId == entry.task.Id && child.task.DeletedAt.Equal(*root.task.DeletedAt) {
+				queue = append(queue, childId)
+			}
+		}
+
+		task := entry.task
+		task.DeletedAt = nil
+		task.BlockedBy = nil
+		if _, ok := ts.tasks[task.ParentId]; !ok {
+			task.ParentId = 0
+		}
+		if _, ok := ts.projects[task.ProjectId]; !ok {
+			task.ProjectId = 0
+		}
+		delete(ts.trash, task.Id)
+		ts.tasks[task.Id] = task
+		ts.index(task)
+	}
+
+	ids := make([]int, 0, len(restored))
+	for _, entry := range restored {
+		for _, blocker := range entry.task.BlockedBy {
+			ts.restoreDependency(entry.task.Id, blocker)
+		}
+		for _, dependent := range entry.dependents {
+			ts.restoreDependency(dependent, entry.task.Id)
+		}
+		ids = append(ids, entry.task.Id)
+	}
+	sort.Ints(ids)
+	return ids, nil
+}
+
+// PurgeTrash permanently deletes tasks which were moved to trash before the given time with their comments
+// and attachments, activity logs stay. Returns sorted ids of deleted tasks.
+func (ts *TaskStore) PurgeTrash(before time.Time) []int {
+	ts.Lock()
+	defer ts.Unlock()
+
+	var ids []int
+	for id, entry := range ts.trash {
+		if entry.task.DeletedAt.Before(before) {
+			delete(ts.trash, id)
+			delete(ts.comments, id)
+			delete(ts.attachments, id)
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	return ids
+}
@@ -1,24 +1,279 @@
 package models
 
 import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
 	"time"
 )
 
+var (
+	ErrNotFound    = errors.New("not found")
+	ErrConflict    = errors.New("already exists")
+	ErrHasSubtasks = errors.New("has open subtasks")
+	ErrCycle       = errors.New("would make a cycle")
+	ErrBlocked     = errors.New("is blocked by open tasks")
+)
+
 // Task structure it's a model for Task entity.
 type Task struct {
-	Id   int       `json:"id"`
-	Text string    `json:"text"`
-	Tags []string  `json:"tags"`
-	Due  time.Time `json:"due"`
+	Id        int        `json:"id" xml:"id" yaml:"id"`
+	Text      string     `json:"text" xml:"text" yaml:"text"`
+	Tags      []string   `json:"tags" xml:"tags>tag" yaml:"tags"`
+	Due       time.Time  `json:"due" xml:"due" yaml:"due"`
+	RRule     string     `json:"rrule,omitempty" xml:"rrule,omitempty" yaml:"rrule,omitempty"`                // recurrence rule of RFC 5545, due date is the start of series
+	Virtual   bool       `json:"virtual,omitempty" xml:"virtual,omitempty" yaml:"virtual,omitempty"`          // future occurrence of recurring task expanded by due date queries
+	ParentId  int        `json:"parentId,omitempty" xml:"parentId,omitempty" yaml:"parentId,omitempty"`       // id of parent task of subtask
+	Done      bool       `json:"done,omitempty" xml:"done,omitempty" yaml:"done,omitempty"`                   // completed subtask or task having subtasks, it stays for progress
+	Progress  *Progress  `json:"progress,omitempty" xml:"progress,omitempty" yaml:"progress,omitempty"`       // rollup of subtasks, computed by repository
+	BlockedBy []int      `json:"blockedBy,omitempty" xml:"blockedBy>id,omitempty" yaml:"blockedBy,omitempty"` // ids of tasks which must be completed before the task
+	Blocked   bool       `json:"blocked,omitempty" xml:"blocked,omitempty" yaml:"blocked,omitempty"`          // some of blockers are open, computed by repository
+	ProjectId int        `json:"projectId,omitempty" xml:"projectId,omitempty" yaml:"projectId,omitempty"`    // id of project of task
+	DeletedAt *time.Time `json:"deletedAt,omitempty" xml:"deletedAt,omitempty" yaml:"deletedAt,omitempty"`    // time of soft deletion of task in trash
+	Owner     string     `json:"owner,omitempty" xml:"owner,omitempty" yaml:"owner,omitempty"`                // user who created task
+	Shares    []Share    `json:"shares,omitempty" xml:"shares>share,omitempty" yaml:"shares,omitempty"`       // users whom owner shared task with
+}
+
+// Access it's a level of access of user to shared task.
+type Access string
+
+const (
+	ReadAccess  Access = "read"  // user sees task, its comments and attachments, and comments it
+	WriteAccess Access = "write" // user also changes task, its subtasks, dependencies and attachments
+)
+
+// Share structure it's an access of user to task of another user.
+type Share struct {
+	User   string `json:"user" xml:"user" yaml:"user"`
+	Access Access `json:"access" xml:"access" yaml:"access"`
+}
+
+// ValidateShares checks that shares have users and known access.
+func ValidateShares(shares []Share) error {
+	for _, share := range shares {
+		if share.User == "" {
+			return fmt.Errorf("user of share must not be empty")
+		}
+		if share.Access != ReadAccess && share.Access != WriteAccess {
+			return fmt.Errorf("unknown access %q of user %q, expect read or write", share.Access, share.User)
+		}
+	}
+	return nil
+}
+
+// Project structure it's a model for Project entity, a list of tasks. Tasks of archived project are hidden
+// from lists of all tasks and from queries by tag, due date and search.
+type Project struct {
+	Id       int    `json:"id" xml:"id" yaml:"id"`
+	Name     string `json:"name" xml:"name" yaml:"name"`
+	Archived bool   `json:"archived,omitempty" xml:"archived,omitempty" yaml:"archived,omitempty"`
+	Owner    string `json:"owner,omitempty" xml:"owner,omitempty" yaml:"owner,omitempty"` // user who created project
+}
+
+// Comment structure it's a comment in thread of task.
+type Comment struct {
+	Id     int       `json:"id" xml:"id" yaml:"id"`
+	TaskId int       `json:"taskId" xml:"taskId" yaml:"taskId"`
+	Author string    `json:"author" xml:"author" yaml:"author"`
+	Text   string    `json:"text" xml:"text" yaml:"text"`
+	Time   time.Time `json:"time" xml:"time" yaml:"time"`
+}
+
+// Attachment structure it's a file attached to task, its content is kept in blob store apart from repository.
+type Attachment struct {
+	Id          int       `json:"id" xml:"id" yaml:"id"`
+	TaskId      int       `json:"taskId" xml:"taskId" yaml:"taskId"`
+	Name        string    `json:"name" xml:"name" yaml:"name"`
+	ContentType string    `json:"contentType" xml:"contentType" yaml:"contentType"`
+	Size        int64     `json:"size" xml:"size" yaml:"size"`
+	Time        time.Time `json:"time" xml:"time" yaml:"time"`
+}
+
+// Activity structure it's an entry of activity log of task: who changed which fields of task and when.
+type Activity struct {
+	Id      int       `json:"id" xml:"id" yaml:"id"`
+	TaskId  int       `json:"taskId" xml:"taskId" yaml:"taskId"`
+	Actor   string    `json:"actor" xml:"actor" yaml:"actor"`
+	Action  string    `json:"action" xml:"action" yaml:"action"` // created, updated or deleted
+	Changes []Change  `json:"changes" xml:"changes>change" yaml:"changes"`
+	Time    time.Time `json:"time" xml:"time" yaml:"time"`
+}
+
+// Change structure it's a change of one field of task, values are formatted as text, empty for missing value.
+type Change struct {
+	Field string `json:"field" xml:"field" yaml:"field"`
+	Old   string `json:"old" xml:"old" yaml:"old"`
+	New   string `json:"new" xml:"new" yaml:"new"`
+}
+
+// Limits of count of items on one page of comments and activity log.
+const (
+	DefaultPageLimit = 50
+	MaxPageLimit     = 500
+)
+
+// ParsePage returns offset and limit of page from query parameters, empty parameters mean the first page
+// of default size.
+func ParsePage(offset, limit string) (int, int, error) {
+	o, l := 0, DefaultPageLimit
+	var err error
+	if offset != "" {
+		if o, err = strconv.Atoi(offset); err != nil || o < 0 {
+			return 0, 0, fmt.Errorf("offset must be non-negative integer, got %q", offset)
+		}
+	}
+	if limit != "" {
+		if l, err = strconv.Atoi(limit); err != nil || l < 1 || l > MaxPageLimit {
+			return 0, 0, fmt.Errorf("limit must be integer in 1..%d, got %q", MaxPageLimit, limit)
+		}
+	}
+	return o, l, nil
+}
+
+// Progress structure it's a rollup of all subtasks of task, including subtasks of subtasks.
+type Progress struct {
+	Done  int `json:"done" xml:"done" yaml:"done"`
+	Total int `json:"total" xml:"total" yaml:"total"`
+}
+
+// SubtaskPolicy it's a way to delete or complete task having open subtasks.
+type SubtaskPolicy string
+
+const (
+	RejectSubtasks  SubtaskPolicy = "reject"  // such task can't be deleted or completed
+	CascadeSubtasks SubtaskPolicy = "cascade" // subtasks are deleted or completed with task
+)
+
+// ParseSubtaskPolicy returns subtask policy by its name.
+func ParseSubtaskPolicy(name string) (SubtaskPolicy, error) {
+	switch policy := SubtaskPolicy(name); policy {
+	case RejectSubtasks, CascadeSubtasks:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown subtask policy %q, expect reject or cascade", name)
+	}
+}
+
+// TagCount structure it's a tag with count of tasks having it.
+type TagCount struct {
+	Tag   string `json:"tag" xml:"tag" yaml:"tag"`
+	Count int    `json:"count" xml:"count" yaml:"count"`
+}
+
+// DateLayout it's a layout of due date in queries by date, like "2021-09-30".
+const DateLayout = "2006-01-02"
+
+// Range of years of due dates in queries by date, like four digits of year of DateLayout.
+const (
+	MinYear = 1
+	MaxYear = 9999
+)
+
+// TagSeparator separates levels of hierarchical tags like "work/backend/api".
+const TagSeparator = "/"
+
+// TagTree returns tag pattern for GetTasksByTag which matches the tag and all its descendants.
+func TagTree(tag string) string {
+	return tag + TagSeparator + "**"
+}
+
+// OrderByDependency returns tasks sorted topologically: blockers go before tasks blocked by them,
+// otherwise tasks go in order of ids. Blockers missing in tasks are ignored.
+func OrderByDependency(tasks []Task) []Task {
+	byId := make(map[int]Task, len(tasks))
+	for _, task := range tasks {
+		byId[task.Id] = task
+	}
+
+	pending := make(map[int]int, len(tasks)) // id -> count of blockers not ordered yet
+	dependents := make(map[int][]int, len(tasks))
+	ready := make([]int, 0, len(tasks))
+	for id, task := range byId {
+		for _, blocker := range task.BlockedBy {
+			if _, ok := byId[blocker]; ok {
+				pending[id]++
+				dependents[blocker] = append(dependents[blocker], id)
+			}
+		}
+		if pending[id] == 0 {
+			ready = append(ready, id)
+		}
+	}
+
+	ordered := make([]Task, 0, len(byId))
+	for len(ready) > 0 {
+		sort.Ints(ready)
+		id := ready[0]
+		ready = ready[1:]
+		ordered = append(ordered, byId[id])
+		for _, dependent := range dependents[id] {
+			pending[dependent]--
+			if pending[dependent] == 0 {
+				ready = append(ready, dependent)
+			}
+		}
+	}
+	return ordered
+}
+
+// AllTasks returns all tasks of repository sorted by id, tasks of archived projects included.
+func AllTasks(repo Repository) []Task {
+	tasks := repo.GetAllTasks()
+	for _, project := range repo.GetAllProjects() {
+		if !project.Archived {
+			continue
+		}
+		if archived, err := repo.GetProjectTasks(project.Id); err == nil {
+			tasks = append(tasks, archived...)
+		}
+	}
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].Id < tasks[j].Id })
+	return tasks
 }
 
 // Repository interface for all repository methods.
 type Repository interface {
-	CreateTask(text string, tags []string, due time.Time) int
+	CreateTask(task Task) (int, error)
+	InsertTask(task Task) error
+	UpdateTask(task Task) error
 	GetTask(id int) (Task, error)
 	DeleteTask(id int) error
 	DeleteAllTasks() error
+	ShareTask(id int, shares []Share) error
+	TrashTask(id int) error
+	TrashAllTasks() error
+	GetTrash() []Task
+	RestoreTask(id int) ([]int, error)
+	PurgeTrash(before time.Time) []int
 	GetAllTasks() []Task
+	CountTasks() int
+	GetChildren(id int) ([]Task, error)
+	AddDependencies(id int, blockers []int) error
+	RemoveDependency(id, blocker int) error
 	GetTasksByTag(tag string) []Task
 	GetTasksByDueDate(year int, month time.Month, day int) []Task
+	GetTasksByDueRange(from, to time.Time) []Task
+	GetAllTags() []TagCount
+	RenameTag(tag, newTag string) ([]int, error)
+	MergeTags(tags []string, into string) ([]int, error)
+	DeleteTag(tag string) ([]int, error)
+	ReplaceTags(ids []int, tags []string, into string) []int
+	SearchTasks(query string) []Task
+	CreateProject(project Project) int
+	GetProject(id int) (Project, error)
+	GetAllProjects() []Project
+	UpdateProject(project Project) error
+	DeleteProject(id int) ([]int, error)
+	GetProjectTasks(id int) ([]Task, error)
+	GetProjectTasksByTag(id int, tag string) ([]Task, error)
+	GetProjectTasksByDueDate(id int, year int, month time.Month, day int) ([]Task, error)
+	AddComment(comment Comment) (Comment, error)
+	GetComments(taskId, offset, limit int) ([]Comment, int, error)
+	AddActivity(activity Activity) error
+	GetActivity(taskId, offset, limit int) ([]Activity, int, error)
+	AddAttachment(attachment Attachment) (Attachment, error)
+	GetAttachments(taskId int) ([]Attachment, error)
+	GetAttachment(taskId, id int) (Attachment, error)
+	DeleteAttachment(taskId, id int) error
 }
@@ -0,0 +1,158 @@
+package oidc
+
+import (
+	"errors"
+	"fmt"
+	"github.com/White-AK111/REST/internal/codec"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// pathPrefix it's a prefix of paths of login by providers.
+const pathPrefix = "/auth/oidc/"
+
+// cookieName it's a name of cookie binding login to browser which started it.
+const cookieName = "oidc_login"
+
+// handler it's a HTTP API of login by providers.
+type handler struct {
+	ps   *Providers
+	next http.Handler
+}
+
+// Handler returns handler of "auth/oidc" path for net/http based servers, requests of other paths are served
+// by next, e.g. by session.Handler:
+//
+//	GET /auth/oidc/<name>/login     redirect to provider to log in
+//	GET /auth/oidc/<name>/callback  redirect URL of provider with state and code, returns tokens of local user
+func Handler(ps *Providers, next http.Handler) http.Handler {
+	return &handler{ps: ps, next: next}
+}
+
+// ServeHTTP routes request by path and method.
+func (h *handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if !strings.HasPrefix(req.URL.Path, pathPrefix) {
+		h.next.ServeHTTP(w, req)
+		return
+	}
+	if h.ps == nil {
+		http.Error(w, ErrNotFound.Error(), http.StatusNotFound)
+		return
+	}
+
+	pathParts := strings.Split(strings.Trim(strings.TrimPrefix(req.URL.Path, pathPrefix), "/"), "/")
+	if len(pathParts) != 2 {
+		http.NotFound(w, req)
+		return
+	}
+	if req.Method != http.MethodGet {
+		http.Error(w, fmt.Sprintf("expect method GET at %s, got %v", req.URL.Path, req.Method), http.StatusMethodNotAllowed)
+		return
+	}
+
+	switch pathParts[1] {
+	case "login":
+		h.loginHandler(w, req, pathParts[0])
+	case "callback":
+		h.callbackHandler(w, req, pathParts[0])
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+// loginHandler handler for "auth/oidc/<name>/login" path, redirects to provider. Login is bound to browser
+// by cookie and limited by IP address of client.
+func (h *handler) loginHandler(w http.ResponseWriter, req *http.Request, name string) {
+	client, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		client = req.RemoteAddr
+	}
+	location, binding, err := h.ps.Login(name, client)
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     cookieName,
+		Value:    binding,
+		Path:     pathPrefix + name + "/",
+		MaxAge:   int(flowTTL / time.Second),
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, req, location, http.StatusFound)
+}
+
+// callbackHandler handler for "auth/oidc/<name>/callback" path, finishes login.
+func (h *handler) callbackHandler(w http.ResponseWriter, req *http.Request, name string) {
+	query := req.URL.Query()
+	if e := query.Get("error"); e != "" {
+		http.Error(w, fmt.Sprintf("%s: %s %s", ErrProvider, e, query.Get("error_description")), http.StatusUnauthorized)
+		return
+	}
+
+	var binding string
+	if cookie, err := req.Cookie(cookieName); err == nil {
+		binding = cookie.Value
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     cookieName,
+		Path:     pathPrefix + name + "/",
+		MaxAge:   -1,
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	tokens, err := h.ps.Callback(name, query.Get("state"), binding, query.Get("code"))
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	render(w, req, http.StatusOK, tokens)
+}
+
+// errorStatus returns HTTP status code of error of login by provider.
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrState):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrProvider), errors.Is(err, ErrToken):
+		return http.StatusUnauthorized
+	case errors.Is(err, ErrUnmapped):
+		return http.StatusForbidden
+	case errors.Is(err, ErrDiscovery):
+		return http.StatusBadGateway
+	case errors.Is(err, ErrBusy):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, ErrTooMany):
+		return http.StatusTooManyRequests
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// render renders 'v' in format negotiated by Accept header of req and writes it as a response with status code.
+func render(w http.ResponseWriter, req *http.Request, code int, v interface{}) {
+	enc, err := codec.Negotiate(req.Header.Get("Accept"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotAcceptable)
+		return
+	}
+	data, err := enc.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", enc.ContentType())
+	w.WriteHeader(code)
+	_, _ = w.Write(data)
+}
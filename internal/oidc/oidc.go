@@ -0,0 +1,389 @@
+// Package oidc logs users in by OpenID Connect providers of config with authorization code flow and PKCE
+// (RFC 7636): endpoints of provider are discovered by its issuer, ID token of provider is verified by keys
+// of provider and its claim is mapped to local user, then session.Sessions issues tokens to the local user.
+// State of login is bound to browser which started it by a cookie, so callback of login started by somebody else
+// is rejected (login CSRF).
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/White-AK111/REST/config"
+	"github.com/White-AK111/REST/internal/jwt"
+	"github.com/White-AK111/REST/internal/session"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// discoveryPath it's a path of discovery document of provider relative to its issuer.
+const discoveryPath = "/.well-known/openid-configuration"
+
+// maxResponseSize it's a max size of responses of provider.
+const maxResponseSize = 1 << 20
+
+// flowTTL it's a time given to user to log in at provider.
+const flowTTL = 10 * time.Minute
+
+// maxFlows it's a max count of started flows, flows are started by unauthenticated requests.
+const maxFlows = 10000
+
+// maxClientFlows it's a max count of flows started by one client and not finished yet, so one client can't
+// exhaust maxFlows.
+const maxClientFlows = 20
+
+// Errors of login by providers.
+var (
+	ErrNotFound  = errors.New("provider isn't found")
+	ErrDiscovery = errors.New("discovery of provider failed")
+	ErrState     = errors.New("state of login is invalid or expired")
+	ErrBusy      = errors.New("too many logins are in progress")
+	ErrTooMany   = errors.New("too many logins are started by client, finish them or try later")
+	ErrProvider  = errors.New("provider rejected login")
+	ErrToken     = errors.New("ID token is invalid")
+	ErrUnmapped  = errors.New("user of provider isn't mapped to local user")
+)
+
+// discovery it's a discovery document of provider (OpenID Connect Discovery 1.0).
+type discovery struct {
+	Issuer                string   `json:"issuer"`
+	AuthorizationEndpoint string   `json:"authorization_endpoint"`
+	TokenEndpoint         string   `json:"token_endpoint"`
+	JWKSURI               string   `json:"jwks_uri"`
+	CodeChallengeMethods  []string `json:"code_challenge_methods_supported"`
+}
+
+// Provider it's an OpenID Connect provider with local users mapped to values of claim of its ID tokens.
+type Provider struct {
+	sync.Mutex
+	cfg      config.Provider
+	users    map[string]string
+	ttl      time.Duration // cache TTL of keys of provider
+	leeway   time.Duration
+	client   *http.Client
+	endpoint *discovery    // nil until discovery succeeds
+	verifier *jwt.Verifier // verifier of ID tokens by keys of provider
+}
+
+// flow it's a login started by redirect to provider and finished by callback.
+type flow struct {
+	provider  *Provider
+	verifier  string // code verifier of PKCE
+	nonce     string
+	binding   string // value of cookie of browser which started login
+	client    string
+	expiresAt time.Time
+}
+
+// Providers it's a providers of config by name and logins started at them.
+type Providers struct {
+	sync.Mutex
+	sessions  *session.Sessions
+	providers map[string]*Provider
+	flows     map[string]*flow // by state
+	clients   map[string]int   // count of flows by client
+	now       func() time.Time
+}
+
+// New function initialize a new Providers with providers from config, returns nil Providers if there are no providers.
+// Tokens of users logged in by providers are issued by sessions, so login must be enabled.
+func New(cfg *config.Config, sessions *session.Sessions) (*Providers, error) {
+	if len(cfg.Auth.OIDC) == 0 {
+		return nil, nil
+	}
+	if sessions == nil {
+		return nil, errors.New("OpenID Connect login requires keys of login")
+	}
+
+	local := make(map[string]bool, len(cfg.Auth.Users))
+	for _, u := range cfg.Auth.Users {
+		local[u.Name] = true
+	}
+	providers := make(map[string]*Provider, len(cfg.Auth.OIDC))
+	for _, c := range cfg.Auth.OIDC {
+		if c.Name == "" || strings.Contains(c.Name, "/") {
+			return nil, fmt.Errorf("name of provider %q must be non-empty without slashes", c.Name)
+		}
+		if _, ok := providers[c.Name]; ok {
+			return nil, fmt.Errorf("provider %q is duplicated", c.Name)
+		}
+		if c.Issuer == "" || c.ClientID == "" || c.RedirectURL == "" {
+			return nil, fmt.Errorf("issuer, clientID and redirectURL of provider %q are required", c.Name)
+		}
+		if c.Claim == "" {
+			c.Claim = "sub"
+		}
+		users := make(map[string]string, len(c.Users))
+		for _, u := range c.Users {
+			if !local[u.User] {
+				return nil, fmt.Errorf("provider %q maps %q to unknown user %q", c.Name, u.Value, u.User)
+			}
+			users[u.Value] = u.User
+		}
+		providers[c.Name] = &Provider{
+			cfg:    c,
+			users:  users,
+			ttl:    cfg.Auth.JWT.JWKSCacheTTL,
+			leeway: cfg.Auth.JWT.Leeway,
+			client: &http.Client{Timeout: 10 * time.Second},
+		}
+	}
+
+	return &Providers{
+		sessions:  sessions,
+		providers: providers,
+		flows:     make(map[string]*flow),
+		clients:   make(map[string]int),
+		now:       time.Now,
+	}, nil
+}
+
+// randomString returns n random bytes encoded by base64url.
+func randomString(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("oidc: random: %s", err))
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// challenge returns S256 code challenge of code verifier of PKCE.
+func challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// Login starts login of client, e.g. IP address of request, at provider by name. Returns URL of provider
+// to redirect user to and binding which must be kept by browser of user, e.g. in cookie, and passed to Callback.
+func (ps *Providers) Login(name, client string) (location, binding string, err error) {
+	p, ok := ps.providers[name]
+	if !ok {
+		return "", "", fmt.Errorf("%w: %q", ErrNotFound, name)
+	}
+	endpoint, _, err := p.discover()
+	if err != nil {
+		return "", "", err
+	}
+
+	state := randomString(32)
+	f := &flow{provider: p, verifier: randomString(32), nonce: randomString(16), binding: randomString(32), client: client}
+	ps.Lock()
+	ps.purge()
+	if ps.clients[client] >= maxClientFlows {
+		ps.Unlock()
+		return "", "", ErrTooMany
+	}
+	if len(ps.flows) >= maxFlows {
+		ps.Unlock()
+		return "", "", ErrBusy
+	}
+	f.expiresAt = ps.now().Add(flowTTL)
+	ps.flows[state] = f
+	ps.clients[client]++
+	ps.Unlock()
+
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.cfg.ClientID},
+		"redirect_uri":          {p.cfg.RedirectURL},
+		"scope":                 {strings.Join(append([]string{"openid"}, p.cfg.Scopes...), " ")},
+		"state":                 {state},
+		"nonce":                 {f.nonce},
+		"code_challenge":        {challenge(f.verifier)},
+		"code_challenge_method": {"S256"},
+	}
+	separator := "?"
+	if strings.Contains(endpoint.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return endpoint.AuthorizationEndpoint + separator + query.Encode(), f.binding, nil
+}
+
+// Callback finishes login at provider by name with state and code of callback and binding of browser returned
+// by Login: code is exchanged for ID token, user of ID token is mapped to local user and session of local user
+// is started.
+func (ps *Providers) Callback(name, state, binding, code string) (session.Tokens, error) {
+	ps.Lock()
+	ps.purge()
+	f, ok := ps.flows[state]
+	if ok {
+		ps.finish(state, f) // state is used once
+	}
+	ps.Unlock()
+	if !ok || f.provider.cfg.Name != name {
+		return session.Tokens{}, ErrState
+	}
+	if subtle.ConstantTimeCompare([]byte(binding), []byte(f.binding)) != 1 {
+		return session.Tokens{}, fmt.Errorf("%w: login was started by another browser", ErrState)
+	}
+	if code == "" {
+		return session.Tokens{}, fmt.Errorf("%w: code is required", ErrProvider)
+	}
+
+	claims, err := f.provider.exchange(code, f.verifier, f.nonce)
+	if err != nil {
+		return session.Tokens{}, err
+	}
+	user, err := f.provider.user(claims)
+	if err != nil {
+		return session.Tokens{}, err
+	}
+	return ps.sessions.Start(user)
+}
+
+// purge deletes expired flows, providers must be locked.
+func (ps *Providers) purge() {
+	now := ps.now()
+	for state, f := range ps.flows {
+		if now.After(f.expiresAt) {
+			ps.finish(state, f)
+		}
+	}
+}
+
+// finish deletes flow by state, providers must be locked.
+func (ps *Providers) finish(state string, f *flow) {
+	delete(ps.flows, state)
+	if ps.clients[f.client]--; ps.clients[f.client] <= 0 {
+		delete(ps.clients, f.client)
+	}
+}
+
+// getJSON gets JSON document by URL into v.
+func (p *Provider) getJSON(u string, v interface{}) error {
+	resp, err := p.client.Get(u)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s responded with status %s", u, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(v)
+}
+
+// discover returns endpoints and verifier of ID tokens of provider, discovery document is loaded once,
+// it's loaded again on next login if loading fails.
+func (p *Provider) discover() (*discovery, *jwt.Verifier, error) {
+	p.Lock()
+	defer p.Unlock()
+	if p.endpoint != nil {
+		return p.endpoint, p.verifier, nil
+	}
+
+	var d discovery
+	if err := p.getJSON(strings.TrimSuffix(p.cfg.Issuer, "/")+discoveryPath, &d); err != nil {
+		return nil, nil, fmt.Errorf("%w: %s", ErrDiscovery, err)
+	}
+	if d.Issuer != p.cfg.Issuer {
+		return nil, nil, fmt.Errorf("%w: issuer %q of discovery document isn't %q", ErrDiscovery, d.Issuer, p.cfg.Issuer)
+	}
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JWKSURI == "" {
+		return nil, nil, fmt.Errorf("%w: authorization, token and JWKS endpoints are required", ErrDiscovery)
+	}
+	if len(d.CodeChallengeMethods) > 0 && !contains(d.CodeChallengeMethods, "S256") {
+		return nil, nil, fmt.Errorf("%w: provider doesn't support S256 code challenge", ErrDiscovery)
+	}
+	verifier, err := jwt.New(jwt.Options{
+		Algorithms: []string{jwt.RS256, jwt.ES256},
+		Keys:       jwt.RemoteKeySet(d.JWKSURI, p.ttl),
+		Issuer:     d.Issuer,
+		Audience:   p.cfg.ClientID,
+		Leeway:     p.leeway,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	p.endpoint, p.verifier = &d, verifier
+	return p.endpoint, p.verifier, nil
+}
+
+// exchange exchanges code for ID token at token endpoint of provider and returns verified claims of ID token.
+func (p *Provider) exchange(code, codeVerifier, nonce string) (jwt.Claims, error) {
+	endpoint, verifier, err := p.discover()
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"code_verifier": {codeVerifier},
+	}
+	if p.cfg.ClientSecret == "" {
+		form.Set("client_id", p.cfg.ClientID)
+	}
+	req, err := http.NewRequest(http.MethodPost, endpoint.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrProvider, err)
+	}
+	defer resp.Body.Close()
+
+	var tr struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err = json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(&tr); err != nil {
+		return nil, fmt.Errorf("%w: token response with status %s: %s", ErrProvider, resp.Status, err)
+	}
+	if resp.StatusCode != http.StatusOK || tr.Error != "" {
+		return nil, fmt.Errorf("%w: %s %s", ErrProvider, tr.Error, tr.ErrorDescription)
+	}
+
+	claims, err := verifier.Verify(tr.IDToken)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrToken, err)
+	}
+	if claims.String("nonce") != nonce {
+		return nil, fmt.Errorf("%w: nonce doesn't match", ErrToken)
+	}
+	if azp := claims.String("azp"); len(claims.Audience()) > 1 && azp != p.cfg.ClientID {
+		return nil, fmt.Errorf("%w: authorized party %q isn't client", ErrToken, azp)
+	}
+	return claims, nil
+}
+
+// user returns local user mapped to claim of ID token, email is mapped only if it's verified.
+func (p *Provider) user(claims jwt.Claims) (string, error) {
+	value := claims.String(p.cfg.Claim)
+	if value == "" {
+		return "", fmt.Errorf("%w: ID token has no %q claim", ErrUnmapped, p.cfg.Claim)
+	}
+	if verified, ok := claims["email_verified"].(bool); p.cfg.Claim == "email" && ok && !verified {
+		return "", fmt.Errorf("%w: email %q isn't verified", ErrUnmapped, value)
+	}
+	user, ok := p.users[value]
+	if !ok {
+		return "", fmt.Errorf("%w: %s %q", ErrUnmapped, p.cfg.Claim, value)
+	}
+	return user, nil
+}
+
+// contains reports whether values contain value.
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
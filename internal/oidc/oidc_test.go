@@ -0,0 +1,286 @@
+package oidc
+
+import (
+	"errors"
+	"github.com/White-AK111/REST/config"
+	"github.com/White-AK111/REST/internal/oidc/oidctest"
+	"github.com/White-AK111/REST/internal/session"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// client it's a client of logins in tests.
+const client = "192.0.2.1"
+
+// setup starts mock provider and returns it with Providers logging in alice@example.com as alice by it.
+func setup(t *testing.T) (*oidctest.Provider, *Providers, *session.Sessions) {
+	t.Helper()
+	mock, err := oidctest.New("tasks", "", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(mock.Handler())
+	t.Cleanup(srv.Close)
+	mock.Issuer = srv.URL
+
+	cfg := &config.Config{}
+	cfg.Auth.Users = []config.User{{Name: "alice"}}
+	cfg.Auth.Login.Issuer = "tasks"
+	cfg.Auth.Login.AccessTTL = time.Minute
+	cfg.Auth.Login.RefreshTTL = time.Hour
+	cfg.Auth.Login.Keys = []config.Key{{Id: "k1", Secret: "0123456789abcdef0123456789abcdef"}}
+	cfg.Auth.JWT.JWKSCacheTTL = time.Minute
+	cfg.Auth.OIDC = []config.Provider{{
+		Name:        "mock",
+		Issuer:      srv.URL,
+		ClientID:    "tasks",
+		RedirectURL: "http://localhost/auth/oidc/mock/callback",
+		Claim:       "email",
+		Users:       []config.ClaimUser{{Value: "alice@example.com", User: "alice"}},
+	}}
+
+	sessions, err := session.New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ps, err := New(cfg, sessions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mock, ps, sessions
+}
+
+// authorize follows redirect to provider by location and returns state and code of redirect back to client.
+func authorize(t *testing.T, location string) (state, code string) {
+	t.Helper()
+	noRedirect := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := noRedirect.Get(location)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorization responded with status %s", resp.Status)
+	}
+	redirect, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := redirect.Query()
+	if e := query.Get("error"); e != "" {
+		t.Fatalf("authorization failed: %s %s", e, query.Get("error_description"))
+	}
+	return query.Get("state"), query.Get("code")
+}
+
+// withQuery returns location with parameter of query set to value.
+func withQuery(t *testing.T, location, param, value string) string {
+	t.Helper()
+	u, err := url.Parse(location)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := u.Query()
+	query.Set(param, value)
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+func TestLogin(t *testing.T) {
+	mock, ps, sessions := setup(t)
+
+	location, binding, err := ps.Login("mock", client)
+	if err != nil {
+		t.Fatalf("Login: %s", err)
+	}
+	if !strings.HasPrefix(location, mock.Issuer+"/authorize?") {
+		t.Errorf("Login redirects to %s, want discovered authorization endpoint", location)
+	}
+	u, _ := url.Parse(location)
+	if method := u.Query().Get("code_challenge_method"); method != "S256" {
+		t.Errorf("code_challenge_method is %q, want S256", method)
+	}
+
+	state, code := authorize(t, location)
+	tokens, err := ps.Callback("mock", state, binding, code)
+	if err != nil {
+		t.Fatalf("Callback: %s", err)
+	}
+	user, err := sessions.Verify(tokens.AccessToken)
+	if err != nil || user != "alice" {
+		t.Errorf("access token is of user %q (%v), want alice", user, err)
+	}
+}
+
+func TestDiscoveryIssuerMismatch(t *testing.T) {
+	mock, ps, _ := setup(t)
+	mock.Issuer = "http://issuer.invalid"
+
+	if _, _, err := ps.Login("mock", client); !errors.Is(err, ErrDiscovery) {
+		t.Errorf("Login with discovery document of another issuer: %v, want %v", err, ErrDiscovery)
+	}
+}
+
+func TestUnknownProvider(t *testing.T) {
+	_, ps, _ := setup(t)
+
+	if _, _, err := ps.Login("other", client); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Login by unknown provider: %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestPKCEMismatch(t *testing.T) {
+	_, ps, _ := setup(t)
+
+	location, binding, err := ps.Login("mock", client)
+	if err != nil {
+		t.Fatalf("Login: %s", err)
+	}
+	// Code is issued for challenge of another verifier, e.g. code of attacker injected into callback.
+	state, code := authorize(t, withQuery(t, location, "code_challenge", challenge("another verifier")))
+	if _, err = ps.Callback("mock", state, binding, code); !errors.Is(err, ErrProvider) {
+		t.Errorf("Callback with code of another code challenge: %v, want %v", err, ErrProvider)
+	}
+}
+
+func TestIDTokenClaims(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims func(claims map[string]interface{})
+		err    error
+	}{
+		{"nonce mismatch", func(c map[string]interface{}) { c["nonce"] = "another nonce" }, ErrToken},
+		{"wrong audience", func(c map[string]interface{}) { c["aud"] = "another client" }, ErrToken},
+		{"wrong issuer", func(c map[string]interface{}) { c["iss"] = "http://issuer.invalid" }, ErrToken},
+		{"expired", func(c map[string]interface{}) { c["exp"] = time.Now().Add(-time.Hour).Unix() }, ErrToken},
+		{"unmapped claim", func(c map[string]interface{}) { c["email"] = "mallory@example.com" }, ErrUnmapped},
+		{"missing claim", func(c map[string]interface{}) { delete(c, "email") }, ErrUnmapped},
+		{"unverified email", func(c map[string]interface{}) { c["email_verified"] = false }, ErrUnmapped},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock, ps, _ := setup(t)
+			mock.Claims = tt.claims
+
+			location, binding, err := ps.Login("mock", client)
+			if err != nil {
+				t.Fatalf("Login: %s", err)
+			}
+			state, code := authorize(t, location)
+			if _, err = ps.Callback("mock", state, binding, code); !errors.Is(err, tt.err) {
+				t.Errorf("Callback: %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestStateReuse(t *testing.T) {
+	_, ps, _ := setup(t)
+
+	location, binding, err := ps.Login("mock", client)
+	if err != nil {
+		t.Fatalf("Login: %s", err)
+	}
+	state, code := authorize(t, location)
+	if _, err = ps.Callback("mock", state, binding, code); err != nil {
+		t.Fatalf("Callback: %s", err)
+	}
+	if _, err = ps.Callback("mock", state, binding, code); !errors.Is(err, ErrState) {
+		t.Errorf("Callback with used state: %v, want %v", err, ErrState)
+	}
+}
+
+func TestStateOfAnotherBrowser(t *testing.T) {
+	_, ps, _ := setup(t)
+
+	location, _, err := ps.Login("mock", client)
+	if err != nil {
+		t.Fatalf("Login: %s", err)
+	}
+	_, binding, err := ps.Login("mock", client)
+	if err != nil {
+		t.Fatalf("Login: %s", err)
+	}
+	state, code := authorize(t, location)
+	if _, err = ps.Callback("mock", state, binding, code); !errors.Is(err, ErrState) {
+		t.Errorf("Callback with binding of another login: %v, want %v", err, ErrState)
+	}
+	if _, err = ps.Callback("mock", "unknown state", binding, code); !errors.Is(err, ErrState) {
+		t.Errorf("Callback with unknown state: %v, want %v", err, ErrState)
+	}
+}
+
+func TestClientFlowsLimit(t *testing.T) {
+	_, ps, _ := setup(t)
+
+	for i := 0; i < maxClientFlows; i++ {
+		if _, _, err := ps.Login("mock", client); err != nil {
+			t.Fatalf("Login #%d: %s", i+1, err)
+		}
+	}
+	if _, _, err := ps.Login("mock", client); !errors.Is(err, ErrTooMany) {
+		t.Errorf("Login above limit of client: %v, want %v", err, ErrTooMany)
+	}
+	if _, _, err := ps.Login("mock", "192.0.2.2"); err != nil {
+		t.Errorf("Login of another client: %s", err)
+	}
+
+	ps.now = func() time.Time { return time.Now().Add(flowTTL + time.Minute) }
+	if _, _, err := ps.Login("mock", client); err != nil {
+		t.Errorf("Login after flows of client are expired: %s", err)
+	}
+}
+
+func TestHandlerBindsLoginToCookie(t *testing.T) {
+	_, ps, _ := setup(t)
+	h := Handler(ps, http.NotFoundHandler())
+
+	req := httptest.NewRequest(http.MethodGet, "/auth/oidc/mock/login", nil)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusFound {
+		t.Fatalf("login responded with status %d: %s", rec.Code, rec.Body)
+	}
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != cookieName {
+		t.Fatalf("login sets cookies %v, want %s", cookies, cookieName)
+	}
+	cookie := cookies[0]
+	if !cookie.Secure || !cookie.HttpOnly || cookie.SameSite != http.SameSiteLaxMode {
+		t.Errorf("cookie %s isn't Secure, HttpOnly and SameSite=Lax", cookie)
+	}
+
+	state, code := authorize(t, rec.Header().Get("Location"))
+	callback := "/auth/oidc/mock/callback?" + url.Values{"state": {state}, "code": {code}}.Encode()
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, callback, nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("callback without cookie responded with status %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestHandlerCallback(t *testing.T) {
+	_, ps, _ := setup(t)
+	h := Handler(ps, http.NotFoundHandler())
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/auth/oidc/mock/login", nil))
+	cookie := rec.Result().Cookies()[0]
+	state, code := authorize(t, rec.Header().Get("Location"))
+
+	req := httptest.NewRequest(http.MethodGet, "/auth/oidc/mock/callback?"+url.Values{"state": {state}, "code": {code}}.Encode(), nil)
+	req.AddCookie(&http.Cookie{Name: cookie.Name, Value: cookie.Value})
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("callback responded with status %d: %s", rec.Code, rec.Body)
+	}
+	if !strings.Contains(rec.Body.String(), "accessToken") {
+		t.Errorf("callback responded without tokens: %s", rec.Body)
+	}
+}
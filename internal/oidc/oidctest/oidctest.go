@@ -0,0 +1,257 @@
+// Package oidctest provides a mock OpenID Connect provider for tests of package oidc and for manual testing
+// of login by auth.oidc of config (see test/mockoidc). It serves discovery, JWKS, authorization and token
+// endpoints of authorization code flow with PKCE: authorization is approved at once for user of login_hint
+// parameter or of Provider.User, ID tokens are signed by RS256 key generated by New.
+package oidctest
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// KeyID it's an id of signing key in JWKS and in ID tokens.
+const KeyID = "mock-1"
+
+// grant it's an authorization code issued to client.
+type grant struct {
+	clientID    string
+	redirectURI string
+	challenge   string
+	nonce       string
+	user        string
+	expiresAt   time.Time
+}
+
+// Provider it's a mock provider, its fields may be changed between requests.
+type Provider struct {
+	sync.Mutex
+	Issuer   string                              // issuer of discovery document and ID tokens, it's URL of provider
+	ClientID string                              // id of registered client
+	Secret   string                              // secret of registered client, empty for public client
+	User     string                              // user approved without login_hint parameter
+	Claims   func(claims map[string]interface{}) // changes claims of ID token before signing, e.g. to break them in tests
+	key      *rsa.PrivateKey
+	grants   map[string]*grant
+}
+
+// New function initialize a new Provider of client with a new signing key, issuer must be set before requests.
+func New(clientID, secret, user string) (*Provider, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, fmt.Errorf("generate key: %s", err)
+	}
+	return &Provider{
+		ClientID: clientID,
+		Secret:   secret,
+		User:     user,
+		key:      key,
+		grants:   make(map[string]*grant),
+	}, nil
+}
+
+// Handler returns handler of endpoints of provider.
+func (p *Provider) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", p.discoveryHandler)
+	mux.HandleFunc("/keys", p.keysHandler)
+	mux.HandleFunc("/authorize", p.authorizeHandler)
+	mux.HandleFunc("/token", p.tokenHandler)
+	return mux
+}
+
+// random returns n random bytes encoded by base64url.
+func random(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// writeJSON writes v as JSON response with status code.
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// tokenError writes error of token endpoint (RFC 6749, section 5.2).
+func tokenError(w http.ResponseWriter, code int, e, description string) {
+	writeJSON(w, code, map[string]string{"error": e, "error_description": description})
+}
+
+// discoveryHandler serves discovery document.
+func (p *Provider) discoveryHandler(w http.ResponseWriter, req *http.Request) {
+	p.Lock()
+	issuer := p.Issuer
+	p.Unlock()
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                issuer,
+		"authorization_endpoint":                issuer + "/authorize",
+		"token_endpoint":                        issuer + "/token",
+		"jwks_uri":                              issuer + "/keys",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+// keysHandler serves JWKS with public key of signatures.
+func (p *Provider) keysHandler(w http.ResponseWriter, req *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": KeyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(p.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(p.key.E)).Bytes()),
+		}},
+	})
+}
+
+// authorizeHandler approves authorization request and redirects to client with code.
+func (p *Provider) authorizeHandler(w http.ResponseWriter, req *http.Request) {
+	p.Lock()
+	defer p.Unlock()
+
+	q := req.URL.Query()
+	redirectURI := q.Get("redirect_uri")
+	if q.Get("client_id") != p.ClientID || redirectURI == "" {
+		http.Error(w, "unknown client or redirect_uri is missing", http.StatusBadRequest)
+		return
+	}
+	redirect, err := url.Parse(redirectURI)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	params := redirect.Query()
+	params.Set("state", q.Get("state"))
+	switch {
+	case q.Get("response_type") != "code":
+		params.Set("error", "unsupported_response_type")
+	case q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "":
+		params.Set("error", "invalid_request")
+		params.Set("error_description", "S256 code challenge is required")
+	default:
+		user := q.Get("login_hint")
+		if user == "" {
+			user = p.User
+		}
+		code := random(32)
+		p.grants[code] = &grant{
+			clientID:    p.ClientID,
+			redirectURI: redirectURI,
+			challenge:   q.Get("code_challenge"),
+			nonce:       q.Get("nonce"),
+			user:        user,
+			expiresAt:   time.Now().Add(time.Minute),
+		}
+		params.Set("code", code)
+	}
+	redirect.RawQuery = params.Encode()
+	http.Redirect(w, req, redirect.String(), http.StatusFound)
+}
+
+// tokenHandler exchanges code for ID token.
+func (p *Provider) tokenHandler(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		tokenError(w, http.StatusMethodNotAllowed, "invalid_request", "expect method POST")
+		return
+	}
+	if err := req.ParseForm(); err != nil {
+		tokenError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	clientID, secret, ok := req.BasicAuth()
+	if ok {
+		clientID, _ = url.QueryUnescape(clientID)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		clientID, secret = req.PostForm.Get("client_id"), req.PostForm.Get("client_secret")
+	}
+	if clientID != p.ClientID || secret != p.Secret {
+		tokenError(w, http.StatusUnauthorized, "invalid_client", "unknown client or wrong secret")
+		return
+	}
+	if req.PostForm.Get("grant_type") != "authorization_code" {
+		tokenError(w, http.StatusBadRequest, "unsupported_grant_type", "expect authorization_code")
+		return
+	}
+
+	code := req.PostForm.Get("code")
+	g, ok := p.grants[code]
+	delete(p.grants, code)
+	if !ok || time.Now().After(g.expiresAt) || g.clientID != clientID || g.redirectURI != req.PostForm.Get("redirect_uri") {
+		tokenError(w, http.StatusBadRequest, "invalid_grant", "code is invalid, expired or issued to another client")
+		return
+	}
+	sum := sha256.Sum256([]byte(req.PostForm.Get("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != g.challenge {
+		tokenError(w, http.StatusBadRequest, "invalid_grant", "code verifier doesn't match code challenge")
+		return
+	}
+
+	now := time.Now()
+	claims := map[string]interface{}{
+		"iss":            p.Issuer,
+		"sub":            "mock-" + g.user,
+		"aud":            clientID,
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+		"nonce":          g.nonce,
+		"email":          g.user + "@example.com",
+		"email_verified": true,
+		"name":           g.user,
+	}
+	if p.Claims != nil {
+		p.Claims(claims)
+	}
+	idToken, err := p.sign(claims)
+	if err != nil {
+		tokenError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": random(32),
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     idToken,
+	})
+}
+
+// sign returns ID token with claims signed by RS256.
+func (p *Provider) sign(claims map[string]interface{}) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "kid": KeyID, "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, p.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("sign ID token: %s", err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
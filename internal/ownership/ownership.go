@@ -0,0 +1,539 @@
+// Package ownership provides isolation of tasks of users. Scope decorates models.Repository and shows user only
+// tasks which the user owns or which are shared with the user, other tasks are not found as if they don't exist.
+// Shared task is changed by users with write access, only owner deletes, restores and shares it. Projects are
+// common for all users, but only owner of project renames, archives and deletes it; queries of their tasks are scoped.
+package ownership
+
+import (
+	"errors"
+	"fmt"
+	"github.com/White-AK111/REST/internal/models"
+	"sort"
+	"time"
+)
+
+// ErrForbidden it's an error of change of visible task by user without access to the change.
+var ErrForbidden = errors.New("isn't permitted")
+
+// Visible reports whether user sees the task: owns it or it's shared with the user.
+func Visible(task models.Task, user string) bool {
+	if task.Owner == user {
+		return true
+	}
+	for _, share := range task.Shares {
+		if share.User == user {
+			return true
+		}
+	}
+	return false
+}
+
+// Writable reports whether user changes the task: owns it or it's shared with the user with write access.
+func Writable(task models.Task, user string) bool {
+	if task.Owner == user {
+		return true
+	}
+	for _, share := range task.Shares {
+		if share.User == user && share.Access == models.WriteAccess {
+			return true
+		}
+	}
+	return false
+}
+
+// scopedRepository decorates models.Repository and limits access of user to tasks.
+type scopedRepository struct {
+	models.Repository
+	user string
+}
+
+// Scope function returns repository of user, tasks created through it are owned by user.
+func Scope(repo models.Repository, user string) models.Repository {
+	return &scopedRepository{Repository: repo, user: user}
+}
+
+// notFound returns error of task which user doesn't see.
+func notFound(id int) error {
+	return fmt.Errorf("task with id=%d %w", id, models.ErrNotFound)
+}
+
+// filter returns tasks visible to user.
+func (r *scopedRepository) filter(tasks []models.Task) []models.Task {
+	visible := make([]models.Task, 0, len(tasks))
+	for _, task := range tasks {
+		if Visible(task, r.user) {
+			visible = append(visible, task)
+		}
+	}
+	return visible
+}
+
+// filterIds returns ids of tasks visible to user.
+func (r *scopedRepository) filterIds(ids []int) []int {
+	var visible []int
+	for _, id := range ids {
+		if _, err := r.GetTask(id); err == nil {
+			visible = append(visible, id)
+		}
+	}
+	return visible
+}
+
+// find returns task in the store or in trash by id.
+func (r *scopedRepository) find(id int) (models.Task, error) {
+	if task, err := r.Repository.GetTask(id); err == nil {
+		return task, nil
+	}
+	for _, task := range r.Repository.GetTrash() {
+		if task.Id == id {
+			return task, nil
+		}
+	}
+	return models.Task{}, notFound(id)
+}
+
+// check returns task in the store or in trash by id if user sees it, with write access if write is true.
+func (r *scopedRepository) check(id int, write bool) (models.Task, error) {
+	task, err := r.find(id)
+	if err != nil || !Visible(task, r.user) {
+		return models.Task{}, notFound(id)
+	}
+	if write && !Writable(task, r.user) {
+		return models.Task{}, fmt.Errorf("user %q %w to change task with id=%d", r.user, ErrForbidden, id)
+	}
+	return task, nil
+}
+
+// checkOwner returns task in the store or in trash by id if user owns it.
+func (r *scopedRepository) checkOwner(id int) (models.Task, error) {
+	task, err := r.check(id, false)
+	if err != nil {
+		return models.Task{}, err
+	}
+	if task.Owner != r.user {
+		return models.Task{}, fmt.Errorf("user %q %w to delete, restore or share task with id=%d of another user", r.user, ErrForbidden, id)
+	}
+	return task, nil
+}
+
+// checkParent checks that user changes parent of task.
+func (r *scopedRepository) checkParent(task models.Task) error {
+	if task.ParentId == 0 {
+		return nil
+	}
+	if _, err := r.check(task.ParentId, true); err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			return fmt.Errorf("parent task with id=%d %w", task.ParentId, models.ErrNotFound)
+		}
+		return err
+	}
+	return nil
+}
+
+// CreateTask creates a new task owned by user without shares, task becomes top level one if user doesn't
+// change its parent.
+func (r *scopedRepository) CreateTask(task models.Task) (int, error) {
+	task.Owner, task.Shares = r.user, nil
+	if r.checkParent(task) != nil {
+		task.ParentId = 0
+	}
+	return r.Repository.CreateTask(task)
+}
+
+// InsertTask stores a task owned by user under its own id, shares of task are kept. Id taken by task which user
+// doesn't see is reported as not found like other ids of hidden tasks, so the task isn't revealed.
+func (r *scopedRepository) InsertTask(task models.Task) error {
+	if existing, err := r.find(task.Id); err == nil && !Visible(existing, r.user) {
+		return notFound(task.Id)
+	}
+	if err := r.checkParent(task); err != nil {
+		return err
+	}
+	task.Owner = r.user
+	return r.Repository.InsertTask(task)
+}
+
+// UpdateTask replaces the task if user changes it and its new parent.
+func (r *scopedRepository) UpdateTask(task models.Task) error {
+	old, err := r.check(task.Id, true)
+	if err != nil {
+		return err
+	}
+	if task.ParentId != old.ParentId {
+		if err = r.checkParent(task); err != nil {
+			return err
+		}
+	}
+	return r.Repository.UpdateTask(task)
+}
+
+// ShareTask replaces shares of the task if user owns it.
+func (r *scopedRepository) ShareTask(id int, shares []models.Share) error {
+	if _, err := r.checkOwner(id); err != nil {
+		return err
+	}
+	return r.Repository.ShareTask(id, shares)
+}
+
+// GetTask returns the task if user sees it.
+func (r *scopedRepository) GetTask(id int) (models.Task, error) {
+	task, err := r.Repository.GetTask(id)
+	if err != nil || !Visible(task, r.user) {
+		return models.Task{}, notFound(id)
+	}
+	return task, nil
+}
+
+// DeleteTask deletes the task if user owns it.
+func (r *scopedRepository) DeleteTask(id int) error {
+	if _, err := r.checkOwner(id); err != nil {
+		return err
+	}
+	return r.Repository.DeleteTask(id)
+}
+
+// TrashTask moves the task to trash if user owns it.
+func (r *scopedRepository) TrashTask(id int) error {
+	if _, err := r.checkOwner(id); err != nil {
+		return err
+	}
+	return r.Repository.TrashTask(id)
+}
+
+// owned returns tasks owned by user, tasks of archived projects included, subtasks go before their parents.
+func (r *scopedRepository) owned() []models.Task {
+	var tasks []models.Task
+	for _, task := range models.AllTasks(r.Repository) {
+		if task.Owner == r.user {
+			tasks = append(tasks, task)
+		}
+	}
+
+	parents := make(map[int]int, len(tasks))
+	for _, task := range tasks {
+		parents[task.Id] = task.ParentId
+	}
+	depth := func(id int) int {
+		d := 0
+		for parent, ok := parents[id]; ok && parent != 0; parent, ok = parents[parent] {
+			d++
+		}
+		return d
+	}
+	sort.SliceStable(tasks, func(i, j int) bool { return depth(tasks[i].Id) > depth(tasks[j].Id) })
+	return tasks
+}
+
+// deleteOwned deletes all tasks owned by user by del, tasks already deleted with their parents are skipped.
+func (r *scopedRepository) deleteOwned(del func(id int) error) error {
+	for _, task := range r.owned() {
+		if err := del(task.Id); err != nil && !errors.Is(err, models.ErrNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteAllTasks deletes all tasks owned by user.
+func (r *scopedRepository) DeleteAllTasks() error {
+	return r.deleteOwned(r.Repository.DeleteTask)
+}
+
+// TrashAllTasks moves all tasks owned by user to trash.
+func (r *scopedRepository) TrashAllTasks() error {
+	return r.deleteOwned(r.Repository.TrashTask)
+}
+
+// GetTrash returns tasks in trash which user sees.
+func (r *scopedRepository) GetTrash() []models.Task {
+	return r.filter(r.Repository.GetTrash())
+}
+
+// RestoreTask restores the task from trash if user owns it.
+func (r *scopedRepository) RestoreTask(id int) ([]int, error) {
+	if _, err := r.checkOwner(id); err != nil {
+		return nil, err
+	}
+	return r.Repository.RestoreTask(id)
+}
+
+// PurgeTrash purges nothing, trash of all users is purged by server.
+func (r *scopedRepository) PurgeTrash(before time.Time) []int {
+	return nil
+}
+
+// GetAllTasks returns all the tasks which user sees.
+func (r *scopedRepository) GetAllTasks() []models.Task {
+	return r.filter(r.Repository.GetAllTasks())
+}
+
+// CountTasks returns count of tasks which user sees, tasks of archived projects and tasks in trash included.
+func (r *scopedRepository) CountTasks() int {
+	return len(r.filter(models.AllTasks(r.Repository))) + len(r.GetTrash())
+}
+
+// GetChildren returns subtasks of the task which user sees.
+func (r *scopedRepository) GetChildren(id int) ([]models.Task, error) {
+	if _, err := r.GetTask(id); err != nil {
+		return nil, err
+	}
+	children, err := r.Repository.GetChildren(id)
+	return r.filter(children), err
+}
+
+// AddDependencies makes the task blocked by blockers if user changes the task and sees blockers.
+func (r *scopedRepository) AddDependencies(id int, blockers []int) error {
+	if _, err := r.check(id, true); err != nil {
+		return err
+	}
+	for _, blocker := range blockers {
+		if _, err := r.GetTask(blocker); err != nil {
+			return err
+		}
+	}
+	return r.Repository.AddDependencies(id, blockers)
+}
+
+// RemoveDependency removes the blocker of the task if user changes the task.
+func (r *scopedRepository) RemoveDependency(id, blocker int) error {
+	if _, err := r.check(id, true); err != nil {
+		return err
+	}
+	return r.Repository.RemoveDependency(id, blocker)
+}
+
+// GetTasksByTag returns tasks having the tag which user sees.
+func (r *scopedRepository) GetTasksByTag(tag string) []models.Task {
+	return r.filter(r.Repository.GetTasksByTag(tag))
+}
+
+// GetTasksByDueDate returns tasks due to the date which user sees.
+func (r *scopedRepository) GetTasksByDueDate(year int, month time.Month, day int) []models.Task {
+	return r.filter(r.Repository.GetTasksByDueDate(year, month, day))
+}
+
+// GetTasksByDueRange returns tasks due to the range which user sees.
+func (r *scopedRepository) GetTasksByDueRange(from, to time.Time) []models.Task {
+	return r.filter(r.Repository.GetTasksByDueRange(from, to))
+}
+
+// SearchTasks returns found tasks which user sees.
+func (r *scopedRepository) SearchTasks(query string) []models.Task {
+	return r.filter(r.Repository.SearchTasks(query))
+}
+
+// GetAllTags returns tags of tasks which user sees with counts of them, sorted by tag.
+func (r *scopedRepository) GetAllTags() []models.TagCount {
+	counts := make(map[string]int)
+	for _, task := range r.filter(models.AllTasks(r.Repository)) {
+		for _, tag := range task.Tags {
+			counts[tag]++
+		}
+	}
+	tags := make([]models.TagCount, 0, len(counts))
+	for tag, count := range counts {
+		tags = append(tags, models.TagCount{Tag: tag, Count: count})
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Tag < tags[j].Tag })
+	return tags
+}
+
+// tagged returns tasks which user sees and changes, having any of the tags, and whether user sees any task
+// having the tags.
+func (r *scopedRepository) tagged(tags map[string]bool) (writable []models.Task, visible bool) {
+	for _, task := range r.filter(models.AllTasks(r.Repository)) {
+		for _, tag := range task.Tags {
+			if !tags[tag] {
+				continue
+			}
+			visible = true
+			if Writable(task, r.user) {
+				writable = append(writable, task)
+			}
+			break
+		}
+	}
+	return writable, visible
+}
+
+// replaceTags replaces tags 'from' by tag 'into' in the tasks at once, empty 'into' strips tags. Returns ids
+// of changed tasks in ascending order.
+func (r *scopedRepository) replaceTags(tasks []models.Task, from map[string]bool, into string) []int {
+	ids := make([]int, 0, len(tasks))
+	for _, task := range tasks {
+		ids = append(ids, task.Id)
+	}
+	tags := make([]string, 0, len(from))
+	for tag := range from {
+		tags = append(tags, tag)
+	}
+	return r.Repository.ReplaceTags(ids, tags, into)
+}
+
+// RenameTag renames the tag in tasks which user changes. If user sees no task having the tag, or sees task
+// already having the new tag, an error is returned and nothing is changed.
+func (r *scopedRepository) RenameTag(tag, newTag string) ([]int, error) {
+	tasks, visible := r.tagged(map[string]bool{tag: true})
+	if !visible {
+		return nil, fmt.Errorf("tag %q %w", tag, models.ErrNotFound)
+	}
+	if tag == newTag {
+		return nil, nil
+	}
+	if _, exists := r.tagged(map[string]bool{newTag: true}); exists {
+		return nil, fmt.Errorf("tag %q %w, merge tags instead", newTag, models.ErrConflict)
+	}
+	return r.replaceTags(tasks, map[string]bool{tag: true}, newTag), nil
+}
+
+// MergeTags replaces the tags by tag 'into' in tasks which user changes. If user sees no task having any
+// of the tags, an error is returned.
+func (r *scopedRepository) MergeTags(tags []string, into string) ([]int, error) {
+	from := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		if tag != into {
+			from[tag] = true
+		}
+	}
+	tasks, visible := r.tagged(from)
+	if !visible {
+		if _, exists := r.tagged(map[string]bool{into: true}); exists {
+			// Tasks already have only the target tag.
+			return nil, nil
+		}
+		return nil, fmt.Errorf("tags %q %w", tags, models.ErrNotFound)
+	}
+	return r.replaceTags(tasks, from, into), nil
+}
+
+// DeleteTag strips the tag from tasks which user changes. If user sees no task having the tag, an error
+// is returned.
+func (r *scopedRepository) DeleteTag(tag string) ([]int, error) {
+	tasks, visible := r.tagged(map[string]bool{tag: true})
+	if !visible {
+		return nil, fmt.Errorf("tag %q %w", tag, models.ErrNotFound)
+	}
+	return r.replaceTags(tasks, map[string]bool{tag: true}, ""), nil
+}
+
+// ReplaceTags replaces the tags in tasks with the ids which user changes, other tasks are skipped.
+func (r *scopedRepository) ReplaceTags(ids []int, tags []string, into string) []int {
+	writable := make([]int, 0, len(ids))
+	for _, id := range ids {
+		if _, err := r.check(id, true); err == nil {
+			writable = append(writable, id)
+		}
+	}
+	return r.Repository.ReplaceTags(writable, tags, into)
+}
+
+// checkProject returns project by id if user changes it: owns it or project has no owner.
+func (r *scopedRepository) checkProject(id int) (models.Project, error) {
+	project, err := r.Repository.GetProject(id)
+	if err != nil {
+		return models.Project{}, err
+	}
+	if project.Owner != "" && project.Owner != r.user {
+		return models.Project{}, fmt.Errorf("user %q %w to change project with id=%d of another user", r.user, ErrForbidden, id)
+	}
+	return project, nil
+}
+
+// CreateProject creates a new project owned by user.
+func (r *scopedRepository) CreateProject(project models.Project) int {
+	project.Owner = r.user
+	return r.Repository.CreateProject(project)
+}
+
+// UpdateProject renames and archives the project which user owns, owner of project is kept.
+func (r *scopedRepository) UpdateProject(project models.Project) error {
+	current, err := r.checkProject(project.Id)
+	if err != nil {
+		return err
+	}
+	project.Owner = current.Owner
+	return r.Repository.UpdateProject(project)
+}
+
+// DeleteProject deletes the project which user owns, returns ids of changed tasks which user sees.
+func (r *scopedRepository) DeleteProject(id int) ([]int, error) {
+	if _, err := r.checkProject(id); err != nil {
+		return nil, err
+	}
+	ids, err := r.Repository.DeleteProject(id)
+	return r.filterIds(ids), err
+}
+
+// GetProjectTasks returns tasks of the project which user sees.
+func (r *scopedRepository) GetProjectTasks(id int) ([]models.Task, error) {
+	tasks, err := r.Repository.GetProjectTasks(id)
+	return r.filter(tasks), err
+}
+
+// GetProjectTasksByTag returns tasks of the project having the tag which user sees.
+func (r *scopedRepository) GetProjectTasksByTag(id int, tag string) ([]models.Task, error) {
+	tasks, err := r.Repository.GetProjectTasksByTag(id, tag)
+	return r.filter(tasks), err
+}
+
+// GetProjectTasksByDueDate returns tasks of the project due to the date which user sees.
+func (r *scopedRepository) GetProjectTasksByDueDate(id int, year int, month time.Month, day int) ([]models.Task, error) {
+	tasks, err := r.Repository.GetProjectTasksByDueDate(id, year, month, day)
+	return r.filter(tasks), err
+}
+
+// AddComment adds comment to the task which user sees.
+func (r *scopedRepository) AddComment(comment models.Comment) (models.Comment, error) {
+	if _, err := r.check(comment.TaskId, false); err != nil {
+		return models.Comment{}, err
+	}
+	return r.Repository.AddComment(comment)
+}
+
+// GetComments returns page of comments of the task which user sees.
+func (r *scopedRepository) GetComments(taskId, offset, limit int) ([]models.Comment, int, error) {
+	if _, err := r.check(taskId, false); err != nil {
+		return nil, 0, err
+	}
+	return r.Repository.GetComments(taskId, offset, limit)
+}
+
+// GetActivity returns page of activity log of the task which user sees.
+func (r *scopedRepository) GetActivity(taskId, offset, limit int) ([]models.Activity, int, error) {
+	if _, err := r.check(taskId, false); err != nil {
+		return nil, 0, err
+	}
+	return r.Repository.GetActivity(taskId, offset, limit)
+}
+
+// AddAttachment adds attachment to the task which user changes.
+func (r *scopedRepository) AddAttachment(attachment models.Attachment) (models.Attachment, error) {
+	if _, err := r.check(attachment.TaskId, true); err != nil {
+		return models.Attachment{}, err
+	}
+	return r.Repository.AddAttachment(attachment)
+}
+
+// GetAttachments returns attachments of the task which user sees.
+func (r *scopedRepository) GetAttachments(taskId int) ([]models.Attachment, error) {
+	if _, err := r.check(taskId, false); err != nil {
+		return nil, err
+	}
+	return r.Repository.GetAttachments(taskId)
+}
+
+// GetAttachment returns attachment of the task which user sees.
+func (r *scopedRepository) GetAttachment(taskId, id int) (models.Attachment, error) {
+	if _, err := r.check(taskId, false); err != nil {
+		return models.Attachment{}, err
+	}
+	return r.Repository.GetAttachment(taskId, id)
+}
+
+// DeleteAttachment deletes attachment of the task which user changes.
+func (r *scopedRepository) DeleteAttachment(taskId, id int) error {
+	if _, err := r.check(taskId, true); err != nil {
+		return err
+	}
+	return r.Repository.DeleteAttachment(taskId, id)
+}
@@ -0,0 +1,156 @@
+// Package recurrence provides recurring tasks by RFC 5545 RRULE. Recurring task is the current occurrence of
+// series: its due date is DTSTART of the rule. Completing of recurring task or passing of its due date
+// creates the next occurrence which takes the rule over; COUNT of the rule is decreased by passed occurrences.
+// Future occurrences are expanded virtually for due date queries, they have id of the recurring task.
+package recurrence
+
+import (
+	"fmt"
+	"github.com/White-AK111/REST/internal/models"
+	"time"
+)
+
+// MaxExpanded limits count of virtual occurrences of one task returned by Expand.
+const MaxExpanded = 1000
+
+// Validate checks rule of task, recurring task must have due date.
+func Validate(rrule string, due time.Time) error {
+	if rrule == "" {
+		return nil
+	}
+	if due.IsZero() {
+		return fmt.Errorf("recurring task must have due date")
+	}
+	_, err := Parse(rrule)
+	return err
+}
+
+// NextOccurrence returns the next occurrence of recurring task after 'after' with rule adjusted for it,
+// ok is false if task isn't recurring or series ends.
+func NextOccurrence(task models.Task, after time.Time) (next models.Task, ok bool, err error) {
+	if task.RRule == "" {
+		return models.Task{}, false, nil
+	}
+	rule, err := Parse(task.RRule)
+	if err != nil {
+		return models.Task{}, false, err
+	}
+
+	due, index, ok := rule.Next(task.Due, after)
+	if !ok {
+		return models.Task{}, false, nil
+	}
+	if rule.Count > 0 {
+		rule.Count -= index
+	}
+
+	next = models.Task{
+		Text:      task.Text,
+		Tags:      append([]string{}, task.Tags...),
+		Due:       due,
+		RRule:     rule.String(),
+		ParentId:  task.ParentId,
+		ProjectId: task.ProjectId,
+	}
+	if rule.Count == 1 {
+		// The last occurrence, the series ends with it.
+		next.RRule = ""
+	}
+	return next, true, nil
+}
+
+// Complete marks task done and creates the next occurrence of recurring task after its due date or now,
+// whichever is later. Returns the next occurrence with id, ok is false if there is no next occurrence.
+// Completed task stays done, so it's kept with its subtasks and can be completed by users who may only update it:
+// open subtasks are completed with it or reject completion by subtask policy of repository. Completed recurring
+// task doesn't recur anymore, the next occurrence starts without subtasks.
+// Task blocked by open tasks can't be completed.
+func Complete(repo models.Repository, id int) (next models.Task, ok bool, err error) {
+	task, err := repo.GetTask(id)
+	if err != nil {
+		return models.Task{}, false, err
+	}
+	if task.Blocked {
+		return models.Task{}, false, fmt.Errorf("task with id=%d %w", id, models.ErrBlocked)
+	}
+	if task.RRule == "" {
+		task.Done = true
+		return models.Task{}, false, repo.UpdateTask(task)
+	}
+
+	after := time.Now()
+	if task.Due.After(after) {
+		after = task.Due
+	}
+	next, ok, err = NextOccurrence(task, after)
+	if err != nil {
+		return models.Task{}, false, err
+	}
+
+	task.Done, task.RRule = true, ""
+	if err = repo.UpdateTask(task); err != nil {
+		return models.Task{}, false, err
+	}
+	if !ok {
+		return models.Task{}, false, nil
+	}
+	if next.Id, err = repo.CreateTask(next); err != nil {
+		return models.Task{}, false, err
+	}
+	return next, true, nil
+}
+
+// Roll creates the next occurrence after now of recurring task whose due date has passed, passed task stays
+// as an ordinary overdue task. due is the due date known to caller, task changed since then isn't rolled.
+func Roll(repo models.Repository, id int, due time.Time, now time.Time) (next models.Task, ok bool, err error) {
+	task, err := repo.GetTask(id)
+	if err != nil {
+		return models.Task{}, false, err
+	}
+	if task.RRule == "" || !task.Due.Equal(due) || task.Due.After(now) {
+		return models.Task{}, false, nil
+	}
+
+	next, ok, err = NextOccurrence(task, now)
+	if err != nil {
+		return models.Task{}, false, err
+	}
+
+	task.RRule = ""
+	if err = repo.UpdateTask(task); err != nil {
+		return models.Task{}, false, err
+	}
+	if !ok {
+		return models.Task{}, false, nil
+	}
+	if next.Id, err = repo.CreateTask(next); err != nil {
+		return models.Task{}, false, err
+	}
+	return next, true, nil
+}
+
+// Expand returns virtual occurrences of recurring task after its due date in range [from, to].
+func Expand(task models.Task, from, to time.Time) []models.Task {
+	if task.RRule == "" {
+		return nil
+	}
+	rule, err := Parse(task.RRule)
+	if err != nil {
+		return nil
+	}
+
+	var occurrences []models.Task
+	for _, due := range rule.Between(task.Due, from, to, MaxExpanded+1) {
+		if !due.After(task.Due) {
+			continue
+		}
+		if len(occurrences) == MaxExpanded {
+			break
+		}
+		occurrence := task
+		occurrence.Due = due
+		occurrence.Virtual = true
+		occurrences = append(occurrences, occurrence)
+	}
+	return occurrences
+}
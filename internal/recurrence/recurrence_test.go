@@ -0,0 +1,171 @@
+package recurrence_test
+
+import (
+	"errors"
+	"github.com/White-AK111/REST/internal/models"
+	"github.com/White-AK111/REST/internal/models/inmemory"
+	"github.com/White-AK111/REST/internal/ownership"
+	"github.com/White-AK111/REST/internal/recurrence"
+	"testing"
+	"time"
+)
+
+// create creates task in repo and returns its id.
+func create(t *testing.T, repo models.Repository, task models.Task) int {
+	t.Helper()
+	id, err := repo.CreateTask(task)
+	if err != nil {
+		t.Fatalf("CreateTask: %s", err)
+	}
+	return id
+}
+
+// get returns task of repo by id.
+func get(t *testing.T, repo models.Repository, id int) models.Task {
+	t.Helper()
+	task, err := repo.GetTask(id)
+	if err != nil {
+		t.Fatalf("GetTask(%d): %s", id, err)
+	}
+	return task
+}
+
+func TestCompleteMarksTaskDone(t *testing.T) {
+	repo := inmemory.NewStorage(models.RejectSubtasks)
+	id := create(t, repo, models.Task{Text: "report"})
+
+	if _, ok, err := recurrence.Complete(repo, id); err != nil || ok {
+		t.Fatalf("Complete returned ok=%v, %v, want no next occurrence", ok, err)
+	}
+	if task := get(t, repo, id); !task.Done {
+		t.Errorf("completed task is %+v, want it done", task)
+	}
+}
+
+func TestCompleteKeepsSubtasks(t *testing.T) {
+	for _, policy := range []models.SubtaskPolicy{models.RejectSubtasks, models.CascadeSubtasks} {
+		t.Run(string(policy), func(t *testing.T) {
+			repo := inmemory.NewStorage(policy)
+			parent := create(t, repo, models.Task{Text: "release"})
+			done := create(t, repo, models.Task{Text: "changelog", ParentId: parent})
+			open := create(t, repo, models.Task{Text: "tag", ParentId: parent})
+
+			if _, _, err := recurrence.Complete(repo, done); err != nil {
+				t.Fatalf("Complete of subtask: %s", err)
+			}
+			if task := get(t, repo, done); !task.Done || task.ParentId != parent {
+				t.Errorf("completed subtask is %+v, want it done in its parent", task)
+			}
+
+			_, _, err := recurrence.Complete(repo, parent)
+			if policy == models.RejectSubtasks {
+				if !errors.Is(err, models.ErrHasSubtasks) {
+					t.Errorf("Complete of task having open subtask: %v, want %v", err, models.ErrHasSubtasks)
+				}
+				if task := get(t, repo, parent); task.Done {
+					t.Errorf("task having open subtask is done by reject policy")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Complete of task having open subtask: %s", err)
+			}
+			for _, id := range []int{parent, done, open} {
+				if task := get(t, repo, id); !task.Done {
+					t.Errorf("task %d isn't done after completion of its parent by cascade policy", id)
+				}
+			}
+			if children, err := repo.GetChildren(parent); err != nil || len(children) != 2 {
+				t.Errorf("completed task has subtasks %+v, %v, want both subtasks kept", children, err)
+			}
+		})
+	}
+}
+
+func TestCompleteRecurringTask(t *testing.T) {
+	repo := inmemory.NewStorage(models.RejectSubtasks)
+	due := time.Now().Add(24 * time.Hour).Truncate(time.Second)
+	id := create(t, repo, models.Task{Text: "standup", Tags: []string{"work"}, Due: due, RRule: "FREQ=DAILY;COUNT=3"})
+	subtask := create(t, repo, models.Task{Text: "notes", ParentId: id, Done: true})
+
+	next, ok, err := recurrence.Complete(repo, id)
+	if err != nil || !ok {
+		t.Fatalf("Complete returned ok=%v, %v, want next occurrence", ok, err)
+	}
+	if !next.Due.Equal(due.AddDate(0, 0, 1)) || next.RRule != "FREQ=DAILY;COUNT=2" || next.Id == id {
+		t.Errorf("next occurrence is %+v, want new task due day after with COUNT=2", next)
+	}
+	if stored := get(t, repo, next.Id); stored.Text != "standup" || len(stored.Tags) != 1 {
+		t.Errorf("stored next occurrence is %+v, want text and tags of completed task", stored)
+	}
+	if children, _ := repo.GetChildren(next.Id); len(children) != 0 {
+		t.Errorf("next occurrence has subtasks %+v, want none", children)
+	}
+
+	task := get(t, repo, id)
+	if !task.Done || task.RRule != "" {
+		t.Errorf("completed occurrence is %+v, want it done without rule", task)
+	}
+	if children, _ := repo.GetChildren(id); len(children) != 1 || children[0].Id != subtask {
+		t.Errorf("completed occurrence has subtasks %+v, want its subtask kept", children)
+	}
+}
+
+func TestCompleteBlockedTask(t *testing.T) {
+	repo := inmemory.NewStorage(models.RejectSubtasks)
+	blocker := create(t, repo, models.Task{Text: "review"})
+	id := create(t, repo, models.Task{Text: "release"})
+	if err := repo.AddDependencies(id, []int{blocker}); err != nil {
+		t.Fatalf("AddDependencies: %s", err)
+	}
+
+	if _, _, err := recurrence.Complete(repo, id); !errors.Is(err, models.ErrBlocked) {
+		t.Errorf("Complete of blocked task: %v, want %v", err, models.ErrBlocked)
+	}
+	if _, _, err := recurrence.Complete(repo, blocker); err != nil {
+		t.Fatalf("Complete of blocker: %s", err)
+	}
+	if _, _, err := recurrence.Complete(repo, id); err != nil {
+		t.Errorf("Complete of task whose blockers are done: %s", err)
+	}
+}
+
+func TestCompleteSharedTask(t *testing.T) {
+	store := inmemory.NewStorage(models.RejectSubtasks)
+	alice := ownership.Scope(store, "alice")
+	id := create(t, alice, models.Task{Text: "report"})
+	if err := alice.ShareTask(id, []models.Share{{User: "bob", Access: models.WriteAccess}, {User: "carol", Access: models.ReadAccess}}); err != nil {
+		t.Fatalf("ShareTask: %s", err)
+	}
+
+	if _, _, err := recurrence.Complete(ownership.Scope(store, "carol"), id); !errors.Is(err, ownership.ErrForbidden) {
+		t.Errorf("Complete by user with read access: %v, want %v", err, ownership.ErrForbidden)
+	}
+	if _, _, err := recurrence.Complete(ownership.Scope(store, "bob"), id); err != nil {
+		t.Fatalf("Complete by user with write access: %s", err)
+	}
+	if task := get(t, alice, id); !task.Done || task.Owner != "alice" {
+		t.Errorf("shared task completed by bob is %+v, want it done and owned by alice", task)
+	}
+}
+
+func TestRoll(t *testing.T) {
+	repo := inmemory.NewStorage(models.RejectSubtasks)
+	due := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+	id := create(t, repo, models.Task{Text: "standup", Due: due, RRule: "FREQ=WEEKLY"})
+	now := time.Date(2024, 1, 20, 12, 0, 0, 0, time.UTC)
+
+	if _, ok, err := recurrence.Roll(repo, id, due.Add(time.Hour), now); err != nil || ok {
+		t.Errorf("Roll of task changed since due date was known returned ok=%v, %v, want nothing rolled", ok, err)
+	}
+	next, ok, err := recurrence.Roll(repo, id, due, now)
+	if err != nil || !ok {
+		t.Fatalf("Roll returned ok=%v, %v, want next occurrence", ok, err)
+	}
+	if want := time.Date(2024, 1, 22, 9, 0, 0, 0, time.UTC); !next.Due.Equal(want) {
+		t.Errorf("next occurrence is due %s, want the first one after now %s", next.Due, want)
+	}
+	if task := get(t, repo, id); task.Done || task.RRule != "" {
+		t.Errorf("passed occurrence is %+v, want ordinary open overdue task", task)
+	}
+}
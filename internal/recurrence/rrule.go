@@ -0,0 +1,484 @@
+package recurrence
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Frequency it's a FREQ part of rule.
+type Frequency string
+
+const (
+	Daily   Frequency = "DAILY"
+	Weekly  Frequency = "WEEKLY"
+	Monthly Frequency = "MONTHLY"
+	Yearly  Frequency = "YEARLY"
+)
+
+// maxPeriods limits count of periods scanned for the next occurrence, so that rule which never
+// matches (e.g. BYMONTH=2;BYMONTHDAY=30) doesn't hang the caller.
+const maxPeriods = 10000
+
+// maxScanned limits count of occurrences scanned by Between, so that query far after DTSTART of series with COUNT,
+// whose occurrences can't be skipped, doesn't hang the caller.
+const maxScanned = 20000
+
+// weekdays names of days in BYDAY and WKST parts.
+var weekdays = map[string]time.Weekday{
+	"MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday, "TH": time.Thursday,
+	"FR": time.Friday, "SA": time.Saturday, "SU": time.Sunday,
+}
+
+// WeekdayNum it's a day of BYDAY part, N is ordinal of the day in month or year (e.g. -1 for last), 0 means every.
+type WeekdayNum struct {
+	N   int
+	Day time.Weekday
+}
+
+// String returns day in RRULE notation, e.g. "-1FR".
+func (w WeekdayNum) String() string {
+	name := strings.ToUpper(w.Day.String()[:2])
+	if w.N == 0 {
+		return name
+	}
+	return strconv.Itoa(w.N) + name
+}
+
+// Rule it's a recurrence rule of RFC 5545, subset of DAILY, WEEKLY, MONTHLY and YEARLY frequencies with
+// INTERVAL, COUNT, UNTIL, BYDAY, BYMONTHDAY, BYMONTH and WKST parts.
+type Rule struct {
+	Freq       Frequency
+	Interval   int
+	Count      int       // count of occurrences including the first one, 0 means unlimited
+	Until      time.Time // last possible occurrence, zero means unlimited
+	ByDay      []WeekdayNum
+	ByMonthDay []int
+	ByMonth    []time.Month
+	WeekStart  time.Weekday
+}
+
+// Parse function parses RRULE value like "FREQ=WEEKLY;BYDAY=MO,WE;COUNT=10", "RRULE:" prefix is allowed.
+func Parse(s string) (*Rule, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "RRULE:")
+	r := &Rule{Interval: 1, WeekStart: time.Monday}
+	for _, part := range strings.Split(s, ";") {
+		if part == "" {
+			continue
+		}
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("bad rrule part %q", part)
+		}
+		name, value := strings.ToUpper(kv[0]), strings.ToUpper(kv[1])
+
+		var err error
+		switch name {
+		case "FREQ":
+			r.Freq = Frequency(value)
+			switch r.Freq {
+			case Daily, Weekly, Monthly, Yearly:
+			default:
+				return nil, fmt.Errorf("unsupported rrule FREQ %q, expect DAILY, WEEKLY, MONTHLY or YEARLY", value)
+			}
+		case "INTERVAL":
+			r.Interval, err = strconv.Atoi(value)
+			if err == nil && r.Interval < 1 {
+				err = fmt.Errorf("must be positive")
+			}
+		case "COUNT":
+			r.Count, err = strconv.Atoi(value)
+			if err == nil && r.Count < 1 {
+				err = fmt.Errorf("must be positive")
+			}
+		case "UNTIL":
+			r.Until, err = parseUntil(value)
+		case "BYDAY":
+			for _, v := range strings.Split(value, ",") {
+				var day WeekdayNum
+				if day, err = parseWeekdayNum(v); err != nil {
+					break
+				}
+				r.ByDay = append(r.ByDay, day)
+			}
+		case "BYMONTHDAY":
+			for _, v := range strings.Split(value, ",") {
+				var day int
+				if day, err = strconv.Atoi(v); err == nil && (day == 0 || day < -31 || day > 31) {
+					err = fmt.Errorf("must be in 1..31 or -31..-1")
+				}
+				if err != nil {
+					break
+				}
+				r.ByMonthDay = append(r.ByMonthDay, day)
+			}
+		case "BYMONTH":
+			for _, v := range strings.Split(value, ",") {
+				var month int
+				if month, err = strconv.Atoi(v); err == nil && (month < 1 || month > 12) {
+					err = fmt.Errorf("must be in 1..12")
+				}
+				if err != nil {
+					break
+				}
+				r.ByMonth = append(r.ByMonth, time.Month(month))
+			}
+		case "WKST":
+			day, ok := weekdays[value]
+			if !ok {
+				err = fmt.Errorf("unknown weekday")
+			}
+			r.WeekStart = day
+		default:
+			return nil, fmt.Errorf("unsupported rrule part %s", name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("bad rrule %s=%s: %v", name, kv[1], err)
+		}
+	}
+
+	if r.Freq == "" {
+		return nil, fmt.Errorf("rrule expects FREQ")
+	}
+	if r.Count > 0 && !r.Until.IsZero() {
+		return nil, fmt.Errorf("rrule must not have both COUNT and UNTIL")
+	}
+	return r, nil
+}
+
+// parseUntil parses UNTIL in forms of date, local date-time or UTC date-time.
+func parseUntil(value string) (time.Time, error) {
+	for _, layout := range []string{"20060102T150405Z", "20060102T150405", "20060102"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			if layout == "20060102" {
+				t = t.Add(24*time.Hour - time.Second)
+			}
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("expect date or date-time")
+}
+
+// parseWeekdayNum parses day of BYDAY part like "MO", "2TU" or "-1FR".
+func parseWeekdayNum(value string) (WeekdayNum, error) {
+	if len(value) < 2 {
+		return WeekdayNum{}, fmt.Errorf("bad weekday %q", value)
+	}
+	day, ok := weekdays[value[len(value)-2:]]
+	if !ok {
+		return WeekdayNum{}, fmt.Errorf("bad weekday %q", value)
+	}
+	w := WeekdayNum{Day: day}
+	if prefix := value[:len(value)-2]; prefix != "" {
+		n, err := strconv.Atoi(prefix)
+		if err != nil || n == 0 || n < -53 || n > 53 {
+			return WeekdayNum{}, fmt.Errorf("bad weekday %q", value)
+		}
+		w.N = n
+	}
+	return w, nil
+}
+
+// String returns rule in RRULE notation without prefix.
+func (r *Rule) String() string {
+	parts := []string{"FREQ=" + string(r.Freq)}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	if !r.Until.IsZero() {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format("20060102T150405Z"))
+	}
+	if len(r.ByDay) > 0 {
+		days := make([]string, len(r.ByDay))
+		for i, day := range r.ByDay {
+			days[i] = day.String()
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if len(r.ByMonthDay) > 0 {
+		days := make([]string, len(r.ByMonthDay))
+		for i, day := range r.ByMonthDay {
+			days[i] = strconv.Itoa(day)
+		}
+		parts = append(parts, "BYMONTHDAY="+strings.Join(days, ","))
+	}
+	if len(r.ByMonth) > 0 {
+		months := make([]string, len(r.ByMonth))
+		for i, month := range r.ByMonth {
+			months[i] = strconv.Itoa(int(month))
+		}
+		parts = append(parts, "BYMONTH="+strings.Join(months, ","))
+	}
+	if r.WeekStart != time.Monday {
+		parts = append(parts, "WKST="+strings.ToUpper(r.WeekStart.String()[:2]))
+	}
+	return strings.Join(parts, ";")
+}
+
+// Each calls fn for occurrences of rule starting at dtstart in ascending order, until fn returns false
+// or the series ends. Index of dtstart, which is always the first occurrence, is 0.
+func (r *Rule) Each(dtstart time.Time, fn func(index int, t time.Time) bool) {
+	r.each(dtstart, 0, 0, fn)
+}
+
+// each calls fn for occurrences of rule starting at period with number start, index is index of the last
+// occurrence before the period.
+func (r *Rule) each(dtstart time.Time, start, index int, fn func(index int, t time.Time) bool) {
+	if start == 0 && !fn(index, dtstart) {
+		return
+	}
+
+	empty := 0
+	for period := start; empty < maxPeriods; period++ {
+		candidates := r.candidates(dtstart, period)
+		if len(candidates) == 0 {
+			empty++
+			continue
+		}
+		empty = 0
+
+		for _, t := range candidates {
+			if !t.After(dtstart) {
+				continue
+			}
+			if !r.Until.IsZero() && t.After(r.Until) {
+				return
+			}
+			index++
+			if r.Count > 0 && index >= r.Count {
+				return
+			}
+			if !fn(index, t) {
+				return
+			}
+		}
+	}
+}
+
+// Next returns the first occurrence after 'after' and its index in series, ok is false if series ends before.
+func (r *Rule) Next(dtstart, after time.Time) (next time.Time, index int, ok bool) {
+	r.Each(dtstart, func(i int, t time.Time) bool {
+		if t.After(after) {
+			next, index, ok = t, i, true
+			return false
+		}
+		return true
+	})
+	return next, index, ok
+}
+
+// Between returns up to limit occurrences in range [from, to]. Periods before from are skipped unless series has
+// COUNT and its occurrences before from can't be counted without scan; then up to maxScanned occurrences are scanned.
+func (r *Rule) Between(dtstart, from, to time.Time, limit int) []time.Time {
+	start, index := 0, 0
+	switch {
+	case r.Count == 0:
+		// Index doesn't matter without COUNT.
+		start = r.periodBefore(dtstart, from)
+	case r.single():
+		// The first occurrence is dtstart of period 0, each next period has one occurrence.
+		start = r.periodBefore(dtstart, from)
+		if start >= r.Count {
+			return nil
+		}
+		if start > 0 {
+			index = start - 1
+		}
+	}
+
+	var occurrences []time.Time
+	scanned := 0
+	r.each(dtstart, start, index, func(i int, t time.Time) bool {
+		scanned++
+		if t.After(to) || len(occurrences) >= limit || scanned > maxScanned {
+			return false
+		}
+		if !t.Before(from) {
+			occurrences = append(occurrences, t)
+		}
+		return true
+	})
+	return occurrences
+}
+
+// single reports whether each period has exactly one occurrence of rule.
+func (r *Rule) single() bool {
+	return (r.Freq == Daily || r.Freq == Weekly) && len(r.ByDay) == 0 && len(r.ByMonthDay) == 0 && len(r.ByMonth) == 0
+}
+
+// periodBefore returns number of a period which ends before t, so occurrences of earlier periods can be skipped.
+func (r *Rule) periodBefore(dtstart, t time.Time) int {
+	if !t.After(dtstart) {
+		return 0
+	}
+	var periods int
+	switch r.Freq {
+	case Daily:
+		periods = int((t.Unix() - dtstart.Unix()) / (24 * 60 * 60))
+	case Weekly:
+		periods = int((t.Unix() - dtstart.Unix()) / (7 * 24 * 60 * 60))
+	case Monthly:
+		periods = (t.Year()-dtstart.Year())*12 + int(t.Month()) - int(dtstart.Month())
+	case Yearly:
+		periods = t.Year() - dtstart.Year()
+	}
+	// One more period back covers periods starting before dtstart, like week of WKST, and shifts of zones.
+	if n := periods/r.Interval - 1; n > 0 {
+		return n
+	}
+	return 0
+}
+
+// candidates returns sorted occurrences of rule in period with number n counted from period of dtstart.
+func (r *Rule) candidates(dtstart time.Time, n int) []time.Time {
+	loc := dtstart.Location()
+	hour, min, sec := dtstart.Clock()
+	at := func(y int, m time.Month, d int) time.Time {
+		return time.Date(y, m, d, hour, min, sec, dtstart.Nanosecond(), loc)
+	}
+	step := n * r.Interval
+
+	var days []time.Time
+	switch r.Freq {
+	case Daily:
+		days = []time.Time{at(dtstart.Year(), dtstart.Month(), dtstart.Day()+step)}
+	case Weekly:
+		offset := (int(dtstart.Weekday()) - int(r.WeekStart) + 7) % 7
+		weekStart := at(dtstart.Year(), dtstart.Month(), dtstart.Day()-offset+7*step)
+		for i := 0; i < 7; i++ {
+			day := weekStart.AddDate(0, 0, i)
+			if len(r.ByDay) == 0 && day.Weekday() == dtstart.Weekday() || r.hasWeekday(day.Weekday()) {
+				days = append(days, day)
+			}
+		}
+	case Monthly:
+		first := at(dtstart.Year(), dtstart.Month()+time.Month(step), 1)
+		days = r.daysOfMonth(first, dtstart)
+	case Yearly:
+		year := dtstart.Year() + step
+		if len(r.ByMonth) == 0 && len(r.ByDay) > 0 && len(r.ByMonthDay) == 0 {
+			days = r.weekdaysOf(at(year, time.January, 1), at(year+1, time.January, 1))
+			break
+		}
+		months := r.ByMonth
+		switch {
+		case len(months) > 0:
+		case len(r.ByMonthDay) > 0:
+			// BYMONTHDAY without BYMONTH expands to every month of year.
+			months = []time.Month{time.January, time.February, time.March, time.April, time.May, time.June,
+				time.July, time.August, time.September, time.October, time.November, time.December}
+		default:
+			months = []time.Month{dtstart.Month()}
+		}
+		for _, month := range months {
+			days = append(days, r.daysOfMonth(at(year, month, 1), dtstart)...)
+		}
+	}
+
+	result := days[:0]
+	for _, day := range days {
+		if r.matches(day) {
+			result = append(result, day)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Before(result[j]) })
+	return result
+}
+
+// daysOfMonth returns days of month starting at first by BYMONTHDAY and BYDAY parts,
+// or the day of month of dtstart if there are no such parts. Days missing in month are skipped.
+func (r *Rule) daysOfMonth(first, dtstart time.Time) []time.Time {
+	next := first.AddDate(0, 1, 0)
+	lastDay := next.AddDate(0, 0, -1).Day()
+
+	var days []time.Time
+	switch {
+	case len(r.ByMonthDay) > 0:
+		for _, d := range r.ByMonthDay {
+			if d < 0 {
+				d = lastDay + d + 1
+			}
+			if d >= 1 && d <= lastDay {
+				days = append(days, first.AddDate(0, 0, d-1))
+			}
+		}
+	case len(r.ByDay) > 0:
+		days = r.weekdaysOf(first, next)
+	default:
+		if dtstart.Day() <= lastDay {
+			days = append(days, first.AddDate(0, 0, dtstart.Day()-1))
+		}
+	}
+	return days
+}
+
+// weekdaysOf returns days in range [start, end) matching BYDAY part, ordinals count within range.
+func (r *Rule) weekdaysOf(start, end time.Time) []time.Time {
+	var days []time.Time
+	for _, wd := range r.ByDay {
+		var all []time.Time
+		for day := start; day.Before(end); day = day.AddDate(0, 0, 1) {
+			if day.Weekday() == wd.Day {
+				all = append(all, day)
+			}
+		}
+		switch {
+		case wd.N == 0:
+			days = append(days, all...)
+		case wd.N > 0 && wd.N <= len(all):
+			days = append(days, all[wd.N-1])
+		case wd.N < 0 && -wd.N <= len(all):
+			days = append(days, all[len(all)+wd.N])
+		}
+	}
+	return days
+}
+
+// matches reports whether day passes BYMONTH part, and BYMONTHDAY and BYDAY parts when they limit
+// instead of expand frequency.
+func (r *Rule) matches(day time.Time) bool {
+	if len(r.ByMonth) > 0 {
+		found := false
+		for _, m := range r.ByMonth {
+			found = found || m == day.Month()
+		}
+		if !found {
+			return false
+		}
+	}
+	if r.Freq == Daily && len(r.ByDay) > 0 && !r.hasWeekday(day.Weekday()) {
+		return false
+	}
+	if (r.Freq == Monthly || r.Freq == Yearly) && len(r.ByMonthDay) > 0 && len(r.ByDay) > 0 && !r.hasWeekday(day.Weekday()) {
+		return false
+	}
+	if r.Freq == Daily && len(r.ByMonthDay) > 0 {
+		lastDay := time.Date(day.Year(), day.Month()+1, 0, 0, 0, 0, 0, day.Location()).Day()
+		found := false
+		for _, d := range r.ByMonthDay {
+			if d < 0 {
+				d = lastDay + d + 1
+			}
+			found = found || d == day.Day()
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// hasWeekday reports whether BYDAY part has weekday.
+func (r *Rule) hasWeekday(day time.Weekday) bool {
+	for _, wd := range r.ByDay {
+		if wd.Day == day {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,171 @@
+package recurrence
+
+import (
+	"github.com/White-AK111/REST/internal/models"
+	"strings"
+	"testing"
+	"time"
+)
+
+// date parses local date-time of RFC 5545 like "19970902T090000" in UTC.
+func date(t *testing.T, value string) time.Time {
+	t.Helper()
+	d, err := time.Parse("20060102T150405", value)
+	if err != nil {
+		t.Fatalf("bad date %q: %s", value, err)
+	}
+	return d
+}
+
+// first returns up to n first occurrences of rule starting at dtstart in RFC 5545 notation.
+func first(t *testing.T, rrule string, dtstart time.Time, n int) []string {
+	t.Helper()
+	rule, err := Parse(rrule)
+	if err != nil {
+		t.Fatalf("Parse(%q): %s", rrule, err)
+	}
+	var occurrences []string
+	rule.Each(dtstart, func(_ int, d time.Time) bool {
+		occurrences = append(occurrences, d.Format("20060102T150405"))
+		return len(occurrences) < n
+	})
+	return occurrences
+}
+
+// Examples of section 3.8.5.3 of RFC 5545, DTSTART is always the first occurrence, EXDATE isn't supported.
+func TestEachRFC5545(t *testing.T) {
+	tests := []struct {
+		name    string
+		dtstart string
+		rrule   string
+		n       int
+		want    string
+	}{
+		{"daily for 10 occurrences", "19970902T090000", "FREQ=DAILY;COUNT=10", 20,
+			"19970902 19970903 19970904 19970905 19970906 19970907 19970908 19970909 19970910 19970911"},
+		{"every other day", "19970902T090000", "FREQ=DAILY;INTERVAL=2", 4,
+			"19970902 19970904 19970906 19970908"},
+		{"every 10 days, 5 occurrences", "19970902T090000", "FREQ=DAILY;INTERVAL=10;COUNT=5", 10,
+			"19970902 19970912 19970922 19971002 19971012"},
+		{"weekly for 10 occurrences", "19970902T090000", "FREQ=WEEKLY;COUNT=10", 20,
+			"19970902 19970909 19970916 19970923 19970930 19971007 19971014 19971021 19971028 19971104"},
+		{"weekly on Tuesday and Thursday for five weeks", "19970902T090000", "FREQ=WEEKLY;COUNT=10;WKST=SU;BYDAY=TU,TH", 20,
+			"19970902 19970904 19970909 19970911 19970916 19970918 19970923 19970925 19970930 19971002"},
+		{"every other week on Monday, Wednesday and Friday", "19970901T090000", "FREQ=WEEKLY;INTERVAL=2;UNTIL=19971224T000000Z;WKST=SU;BYDAY=MO,WE,FR", 30,
+			"19970901 19970903 19970905 19970915 19970917 19970919 19970929 19971001 19971003 19971013 19971015 19971017 " +
+				"19971027 19971029 19971031 19971110 19971112 19971114 19971124 19971126 19971128 19971208 19971210 19971212 19971222"},
+		{"monthly on the first Friday for 10 occurrences", "19970905T090000", "FREQ=MONTHLY;COUNT=10;BYDAY=1FR", 20,
+			"19970905 19971003 19971107 19971205 19980102 19980206 19980306 19980403 19980501 19980605"},
+		{"monthly on the second-to-last Monday for 6 months", "19970922T090000", "FREQ=MONTHLY;COUNT=6;BYDAY=-2MO", 10,
+			"19970922 19971020 19971117 19971222 19980119 19980216"},
+		{"monthly on the third-to-the-last day", "19970928T090000", "FREQ=MONTHLY;BYMONTHDAY=-3", 6,
+			"19970928 19971029 19971128 19971229 19980129 19980226"},
+		{"monthly on the 2nd and 15th for 10 occurrences", "19970902T090000", "FREQ=MONTHLY;COUNT=10;BYMONTHDAY=2,15", 20,
+			"19970902 19970915 19971002 19971015 19971102 19971115 19971202 19971215 19980102 19980115"},
+		{"every Friday the 13th", "19970902T090000", "FREQ=MONTHLY;BYDAY=FR;BYMONTHDAY=13", 6,
+			"19970902 19980213 19980313 19981113 19990813 20001013"},
+		{"yearly in June and July for 10 occurrences", "19970610T090000", "FREQ=YEARLY;COUNT=10;BYMONTH=6,7", 20,
+			"19970610 19970710 19980610 19980710 19990610 19990710 20000610 20000710 20010610 20010710"},
+		{"every 20th Monday of the year", "19970519T090000", "FREQ=YEARLY;BYDAY=20MO", 3,
+			"19970519 19980518 19990517"},
+		{"every Thursday in March", "19970313T090000", "FREQ=YEARLY;BYMONTH=3;BYDAY=TH", 7,
+			"19970313 19970320 19970327 19980305 19980312 19980319 19980326"},
+		{"yearly on the first day of every month", "19970101T090000", "FREQ=YEARLY;BYMONTHDAY=1;COUNT=4", 10,
+			"19970101 19970201 19970301 19970401"},
+		{"yearly on the last day of every month", "19970131T090000", "FREQ=YEARLY;BYMONTHDAY=-1", 4,
+			"19970131 19970228 19970331 19970430"},
+		{"monthly on the 31st skips short months", "19970131T090000", "FREQ=MONTHLY;BYMONTHDAY=31", 4,
+			"19970131 19970331 19970531 19970731"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var want []string
+			for _, d := range strings.Fields(tt.want) {
+				want = append(want, d+"T090000")
+			}
+			got := first(t, tt.rrule, date(t, tt.dtstart), tt.n)
+			if strings.Join(got, " ") != strings.Join(want, " ") {
+				t.Errorf("occurrences of %s are\n%v, want\n%v", tt.rrule, got, want)
+			}
+		})
+	}
+}
+
+func TestEachEveryDayInJanuary(t *testing.T) {
+	// Every day in January, for 3 years.
+	got := first(t, "FREQ=YEARLY;UNTIL=20000131T140000Z;BYMONTH=1;BYDAY=SU,MO,TU,WE,TH,FR,SA", date(t, "19980101T090000"), 200)
+	if len(got) != 93 || got[0] != "19980101T090000" || got[31] != "19990101T090000" || got[92] != "20000131T090000" {
+		t.Errorf("occurrences are %d from %v to %v, want 93 days of January from 1998 to 2000", len(got), got[0], got[len(got)-1])
+	}
+}
+
+func TestNextOccurrence(t *testing.T) {
+	dtstart := date(t, "19970902T090000")
+	tests := []struct {
+		name  string
+		rrule string
+		after time.Time
+		ok    bool
+		due   time.Time
+		next  string
+	}{
+		{"count is decreased by passed occurrences", "FREQ=DAILY;COUNT=10", date(t, "19970904T120000"),
+			true, date(t, "19970905T090000"), "FREQ=DAILY;COUNT=7"},
+		{"the last occurrence ends series", "FREQ=DAILY;COUNT=3", date(t, "19970903T090000"),
+			true, date(t, "19970904T090000"), ""},
+		{"series with count ends", "FREQ=DAILY;COUNT=3", date(t, "19970904T090000"), false, time.Time{}, ""},
+		{"series with until ends", "FREQ=WEEKLY;UNTIL=19970920T000000Z", date(t, "19970916T090000"), false, time.Time{}, ""},
+		{"unlimited series keeps rule", "FREQ=MONTHLY;BYMONTHDAY=2,15", date(t, "19970902T090000"),
+			true, date(t, "19970915T090000"), "FREQ=MONTHLY;BYMONTHDAY=2,15"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			task := models.Task{Id: 1, Text: "report", Tags: []string{"work"}, Due: dtstart, RRule: tt.rrule}
+			next, ok, err := NextOccurrence(task, tt.after)
+			if err != nil {
+				t.Fatalf("NextOccurrence: %s", err)
+			}
+			if ok != tt.ok {
+				t.Fatalf("NextOccurrence returned ok=%v, want %v", ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+			if !next.Due.Equal(tt.due) || next.RRule != tt.next {
+				t.Errorf("next occurrence is due %s with rule %q, want %s with %q", next.Due, next.RRule, tt.due, tt.next)
+			}
+			if next.Id != 0 || next.Text != task.Text || len(next.Tags) != 1 || next.Tags[0] != "work" {
+				t.Errorf("next occurrence is %+v, want new task with text and tags of %+v", next, task)
+			}
+		})
+	}
+}
+
+func TestExpandIsCapped(t *testing.T) {
+	dtstart := date(t, "19970902T090000")
+	task := models.Task{Id: 1, Due: dtstart, RRule: "FREQ=DAILY"}
+
+	occurrences := Expand(task, dtstart, dtstart.AddDate(10, 0, 0))
+	if len(occurrences) != MaxExpanded {
+		t.Fatalf("Expand returned %d occurrences, want %d", len(occurrences), MaxExpanded)
+	}
+	if !occurrences[0].Due.Equal(dtstart.AddDate(0, 0, 1)) || !occurrences[0].Virtual || occurrences[0].Id != task.Id {
+		t.Errorf("the first expanded occurrence is %+v, want virtual occurrence of task after its due date", occurrences[0])
+	}
+
+	occurrences = Expand(task, date(t, "19970910T000000"), date(t, "19970912T235959"))
+	if len(occurrences) != 3 {
+		t.Errorf("Expand returned %d occurrences in 3 days, want 3", len(occurrences))
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, rrule := range []string{
+		"", "COUNT=3", "FREQ=HOURLY", "FREQ=DAILY;COUNT=0", "FREQ=DAILY;INTERVAL=-1", "FREQ=DAILY;BYMONTHDAY=32",
+		"FREQ=DAILY;BYMONTH=13", "FREQ=WEEKLY;BYDAY=XX", "FREQ=DAILY;COUNT=3;UNTIL=19971224", "FREQ=DAILY;BYSETPOS=1",
+	} {
+		if _, err := Parse(rrule); err == nil {
+			t.Errorf("Parse(%q) returned no error", rrule)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package scheduler
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/White-AK111/REST/config"
+	"github.com/White-AK111/REST/internal/webhook"
+	"log"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Notifier delivers fired reminders.
+type Notifier interface {
+	Notify(r Reminder) error
+}
+
+// NewNotifiers function returns notifiers by names from config: log, webhook, smtp.
+func NewNotifiers(cfg *config.Config, hooks *webhook.Dispatcher) ([]Notifier, error) {
+	var notifiers []Notifier
+	for _, name := range cfg.Scheduler.Notifiers {
+		switch name {
+		case "log":
+			notifiers = append(notifiers, &LogNotifier{Logger: cfg.ErrorLogger})
+		case "webhook":
+			notifiers = append(notifiers, &WebhookNotifier{Dispatcher: hooks})
+		case "smtp":
+			if len(cfg.Scheduler.SMTP.To) == 0 {
+				return nil, fmt.Errorf("smtp notifier expects recipients in scheduler.smtp.to")
+			}
+			notifiers = append(notifiers, &SMTPNotifier{
+				Address: cfg.Scheduler.SMTP.Address,
+				From:    cfg.Scheduler.SMTP.From,
+				To:      cfg.Scheduler.SMTP.To,
+				Timeout: cfg.Scheduler.SMTP.Timeout,
+			})
+		default:
+			return nil, fmt.Errorf("unknown notifier %q, expect log, webhook or smtp", name)
+		}
+	}
+	return notifiers, nil
+}
+
+// describe returns human readable text of reminder.
+func describe(r Reminder) string {
+	if r.Before == 0 {
+		return fmt.Sprintf("task %d %q is due now (%s)", r.Task.Id, r.Task.Text, r.Task.Due.Format(time.RFC3339))
+	}
+	return fmt.Sprintf("task %d %q is due in %s (%s)", r.Task.Id, r.Task.Text, r.Before, r.Task.Due.Format(time.RFC3339))
+}
+
+// LogNotifier writes reminders to logger.
+type LogNotifier struct {
+	Logger *log.Logger
+}
+
+// Notify method writes reminder to logger.
+func (n *LogNotifier) Notify(r Reminder) error {
+	n.Logger.Printf("Reminder: %s\n", describe(r))
+	return nil
+}
+
+// WebhookNotifier sends reminders to webhooks: task.reminder before due date and task.due at due date.
+type WebhookNotifier struct {
+	Dispatcher *webhook.Dispatcher
+}
+
+// Notify method starts deliveries of reminder, dispatcher retries failed deliveries itself.
+func (n *WebhookNotifier) Notify(r Reminder) error {
+	if r.Before == 0 {
+		n.Dispatcher.Notify(webhook.TaskDue, r.Task)
+	} else {
+		n.Dispatcher.Notify(webhook.TaskReminder, r.Task)
+	}
+	return nil
+}
+
+// SMTPNotifier sends reminders by mail through SMTP server without authentication and TLS,
+// e.g. local stand-in like MailHog or relay of the host.
+type SMTPNotifier struct {
+	Address string // host:port of SMTP server
+	From    string
+	To      []string
+	Timeout time.Duration // timeout of whole session with server
+}
+
+// Notify method sends mail with reminder.
+func (n *SMTPNotifier) Notify(r Reminder) error {
+	conn, err := net.DialTimeout("tcp", n.Address, n.Timeout)
+	if err != nil {
+		return fmt.Errorf("can't connect to SMTP server: %w", err)
+	}
+	_ = conn.SetDeadline(time.Now().Add(n.Timeout))
+
+	host, _, _ := net.SplitHostPort(n.Address)
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("can't start SMTP session: %w", err)
+	}
+	defer c.Close()
+
+	if err = c.Mail(n.From); err != nil {
+		return err
+	}
+	for _, to := range n.To {
+		if err = c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(n.message(r)); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// message returns mail with reminder in RFC 5322 format.
+func (n *SMTPNotifier) message(r Reminder) []byte {
+	subject := fmt.Sprintf("Reminder: %s", r.Task.Text)
+	if r.Before == 0 {
+		subject = fmt.Sprintf("Due: %s", r.Task.Text)
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", n.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(n.To, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", strings.NewReplacer("\r", " ", "\n", " ").Replace(subject)))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("\r\n")
+	fmt.Fprintf(&buf, "Reminder: %s.\r\n", describe(r))
+	if len(r.Task.Tags) > 0 {
+		fmt.Fprintf(&buf, "Tags: %s\r\n", strings.Join(r.Task.Tags, ", "))
+	}
+	return buf.Bytes()
+}
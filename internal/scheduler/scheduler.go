@@ -0,0 +1,351 @@
+// Package scheduler fires reminders of due dates of tasks into pluggable notifiers: log, webhook and SMTP.
+// Upcoming reminders are kept in a min-heap ordered by fire time and one timer waits for the earliest of them,
+// so tasks are never scanned on a tick. Changes of tasks come from the bus of events.
+//
+// Fired reminders are recorded in State; after restart the scheduler loads tasks from the repository, skips
+// reminders which have already been fired and fires the missed ones not older than grace period.
+//
+// When due date of recurring task passes, the scheduler creates its next occurrence by package recurrence.
+package scheduler
+
+import (
+	"container/heap"
+	"fmt"
+	"github.com/White-AK111/REST/config"
+	"github.com/White-AK111/REST/internal/events"
+	"github.com/White-AK111/REST/internal/models"
+	"github.com/White-AK111/REST/internal/recurrence"
+	"github.com/White-AK111/REST/internal/webhook"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Reminder it's a notification about task that falls due.
+type Reminder struct {
+	Task   models.Task
+	Before time.Duration // time between reminder and due date, 0 means reminder at due date
+	At     time.Time     // time of firing
+}
+
+// item it's a reminder in the heap.
+type item struct {
+	Reminder
+	key   string
+	roll  bool // item rolls recurring task over to the next occurrence instead of reminding
+	index int
+}
+
+// reminderHeap min-heap of reminders by time of firing, implements heap.Interface.
+type reminderHeap []*item
+
+func (h reminderHeap) Len() int { return len(h) }
+
+func (h reminderHeap) Less(i, j int) bool {
+	if h[i].At.Equal(h[j].At) {
+		return h[i].Task.Id < h[j].Task.Id
+	}
+	return h[i].At.Before(h[j].At)
+}
+
+func (h reminderHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *reminderHeap) Push(x interface{}) {
+	it := x.(*item)
+	it.index = len(*h)
+	*h = append(*h, it)
+}
+
+func (h *reminderHeap) Pop() interface{} {
+	old := *h
+	it := old[len(old)-1]
+	old[len(old)-1] = nil
+	it.index = -1
+	*h = old[:len(old)-1]
+	return it
+}
+
+// Scheduler tracks due dates of tasks and fires reminders; Scheduler methods are safe to call concurrently.
+type Scheduler struct {
+	sync.Mutex
+	store     models.Repository
+	offsets   []time.Duration // times before due date, in descending order
+	grace     time.Duration
+	notifiers []Notifier
+	state     *State
+
+	queue  reminderHeap
+	byTask map[int][]*item
+	wake   chan struct{}
+	done   chan struct{}
+}
+
+// New function initialize a new Scheduler with parameters from config, reminders of tasks of store
+// are scheduled when Run is called.
+func New(cfg *config.Config, store models.Repository, hooks *webhook.Dispatcher) (*Scheduler, error) {
+	notifiers, err := NewNotifiers(cfg, hooks)
+	if err != nil {
+		return nil, err
+	}
+	state, err := OpenState(cfg.Scheduler.StateFile)
+	if err != nil {
+		return nil, err
+	}
+
+	offsets := make([]time.Duration, 0, len(cfg.Scheduler.Reminders))
+	for _, offset := range cfg.Scheduler.Reminders {
+		if offset < 0 {
+			return nil, fmt.Errorf("reminder must be before due date, got %s", offset)
+		}
+		offsets = append(offsets, offset)
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] > offsets[j] })
+
+	return &Scheduler{
+		store:     store,
+		offsets:   offsets,
+		grace:     cfg.Scheduler.MissedGrace,
+		notifiers: notifiers,
+		state:     state,
+		byTask:    make(map[int][]*item),
+		wake:      make(chan struct{}, 1),
+		done:      make(chan struct{}),
+	}, nil
+}
+
+// Run loads tasks from repository and fires reminders until Close is called, changes of tasks come from the bus.
+func (s *Scheduler) Run(bus *events.Bus) {
+	sub := bus.Subscribe(1024)
+	defer func() { sub.Close() }()
+	s.load()
+
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+
+	for {
+		s.Lock()
+		var wait <-chan time.Time
+		if len(s.queue) > 0 {
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(time.Until(s.queue[0].At))
+			wait = timer.C
+		}
+		s.Unlock()
+
+		select {
+		case <-s.done:
+			return
+		case <-s.wake:
+		case <-wait:
+			s.fireDue(time.Now())
+		case e, ok := <-sub.C:
+			if !ok {
+				log.Println("scheduler is too slow to receive events, reload tasks")
+				sub = bus.Subscribe(1024)
+				s.load()
+				continue
+			}
+			s.handleEvent(e)
+		}
+	}
+}
+
+// Close stops scheduler, reminders being sent are finished.
+func (s *Scheduler) Close() {
+	s.Lock()
+	defer s.Unlock()
+
+	select {
+	case <-s.done:
+	default:
+		close(s.done)
+	}
+}
+
+// load schedules reminders of all tasks of repository. Fired reminders of tasks missing in repository are kept:
+// repository may be not persistent, e.g. in-memory one is empty at start, so they are forgotten only by Deleted
+// and Cleared events.
+func (s *Scheduler) load() {
+	tasks := s.store.GetAllTasks()
+
+	s.Lock()
+	s.queue = s.queue[:0]
+	s.byTask = make(map[int][]*item)
+	s.Unlock()
+	for _, task := range tasks {
+		s.Schedule(task)
+	}
+}
+
+// handleEvent updates reminders by event of the bus.
+func (s *Scheduler) handleEvent(e events.Event) {
+	switch e.Type {
+	case events.Created, events.Updated:
+		s.Schedule(e.Task)
+	case events.Deleted:
+		s.Unschedule(e.Task.Id)
+		if err := s.state.Forget(e.Task.Id); err != nil {
+			log.Printf("error on update scheduler state: %s", err)
+		}
+	case events.Cleared:
+		s.Lock()
+		s.queue = s.queue[:0]
+		s.byTask = make(map[int][]*item)
+		s.Unlock()
+		if err := s.state.Retain(nil); err != nil {
+			log.Printf("error on update scheduler state: %s", err)
+		}
+	}
+}
+
+// Schedule replaces reminders of task by reminders of its current due date, done subtask has no reminders.
+// Reminders which have been fired are skipped; of the missed reminders only the latest one is kept and only
+// if it's not older than grace period.
+func (s *Scheduler) Schedule(task models.Task) {
+	s.Unschedule(task.Id)
+	if task.Due.IsZero() || task.Done {
+		return
+	}
+
+	now := time.Now()
+	var missed *item
+	var upcoming []*item
+	for _, offset := range s.offsets {
+		it := &item{
+			Reminder: Reminder{Task: task, Before: offset, At: task.Due.Add(-offset)},
+			key:      reminderKey(task.Id, task.Due, offset),
+		}
+		if s.state.Fired(it.key) {
+			continue
+		}
+		if it.At.After(now) {
+			upcoming = append(upcoming, it)
+		} else if now.Sub(it.At) <= s.grace {
+			missed = it
+		}
+	}
+	if missed != nil {
+		upcoming = append(upcoming, missed)
+	}
+	if task.RRule != "" {
+		upcoming = append(upcoming, &item{Reminder: Reminder{Task: task, At: task.Due}, roll: true})
+	}
+	if len(upcoming) == 0 {
+		return
+	}
+
+	s.Lock()
+	for _, it := range upcoming {
+		heap.Push(&s.queue, it)
+	}
+	s.byTask[task.Id] = upcoming
+	s.Unlock()
+	s.wakeUp()
+}
+
+// Unschedule deletes reminders of task.
+func (s *Scheduler) Unschedule(id int) {
+	s.Lock()
+	defer s.Unlock()
+
+	for _, it := range s.byTask[id] {
+		if it.index >= 0 {
+			heap.Remove(&s.queue, it.index)
+		}
+	}
+	delete(s.byTask, id)
+}
+
+// Upcoming returns scheduled reminders ordered by time of firing.
+func (s *Scheduler) Upcoming() []Reminder {
+	s.Lock()
+	defer s.Unlock()
+
+	reminders := make([]Reminder, 0, len(s.queue))
+	for _, it := range s.queue {
+		if !it.roll {
+			reminders = append(reminders, it.Reminder)
+		}
+	}
+	sort.Slice(reminders, func(i, j int) bool {
+		if reminders[i].At.Equal(reminders[j].At) {
+			return reminders[i].Task.Id < reminders[j].Task.Id
+		}
+		return reminders[i].At.Before(reminders[j].At)
+	})
+	return reminders
+}
+
+// wakeUp makes Run loop to recompute time of the earliest reminder.
+func (s *Scheduler) wakeUp() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// fireDue pops reminders with time of firing up to now and sends them to notifiers. Reminders are recorded
+// as fired before sending, so that changes of task made meanwhile don't schedule them again.
+func (s *Scheduler) fireDue(now time.Time) {
+	s.Lock()
+	var due []*item
+	for len(s.queue) > 0 && !s.queue[0].At.After(now) {
+		it := heap.Pop(&s.queue).(*item)
+		due = append(due, it)
+		s.dropFromTask(it)
+	}
+	s.Unlock()
+
+	for _, it := range due {
+		if it.roll {
+			go s.roll(it)
+			continue
+		}
+		if err := s.state.MarkFired(it.key, now); err != nil {
+			log.Printf("error on update scheduler state: %s", err)
+		}
+		go s.fire(it)
+	}
+}
+
+// dropFromTask deletes popped item from reminders of task, must be called with lock held.
+func (s *Scheduler) dropFromTask(it *item) {
+	items := s.byTask[it.Task.Id]
+	for i, other := range items {
+		if other == it {
+			items = append(items[:i], items[i+1:]...)
+			break
+		}
+	}
+	if len(items) == 0 {
+		delete(s.byTask, it.Task.Id)
+	} else {
+		s.byTask[it.Task.Id] = items
+	}
+}
+
+// roll creates the next occurrence of recurring task whose due date has passed.
+func (s *Scheduler) roll(it *item) {
+	if _, _, err := recurrence.Roll(s.store, it.Task.Id, it.Task.Due, time.Now()); err != nil {
+		log.Printf("error on roll recurring task %d over: %s", it.Task.Id, err)
+	}
+}
+
+// fire sends reminder to all notifiers.
+func (s *Scheduler) fire(it *item) {
+	for _, n := range s.notifiers {
+		if err := n.Notify(it.Reminder); err != nil {
+			log.Printf("error on notify about task %d with %T: %s", it.Task.Id, n, err)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package scheduler
+
+import (
+	"github.com/White-AK111/REST/config"
+	"github.com/White-AK111/REST/internal/events"
+	"github.com/White-AK111/REST/internal/models"
+	"github.com/White-AK111/REST/internal/models/inmemory"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// recorder it's a notifier sending reminders into channel.
+type recorder chan Reminder
+
+// Notify method sends reminder into channel.
+func (r recorder) Notify(reminder Reminder) error {
+	r <- reminder
+	return nil
+}
+
+// newScheduler returns scheduler of store with reminders and grace period, its reminders are sent to recorder.
+func newScheduler(t *testing.T, store models.Repository, stateFile string, grace time.Duration, reminders ...time.Duration) (*Scheduler, recorder) {
+	t.Helper()
+	cfg := &config.Config{}
+	cfg.Scheduler.Reminders = reminders
+	cfg.Scheduler.MissedGrace = grace
+	cfg.Scheduler.StateFile = stateFile
+	s, err := New(cfg, store, nil)
+	if err != nil {
+		t.Fatalf("New: %s", err)
+	}
+	rec := make(recorder, 16)
+	s.notifiers = []Notifier{rec}
+	t.Cleanup(s.Close)
+	return s, rec
+}
+
+// receive returns the next reminder sent to recorder.
+func receive(t *testing.T, rec recorder) Reminder {
+	t.Helper()
+	select {
+	case r := <-rec:
+		return r
+	case <-time.After(2 * time.Second):
+		t.Fatalf("no reminder is fired")
+		return Reminder{}
+	}
+}
+
+func TestNew(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Scheduler.Reminders = []time.Duration{-time.Hour}
+	if _, err := New(cfg, inmemory.NewStorage(models.RejectSubtasks), nil); err == nil {
+		t.Errorf("New accepted reminder after due date")
+	}
+	cfg.Scheduler.Reminders = nil
+	cfg.Scheduler.Notifiers = []string{"pager"}
+	if _, err := New(cfg, inmemory.NewStorage(models.RejectSubtasks), nil); err == nil {
+		t.Errorf("New accepted unknown notifier")
+	}
+}
+
+func TestSchedule(t *testing.T) {
+	s, _ := newScheduler(t, nil, "", time.Hour, 0, time.Hour)
+	due := time.Now().Add(2 * time.Hour)
+
+	s.Schedule(models.Task{Id: 1, Text: "report", Due: due})
+	s.Schedule(models.Task{Id: 2, Text: "done", Due: due, Done: true})
+	s.Schedule(models.Task{Id: 3, Text: "someday"})
+	s.Schedule(models.Task{Id: 4, Text: "standup", Due: due.Add(time.Minute), RRule: "FREQ=DAILY"})
+
+	upcoming := s.Upcoming()
+	if len(upcoming) != 4 {
+		t.Fatalf("upcoming reminders are %+v, want 2 reminders of each open task with due date", upcoming)
+	}
+	if upcoming[0].Task.Id != 1 || upcoming[0].Before != time.Hour || !upcoming[0].At.Equal(due.Add(-time.Hour)) ||
+		upcoming[2].Task.Id != 1 || upcoming[2].Before != 0 || !upcoming[2].At.Equal(due) {
+		t.Errorf("upcoming reminders are %+v, want them ordered by time of firing", upcoming)
+	}
+
+	s.Schedule(models.Task{Id: 1, Text: "report", Due: due, Done: true})
+	s.Unschedule(4)
+	if upcoming = s.Upcoming(); len(upcoming) != 0 {
+		t.Errorf("upcoming reminders are %+v, want none after task is done and unscheduled", upcoming)
+	}
+}
+
+func TestScheduleMissed(t *testing.T) {
+	s, _ := newScheduler(t, nil, "", time.Hour, 0, time.Hour, 2*time.Hour)
+	due := time.Now().Add(-30 * time.Minute)
+
+	s.Schedule(models.Task{Id: 1, Text: "report", Due: due})
+	if upcoming := s.Upcoming(); len(upcoming) != 1 || upcoming[0].Before != 0 {
+		t.Errorf("upcoming reminders are %+v, want only the latest missed reminder", upcoming)
+	}
+
+	s.Schedule(models.Task{Id: 1, Text: "report", Due: due.Add(-time.Hour)})
+	if upcoming := s.Upcoming(); len(upcoming) != 0 {
+		t.Errorf("upcoming reminders are %+v, want none of reminders missed longer than grace period", upcoming)
+	}
+}
+
+func TestFireDue(t *testing.T) {
+	s, rec := newScheduler(t, nil, "", time.Hour, 0, time.Hour)
+	due := time.Now().Add(30 * time.Minute)
+	task := models.Task{Id: 1, Text: "report", Due: due}
+	s.Schedule(task)
+
+	s.fireDue(time.Now())
+	if r := receive(t, rec); r.Task.Id != 1 || r.Before != time.Hour {
+		t.Errorf("fired reminder is %+v, want reminder an hour before due date", r)
+	}
+	s.Schedule(task)
+	if upcoming := s.Upcoming(); len(upcoming) != 1 || upcoming[0].Before != 0 {
+		t.Errorf("upcoming reminders are %+v, want fired reminder not scheduled again", upcoming)
+	}
+
+	task.Due = due.Add(24 * time.Hour)
+	s.Schedule(task)
+	if upcoming := s.Upcoming(); len(upcoming) != 2 {
+		t.Errorf("upcoming reminders are %+v, want both reminders armed again by changed due date", upcoming)
+	}
+}
+
+func TestRun(t *testing.T) {
+	bus := events.NewBus()
+	store := events.Observe(inmemory.NewStorage(models.RejectSubtasks), bus)
+	s, rec := newScheduler(t, store, "", time.Hour, 0)
+	go s.Run(bus)
+
+	due := time.Now().Add(100 * time.Millisecond)
+	id, err := store.CreateTask(models.Task{Text: "standup", Due: due, RRule: "FREQ=DAILY"})
+	if err != nil {
+		t.Fatalf("CreateTask: %s", err)
+	}
+	if r := receive(t, rec); r.Task.Id != id {
+		t.Errorf("fired reminder is %+v, want reminder of created task", r)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(store.GetAllTasks()) != 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	var next models.Task
+	for _, task := range store.GetAllTasks() {
+		if task.Id != id {
+			next = task
+		}
+	}
+	if next.Id == 0 || !next.Due.Equal(due.AddDate(0, 0, 1)) || next.RRule != "FREQ=DAILY" {
+		t.Fatalf("next occurrence is %+v, want recurring task due day after", next)
+	}
+	for len(s.Upcoming()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if upcoming := s.Upcoming(); len(upcoming) != 1 || upcoming[0].Task.Id != next.Id {
+		t.Errorf("upcoming reminders are %+v, want reminder of next occurrence", upcoming)
+	}
+}
+
+func TestState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	due := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+
+	state, err := OpenState(path)
+	if err != nil {
+		t.Fatalf("OpenState: %s", err)
+	}
+	for id := 1; id <= 3; id++ {
+		if err = state.MarkFired(reminderKey(id, due, time.Hour), due); err != nil {
+			t.Fatalf("MarkFired: %s", err)
+		}
+	}
+	if err = state.Forget(1); err != nil {
+		t.Fatalf("Forget: %s", err)
+	}
+	if err = state.Retain(map[int]bool{1: true, 2: true}); err != nil {
+		t.Fatalf("Retain: %s", err)
+	}
+
+	state, err = OpenState(path)
+	if err != nil {
+		t.Fatalf("OpenState of saved state: %s", err)
+	}
+	for id, fired := range map[int]bool{1: false, 2: true, 3: false} {
+		if state.Fired(reminderKey(id, due, time.Hour)) != fired {
+			t.Errorf("reminder of task %d is fired %v after reopen, want %v", id, !fired, fired)
+		}
+	}
+	if state.Fired(reminderKey(2, due.Add(time.Minute), time.Hour)) {
+		t.Errorf("reminder of changed due date is fired")
+	}
+}
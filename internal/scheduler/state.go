@@ -0,0 +1,127 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// State keeps fired reminders, so that after restart reminders are neither repeated nor lost.
+// State with empty path lives only in memory. State methods are safe to call concurrently.
+type State struct {
+	sync.Mutex
+	path  string
+	fired map[string]time.Time // key of reminder -> time of firing
+}
+
+// OpenState function loads state from JSON file at path, missing file means empty state.
+func OpenState(path string) (*State, error) {
+	s := &State{path: path, fired: make(map[string]time.Time)}
+	if path == "" {
+		return s, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can't read scheduler state: %w", err)
+	}
+	if err = json.Unmarshal(data, &s.fired); err != nil {
+		return nil, fmt.Errorf("can't parse scheduler state %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// reminderKey returns key of reminder, key depends on due date so that changed due date arms reminders again.
+func reminderKey(taskId int, due time.Time, before time.Duration) string {
+	return strconv.Itoa(taskId) + "|" + due.UTC().Format(time.RFC3339) + "|" + before.String()
+}
+
+// taskIdOfKey returns id of task from key of reminder.
+func taskIdOfKey(key string) int {
+	id, _ := strconv.Atoi(key[:strings.IndexByte(key, '|')])
+	return id
+}
+
+// Fired reports whether reminder was fired.
+func (s *State) Fired(key string) bool {
+	s.Lock()
+	defer s.Unlock()
+
+	_, ok := s.fired[key]
+	return ok
+}
+
+// MarkFired records firing of reminder.
+func (s *State) MarkFired(key string, at time.Time) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.fired[key] = at
+	return s.save()
+}
+
+// Forget deletes records of reminders of task.
+func (s *State) Forget(taskId int) error {
+	return s.retain(func(id int) bool { return id != taskId })
+}
+
+// Retain deletes records of reminders of tasks which aren't in ids.
+func (s *State) Retain(ids map[int]bool) error {
+	return s.retain(func(id int) bool { return ids[id] })
+}
+
+// retain deletes records of reminders of tasks for which keep returns false.
+func (s *State) retain(keep func(taskId int) bool) error {
+	s.Lock()
+	defer s.Unlock()
+
+	changed := false
+	for key := range s.fired {
+		if !keep(taskIdOfKey(key)) {
+			delete(s.fired, key)
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return s.save()
+}
+
+// save writes state to file atomically, must be called with lock held.
+func (s *State) save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(s.fired)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return fmt.Errorf("can't save scheduler state: %w", err)
+	}
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("can't save scheduler state: %w", err)
+	}
+	if err = tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("can't save scheduler state: %w", err)
+	}
+	if err = os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("can't save scheduler state: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"github.com/White-AK111/REST/internal/codec"
+	"github.com/White-AK111/REST/internal/jwt"
+	"net/http"
+	"strings"
+)
+
+// Challenge it's a value of WWW-Authenticate header of response to request with invalid credentials or tokens.
+const Challenge = `Bearer realm="tasks"`
+
+// handler it's a HTTP API of sessions.
+type handler struct {
+	s *Sessions
+}
+
+// Handler returns handler of "auth" path for net/http based servers, it rejects requests if sessions are nil:
+//
+//	POST /auth/login    log in: {"user":"alice","password":"secret"}, returns tokens
+//	POST /auth/refresh  rotate refresh token: {"refreshToken":"..."}, returns new tokens
+//	POST /auth/logout   revoke session of access token of Authorization header and/or of {"refreshToken":"..."}
+func Handler(s *Sessions) http.Handler {
+	return &handler{s: s}
+}
+
+// ServeHTTP routes request by path and method.
+func (h *handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if h.s == nil {
+		http.Error(w, ErrDisabled.Error(), http.StatusForbidden)
+		return
+	}
+
+	path := strings.Trim(req.URL.Path, "/")
+	pathParts := strings.Split(path, "/")
+	if len(pathParts) != 2 || pathParts[0] != "auth" {
+		http.NotFound(w, req)
+		return
+	}
+	if req.Method != http.MethodPost {
+		http.Error(w, fmt.Sprintf("expect method POST at %s, got %v", req.URL.Path, req.Method), http.StatusMethodNotAllowed)
+		return
+	}
+
+	switch pathParts[1] {
+	case "login":
+		h.loginHandler(w, req)
+	case "refresh":
+		h.refreshHandler(w, req)
+	case "logout":
+		h.logoutHandler(w, req)
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+// loginHandler handler for "auth/login" path, starts session.
+func (h *handler) loginHandler(w http.ResponseWriter, req *http.Request) {
+	type RequestLogin struct {
+		User     string `json:"user" xml:"user" yaml:"user"`
+		Password string `json:"password" xml:"password" yaml:"password"`
+	}
+
+	var rl RequestLogin
+	if !decodeBody(w, req, &rl) {
+		return
+	}
+	tokens, err := h.s.Login(rl.User, rl.Password)
+	if err != nil {
+		unauthorized(w, err)
+		return
+	}
+	renderTokens(w, req, tokens)
+}
+
+// refreshHandler handler for "auth/refresh" path, rotates refresh token.
+func (h *handler) refreshHandler(w http.ResponseWriter, req *http.Request) {
+	type RequestRefresh struct {
+		RefreshToken string `json:"refreshToken" xml:"refreshToken" yaml:"refreshToken"`
+	}
+
+	var rr RequestRefresh
+	if !decodeBody(w, req, &rr) {
+		return
+	}
+	tokens, err := h.s.Refresh(rr.RefreshToken)
+	if err != nil {
+		unauthorized(w, err)
+		return
+	}
+	renderTokens(w, req, tokens)
+}
+
+// logoutHandler handler for "auth/logout" path, revokes session, body is optional.
+func (h *handler) logoutHandler(w http.ResponseWriter, req *http.Request) {
+	type RequestRefresh struct {
+		RefreshToken string `json:"refreshToken" xml:"refreshToken" yaml:"refreshToken"`
+	}
+
+	var rr RequestRefresh
+	if req.ContentLength != 0 && !decodeBody(w, req, &rr) {
+		return
+	}
+	if err := h.s.Logout(jwt.Bearer(req.Header.Get("Authorization")), rr.RefreshToken); err != nil {
+		unauthorized(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// unauthorized writes error of credentials or tokens.
+func unauthorized(w http.ResponseWriter, err error) {
+	w.Header().Set("WWW-Authenticate", Challenge)
+	http.Error(w, err.Error(), http.StatusUnauthorized)
+}
+
+// renderTokens renders issued tokens, they must not be cached (RFC 6749, section 5.1).
+func renderTokens(w http.ResponseWriter, req *http.Request, tokens Tokens) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	render(w, req, http.StatusOK, tokens)
+}
+
+// decodeBody decodes request body into v by Content-Type of req, on error writes response and returns false.
+func decodeBody(w http.ResponseWriter, req *http.Request, v interface{}) bool {
+	dec, err := codec.ForContentType(req.Header.Get("Content-Type"))
+	if errors.Is(err, codec.ErrUnsupportedMediaType) {
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	if err = dec.Decode(req.Body, v); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// render renders 'v' in format negotiated by Accept header of req and writes it as a response with status code.
+func render(w http.ResponseWriter, req *http.Request, code int, v interface{}) {
+	enc, err := codec.Negotiate(req.Header.Get("Accept"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotAcceptable)
+		return
+	}
+	data, err := enc.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", enc.ContentType())
+	w.WriteHeader(code)
+	_, _ = w.Write(data)
+}
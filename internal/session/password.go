@@ -0,0 +1,85 @@
+package session
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+)
+
+// argon2Prefix it's a prefix of argon2id hash in PHC string format:
+// $argon2id$v=19$m=65536,t=3,p=4$<salt>$<hash>, salt and hash are base64 without padding.
+const argon2Prefix = "$argon2id$"
+
+// password it's a parsed hash of password.
+type password interface {
+	// check reports whether plain password matches hash.
+	check(plain string) bool
+}
+
+// bcryptHash it's a bcrypt hash of password.
+type bcryptHash []byte
+
+// check compares password with bcrypt hash.
+func (h bcryptHash) check(plain string) bool {
+	return bcrypt.CompareHashAndPassword(h, []byte(plain)) == nil
+}
+
+// argon2Hash it's an argon2id hash of password with its parameters.
+type argon2Hash struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+	salt    []byte
+	key     []byte
+}
+
+// check compares password with argon2id hash.
+func (h argon2Hash) check(plain string) bool {
+	key := argon2.IDKey([]byte(plain), h.salt, h.time, h.memory, h.threads, uint32(len(h.key)))
+	return subtle.ConstantTimeCompare(key, h.key) == 1
+}
+
+// parsePassword parses bcrypt hash or argon2id hash in PHC string format.
+func parsePassword(hash string) (password, error) {
+	if strings.HasPrefix(hash, argon2Prefix) {
+		return parseArgon2(hash)
+	}
+	if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+		return nil, fmt.Errorf("expect bcrypt or argon2id hash: %s", err)
+	}
+	return bcryptHash(hash), nil
+}
+
+// parseArgon2 parses argon2id hash in PHC string format.
+func parseArgon2(hash string) (password, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return nil, errors.New("argon2id hash must be $argon2id$v=19$m=<memory>,t=<time>,p=<threads>$<salt>$<hash>")
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, fmt.Errorf("unsupported version of argon2id hash %q, expect v=%d", parts[2], argon2.Version)
+	}
+	var h argon2Hash
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &h.memory, &h.time, &h.threads); err != nil {
+		return nil, fmt.Errorf("parameters of argon2id hash %q: %s", parts[3], err)
+	}
+	if h.memory == 0 || h.time == 0 || h.threads == 0 {
+		return nil, fmt.Errorf("parameters of argon2id hash %q must be positive", parts[3])
+	}
+	var err error
+	if h.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, fmt.Errorf("salt of argon2id hash: %s", err)
+	}
+	if h.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		return nil, fmt.Errorf("key of argon2id hash: %s", err)
+	}
+	if len(h.key) == 0 {
+		return nil, errors.New("key of argon2id hash is empty")
+	}
+	return h, nil
+}
@@ -0,0 +1,290 @@
+// Package session issues tokens to users of config who log in with password: a short-lived access token, which
+// is a JWT signed by HS256 with key of config, and a long-lived opaque refresh token. Each refresh rotates the
+// refresh token, so a refresh token is used once: reuse of a refresh token means it's stolen and revokes the whole
+// session. Logout revokes session too. Keys are rotated by config: the first key signs, all keys verify.
+package session
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/White-AK111/REST/config"
+	"github.com/White-AK111/REST/internal/jwt"
+	"golang.org/x/crypto/bcrypt"
+	"sync"
+	"time"
+)
+
+// minSecret it's a min size of secret of key, HS256 key shouldn't be shorter than its hash.
+const minSecret = 32
+
+// TokenType it's a type of issued access tokens.
+const TokenType = "Bearer"
+
+// Errors of sessions.
+var (
+	ErrDisabled    = errors.New("login is disabled")
+	ErrCredentials = errors.New("user or password is invalid")
+	ErrRefresh     = errors.New("refresh token is invalid or expired")
+	ErrReused      = errors.New("refresh token is already used, session is revoked")
+	ErrRevoked     = errors.New("session is revoked")
+	ErrToken       = errors.New("valid access or refresh token is required")
+)
+
+// Tokens it's a tokens issued on login and refresh.
+type Tokens struct {
+	AccessToken  string `json:"accessToken" xml:"accessToken" yaml:"accessToken"`
+	RefreshToken string `json:"refreshToken" xml:"refreshToken" yaml:"refreshToken"`
+	TokenType    string `json:"tokenType" xml:"tokenType" yaml:"tokenType"`
+	ExpiresIn    int    `json:"expiresIn" xml:"expiresIn" yaml:"expiresIn"` // lifetime of access token in seconds
+}
+
+// refresh it's an issued refresh token, it's kept after use until expiration to detect reuse.
+type refresh struct {
+	user      string
+	session   string
+	expiresAt time.Time
+	used      bool
+}
+
+// Sessions issues, refreshes and revokes tokens of users, it's safe to call concurrently.
+type Sessions struct {
+	sync.Mutex
+	issuer     string
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+	kid        string // id of key signing access tokens
+	secret     []byte // secret of key signing access tokens
+	verifier   *jwt.Verifier
+	passwords  map[string]password
+	dummy      password            // hash checked for unknown users, so they can't be found by time of response
+	refreshes  map[string]*refresh // by SHA-256 of token, token itself isn't kept
+	revoked    map[string]time.Time
+	now        func() time.Time
+}
+
+// New function initialize a new Sessions with users and keys from config, returns nil Sessions if there are no keys.
+func New(cfg *config.Config) (*Sessions, error) {
+	c := cfg.Auth.Login
+	if len(c.Keys) == 0 {
+		return nil, nil
+	}
+
+	secrets := make(map[string][]byte, len(c.Keys))
+	for _, k := range c.Keys {
+		if k.Id == "" {
+			return nil, errors.New("id of login key is required")
+		}
+		if _, ok := secrets[k.Id]; ok {
+			return nil, fmt.Errorf("login key %q is duplicated", k.Id)
+		}
+		if len(k.Secret) < minSecret {
+			return nil, fmt.Errorf("secret of login key %q must be at least %d bytes", k.Id, minSecret)
+		}
+		secrets[k.Id] = []byte(k.Secret)
+	}
+	verifier, err := jwt.New(jwt.Options{Algorithms: []string{jwt.HS256}, Secrets: secrets, Issuer: c.Issuer})
+	if err != nil {
+		return nil, err
+	}
+
+	passwords := make(map[string]password)
+	for _, u := range cfg.Auth.Users {
+		if u.PasswordHash == "" {
+			continue
+		}
+		p, err := parsePassword(u.PasswordHash)
+		if err != nil {
+			return nil, fmt.Errorf("password of user %q: %s", u.Name, err)
+		}
+		passwords[u.Name] = p
+	}
+	dummy, err := bcrypt.GenerateFromPassword([]byte(randomString(16)), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Sessions{
+		issuer:     c.Issuer,
+		accessTTL:  c.AccessTTL,
+		refreshTTL: c.RefreshTTL,
+		kid:        c.Keys[0].Id,
+		secret:     []byte(c.Keys[0].Secret),
+		verifier:   verifier,
+		passwords:  passwords,
+		dummy:      bcryptHash(dummy),
+		refreshes:  make(map[string]*refresh),
+		revoked:    make(map[string]time.Time),
+		now:        time.Now,
+	}, nil
+}
+
+// randomString returns n random bytes encoded by base64url.
+func randomString(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("session: random: %s", err))
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// digest returns key of refresh token in sessions.
+func digest(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Login checks password of user and starts a new session.
+func (s *Sessions) Login(user, plain string) (Tokens, error) {
+	p, ok := s.passwords[user]
+	if !ok {
+		s.dummy.check(plain)
+		return Tokens{}, ErrCredentials
+	}
+	if !p.check(plain) {
+		return Tokens{}, ErrCredentials
+	}
+	return s.Start(user)
+}
+
+// Start starts a new session of user authenticated by caller, e.g. by OpenID Connect provider.
+func (s *Sessions) Start(user string) (Tokens, error) {
+	s.Lock()
+	defer s.Unlock()
+	s.purge()
+	return s.issue(user, randomString(16))
+}
+
+// Refresh exchanges refresh token for new tokens of its session, the refresh token can't be used again.
+// Reuse of refresh token revokes its session.
+func (s *Sessions) Refresh(token string) (Tokens, error) {
+	s.Lock()
+	defer s.Unlock()
+	s.purge()
+
+	r, ok := s.refreshes[digest(token)]
+	if !ok {
+		return Tokens{}, ErrRefresh
+	}
+	if r.used {
+		s.revoke(r.session)
+		return Tokens{}, ErrReused
+	}
+	r.used = true
+	return s.issue(r.user, r.session)
+}
+
+// Logout revokes session of refresh token or of access token: refresh tokens of session can't be used and access
+// tokens of session aren't accepted.
+func (s *Sessions) Logout(accessToken, refreshToken string) error {
+	var session string
+	if accessToken != "" {
+		claims, err := s.verify(accessToken)
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrToken, err)
+		}
+		session = claims.String("sid")
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	s.purge()
+
+	if refreshToken != "" {
+		r, ok := s.refreshes[digest(refreshToken)]
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrToken, ErrRefresh)
+		}
+		if session != "" && session != r.session {
+			return fmt.Errorf("%w: tokens are of different sessions", ErrToken)
+		}
+		session = r.session
+	}
+	if session == "" {
+		return ErrToken
+	}
+	s.revoke(session)
+	return nil
+}
+
+// Verify verifies access token issued by sessions and returns user of token.
+func (s *Sessions) Verify(token string) (string, error) {
+	claims, err := s.verify(token)
+	if err != nil {
+		return "", err
+	}
+	return claims.Subject(), nil
+}
+
+// verify verifies access token and checks that its session isn't revoked.
+func (s *Sessions) verify(token string) (jwt.Claims, error) {
+	claims, err := s.verifier.Verify(token)
+	if err != nil {
+		return nil, err
+	}
+	session := claims.String("sid")
+	if session == "" || claims.Subject() == "" {
+		return nil, fmt.Errorf("%w: token has no session or subject", jwt.ErrMalformed)
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	if _, ok := s.revoked[session]; ok {
+		return nil, ErrRevoked
+	}
+	return claims, nil
+}
+
+// issue issues access token and refresh token of session, sessions must be locked.
+func (s *Sessions) issue(user, session string) (Tokens, error) {
+	now := s.now()
+	access, err := jwt.SignHS256(jwt.Claims{
+		"iss": s.issuer,
+		"sub": user,
+		"iat": now.Unix(),
+		"exp": now.Add(s.accessTTL).Unix(),
+		"jti": randomString(16),
+		"sid": session,
+	}, s.kid, s.secret)
+	if err != nil {
+		return Tokens{}, err
+	}
+
+	token := randomString(32)
+	s.refreshes[digest(token)] = &refresh{user: user, session: session, expiresAt: now.Add(s.refreshTTL)}
+	return Tokens{
+		AccessToken:  access,
+		RefreshToken: token,
+		TokenType:    TokenType,
+		ExpiresIn:    int(s.accessTTL / time.Second),
+	}, nil
+}
+
+// revoke deletes refresh tokens of session and rejects its access tokens until they are expired, sessions must be
+// locked.
+func (s *Sessions) revoke(session string) {
+	for key, r := range s.refreshes {
+		if r.session == session {
+			delete(s.refreshes, key)
+		}
+	}
+	s.revoked[session] = s.now().Add(s.accessTTL)
+}
+
+// purge deletes expired refresh tokens and revoked sessions whose access tokens are expired, sessions must be locked.
+func (s *Sessions) purge() {
+	now := s.now()
+	for key, r := range s.refreshes {
+		if now.After(r.expiresAt) {
+			delete(s.refreshes, key)
+		}
+	}
+	for session, until := range s.revoked {
+		if now.After(until) {
+			delete(s.revoked, session)
+		}
+	}
+}
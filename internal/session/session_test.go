@@ -0,0 +1,278 @@
+package session
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/White-AK111/REST/config"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// secretA and secretB are secrets of login keys.
+const (
+	secretA = "0123456789abcdef0123456789abcdef"
+	secretB = "fedcba9876543210fedcba9876543210"
+)
+
+// newConfig returns config with login keys and users alice with bcrypt hash and bob with argon2id hash
+// of password "secret".
+func newConfig(t *testing.T, keys ...config.Key) *config.Config {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("GenerateFromPassword: %s", err)
+	}
+	salt := []byte("0123456789abcdef")
+	key := argon2.IDKey([]byte("secret"), salt, 1, 64, 1, 32)
+
+	cfg := &config.Config{}
+	cfg.Auth.Users = []config.User{
+		{Name: "alice", PasswordHash: string(hash)},
+		{Name: "bob", PasswordHash: fmt.Sprintf("$argon2id$v=19$m=64,t=1,p=1$%s$%s",
+			base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))},
+		{Name: "carol", Token: "carol-token"},
+	}
+	cfg.Auth.Login.Issuer = "tasks"
+	cfg.Auth.Login.AccessTTL = 15 * time.Minute
+	cfg.Auth.Login.RefreshTTL = time.Hour
+	cfg.Auth.Login.Keys = keys
+	return cfg
+}
+
+// newSessions returns sessions of config with login key "a".
+func newSessions(t *testing.T) *Sessions {
+	t.Helper()
+	s, err := New(newConfig(t, config.Key{Id: "a", Secret: secretA}))
+	if err != nil {
+		t.Fatalf("New: %s", err)
+	}
+	return s
+}
+
+// login logs in user with password "secret".
+func login(t *testing.T, s *Sessions, user string) Tokens {
+	t.Helper()
+	tokens, err := s.Login(user, "secret")
+	if err != nil {
+		t.Fatalf("Login(%q): %s", user, err)
+	}
+	return tokens
+}
+
+func TestNew(t *testing.T) {
+	if s, err := New(newConfig(t)); s != nil || err != nil {
+		t.Errorf("New without keys returned %v, %v, want nil sessions", s, err)
+	}
+	if _, err := New(newConfig(t, config.Key{Id: "b", Secret: secretB}, config.Key{Id: "a", Secret: secretA})); err != nil {
+		t.Errorf("New with rotated keys: %s", err)
+	}
+
+	for _, tt := range []struct {
+		name   string
+		change func(cfg *config.Config)
+	}{
+		{"key without id", func(cfg *config.Config) { cfg.Auth.Login.Keys[0].Id = "" }},
+		{"short secret", func(cfg *config.Config) { cfg.Auth.Login.Keys[0].Secret = "short" }},
+		{"duplicated key", func(cfg *config.Config) {
+			cfg.Auth.Login.Keys = append(cfg.Auth.Login.Keys, config.Key{Id: "a", Secret: secretB})
+		}},
+		{"plain password", func(cfg *config.Config) { cfg.Auth.Users[0].PasswordHash = "secret" }},
+		{"zero memory of argon2id", func(cfg *config.Config) {
+			cfg.Auth.Users[1].PasswordHash = "$argon2id$v=19$m=0,t=1,p=1$c2FsdA$a2V5"
+		}},
+		{"old version of argon2id", func(cfg *config.Config) {
+			cfg.Auth.Users[1].PasswordHash = "$argon2id$v=16$m=64,t=1,p=1$c2FsdA$a2V5"
+		}},
+	} {
+		cfg := newConfig(t, config.Key{Id: "a", Secret: secretA})
+		tt.change(cfg)
+		if _, err := New(cfg); err == nil {
+			t.Errorf("New accepted config with %s", tt.name)
+		}
+	}
+}
+
+func TestLogin(t *testing.T) {
+	s := newSessions(t)
+	for _, user := range []string{"alice", "bob"} {
+		tokens := login(t, s, user)
+		if tokens.TokenType != TokenType || tokens.ExpiresIn != 15*60 || tokens.RefreshToken == "" {
+			t.Errorf("tokens of %s are %+v, want bearer token for 15 minutes and refresh token", user, tokens)
+		}
+		if got, err := s.Verify(tokens.AccessToken); err != nil || got != user {
+			t.Errorf("Verify of access token of %s returned %q, %v", user, got, err)
+		}
+	}
+
+	for _, tt := range []struct{ user, password string }{
+		{"alice", "wrong"}, {"bob", "wrong"}, {"carol", "carol-token"}, {"dave", "secret"},
+	} {
+		if _, err := s.Login(tt.user, tt.password); !errors.Is(err, ErrCredentials) {
+			t.Errorf("Login(%q, %q): %v, want %v", tt.user, tt.password, err, ErrCredentials)
+		}
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	s := newSessions(t)
+	first := login(t, s, "alice")
+
+	second, err := s.Refresh(first.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh: %s", err)
+	}
+	if second.RefreshToken == first.RefreshToken || second.AccessToken == first.AccessToken {
+		t.Errorf("Refresh returned the same tokens, want them rotated")
+	}
+	if got, err := s.Verify(second.AccessToken); err != nil || got != "alice" {
+		t.Errorf("Verify of refreshed access token returned %q, %v", got, err)
+	}
+
+	other := login(t, s, "alice")
+	if _, err = s.Refresh(first.RefreshToken); !errors.Is(err, ErrReused) {
+		t.Fatalf("Refresh with used token: %v, want %v", err, ErrReused)
+	}
+	if _, err = s.Refresh(second.RefreshToken); !errors.Is(err, ErrRefresh) {
+		t.Errorf("Refresh with token of revoked session: %v, want %v", err, ErrRefresh)
+	}
+	for _, token := range []string{first.AccessToken, second.AccessToken} {
+		if _, err = s.Verify(token); !errors.Is(err, ErrRevoked) {
+			t.Errorf("Verify of access token of revoked session: %v, want %v", err, ErrRevoked)
+		}
+	}
+	if _, err = s.Refresh(other.RefreshToken); err != nil {
+		t.Errorf("Refresh of other session of user: %s", err)
+	}
+}
+
+func TestRefreshExpires(t *testing.T) {
+	s := newSessions(t)
+	tokens := login(t, s, "alice")
+
+	now := time.Now()
+	s.now = func() time.Time { return now.Add(time.Hour + time.Minute) }
+	if _, err := s.Refresh(tokens.RefreshToken); !errors.Is(err, ErrRefresh) {
+		t.Errorf("Refresh with expired token: %v, want %v", err, ErrRefresh)
+	}
+	if _, err := s.Refresh("unknown"); !errors.Is(err, ErrRefresh) {
+		t.Errorf("Refresh with unknown token: %v, want %v", err, ErrRefresh)
+	}
+}
+
+func TestLogout(t *testing.T) {
+	s := newSessions(t)
+
+	byAccess := login(t, s, "alice")
+	if err := s.Logout(byAccess.AccessToken, ""); err != nil {
+		t.Fatalf("Logout by access token: %s", err)
+	}
+	if _, err := s.Refresh(byAccess.RefreshToken); !errors.Is(err, ErrRefresh) {
+		t.Errorf("Refresh after logout: %v, want %v", err, ErrRefresh)
+	}
+
+	byRefresh := login(t, s, "alice")
+	if err := s.Logout("", byRefresh.RefreshToken); err != nil {
+		t.Fatalf("Logout by refresh token: %s", err)
+	}
+	if _, err := s.Verify(byRefresh.AccessToken); !errors.Is(err, ErrRevoked) {
+		t.Errorf("Verify after logout: %v, want %v", err, ErrRevoked)
+	}
+
+	one, another := login(t, s, "alice"), login(t, s, "bob")
+	if err := s.Logout(one.AccessToken, another.RefreshToken); !errors.Is(err, ErrToken) {
+		t.Errorf("Logout by tokens of different sessions: %v, want %v", err, ErrToken)
+	}
+	if err := s.Logout("", ""); !errors.Is(err, ErrToken) {
+		t.Errorf("Logout without tokens: %v, want %v", err, ErrToken)
+	}
+	if _, err := s.Verify(one.AccessToken); err != nil {
+		t.Errorf("Verify after failed logout: %s", err)
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	tokens := login(t, newSessions(t), "alice")
+
+	rotated, err := New(newConfig(t, config.Key{Id: "b", Secret: secretB}, config.Key{Id: "a", Secret: secretA}))
+	if err != nil {
+		t.Fatalf("New: %s", err)
+	}
+	if got, err := rotated.Verify(tokens.AccessToken); err != nil || got != "alice" {
+		t.Errorf("Verify of token signed by previous key returned %q, %v", got, err)
+	}
+	if got, err := rotated.Verify(login(t, rotated, "bob").AccessToken); err != nil || got != "bob" {
+		t.Errorf("Verify of token signed by new key returned %q, %v", got, err)
+	}
+
+	retired, err := New(newConfig(t, config.Key{Id: "b", Secret: secretB}))
+	if err != nil {
+		t.Fatalf("New: %s", err)
+	}
+	if _, err = retired.Verify(tokens.AccessToken); err == nil {
+		t.Errorf("Verify accepted token signed by retired key")
+	}
+}
+
+func TestHandler(t *testing.T) {
+	s := newSessions(t)
+	h := Handler(s)
+	do := func(method, path, authorization, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do(http.MethodPost, "/auth/login", "", `{"user":"alice","password":"secret"}`)
+	if rec.Code != http.StatusOK || rec.Header().Get("Cache-Control") != "no-store" {
+		t.Fatalf("login got %d with Cache-Control %q, want %d with no-store", rec.Code, rec.Header().Get("Cache-Control"), http.StatusOK)
+	}
+	var tokens Tokens
+	if err := json.Unmarshal(rec.Body.Bytes(), &tokens); err != nil || tokens.AccessToken == "" {
+		t.Fatalf("login returned %s, %v, want tokens", rec.Body, err)
+	}
+
+	rec = do(http.MethodPost, "/auth/login", "", `{"user":"alice","password":"wrong"}`)
+	if rec.Code != http.StatusUnauthorized || rec.Header().Get("WWW-Authenticate") != Challenge {
+		t.Errorf("login with wrong password got %d with challenge %q, want %d", rec.Code, rec.Header().Get("WWW-Authenticate"), http.StatusUnauthorized)
+	}
+	if rec = do(http.MethodGet, "/auth/login", "", ""); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET of login got %d, want %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+	if rec = do(http.MethodPost, "/auth/unknown", "", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown path got %d, want %d", rec.Code, http.StatusNotFound)
+	}
+
+	rec = do(http.MethodPost, "/auth/refresh", "", fmt.Sprintf(`{"refreshToken":%q}`, tokens.RefreshToken))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("refresh got %d: %s", rec.Code, rec.Body)
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &tokens); err != nil {
+		t.Fatalf("refresh returned %s: %s", rec.Body, err)
+	}
+	if rec = do(http.MethodPost, "/auth/logout", "Bearer "+tokens.AccessToken, ""); rec.Code != http.StatusNoContent {
+		t.Errorf("logout got %d: %s", rec.Code, rec.Body)
+	}
+	if rec = do(http.MethodPost, "/auth/logout", "Bearer "+tokens.AccessToken, ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("logout of revoked session got %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+
+	rec = httptest.NewRecorder()
+	Handler(nil).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/auth/login", nil))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("login without sessions got %d, want %d", rec.Code, http.StatusForbidden)
+	}
+}
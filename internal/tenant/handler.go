@@ -0,0 +1,175 @@
+package tenant
+
+import (
+	"errors"
+	"fmt"
+	"github.com/White-AK111/REST/internal/codec"
+	"net/http"
+	"strings"
+)
+
+// Challenge it's a value of WWW-Authenticate header of response to request without valid admin token.
+const Challenge = `Bearer realm="admin"`
+
+// handler it's a HTTP API of tenants for admin.
+type handler struct {
+	ts *Tenants
+}
+
+// Handler returns handler of "admin/tenants" path for net/http based servers, requests are authorized by admin
+// token of config in Authorization header:
+//
+//	POST   /admin/tenants         create tenant: {"name":"team","maxTasks":100}, maxTasks is optional
+//	GET    /admin/tenants         all tenants with counts of tasks
+//	GET    /admin/tenants/<name>  tenant
+//	PUT    /admin/tenants/<name>  change quota: {"maxTasks":200}
+//	DELETE /admin/tenants/<name>  delete tenant with all its tasks
+func Handler(ts *Tenants) http.Handler {
+	return &handler{ts: ts}
+}
+
+// ServeHTTP authorizes request and routes it by path and method.
+func (h *handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if err := h.ts.Authorize(req.Header.Get("Authorization")); err != nil {
+		if errors.Is(err, ErrDisabled) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		w.Header().Set("WWW-Authenticate", Challenge)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	path := strings.Trim(req.URL.Path, "/")
+	pathParts := strings.Split(path, "/")
+	if len(pathParts) < 2 || pathParts[0] != "admin" || pathParts[1] != "tenants" {
+		http.NotFound(w, req)
+		return
+	}
+	pathParts = pathParts[2:]
+
+	switch {
+	case len(pathParts) == 0:
+		if req.Method == http.MethodPost {
+			h.createHandler(w, req)
+		} else if req.Method == http.MethodGet {
+			render(w, req, http.StatusOK, h.ts.List())
+		} else {
+			methodNotAllowed(w, req, "GET or POST")
+		}
+	case len(pathParts) == 1:
+		h.tenantHandler(w, req, pathParts[0])
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+// createHandler handler for POST method, creates tenant.
+func (h *handler) createHandler(w http.ResponseWriter, req *http.Request) {
+	type RequestTenant struct {
+		Name     string `json:"name" xml:"name" yaml:"name"`
+		MaxTasks int    `json:"maxTasks" xml:"maxTasks" yaml:"maxTasks"`
+	}
+
+	var rt RequestTenant
+	if !decodeBody(w, req, &rt) {
+		return
+	}
+
+	info, err := h.ts.Create(rt.Name, rt.MaxTasks)
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	render(w, req, http.StatusCreated, info)
+}
+
+// tenantHandler handler for "admin/tenants/<name>" path.
+func (h *handler) tenantHandler(w http.ResponseWriter, req *http.Request, name string) {
+	switch req.Method {
+	case http.MethodGet:
+		info, err := h.ts.Info(name)
+		if err != nil {
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+		render(w, req, http.StatusOK, info)
+	case http.MethodPut:
+		type RequestQuota struct {
+			MaxTasks int `json:"maxTasks" xml:"maxTasks" yaml:"maxTasks"`
+		}
+
+		var rq RequestQuota
+		if !decodeBody(w, req, &rq) {
+			return
+		}
+		info, err := h.ts.SetQuota(name, rq.MaxTasks)
+		if err != nil {
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+		render(w, req, http.StatusOK, info)
+	case http.MethodDelete:
+		if err := h.ts.Delete(name); err != nil {
+			http.Error(w, err.Error(), errorStatus(err))
+		}
+	default:
+		methodNotAllowed(w, req, "GET, PUT or DELETE")
+	}
+}
+
+// errorStatus returns HTTP status code of error of tenants.
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrExists):
+		return http.StatusConflict
+	case errors.Is(err, ErrBadName):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrDefault):
+		return http.StatusForbidden
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// decodeBody decodes request body into v by Content-Type of req, on error writes response and returns false.
+func decodeBody(w http.ResponseWriter, req *http.Request, v interface{}) bool {
+	dec, err := codec.ForContentType(req.Header.Get("Content-Type"))
+	if errors.Is(err, codec.ErrUnsupportedMediaType) {
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	if err = dec.Decode(req.Body, v); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// methodNotAllowed writes error about unexpected method.
+func methodNotAllowed(w http.ResponseWriter, req *http.Request, expect string) {
+	http.Error(w, fmt.Sprintf("expect method %s at %s, got %v", expect, req.URL.Path, req.Method), http.StatusMethodNotAllowed)
+}
+
+// render renders 'v' in format negotiated by Accept header of req and writes it as a response with status code.
+func render(w http.ResponseWriter, req *http.Request, code int, v interface{}) {
+	enc, err := codec.Negotiate(req.Header.Get("Accept"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotAcceptable)
+		return
+	}
+	data, err := enc.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", enc.ContentType())
+	w.WriteHeader(code)
+	_, _ = w.Write(data)
+}
@@ -0,0 +1,513 @@
+// Package tenant hosts several tenants on one server: each tenant has own repository of tasks, own attachments
+// and own quota of tasks. Tenant of request is resolved by X-Tenant header, subdomain of Host or /t/<tenant> path
+// prefix, requests without tenant are served by default tenant.
+//
+// Each tenant has own bus of events of its tasks, own webhooks and own scheduler of reminders and of rolling of
+// recurring tasks, so events, webhooks, GraphQL, WebSocket and gRPC serve tenant of request like REST API does.
+package tenant
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"github.com/White-AK111/REST/config"
+	"github.com/White-AK111/REST/internal/activity"
+	"github.com/White-AK111/REST/internal/attachment"
+	"github.com/White-AK111/REST/internal/blob"
+	"github.com/White-AK111/REST/internal/events"
+	"github.com/White-AK111/REST/internal/models"
+	"github.com/White-AK111/REST/internal/scheduler"
+	"github.com/White-AK111/REST/internal/webhook"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Header it's a header of request with name of tenant.
+const Header = "X-Tenant"
+
+// Default it's a name of default tenant, it can't be created or deleted.
+const Default = "default"
+
+// pathPrefix it's a prefix of path of request naming tenant: /t/<tenant>/task/.
+const pathPrefix = "/t/"
+
+// Resolutions of tenant of request.
+const (
+	ByHeader    = "header"
+	BySubdomain = "subdomain"
+	ByPath      = "path"
+)
+
+// Errors of tenants.
+var (
+	ErrNotFound     = errors.New("tenant isn't found")
+	ErrExists       = errors.New("tenant already exists")
+	ErrBadName      = errors.New("name of tenant must be 1-63 lowercase letters, digits or hyphens starting with letter or digit")
+	ErrDefault      = errors.New("default tenant can't be created or deleted")
+	ErrQuota        = errors.New("quota of tasks of tenant is exceeded")
+	ErrDisabled     = errors.New("admin endpoints of tenants are disabled")
+	ErrUnauthorized = errors.New("valid admin token is required")
+)
+
+// name it's a valid name of tenant, it's a DNS label so it can be used as subdomain and directory.
+var name = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+
+// Info it's a tenant with count of its tasks.
+type Info struct {
+	Name     string `json:"name" xml:"name" yaml:"name"`
+	MaxTasks int    `json:"maxTasks" xml:"maxTasks" yaml:"maxTasks"` // 0 means no quota
+	Tasks    int    `json:"tasks" xml:"tasks" yaml:"tasks"`          // tasks in trash included
+}
+
+// Tenant it's a tenant with own repository of tasks and attachments, own bus of events, webhooks and scheduler.
+type Tenant struct {
+	sync.Mutex // guards quota, admission of new tasks and their creation are done under it
+	name       string
+	maxTasks   int
+	store      models.Repository
+	files      *attachment.Attachments
+	bus        *events.Bus
+	hooks      *webhook.Dispatcher
+	reminders  *scheduler.Scheduler
+	dirs       []string // directories of attachments and scheduler state removed with tenant, none for default tenant
+
+	handlersMu sync.Mutex
+	handlers   map[*byte]http.Handler // handlers of APIs created by Tenants.PerTenant
+}
+
+// Name returns name of tenant.
+func (t *Tenant) Name() string {
+	return t.name
+}
+
+// Store returns repository of tasks of tenant, it rejects new tasks above quota of tenant.
+func (t *Tenant) Store() models.Repository {
+	return t.store
+}
+
+// Files returns attachments of tasks of tenant.
+func (t *Tenant) Files() *attachment.Attachments {
+	return t.files
+}
+
+// Bus returns bus of events of tasks of tenant.
+func (t *Tenant) Bus() *events.Bus {
+	return t.bus
+}
+
+// Hooks returns webhooks of tenant.
+func (t *Tenant) Hooks() *webhook.Dispatcher {
+	return t.hooks
+}
+
+// count returns count of tasks of tenant, tasks of archived projects and tasks in trash included.
+func (t *Tenant) count() int {
+	return t.store.CountTasks()
+}
+
+// handler returns handler of API by key, it's created by newHandler on the first call.
+func (t *Tenant) handler(key *byte, newHandler func(t *Tenant) (http.Handler, error)) (http.Handler, error) {
+	t.handlersMu.Lock()
+	defer t.handlersMu.Unlock()
+
+	if h, ok := t.handlers[key]; ok {
+		return h, nil
+	}
+	h, err := newHandler(t)
+	if err != nil {
+		return nil, err
+	}
+	t.handlers[key] = h
+	return h, nil
+}
+
+// close stops webhooks and scheduler of tenant.
+func (t *Tenant) close() {
+	t.hooks.Close()
+	t.reminders.Close()
+}
+
+// info returns info of tenant.
+func (t *Tenant) info() Info {
+	t.Lock()
+	defer t.Unlock()
+	return Info{Name: t.name, MaxTasks: t.maxTasks, Tasks: t.count()}
+}
+
+// Admit checks that n new tasks fit quota of tenant, it's called before bulk import to reject it as a whole.
+// Quota is enforced by repository of tenant anyway, see Store.
+func (t *Tenant) Admit(n int) error {
+	t.Lock()
+	defer t.Unlock()
+	return t.admit(n)
+}
+
+// admit checks that n new tasks fit quota of tenant, tenant must be locked.
+func (t *Tenant) admit(n int) error {
+	if t.maxTasks <= 0 {
+		return nil
+	}
+	if count := t.count(); count+n > t.maxTasks {
+		return fmt.Errorf("%w: %d of %d tasks, %d more requested", ErrQuota, count, t.maxTasks, n)
+	}
+	return nil
+}
+
+// tenantRepository decorates repository of tenant: it rejects tasks above quota of tenant. Quota is checked
+// and task is created under lock of tenant, so concurrent creates don't exceed quota. Restored tasks aren't checked:
+// tasks in trash are counted by quota already.
+type tenantRepository struct {
+	models.Repository
+	tenant *Tenant
+}
+
+// CreateTask creates a new task if it fits quota of tenant.
+func (r *tenantRepository) CreateTask(task models.Task) (int, error) {
+	r.tenant.Lock()
+	defer r.tenant.Unlock()
+
+	if err := r.tenant.admit(1); err != nil {
+		return 0, err
+	}
+	return r.Repository.CreateTask(task)
+}
+
+// InsertTask stores a task under its own id if it fits quota of tenant.
+func (r *tenantRepository) InsertTask(task models.Task) error {
+	r.tenant.Lock()
+	defer r.tenant.Unlock()
+
+	if err := r.tenant.admit(1); err != nil {
+		return err
+	}
+	return r.Repository.InsertTask(task)
+}
+
+// start returns tenant whose tasks are kept by a new repository of storage: changes of tasks are published to bus
+// of tenant, webhooks and scheduler of tenant run by the bus. State of scheduler is kept in stateFile.
+func (ts *Tenants) start(name string, maxTasks int, files *attachment.Attachments, stateFile string, dirs ...string) (*Tenant, error) {
+	hooks, err := webhook.NewDispatcher(ts.cfg)
+	if err != nil {
+		return nil, err
+	}
+	t := &Tenant{
+		name:     name,
+		maxTasks: maxTasks,
+		files:    files,
+		bus:      events.NewBus(),
+		hooks:    hooks,
+		dirs:     dirs,
+		handlers: make(map[*byte]http.Handler),
+	}
+	store := activity.Track(files.Cleanup(events.Observe(ts.storage(), t.bus)), activity.System)
+	t.store = &tenantRepository{Repository: store, tenant: t}
+
+	cfg := *ts.cfg
+	cfg.Scheduler.StateFile = stateFile
+	reminders, err := scheduler.New(&cfg, t.store, t.hooks)
+	if err != nil {
+		return nil, err
+	}
+	t.reminders = reminders
+
+	go t.hooks.Run(t.bus)
+	go t.reminders.Run(t.bus)
+	return t, nil
+}
+
+// Tenants resolves tenants of requests and keeps tenants created by admin.
+type Tenants struct {
+	sync.RWMutex
+	cfg        *config.Config
+	resolve    string
+	domain     string
+	maxTasks   int
+	adminToken string
+	dir        string
+	limits     attachment.Limits
+	storage    func() models.Repository
+	tenants    map[string]*Tenant
+}
+
+// New function initialize a new Tenants with parameters from config, tenants are served after Open.
+func New(cfg *config.Config) (*Tenants, error) {
+	domain := strings.ToLower(strings.Trim(cfg.Tenants.Domain, "."))
+	switch cfg.Tenants.Resolve {
+	case "", ByHeader, ByPath:
+	case BySubdomain:
+		if domain == "" {
+			return nil, fmt.Errorf("resolution of tenant by %s requires base domain of tenants", BySubdomain)
+		}
+	default:
+		return nil, fmt.Errorf("unknown resolution of tenant %q, expect one of: %s, %s, %s", cfg.Tenants.Resolve, ByHeader, BySubdomain, ByPath)
+	}
+	return &Tenants{
+		cfg:        cfg,
+		resolve:    cfg.Tenants.Resolve,
+		domain:     domain,
+		maxTasks:   cfg.Tenants.MaxTasks,
+		adminToken: cfg.Tenants.AdminToken,
+		dir:        filepath.Join(cfg.Attachments.Dir, "tenants"),
+		limits:     attachment.Limits{MaxSize: cfg.Attachments.MaxSize, Types: cfg.Attachments.Types},
+		tenants:    make(map[string]*Tenant),
+	}, nil
+}
+
+// Open starts default tenant with files, storage creates repository of each tenant. Attachments and scheduler
+// state of tenants created by admin are kept in own directories. Returns default tenant.
+func (ts *Tenants) Open(files *attachment.Attachments, storage func() models.Repository) (*Tenant, error) {
+	ts.Lock()
+	defer ts.Unlock()
+
+	ts.storage = storage
+	t, err := ts.start(Default, ts.maxTasks, files, ts.cfg.Scheduler.StateFile)
+	if err != nil {
+		return nil, err
+	}
+	ts.tenants[Default] = t
+	return t, nil
+}
+
+// Resolve returns name of tenant of request by its host, path and X-Tenant header and path of request without
+// prefix of tenant. Empty name means default tenant.
+func (ts *Tenants) Resolve(host, path, header string) (string, string) {
+	switch ts.resolve {
+	case ByHeader:
+		return strings.ToLower(header), path
+	case BySubdomain:
+		return ts.subdomain(host), path
+	case ByPath:
+		if !strings.HasPrefix(path, pathPrefix) {
+			return "", path
+		}
+		tenant, rest := path[len(pathPrefix):], ""
+		if i := strings.IndexByte(tenant, '/'); i >= 0 {
+			tenant, rest = tenant[:i], tenant[i:]
+		}
+		if rest == "" {
+			rest = "/"
+		}
+		return strings.ToLower(tenant), rest
+	default:
+		return "", path
+	}
+}
+
+// subdomain returns tenant named by label of host before base domain. Host of base domain itself, hosts of other
+// domains and IP addresses default tenant.
+func (ts *Tenants) subdomain(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if ts.domain == "" || net.ParseIP(host) != nil || !strings.HasSuffix(host, "."+ts.domain) {
+		return ""
+	}
+	host = strings.TrimSuffix(host, "."+ts.domain)
+	if i := strings.LastIndexByte(host, '.'); i >= 0 {
+		host = host[i+1:]
+	}
+	return host
+}
+
+// Handler returns handler which resolves tenant of request before next handler: resolved tenant is set to
+// X-Tenant header and prefix of tenant is removed from path, so routes of next handler are the same for all tenants.
+func (ts *Tenants) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		tenant, path := ts.Resolve(req.Host, req.URL.Path, req.Header.Get(Header))
+		req.Header.Del(Header)
+		if tenant != "" {
+			req.Header.Set(Header, tenant)
+		}
+		if path != req.URL.Path {
+			req.URL.Path, req.URL.RawPath = path, ""
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// Tenant returns tenant by name resolved by Resolve, empty name or disabled resolution means default tenant.
+func (ts *Tenants) Tenant(name string) (*Tenant, error) {
+	if ts.resolve == "" || name == "" {
+		name = Default
+	}
+
+	ts.RLock()
+	defer ts.RUnlock()
+
+	t, ok := ts.tenants[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrNotFound, name)
+	}
+	return t, nil
+}
+
+// PerTenant returns handler which serves request by handler of its tenant resolved by Handler, e.g. by handler
+// of GraphQL over repository of tenant. Handler of tenant is created by newHandler on the first request of tenant.
+func (ts *Tenants) PerTenant(newHandler func(t *Tenant) (http.Handler, error)) http.Handler {
+	key := new(byte)
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		t, err := ts.Tenant(req.Header.Get(Header))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		h, err := t.handler(key, newHandler)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		h.ServeHTTP(w, req)
+	})
+}
+
+// check checks that tenant with name can be created or deleted.
+func check(tenant string) error {
+	if !name.MatchString(tenant) {
+		return ErrBadName
+	}
+	if tenant == Default {
+		return ErrDefault
+	}
+	return nil
+}
+
+// Create creates tenant with quota of tasks, 0 means quota of config, negative means no quota.
+func (ts *Tenants) Create(tenant string, maxTasks int) (Info, error) {
+	if err := check(tenant); err != nil {
+		return Info{}, err
+	}
+	if maxTasks == 0 {
+		maxTasks = ts.maxTasks
+	}
+	if maxTasks < 0 {
+		maxTasks = 0
+	}
+
+	ts.Lock()
+	defer ts.Unlock()
+
+	if _, ok := ts.tenants[tenant]; ok {
+		return Info{}, fmt.Errorf("%w: %q", ErrExists, tenant)
+	}
+	dir := filepath.Join(ts.dir, tenant)
+	blobs, err := blob.NewFS(dir)
+	if err != nil {
+		return Info{}, err
+	}
+	dirs, stateFile := []string{dir}, ""
+	if ts.cfg.Scheduler.StateFile != "" {
+		stateDir := filepath.Join(filepath.Dir(ts.cfg.Scheduler.StateFile), "tenants", tenant)
+		if err = os.MkdirAll(stateDir, 0o755); err != nil {
+			return Info{}, err
+		}
+		dirs, stateFile = append(dirs, stateDir), filepath.Join(stateDir, filepath.Base(ts.cfg.Scheduler.StateFile))
+	}
+	t, err := ts.start(tenant, maxTasks, attachment.New(blobs, ts.limits), stateFile, dirs...)
+	if err != nil {
+		return Info{}, err
+	}
+	ts.tenants[tenant] = t
+	return t.info(), nil
+}
+
+// SetQuota changes quota of tasks of tenant, 0 or negative means no quota. Tasks above new quota are kept.
+func (ts *Tenants) SetQuota(tenant string, maxTasks int) (Info, error) {
+	if maxTasks < 0 {
+		maxTasks = 0
+	}
+
+	ts.Lock()
+	defer ts.Unlock()
+
+	t, ok := ts.tenants[tenant]
+	if !ok {
+		return Info{}, fmt.Errorf("%w: %q", ErrNotFound, tenant)
+	}
+	t.Lock()
+	t.maxTasks = maxTasks
+	t.Unlock()
+	return t.info(), nil
+}
+
+// Delete deletes tenant with all its tasks and attachments.
+func (ts *Tenants) Delete(tenant string) error {
+	if err := check(tenant); err != nil {
+		return err
+	}
+
+	ts.Lock()
+	t, ok := ts.tenants[tenant]
+	delete(ts.tenants, tenant)
+	ts.Unlock()
+
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrNotFound, tenant)
+	}
+	t.close()
+	for _, dir := range t.dirs {
+		if err := os.RemoveAll(dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Info returns info of tenant by name.
+func (ts *Tenants) Info(tenant string) (Info, error) {
+	ts.RLock()
+	defer ts.RUnlock()
+
+	t, ok := ts.tenants[tenant]
+	if !ok {
+		return Info{}, fmt.Errorf("%w: %q", ErrNotFound, tenant)
+	}
+	return t.info(), nil
+}
+
+// List returns info of all tenants sorted by name, default tenant included.
+func (ts *Tenants) List() []Info {
+	ts.RLock()
+	defer ts.RUnlock()
+
+	infos := make([]Info, 0, len(ts.tenants))
+	for _, t := range ts.tenants {
+		infos = append(infos, t.info())
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
+// Stores returns repositories of all tenants, e.g. for purging of trash.
+func (ts *Tenants) Stores() []models.Repository {
+	ts.RLock()
+	defer ts.RUnlock()
+
+	stores := make([]models.Repository, 0, len(ts.tenants))
+	for _, t := range ts.tenants {
+		stores = append(stores, t.store)
+	}
+	return stores
+}
+
+// Authorize checks bearer token of admin in value of Authorization header.
+func (ts *Tenants) Authorize(authorization string) error {
+	if ts.adminToken == "" {
+		return ErrDisabled
+	}
+	const prefix = "Bearer "
+	if len(authorization) <= len(prefix) || !strings.EqualFold(authorization[:len(prefix)], prefix) {
+		return ErrUnauthorized
+	}
+	token := strings.TrimSpace(authorization[len(prefix):])
+	if subtle.ConstantTimeCompare([]byte(token), []byte(ts.adminToken)) != 1 {
+		return ErrUnauthorized
+	}
+	return nil
+}
@@ -0,0 +1,263 @@
+package tenant
+
+import (
+	"errors"
+	"github.com/White-AK111/REST/config"
+	"github.com/White-AK111/REST/internal/attachment"
+	"github.com/White-AK111/REST/internal/models"
+	"github.com/White-AK111/REST/internal/models/inmemory"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// open returns tenants resolved by resolve with started default tenant, files and scheduler state are kept
+// in temporary directory.
+func open(t *testing.T, resolve string) *Tenants {
+	t.Helper()
+	dir := t.TempDir()
+	cfg := &config.Config{}
+	cfg.Tenants.Resolve = resolve
+	cfg.Tenants.Domain = "tasks.example.com"
+	cfg.Attachments.Dir = filepath.Join(dir, "attachments")
+	cfg.Scheduler.StateFile = filepath.Join(dir, "state.json")
+	cfg.Scheduler.Reminders = []time.Duration{time.Hour}
+
+	ts, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New: %s", err)
+	}
+	files, err := attachment.NewFromConfig(cfg)
+	if err != nil {
+		t.Fatalf("NewFromConfig: %s", err)
+	}
+	if _, err = ts.Open(files, func() models.Repository { return inmemory.NewStorage(models.RejectSubtasks) }); err != nil {
+		t.Fatalf("Open: %s", err)
+	}
+	t.Cleanup(func() {
+		ts.Lock()
+		defer ts.Unlock()
+		for _, tenant := range ts.tenants {
+			tenant.close()
+		}
+	})
+	return ts
+}
+
+// tenant returns tenant by name.
+func tenant(t *testing.T, ts *Tenants, name string) *Tenant {
+	t.Helper()
+	tenant, err := ts.Tenant(name)
+	if err != nil {
+		t.Fatalf("Tenant(%q): %s", name, err)
+	}
+	return tenant
+}
+
+func TestNew(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Tenants.Resolve = BySubdomain
+	if _, err := New(cfg); err == nil {
+		t.Errorf("New accepted resolution by subdomain without base domain")
+	}
+	cfg.Tenants.Domain = "tasks.example.com"
+	if _, err := New(cfg); err != nil {
+		t.Errorf("New: %s", err)
+	}
+	cfg.Tenants.Resolve = "cookie"
+	if _, err := New(cfg); err == nil {
+		t.Errorf("New accepted unknown resolution")
+	}
+}
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		resolve, host, path, header string
+		tenant, rest                string
+	}{
+		{ByHeader, "localhost", "/task/", "Acme", "acme", "/task/"},
+		{ByHeader, "acme.tasks.example.com", "/t/acme/task/", "", "", "/t/acme/task/"},
+		{ByPath, "localhost", "/t/acme/task/1", "", "acme", "/task/1"},
+		{ByPath, "localhost", "/t/acme", "", "acme", "/"},
+		{ByPath, "localhost", "/task/", "acme", "", "/task/"},
+		{BySubdomain, "acme.tasks.example.com:8080", "/task/", "", "acme", "/task/"},
+		{BySubdomain, "ACME.tasks.example.com.", "/task/", "", "acme", "/task/"},
+		{BySubdomain, "api.acme.tasks.example.com", "/task/", "", "acme", "/task/"},
+		{BySubdomain, "tasks.example.com", "/task/", "", "", "/task/"},
+		{BySubdomain, "acme.example.org", "/task/", "", "", "/task/"},
+		{BySubdomain, "eviltasks.example.com", "/task/", "", "", "/task/"},
+		{BySubdomain, "127.0.0.1:8080", "/task/", "acme", "", "/task/"},
+		{"", "acme.tasks.example.com", "/t/acme/task/", "acme", "", "/t/acme/task/"},
+	}
+	for _, tt := range tests {
+		ts := &Tenants{resolve: tt.resolve, domain: "tasks.example.com"}
+		tenant, rest := ts.Resolve(tt.host, tt.path, tt.header)
+		if tenant != tt.tenant || rest != tt.rest {
+			t.Errorf("Resolve by %q of %s%s with header %q returned %q, %q, want %q, %q",
+				tt.resolve, tt.host, tt.path, tt.header, tenant, rest, tt.tenant, tt.rest)
+		}
+	}
+}
+
+func TestQuota(t *testing.T) {
+	ts := open(t, ByHeader)
+	if _, err := ts.Create("acme", 3); err != nil {
+		t.Fatalf("Create: %s", err)
+	}
+	store := tenant(t, ts, "acme").Store()
+
+	project := store.CreateProject(models.Project{Name: "archive"})
+	if _, err := store.CreateTask(models.Task{Text: "old", ProjectId: project}); err != nil {
+		t.Fatalf("CreateTask: %s", err)
+	}
+	if err := store.UpdateProject(models.Project{Id: project, Name: "archive", Archived: true}); err != nil {
+		t.Fatalf("UpdateProject: %s", err)
+	}
+	trashed, err := store.CreateTask(models.Task{Text: "trashed"})
+	if err != nil {
+		t.Fatalf("CreateTask: %s", err)
+	}
+	if err = store.TrashTask(trashed); err != nil {
+		t.Fatalf("TrashTask: %s", err)
+	}
+	due := time.Now().Add(24 * time.Hour)
+	if _, err = store.CreateTask(models.Task{Text: "standup", Due: due, RRule: "FREQ=DAILY"}); err != nil {
+		t.Fatalf("CreateTask of recurring task: %s", err)
+	}
+
+	if info, _ := ts.Info("acme"); info.Tasks != 3 {
+		t.Errorf("tenant has %d tasks, want tasks of archived project and in trash counted", info.Tasks)
+	}
+	if _, err = store.CreateTask(models.Task{Text: "over"}); !errors.Is(err, ErrQuota) {
+		t.Errorf("CreateTask above quota: %v, want %v", err, ErrQuota)
+	}
+	if err = store.InsertTask(models.Task{Id: 100, Text: "over"}); !errors.Is(err, ErrQuota) {
+		t.Errorf("InsertTask above quota: %v, want %v", err, ErrQuota)
+	}
+	if err = tenant(t, ts, "acme").Admit(1); !errors.Is(err, ErrQuota) {
+		t.Errorf("Admit above quota: %v, want %v", err, ErrQuota)
+	}
+
+	if _, err = ts.SetQuota("acme", 0); err != nil {
+		t.Fatalf("SetQuota: %s", err)
+	}
+	if _, err = store.CreateTask(models.Task{Text: "unlimited"}); err != nil {
+		t.Errorf("CreateTask without quota: %s", err)
+	}
+}
+
+func TestTenantsAreIsolated(t *testing.T) {
+	ts := open(t, ByHeader)
+	if _, err := ts.Create("acme", 0); err != nil {
+		t.Fatalf("Create: %s", err)
+	}
+	def, acme := tenant(t, ts, ""), tenant(t, ts, "acme")
+	if def.Bus() == acme.Bus() || def.Hooks() == acme.Hooks() {
+		t.Fatalf("tenants share bus or webhooks")
+	}
+	sub := acme.Bus().Subscribe(16)
+	defer sub.Close()
+
+	if _, err := def.Store().CreateTask(models.Task{Text: "default"}); err != nil {
+		t.Fatalf("CreateTask: %s", err)
+	}
+	id, err := acme.Store().CreateTask(models.Task{Text: "acme"})
+	if err != nil {
+		t.Fatalf("CreateTask: %s", err)
+	}
+
+	select {
+	case e := <-sub.C:
+		if e.Task.Id != id || e.Task.Text != "acme" {
+			t.Errorf("bus of tenant published %+v, want only event of its task", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("bus of tenant published no event of its task")
+	}
+	if tasks := acme.Store().GetAllTasks(); len(tasks) != 1 || tasks[0].Text != "acme" {
+		t.Errorf("tenant has tasks %+v, want only its own task", tasks)
+	}
+}
+
+func TestPerTenant(t *testing.T) {
+	ts := open(t, ByHeader)
+	if _, err := ts.Create("acme", 0); err != nil {
+		t.Fatalf("Create: %s", err)
+	}
+	created := make(map[string]int)
+	h := ts.Handler(ts.PerTenant(func(tenant *Tenant) (http.Handler, error) {
+		created[tenant.Name()]++
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			_, _ = w.Write([]byte(tenant.Name()))
+		}), nil
+	}))
+
+	for _, tt := range []struct {
+		header string
+		status int
+		body   string
+	}{
+		{"", http.StatusOK, Default},
+		{"acme", http.StatusOK, "acme"},
+		{"ACME", http.StatusOK, "acme"},
+		{"unknown", http.StatusNotFound, ""},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/graphql", nil)
+		req.Header.Set(Header, tt.header)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tt.status || tt.body != "" && rec.Body.String() != tt.body {
+			t.Errorf("request of tenant %q got %d %q, want %d %q", tt.header, rec.Code, rec.Body.String(), tt.status, tt.body)
+		}
+	}
+	if created[Default] != 1 || created["acme"] != 1 {
+		t.Errorf("handlers of tenants are created %v times, want once per tenant", created)
+	}
+}
+
+func TestCreateAndDelete(t *testing.T) {
+	ts := open(t, ByPath)
+	if _, err := ts.Create(Default, 0); !errors.Is(err, ErrDefault) {
+		t.Errorf("Create of default tenant: %v, want %v", err, ErrDefault)
+	}
+	if _, err := ts.Create("Bad_Name", 0); !errors.Is(err, ErrBadName) {
+		t.Errorf("Create of tenant with bad name: %v, want %v", err, ErrBadName)
+	}
+	if _, err := ts.Create("acme", 0); err != nil {
+		t.Fatalf("Create: %s", err)
+	}
+	if _, err := ts.Create("acme", 0); !errors.Is(err, ErrExists) {
+		t.Errorf("Create of existing tenant: %v, want %v", err, ErrExists)
+	}
+
+	acme := tenant(t, ts, "acme")
+	if len(acme.dirs) != 2 {
+		t.Fatalf("tenant has directories %v, want directories of attachments and of scheduler state", acme.dirs)
+	}
+	for _, dir := range acme.dirs {
+		if _, err := os.Stat(dir); err != nil {
+			t.Errorf("directory of tenant: %s", err)
+		}
+	}
+
+	if err := ts.Delete("acme"); err != nil {
+		t.Fatalf("Delete: %s", err)
+	}
+	for _, dir := range acme.dirs {
+		if _, err := os.Stat(dir); !os.IsNotExist(err) {
+			t.Errorf("directory %s of deleted tenant: %v, want it removed", dir, err)
+		}
+	}
+	if _, err := ts.Tenant("acme"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Tenant of deleted tenant: %v, want %v", err, ErrNotFound)
+	}
+	if err := ts.Delete("acme"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Delete of deleted tenant: %v, want %v", err, ErrNotFound)
+	}
+	if err := ts.Delete(Default); !errors.Is(err, ErrDefault) {
+		t.Errorf("Delete of default tenant: %v, want %v", err, ErrDefault)
+	}
+}
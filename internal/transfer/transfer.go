@@ -0,0 +1,605 @@
+// Package transfer provides export and import of all tasks in JSON, NDJSON and CSV formats.
+// It works only through the models.Repository interface, so it can be used for backups of any
+// storage and for migration of tasks between storages.
+package transfer
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/White-AK111/REST/internal/models"
+	"github.com/White-AK111/REST/internal/recurrence"
+	"io"
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Format it's a serialization format of exported tasks.
+type Format string
+
+const (
+	FormatJSON   Format = "json"   // one JSON array with all tasks
+	FormatNDJSON Format = "ndjson" // one JSON object per line
+	FormatCSV    Format = "csv"    // CSV with header: id,text,tags,due,rrule,parent,done,blockers,project
+)
+
+// csvHeader columns of CSV format, tags and blockers columns contain JSON arrays of tags and of ids of blockers.
+var csvHeader = []string{"id", "text", "tags", "due", "rrule", "parent", "done", "blockers", "project"}
+
+// ParseFormat function returns Format by name, empty name means JSON.
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(name) {
+	case "", "json":
+		return FormatJSON, nil
+	case "ndjson", "jsonl":
+		return FormatNDJSON, nil
+	case "csv":
+		return FormatCSV, nil
+	default:
+		return "", fmt.Errorf("unknown format %q, expect json, ndjson or csv", name)
+	}
+}
+
+// FormatByContentType function returns Format by media type of request body.
+func FormatByContentType(mediaType string) (Format, error) {
+	switch mediaType {
+	case "application/json":
+		return FormatJSON, nil
+	case "application/x-ndjson", "application/ndjson", "application/jsonl":
+		return FormatNDJSON, nil
+	case "text/csv":
+		return FormatCSV, nil
+	default:
+		return "", fmt.Errorf("unsupported Content-Type %q for import", mediaType)
+	}
+}
+
+// ContentType returns media type of the Format for response.
+func (f Format) ContentType() string {
+	switch f {
+	case FormatNDJSON:
+		return "application/x-ndjson"
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	default:
+		return "application/json"
+	}
+}
+
+// FileName returns default name of file with exported tasks.
+func (f Format) FileName() string {
+	return "tasks." + string(f)
+}
+
+// Export writes all tasks from repository into w sorted by id, tasks are written one by one.
+// Tasks of archived projects are exported too.
+func Export(w io.Writer, repo models.Repository, format Format) error {
+	tasks := models.AllTasks(repo)
+
+	bw := bufio.NewWriter(w)
+	var err error
+	switch format {
+	case FormatJSON:
+		err = exportJSON(bw, tasks)
+	case FormatNDJSON:
+		err = exportNDJSON(bw, tasks)
+	case FormatCSV:
+		err = exportCSV(bw, tasks)
+	default:
+		err = fmt.Errorf("unknown format %q", format)
+	}
+	if err != nil {
+		return err
+	}
+
+	return bw.Flush()
+}
+
+// exportJSON writes tasks as JSON array.
+func exportJSON(w *bufio.Writer, tasks []models.Task) error {
+	if _, err := w.WriteString("["); err != nil {
+		return err
+	}
+	for i, task := range tasks {
+		if i > 0 {
+			if _, err := w.WriteString(","); err != nil {
+				return err
+			}
+		}
+		js, err := json.Marshal(task)
+		if err != nil {
+			return err
+		}
+		if _, err = w.Write(js); err != nil {
+			return err
+		}
+	}
+	_, err := w.WriteString("]\n")
+	return err
+}
+
+// exportNDJSON writes tasks as newline delimited JSON.
+func exportNDJSON(w *bufio.Writer, tasks []models.Task) error {
+	enc := json.NewEncoder(w)
+	for _, task := range tasks {
+		if err := enc.Encode(task); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exportCSV writes tasks as CSV with header.
+func exportCSV(w *bufio.Writer, tasks []models.Task) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, task := range tasks {
+		tags := task.Tags
+		if tags == nil {
+			tags = []string{}
+		}
+		js, err := json.Marshal(tags)
+		if err != nil {
+			return err
+		}
+		due := ""
+		if !task.Due.IsZero() {
+			due = task.Due.Format(time.RFC3339Nano)
+		}
+		parent := ""
+		if task.ParentId != 0 {
+			parent = strconv.Itoa(task.ParentId)
+		}
+		blockers := task.BlockedBy
+		if blockers == nil {
+			blockers = []int{}
+		}
+		jsBlockers, err := json.Marshal(blockers)
+		if err != nil {
+			return err
+		}
+		project := ""
+		if task.ProjectId != 0 {
+			project = strconv.Itoa(task.ProjectId)
+		}
+		record := []string{strconv.Itoa(task.Id), task.Text, string(js), due, task.RRule, parent, strconv.FormatBool(task.Done), string(jsBlockers), project}
+		if err = cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ConflictPolicy defines what to do on import when task with the same id already exists.
+type ConflictPolicy string
+
+const (
+	ConflictSkip      ConflictPolicy = "skip"      // keep existing task, skip imported one
+	ConflictOverwrite ConflictPolicy = "overwrite" // replace existing task by imported one
+	ConflictFail      ConflictPolicy = "fail"      // abort import before any change
+)
+
+// ParseConflictPolicy function returns ConflictPolicy by name, empty name means fail.
+func ParseConflictPolicy(name string) (ConflictPolicy, error) {
+	switch ConflictPolicy(strings.ToLower(name)) {
+	case "", ConflictFail:
+		return ConflictFail, nil
+	case ConflictSkip:
+		return ConflictSkip, nil
+	case ConflictOverwrite:
+		return ConflictOverwrite, nil
+	default:
+		return "", fmt.Errorf("unknown conflict policy %q, expect skip, overwrite or fail", name)
+	}
+}
+
+// ImportOptions options of import.
+type ImportOptions struct {
+	PreserveIds bool           // keep ids of imported tasks, otherwise repository assigns new ids
+	OnConflict  ConflictPolicy // used only with PreserveIds
+}
+
+// Result it's a summary of import.
+type Result struct {
+	Created     int `json:"created"`
+	Overwritten int `json:"overwritten"`
+	Skipped     int `json:"skipped"`
+}
+
+// ParseImportParams function parses parameters of import request: format (or Content-Type of body if
+// format is empty), preserveIds and onConflict.
+func ParseImportParams(format, contentType, preserveIds, onConflict string) (Format, ImportOptions, error) {
+	var (
+		f    Format
+		opts ImportOptions
+		err  error
+	)
+
+	if format != "" {
+		f, err = ParseFormat(format)
+	} else {
+		var mediaType string
+		mediaType, _, err = mime.ParseMediaType(contentType)
+		if err == nil {
+			f, err = FormatByContentType(mediaType)
+		}
+	}
+	if err != nil {
+		return "", opts, err
+	}
+
+	if preserveIds != "" {
+		if opts.PreserveIds, err = strconv.ParseBool(preserveIds); err != nil {
+			return "", opts, fmt.Errorf("bad preserveIds: %w", err)
+		}
+	}
+	if opts.OnConflict, err = ParseConflictPolicy(onConflict); err != nil {
+		return "", opts, err
+	}
+
+	return f, opts, nil
+}
+
+// Import reads tasks from r in given format and stores them into repository.
+func Import(r io.Reader, repo models.Repository, format Format, opts ImportOptions) (Result, error) {
+	tasks, err := Decode(r, format)
+	if err != nil {
+		return Result{}, err
+	}
+
+	return Load(repo, tasks, opts)
+}
+
+// Migrate copies all tasks from src repository into dst repository, tasks of archived projects included.
+func Migrate(dst, src models.Repository, opts ImportOptions) (Result, error) {
+	tasks := models.AllTasks(src)
+
+	return Load(dst, tasks, opts)
+}
+
+// Load stores decoded tasks into repository. With ConflictFail policy all ids are checked before any change.
+// Parents are stored before their subtasks; without PreserveIds parent ids are mapped to new ids of imported
+// parents, subtasks of parents missing in imported data become top level tasks.
+// Existing task is overwritten in place, so its subtasks stay with it. Dependencies are added after all tasks
+// are stored, blockers missing in imported data and in repository are dropped. Tasks of projects missing
+// in repository get no project.
+// Import is atomic: if any task can't be stored, changes made by the import are rolled back.
+func Load(repo models.Repository, tasks []models.Task, opts ImportOptions) (Result, error) {
+	var c changes
+	result, err := load(repo, tasks, opts, &c)
+	if err != nil {
+		if rbErr := c.rollback(repo); rbErr != nil {
+			return Result{}, fmt.Errorf("%w, rollback of import failed: %v", err, rbErr)
+		}
+		return Result{}, err
+	}
+	return result, nil
+}
+
+// load stores decoded tasks into repository like Load and records changes into c.
+func load(repo models.Repository, tasks []models.Task, opts ImportOptions, c *changes) (Result, error) {
+	var result Result
+
+	for i, task := range tasks {
+		if err := recurrence.Validate(task.RRule, task.Due); err != nil {
+			return result, fmt.Errorf("task #%d: %w", i+1, err)
+		}
+		if task.ProjectId != 0 {
+			if _, err := repo.GetProject(task.ProjectId); err != nil {
+				tasks[i].ProjectId = 0
+			}
+		}
+	}
+	tasks = parentsFirst(tasks)
+
+	if !opts.PreserveIds {
+		ids := make(map[int]int, len(tasks)) // id in imported data -> id of created task
+		for _, task := range tasks {
+			task.ParentId = ids[task.ParentId]
+			id, err := repo.CreateTask(task)
+			if err != nil {
+				return result, err
+			}
+			c.created = append(c.created, id)
+			if task.Id > 0 {
+				ids[task.Id] = id
+			}
+			result.Created++
+		}
+
+		for _, task := range tasks {
+			if task.Id <= 0 {
+				continue
+			}
+			var blockers []int
+			for _, blocker := range task.BlockedBy {
+				if id, ok := ids[blocker]; ok {
+					blockers = append(blockers, id)
+				}
+			}
+			if err := addDependencies(repo, ids[task.Id], blockers); err != nil {
+				return result, err
+			}
+		}
+		return result, nil
+	}
+
+	seen := make(map[int]bool, len(tasks))
+	for i, task := range tasks {
+		if task.Id <= 0 {
+			return result, fmt.Errorf("task #%d: id is required to preserve ids", i+1)
+		}
+		if seen[task.Id] {
+			return result, fmt.Errorf("task #%d: duplicate id=%d in imported data", i+1, task.Id)
+		}
+		seen[task.Id] = true
+
+		if opts.OnConflict == ConflictFail {
+			if _, err := repo.GetTask(task.Id); err == nil {
+				return result, fmt.Errorf("task #%d: task with id=%d already exists", i+1, task.Id)
+			}
+		}
+	}
+
+	var stored []models.Task
+	previous := make(map[int]models.Task) // overwritten task -> task before import
+	for _, task := range tasks {
+		if old, err := repo.GetTask(task.Id); err == nil {
+			if opts.OnConflict != ConflictOverwrite {
+				result.Skipped++
+				continue
+			}
+			if err = repo.UpdateTask(task); err != nil {
+				return result, err
+			}
+			c.overwritten = append(c.overwritten, old)
+			previous[task.Id] = old
+			stored = append(stored, task)
+			result.Overwritten++
+			continue
+		}
+
+		if err := repo.InsertTask(task); err != nil {
+			return result, err
+		}
+		c.created = append(c.created, task.Id)
+		stored = append(stored, task)
+		result.Created++
+	}
+
+	for _, task := range stored {
+		var blockers []int
+		for _, blocker := range task.BlockedBy {
+			if _, err := repo.GetTask(blocker); err == nil {
+				blockers = append(blockers, blocker)
+			}
+		}
+		if err := addDependencies(repo, task.Id, blockers); err != nil {
+			return result, err
+		}
+		if old, ok := previous[task.Id]; ok {
+			c.addBlockers(old, blockers)
+		}
+	}
+
+	return result, nil
+}
+
+// changes it's a record of changes made by import, used to roll back failed import.
+type changes struct {
+	created     []int         // ids of created tasks, parents first
+	overwritten []models.Task // overwritten tasks as they were before import
+	blockers    map[int][]int // new blockers of overwritten tasks by id
+}
+
+// addBlockers records blockers added to overwritten task which it didn't have before import.
+func (c *changes) addBlockers(old models.Task, blockers []int) {
+	had := make(map[int]bool, len(old.BlockedBy))
+	for _, id := range old.BlockedBy {
+		had[id] = true
+	}
+	for _, id := range blockers {
+		if had[id] {
+			continue
+		}
+		if c.blockers == nil {
+			c.blockers = make(map[int][]int)
+		}
+		c.blockers[old.Id] = append(c.blockers[old.Id], id)
+	}
+}
+
+// rollback undoes recorded changes: removes added blockers, restores overwritten tasks and deletes created tasks,
+// subtasks before their parents. Dependencies on deleted tasks are dropped by repository.
+func (c *changes) rollback(repo models.Repository) error {
+	for id, blockers := range c.blockers {
+		for _, blocker := range blockers {
+			if err := repo.RemoveDependency(id, blocker); err != nil {
+				return err
+			}
+		}
+	}
+	for i := len(c.overwritten) - 1; i >= 0; i-- {
+		if err := repo.UpdateTask(c.overwritten[i]); err != nil {
+			return err
+		}
+	}
+	for i := len(c.created) - 1; i >= 0; i-- {
+		if err := repo.DeleteTask(c.created[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addDependencies makes stored task blocked by blockers, if any.
+func addDependencies(repo models.Repository, id int, blockers []int) error {
+	if len(blockers) == 0 {
+		return nil
+	}
+	return repo.AddDependencies(id, blockers)
+}
+
+// parentsFirst returns tasks ordered so that parents go before their subtasks from the same data,
+// otherwise order of tasks is kept.
+func parentsFirst(tasks []models.Task) []models.Task {
+	parents := make(map[int]int, len(tasks)) // id -> id of parent
+	for _, task := range tasks {
+		if task.Id > 0 {
+			parents[task.Id] = task.ParentId
+		}
+	}
+
+	type ranked struct {
+		task  models.Task
+		depth int // count of ancestors in the same data
+	}
+	ranks := make([]ranked, len(tasks))
+	for i, task := range tasks {
+		ranks[i].task = task
+		seen := map[int]bool{task.Id: true}
+		for id := task.ParentId; !seen[id]; id = parents[id] {
+			if _, ok := parents[id]; !ok {
+				break
+			}
+			seen[id] = true
+			ranks[i].depth++
+		}
+	}
+	sort.SliceStable(ranks, func(i, j int) bool { return ranks[i].depth < ranks[j].depth })
+
+	ordered := make([]models.Task, len(ranks))
+	for i, r := range ranks {
+		ordered[i] = r.task
+	}
+	return ordered
+}
+
+// Decode reads all tasks from r in given format.
+func Decode(r io.Reader, format Format) ([]models.Task, error) {
+	switch format {
+	case FormatJSON:
+		return decodeJSON(r)
+	case FormatNDJSON:
+		return decodeNDJSON(r)
+	case FormatCSV:
+		return decodeCSV(r)
+	default:
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+}
+
+// decodeJSON reads JSON array of tasks.
+func decodeJSON(r io.Reader) ([]models.Task, error) {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	var tasks []models.Task
+	if err := dec.Decode(&tasks); err != nil {
+		return nil, fmt.Errorf("can't decode JSON: %w", err)
+	}
+	return tasks, nil
+}
+
+// decodeNDJSON reads one task per line, empty lines are ignored.
+func decodeNDJSON(r io.Reader) ([]models.Task, error) {
+	var tasks []models.Task
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	line := 0
+	for sc.Scan() {
+		line++
+		data := strings.TrimSpace(sc.Text())
+		if data == "" {
+			continue
+		}
+		var task models.Task
+		if err := json.Unmarshal([]byte(data), &task); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		tasks = append(tasks, task)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
+
+// decodeCSV reads CSV with header, columns are matched by name and all columns except text are optional.
+func decodeCSV(r io.Reader) ([]models.Task, error) {
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("can't read CSV header: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["text"]; !ok {
+		return nil, fmt.Errorf("CSV header must contain column \"text\"")
+	}
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	var tasks []models.Task
+	for line := 2; ; line++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		task := models.Task{Text: record[columns["text"]]}
+		if v := field(record, "id"); v != "" {
+			if task.Id, err = strconv.Atoi(v); err != nil {
+				return nil, fmt.Errorf("line %d: bad id: %w", line, err)
+			}
+		}
+		if v := field(record, "tags"); v != "" {
+			if err = json.Unmarshal([]byte(v), &task.Tags); err != nil {
+				return nil, fmt.Errorf("line %d: tags must be JSON array: %w", line, err)
+			}
+		}
+		if v := field(record, "due"); v != "" {
+			if task.Due, err = time.Parse(time.RFC3339Nano, v); err != nil {
+				return nil, fmt.Errorf("line %d: bad due: %w", line, err)
+			}
+		}
+		task.RRule = field(record, "rrule")
+		if v := field(record, "parent"); v != "" {
+			if task.ParentId, err = strconv.Atoi(v); err != nil {
+				return nil, fmt.Errorf("line %d: bad parent: %w", line, err)
+			}
+		}
+		if v := field(record, "done"); v != "" {
+			if task.Done, err = strconv.ParseBool(v); err != nil {
+				return nil, fmt.Errorf("line %d: bad done: %w", line, err)
+			}
+		}
+		if v := field(record, "blockers"); v != "" {
+			if err = json.Unmarshal([]byte(v), &task.BlockedBy); err != nil {
+				return nil, fmt.Errorf("line %d: blockers must be JSON array: %w", line, err)
+			}
+		}
+		if v := field(record, "project"); v != "" {
+			if task.ProjectId, err = strconv.Atoi(v); err != nil {
+				return nil, fmt.Errorf("line %d: bad project: %w", line, err)
+			}
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks, nil
+}
@@ -0,0 +1,155 @@
+package transfer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/White-AK111/REST/internal/models"
+	"github.com/White-AK111/REST/internal/models/inmemory"
+	"github.com/White-AK111/REST/internal/ownership"
+	"strings"
+	"testing"
+	"time"
+)
+
+// create creates task in repo and returns its id.
+func create(t *testing.T, repo models.Repository, task models.Task) int {
+	t.Helper()
+	id, err := repo.CreateTask(task)
+	if err != nil {
+		t.Fatalf("CreateTask: %s", err)
+	}
+	return id
+}
+
+// dump returns exported fields of all tasks of repo sorted by id, one task per line.
+func dump(repo models.Repository) string {
+	var lines []string
+	for _, task := range models.AllTasks(repo) {
+		lines = append(lines, fmt.Sprintf("%d %q %q %s %q parent=%d done=%v blockers=%v project=%d",
+			task.Id, task.Text, task.Tags, task.Due.UTC().Format(time.RFC3339Nano), task.RRule,
+			task.ParentId, task.Done, task.BlockedBy, task.ProjectId))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// source returns repository with tasks using all exported fields: subtask, dependency, recurring task,
+// done task and task of archived project.
+func source(t *testing.T) models.Repository {
+	t.Helper()
+	repo := inmemory.NewStorage(models.RejectSubtasks)
+	project := repo.CreateProject(models.Project{Name: "home"})
+
+	parent := create(t, repo, models.Task{Text: "release, \"v2\"", Tags: []string{"work", "work/backend"}})
+	create(t, repo, models.Task{Text: "changelog", ParentId: parent, Done: true})
+	blocker := create(t, repo, models.Task{Text: "review\nof code", Due: time.Date(2024, 3, 1, 9, 30, 0, 500, time.UTC)})
+	create(t, repo, models.Task{Text: "standup", Due: time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC), RRule: "FREQ=DAILY;COUNT=5"})
+	create(t, repo, models.Task{Text: "paint", ProjectId: project})
+	if err := repo.AddDependencies(parent, []int{blocker}); err != nil {
+		t.Fatalf("AddDependencies: %s", err)
+	}
+	if err := repo.UpdateProject(models.Project{Id: project, Name: "home", Archived: true}); err != nil {
+		t.Fatalf("UpdateProject: %s", err)
+	}
+	return repo
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, format := range []Format{FormatJSON, FormatNDJSON, FormatCSV} {
+		t.Run(string(format), func(t *testing.T) {
+			src := source(t)
+			var buf bytes.Buffer
+			if err := Export(&buf, src, format); err != nil {
+				t.Fatalf("Export: %s", err)
+			}
+
+			dst := inmemory.NewStorage(models.RejectSubtasks)
+			dst.CreateProject(models.Project{Name: "home", Archived: true})
+			result, err := Import(&buf, dst, format, ImportOptions{PreserveIds: true})
+			if err != nil {
+				t.Fatalf("Import: %s", err)
+			}
+			if result.Created != 5 || result.Overwritten != 0 || result.Skipped != 0 {
+				t.Errorf("Import result is %+v, want 5 created tasks", result)
+			}
+			if got, want := dump(dst), dump(src); got != want {
+				t.Errorf("imported tasks are\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestImportWithNewIds(t *testing.T) {
+	src := source(t)
+	var buf bytes.Buffer
+	if err := Export(&buf, src, FormatJSON); err != nil {
+		t.Fatalf("Export: %s", err)
+	}
+
+	dst := inmemory.NewStorage(models.RejectSubtasks)
+	create(t, dst, models.Task{Text: "existing"})
+	if _, err := Import(&buf, dst, FormatJSON, ImportOptions{}); err != nil {
+		t.Fatalf("Import: %s", err)
+	}
+
+	tasks := models.AllTasks(dst)
+	if len(tasks) != 6 {
+		t.Fatalf("repository has %d tasks, want existing and 5 imported ones", len(tasks))
+	}
+	byText := make(map[string]models.Task, len(tasks))
+	for _, task := range tasks {
+		byText[task.Text] = task
+	}
+	release, changelog, review := byText["release, \"v2\""], byText["changelog"], byText["review\nof code"]
+	if release.Id == 1 || changelog.ParentId != release.Id {
+		t.Errorf("subtask has parent %d, want new id %d of imported parent", changelog.ParentId, release.Id)
+	}
+	if len(release.BlockedBy) != 1 || release.BlockedBy[0] != review.Id {
+		t.Errorf("task is blocked by %v, want new id %d of imported blocker", release.BlockedBy, review.Id)
+	}
+}
+
+func TestImportIsRolledBack(t *testing.T) {
+	repo := inmemory.NewStorage(models.RejectSubtasks)
+	blocker := create(t, repo, models.Task{Text: "blocker"})
+	existing := create(t, repo, models.Task{Text: "existing", Tags: []string{"old"}})
+	before := dump(repo)
+
+	tasks := []models.Task{
+		{Id: existing, Text: "overwritten", BlockedBy: []int{blocker, 10}},
+		{Id: 10, Text: "created"},
+		{Id: 11, Text: "subtask", ParentId: 10},
+		{Id: 12, Text: "orphan", ParentId: 99},
+	}
+	result, err := Load(repo, tasks, ImportOptions{PreserveIds: true, OnConflict: ConflictOverwrite})
+	if !errors.Is(err, models.ErrNotFound) {
+		t.Fatalf("Load of task with missing parent: %v, want %v", err, models.ErrNotFound)
+	}
+	if result != (Result{}) {
+		t.Errorf("Load of failed import returned %+v, want empty result", result)
+	}
+	if after := dump(repo); after != before {
+		t.Errorf("tasks after failed import are\n%s\nwant\n%s", after, before)
+	}
+	if _, err = repo.CreateTask(models.Task{Text: "next"}); err != nil {
+		t.Errorf("CreateTask after failed import: %s", err)
+	}
+}
+
+func TestImportOntoHiddenId(t *testing.T) {
+	store := inmemory.NewStorage(models.RejectSubtasks)
+	hidden := create(t, ownership.Scope(store, "alice"), models.Task{Text: "alice's"})
+
+	bob := ownership.Scope(store, "bob")
+	tasks := []models.Task{{Id: 20, Text: "bob's"}, {Id: hidden, Text: "bob's too"}}
+	_, err := Load(bob, tasks, ImportOptions{PreserveIds: true})
+	if !errors.Is(err, models.ErrNotFound) || errors.Is(err, models.ErrConflict) {
+		t.Errorf("Load onto id of hidden task: %v, want %v", err, models.ErrNotFound)
+	}
+	if tasks := models.AllTasks(bob); len(tasks) != 0 {
+		t.Errorf("bob has tasks %+v after failed import, want none", tasks)
+	}
+	if task, err := store.GetTask(hidden); err != nil || task.Text != "alice's" || task.Owner != "alice" {
+		t.Errorf("hidden task is %+v, %v, want task of alice", task, err)
+	}
+}
@@ -0,0 +1,110 @@
+// Package trash provides retention of soft deleted tasks: Trash purges tasks which stay in trash longer than
+// retention period and permits hard delete, bypassing trash, only to configured authenticated users.
+package trash
+
+import (
+	"errors"
+	"fmt"
+	"github.com/White-AK111/REST/config"
+	"github.com/White-AK111/REST/internal/models"
+	"log"
+	"strconv"
+	"time"
+)
+
+// ErrForbidden it's an error of hard delete by actor without permission.
+var ErrForbidden = errors.New("isn't permitted to delete tasks permanently")
+
+// Trash purges tasks in trash and checks permissions of hard delete.
+type Trash struct {
+	retention    time.Duration
+	interval     time.Duration
+	hardDeleters map[string]bool
+	byActor      bool // trust actor of X-Actor header without authentication
+	done         chan struct{}
+}
+
+// New function initialize a new Trash with parameters from config.
+func New(cfg *config.Config) *Trash {
+	hardDeleters := make(map[string]bool, len(cfg.Trash.HardDelete))
+	for _, actor := range cfg.Trash.HardDelete {
+		hardDeleters[actor] = true
+	}
+	return &Trash{
+		retention:    cfg.Trash.Retention,
+		interval:     cfg.Trash.PurgeInterval,
+		hardDeleters: hardDeleters,
+		byActor:      cfg.Trash.HardByActor,
+		done:         make(chan struct{}),
+	}
+}
+
+// ParseHard function parses value of query parameter "hard", empty value means soft delete.
+func ParseHard(value string) (bool, error) {
+	if value == "" {
+		return false, nil
+	}
+	hard, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("hard must be true or false, got %q", value)
+	}
+	return hard, nil
+}
+
+// Permit checks that actor is permitted to delete tasks permanently. Actor of unauthenticated request is named
+// by client, so it's permitted only if config trusts it.
+func (t *Trash) Permit(actor string, authenticated bool) error {
+	if !authenticated && !t.byActor {
+		return fmt.Errorf("unauthenticated actor %q %w, configure users", actor, ErrForbidden)
+	}
+	if !t.hardDeleters[actor] {
+		return fmt.Errorf("actor %q %w", actor, ErrForbidden)
+	}
+	return nil
+}
+
+// Purge permanently deletes tasks which were moved to trash before now minus retention period,
+// returns ids of deleted tasks.
+func (t *Trash) Purge(repo models.Repository, now time.Time) []int {
+	return repo.PurgeTrash(now.Add(-t.retention))
+}
+
+// Run purges trash of repo every purge interval until Close is called, negative retention disables purging
+// and tasks stay in trash until they are restored.
+func (t *Trash) Run(repo models.Repository) {
+	t.RunAll(func() []models.Repository { return []models.Repository{repo} })
+}
+
+// RunAll purges trash of each repository returned by repos every purge interval until Close is called, like Run.
+func (t *Trash) RunAll(repos func() []models.Repository) {
+	if t.retention < 0 || t.interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+
+	for {
+		now := time.Now()
+		for _, repo := range repos() {
+			if ids := t.Purge(repo, now); len(ids) > 0 {
+				log.Printf("purged %d tasks from trash: %v", len(ids), ids)
+			}
+		}
+
+		select {
+		case <-t.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Close stops purging of trash.
+func (t *Trash) Close() {
+	select {
+	case <-t.done:
+	default:
+		close(t.done)
+	}
+}
@@ -0,0 +1,189 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"github.com/White-AK111/REST/internal/auth"
+	"github.com/White-AK111/REST/internal/codec"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// handler it's a HTTP API of webhook subscriptions.
+type handler struct {
+	d     *Dispatcher
+	users *auth.Users
+}
+
+// Handler returns handler of "webhooks" path for net/http based servers, requests are authenticated by users and
+// each user manages own subscriptions:
+//
+//	POST   /webhooks/                       subscribe: {"url":"...","events":["task.created"],"secret":"..."}
+//	GET    /webhooks/                       all subscriptions
+//	GET    /webhooks/<id>                   subscription
+//	DELETE /webhooks/<id>                   unsubscribe
+//	GET    /webhooks/<id>/deliveries        history of deliveries, newest first
+//	GET    /webhooks/dead-letters           failed deliveries, newest first
+//	POST   /webhooks/dead-letters/<id>/retry start failed delivery again
+func Handler(d *Dispatcher, users *auth.Users) http.Handler {
+	return &handler{d: d, users: users}
+}
+
+// ServeHTTP authenticates request and routes it by path and method.
+func (h *handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	principal, err := h.users.AuthenticateRequest(req)
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", auth.Challenge)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	// Without authentication anyone manages all subscriptions like before.
+	owner := ""
+	if h.users.Enabled() {
+		owner = principal
+	}
+
+	path := strings.Trim(req.URL.Path, "/")
+	pathParts := strings.Split(path, "/")
+	if len(pathParts) == 0 || pathParts[0] != "webhooks" {
+		http.NotFound(w, req)
+		return
+	}
+	pathParts = pathParts[1:]
+
+	switch {
+	case len(pathParts) == 0:
+		if req.Method == http.MethodPost {
+			h.subscribeHandler(w, req, principal)
+		} else if req.Method == http.MethodGet {
+			render(w, req, http.StatusOK, h.d.Subscriptions(owner))
+		} else {
+			methodNotAllowed(w, req, "GET or POST")
+		}
+	case pathParts[0] == "dead-letters":
+		h.deadLettersHandler(w, req, owner, pathParts[1:])
+	default:
+		id, err := strconv.Atoi(pathParts[0])
+		if err != nil {
+			http.Error(w, fmt.Sprintf("expect /webhooks/<id>, got %v", req.URL.Path), http.StatusBadRequest)
+			return
+		}
+		h.subscriptionHandler(w, req, owner, id, pathParts[1:])
+	}
+}
+
+// subscribeHandler handler for POST method, creates subscription of principal.
+func (h *handler) subscribeHandler(w http.ResponseWriter, req *http.Request, principal string) {
+	type RequestSubscription struct {
+		URL    string      `json:"url" xml:"url" yaml:"url"`
+		Events []EventType `json:"events" xml:"events>event" yaml:"events"`
+		Secret string      `json:"secret" xml:"secret" yaml:"secret"`
+	}
+
+	dec, err := codec.ForContentType(req.Header.Get("Content-Type"))
+	if errors.Is(err, codec.ErrUnsupportedMediaType) {
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var rs RequestSubscription
+	if err = dec.Decode(req.Body, &rs); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sub, err := h.d.Subscribe(principal, h.users.Visible(principal), rs.URL, rs.Events, rs.Secret)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	render(w, req, http.StatusCreated, sub)
+}
+
+// subscriptionHandler handler for "webhooks/<id>" path.
+func (h *handler) subscriptionHandler(w http.ResponseWriter, req *http.Request, owner string, id int, rest []string) {
+	switch {
+	case len(rest) == 0 && req.Method == http.MethodGet:
+		sub, err := h.d.Subscription(owner, id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		render(w, req, http.StatusOK, sub)
+	case len(rest) == 0 && req.Method == http.MethodDelete:
+		if err := h.d.Unsubscribe(owner, id); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+		}
+	case len(rest) == 0:
+		methodNotAllowed(w, req, "GET or DELETE")
+	case len(rest) == 1 && rest[0] == "deliveries":
+		if req.Method != http.MethodGet {
+			methodNotAllowed(w, req, "GET")
+			return
+		}
+		deliveries, err := h.d.Deliveries(owner, id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		render(w, req, http.StatusOK, deliveries)
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+// deadLettersHandler handler for "webhooks/dead-letters" path.
+func (h *handler) deadLettersHandler(w http.ResponseWriter, req *http.Request, owner string, rest []string) {
+	switch {
+	case len(rest) == 0:
+		if req.Method != http.MethodGet {
+			methodNotAllowed(w, req, "GET")
+			return
+		}
+		render(w, req, http.StatusOK, h.d.DeadLetters(owner))
+	case len(rest) == 2 && rest[1] == "retry":
+		if req.Method != http.MethodPost {
+			methodNotAllowed(w, req, "POST")
+			return
+		}
+		id, err := strconv.Atoi(rest[0])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		delivery, err := h.d.Redeliver(owner, id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		render(w, req, http.StatusAccepted, delivery)
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+// methodNotAllowed writes error about unexpected method.
+func methodNotAllowed(w http.ResponseWriter, req *http.Request, expect string) {
+	http.Error(w, fmt.Sprintf("expect method %s at %s, got %v", expect, req.URL.Path, req.Method), http.StatusMethodNotAllowed)
+}
+
+// render renders 'v' in format negotiated by Accept header of req and writes it as a response with status code.
+func render(w http.ResponseWriter, req *http.Request, code int, v interface{}) {
+	enc, err := codec.Negotiate(req.Header.Get("Accept"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotAcceptable)
+		return
+	}
+	data, err := enc.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", enc.ContentType())
+	w.WriteHeader(code)
+	_, _ = w.Write(data)
+}
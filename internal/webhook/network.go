@@ -0,0 +1,84 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrForbiddenAddress it's an error of receiver at address of local or private network, which isn't allowed.
+var ErrForbiddenAddress = errors.New("isn't allowed address of receiver")
+
+// network checks addresses of receivers: loopback, link-local, private, unspecified and multicast addresses are
+// refused unless they are in allowed networks, so subscriptions can't reach services of internal networks.
+type network struct {
+	allowed []*net.IPNet
+}
+
+// newNetwork returns network allowing receivers in CIDRs, e.g. 10.1.0.0/16 for receivers in the same network.
+func newNetwork(cidrs []string) (network, error) {
+	var n network
+	for _, cidr := range cidrs {
+		_, allowed, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return network{}, fmt.Errorf("bad allowed network of webhooks %q: %w", cidr, err)
+		}
+		n.allowed = append(n.allowed, allowed)
+	}
+	return n, nil
+}
+
+// checkIP checks that receiver may be at the IP address.
+func (n network) checkIP(ip net.IP) error {
+	for _, allowed := range n.allowed {
+		if allowed.Contains(ip) {
+			return nil
+		}
+	}
+	if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() ||
+		ip.IsPrivate() || ip.IsUnspecified() || ip.IsMulticast() {
+		return fmt.Errorf("%s %w", ip, ErrForbiddenAddress)
+	}
+	return nil
+}
+
+// checkHost checks host of URL of receiver before subscription: IP address and localhost names are checked at once,
+// other names are checked by addresses they resolve to on each connection, see client.
+func (n network) checkHost(host string) error {
+	if ip := net.ParseIP(host); ip != nil {
+		return n.checkIP(ip)
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return n.checkIP(net.IPv4(127, 0, 0, 1))
+	}
+	return nil
+}
+
+// control checks address of connection to receiver before dialing, so names resolving to forbidden addresses
+// and redirects to them are refused too.
+func (n network) control(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return fmt.Errorf("%s %w", host, ErrForbiddenAddress)
+	}
+	return n.checkIP(ip)
+}
+
+// client returns HTTP client of deliveries with timeout which dials only allowed addresses. Receivers are dialed
+// directly without proxy of environment, so the addresses of receivers are checked.
+func (n network) client(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second, Control: n.control}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
@@ -0,0 +1,489 @@
+// Package webhook provides outbound webhooks on task events. Receivers subscribe with URL, event types and
+// secret; each delivery is a POST with JSON payload signed by HMAC-SHA256 of "<timestamp>.<body>" with the secret:
+//
+//	X-Webhook-Event: task.created
+//	X-Webhook-Delivery: 42
+//	X-Webhook-Timestamp: 1635087845
+//	X-Webhook-Signature: sha256=<hex>
+//
+// Failed deliveries are retried with exponential backoff, after the last attempt a delivery goes to dead letters.
+// Subscription is owned by the principal who subscribed, it receives events of tasks which the owner sees.
+// Receivers at loopback, link-local and private addresses are refused unless their networks are allowed by config.
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/White-AK111/REST/config"
+	"github.com/White-AK111/REST/internal/events"
+	"github.com/White-AK111/REST/internal/models"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// EventType it's a type of event delivered to webhooks.
+type EventType string
+
+const (
+	TaskCreated  EventType = "task.created"
+	TaskDeleted  EventType = "task.deleted"
+	TaskDue      EventType = "task.due"
+	TaskReminder EventType = "task.reminder" // task falls due soon, sent by scheduler before due date
+)
+
+// eventTypes all supported event types.
+var eventTypes = map[EventType]bool{TaskCreated: true, TaskDeleted: true, TaskDue: true, TaskReminder: true}
+
+// Delivery statuses.
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusFailed    = "failed" // all attempts failed, delivery is in dead letters
+)
+
+var ErrNotFound = errors.New("not found")
+
+// Subscription it's a webhook of receiver.
+type Subscription struct {
+	Id        int         `json:"id" xml:"id" yaml:"id"`
+	Owner     string      `json:"owner" xml:"owner" yaml:"owner"`
+	URL       string      `json:"url" xml:"url" yaml:"url"`
+	Events    []EventType `json:"events" xml:"events>event" yaml:"events"`
+	Secret    string      `json:"-" xml:"-" yaml:"-"`
+	CreatedAt time.Time   `json:"createdAt" xml:"createdAt" yaml:"createdAt"`
+
+	visible func(models.Task) bool // filter of tasks which owner sees, nil means all tasks
+}
+
+// owned reports whether owner may manage subscription, empty owner may manage all subscriptions.
+func (s *Subscription) owned(owner string) bool {
+	return owner == "" || s.Owner == owner
+}
+
+// Attempt it's a result of one request to receiver.
+type Attempt struct {
+	Time       time.Time `json:"time" xml:"time" yaml:"time"`
+	StatusCode int       `json:"statusCode,omitempty" xml:"statusCode,omitempty" yaml:"statusCode,omitempty"`
+	Error      string    `json:"error,omitempty" xml:"error,omitempty" yaml:"error,omitempty"`
+	DurationMs int64     `json:"durationMs" xml:"durationMs" yaml:"durationMs"`
+}
+
+// Delivery it's a notification of subscription about one event with history of attempts.
+type Delivery struct {
+	Id             int             `json:"id" xml:"id" yaml:"id"`
+	SubscriptionId int             `json:"subscriptionId" xml:"subscriptionId" yaml:"subscriptionId"`
+	URL            string          `json:"url" xml:"url" yaml:"url"`
+	Event          EventType       `json:"event" xml:"event" yaml:"event"`
+	Payload        json.RawMessage `json:"payload" xml:"-" yaml:"-"`
+	Status         string          `json:"status" xml:"status" yaml:"status"`
+	Attempts       []Attempt       `json:"attempts" xml:"attempts>attempt" yaml:"attempts"`
+	CreatedAt      time.Time       `json:"createdAt" xml:"createdAt" yaml:"createdAt"`
+	NextAttemptAt  *time.Time      `json:"nextAttemptAt,omitempty" xml:"nextAttemptAt,omitempty" yaml:"nextAttemptAt,omitempty"`
+
+	owner string // owner of subscription
+}
+
+// payload it's a body of webhook request.
+type payload struct {
+	Delivery int         `json:"delivery"`
+	Event    EventType   `json:"event"`
+	Time     time.Time   `json:"time"`
+	Task     models.Task `json:"task"`
+}
+
+// Sign returns signature of body for X-Webhook-Signature header.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether signature of body is valid, used by receivers.
+func Verify(secret string, timestamp int64, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
+
+// Dispatcher keeps subscriptions and delivers events to them; Dispatcher methods are safe to call concurrently.
+type Dispatcher struct {
+	sync.Mutex
+	client         *http.Client
+	network        network
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	historySize    int
+
+	subs           map[int]*Subscription
+	nextSubId      int
+	deliveries     []*Delivery // last deliveries, oldest first
+	deadLetters    []*Delivery // last failed deliveries, oldest first
+	nextDeliveryId int
+	done           chan struct{}
+}
+
+// NewDispatcher function initialize a new Dispatcher with parameters from config.
+func NewDispatcher(cfg *config.Config) (*Dispatcher, error) {
+	n, err := newNetwork(cfg.Webhooks.AllowedNetworks)
+	if err != nil {
+		return nil, err
+	}
+	return &Dispatcher{
+		client:         n.client(cfg.Webhooks.Timeout),
+		network:        n,
+		maxAttempts:    cfg.Webhooks.MaxAttempts,
+		initialBackoff: cfg.Webhooks.InitialBackoff,
+		maxBackoff:     cfg.Webhooks.MaxBackoff,
+		historySize:    cfg.Webhooks.HistorySize,
+		subs:           make(map[int]*Subscription),
+		nextSubId:      1,
+		nextDeliveryId: 1,
+		done:           make(chan struct{}),
+	}, nil
+}
+
+// SetClient replaces HTTP client used for deliveries, e.g. by client of httptest.Server.
+func (d *Dispatcher) SetClient(client *http.Client) {
+	d.Lock()
+	defer d.Unlock()
+
+	d.client = client
+}
+
+// Run delivers events from the bus until Close is called.
+func (d *Dispatcher) Run(bus *events.Bus) {
+	sub := bus.Subscribe(1024)
+	defer func() { sub.Close() }()
+
+	for {
+		select {
+		case <-d.done:
+			return
+		case e, ok := <-sub.C:
+			if !ok {
+				log.Println("webhook dispatcher is too slow to receive events, some events are lost")
+				sub = bus.Subscribe(1024)
+				continue
+			}
+			d.handleEvent(e)
+		}
+	}
+}
+
+// Close stops dispatcher, pending retries are abandoned.
+func (d *Dispatcher) Close() {
+	d.Lock()
+	defer d.Unlock()
+
+	select {
+	case <-d.done:
+	default:
+		close(d.done)
+	}
+}
+
+// handleEvent maps event of the bus to webhook events, due events are sent by scheduler.
+func (d *Dispatcher) handleEvent(e events.Event) {
+	switch e.Type {
+	case events.Created:
+		d.Notify(TaskCreated, e.Task)
+	case events.Deleted:
+		d.Notify(TaskDeleted, e.Task)
+	}
+}
+
+// Notify creates deliveries of event for all subscriptions of event type and starts them.
+func (d *Dispatcher) Notify(event EventType, task models.Task) {
+	d.Lock()
+	defer d.Unlock()
+
+	now := time.Now()
+	for _, id := range d.sortedSubIds() {
+		sub := d.subs[id]
+		if !sub.wants(event) || (sub.visible != nil && !sub.visible(task)) {
+			continue
+		}
+
+		delivery := &Delivery{
+			Id:             d.nextDeliveryId,
+			SubscriptionId: sub.Id,
+			URL:            sub.URL,
+			Event:          event,
+			Status:         StatusPending,
+			CreatedAt:      now,
+			owner:          sub.Owner,
+		}
+		d.nextDeliveryId++
+		body, err := json.Marshal(payload{Delivery: delivery.Id, Event: event, Time: now, Task: task})
+		if err != nil {
+			log.Printf("error on marshal webhook payload: %s", err)
+			continue
+		}
+		delivery.Payload = body
+
+		d.deliveries = appendBounded(d.deliveries, delivery, d.historySize)
+		go d.deliver(delivery, sub.Secret)
+	}
+}
+
+// wants reports whether subscription is subscribed to event type.
+func (s *Subscription) wants(event EventType) bool {
+	for _, e := range s.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// deliver sends delivery with retries, after the last failed attempt delivery goes to dead letters.
+func (d *Dispatcher) deliver(delivery *Delivery, secret string) {
+	backoff := d.initialBackoff
+	for attempt := 1; ; attempt++ {
+		result := d.attempt(delivery, secret)
+
+		d.Lock()
+		delivery.Attempts = append(delivery.Attempts, result)
+		delivery.NextAttemptAt = nil
+		if result.Error == "" {
+			delivery.Status = StatusDelivered
+			d.Unlock()
+			return
+		}
+		if attempt >= d.maxAttempts {
+			delivery.Status = StatusFailed
+			d.deadLetters = appendBounded(d.deadLetters, delivery, d.historySize)
+			d.Unlock()
+			log.Printf("webhook delivery %d to %s failed after %d attempts: %s", delivery.Id, delivery.URL, attempt, result.Error)
+			return
+		}
+		next := time.Now().Add(backoff)
+		delivery.NextAttemptAt = &next
+		d.Unlock()
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-d.done:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		backoff *= 2
+		if backoff > d.maxBackoff {
+			backoff = d.maxBackoff
+		}
+	}
+}
+
+// attempt sends one request to receiver, any status except 2xx is a failure.
+func (d *Dispatcher) attempt(delivery *Delivery, secret string) Attempt {
+	start := time.Now()
+	result := Attempt{Time: start}
+
+	req, err := http.NewRequest(http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	timestamp := start.Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "REST-tasks-webhook")
+	req.Header.Set("X-Webhook-Event", string(delivery.Event))
+	req.Header.Set("X-Webhook-Delivery", strconv.Itoa(delivery.Id))
+	req.Header.Set("X-Webhook-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Webhook-Signature", Sign(secret, timestamp, delivery.Payload))
+
+	d.Lock()
+	client := d.client
+	d.Unlock()
+
+	resp, err := client.Do(req)
+	result.DurationMs = time.Since(start).Milliseconds()
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	result.StatusCode = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		result.Error = fmt.Sprintf("receiver responded with status %d", resp.StatusCode)
+	}
+	return result
+}
+
+// appendBounded appends delivery and drops the oldest ones over limit.
+func appendBounded(list []*Delivery, delivery *Delivery, limit int) []*Delivery {
+	list = append(list, delivery)
+	if limit > 0 && len(list) > limit {
+		list = append(list[:0:0], list[len(list)-limit:]...)
+	}
+	return list
+}
+
+// sortedSubIds returns ids of subscriptions in ascending order, must be called with lock held.
+func (d *Dispatcher) sortedSubIds() []int {
+	ids := make([]int, 0, len(d.subs))
+	for id := range d.subs {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// Subscribe adds subscription of owner of URL to event types, secret is used to sign deliveries. Only events of tasks
+// passing visible filter are delivered, nil filter passes all tasks.
+func (d *Dispatcher) Subscribe(owner string, visible func(models.Task) bool, rawURL string, eventTypes []EventType, secret string) (Subscription, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return Subscription{}, fmt.Errorf("url must be absolute http or https URL, got %q", rawURL)
+	}
+	if err = d.network.checkHost(u.Hostname()); err != nil {
+		return Subscription{}, fmt.Errorf("url %q: %w", rawURL, err)
+	}
+	if len(eventTypes) == 0 {
+		return Subscription{}, fmt.Errorf("expect at least one event type")
+	}
+	for _, e := range eventTypes {
+		if !knownEvent(e) {
+			return Subscription{}, fmt.Errorf("unknown event type %q, expect %s, %s, %s or %s", e, TaskCreated, TaskDeleted, TaskDue, TaskReminder)
+		}
+	}
+	if secret == "" {
+		return Subscription{}, fmt.Errorf("expect secret for signing of deliveries")
+	}
+
+	d.Lock()
+	defer d.Unlock()
+
+	sub := &Subscription{
+		Id:        d.nextSubId,
+		Owner:     owner,
+		URL:       u.String(),
+		Events:    append([]EventType(nil), eventTypes...),
+		Secret:    secret,
+		CreatedAt: time.Now(),
+		visible:   visible,
+	}
+	d.subs[sub.Id] = sub
+	d.nextSubId++
+	return *sub, nil
+}
+
+// knownEvent reports whether event type is supported.
+func knownEvent(e EventType) bool {
+	return eventTypes[e]
+}
+
+// Unsubscribe deletes subscription of owner, started deliveries are finished. Empty owner means any owner.
+func (d *Dispatcher) Unsubscribe(owner string, id int) error {
+	d.Lock()
+	defer d.Unlock()
+
+	if sub, ok := d.subs[id]; !ok || !sub.owned(owner) {
+		return fmt.Errorf("webhook with id=%d %w", id, ErrNotFound)
+	}
+	delete(d.subs, id)
+	return nil
+}
+
+// Subscription returns subscription of owner by id, empty owner means any owner.
+func (d *Dispatcher) Subscription(owner string, id int) (Subscription, error) {
+	d.Lock()
+	defer d.Unlock()
+
+	sub, ok := d.subs[id]
+	if !ok || !sub.owned(owner) {
+		return Subscription{}, fmt.Errorf("webhook with id=%d %w", id, ErrNotFound)
+	}
+	return *sub, nil
+}
+
+// Subscriptions returns subscriptions of owner sorted by id, empty owner means all subscriptions.
+func (d *Dispatcher) Subscriptions(owner string) []Subscription {
+	d.Lock()
+	defer d.Unlock()
+
+	subs := make([]Subscription, 0, len(d.subs))
+	for _, id := range d.sortedSubIds() {
+		if sub := d.subs[id]; sub.owned(owner) {
+			subs = append(subs, *sub)
+		}
+	}
+	return subs
+}
+
+// Deliveries returns history of deliveries of subscription of owner, newest first. Empty owner means any owner.
+func (d *Dispatcher) Deliveries(owner string, subId int) ([]Delivery, error) {
+	d.Lock()
+	defer d.Unlock()
+
+	if sub, ok := d.subs[subId]; !ok || !sub.owned(owner) {
+		return nil, fmt.Errorf("webhook with id=%d %w", subId, ErrNotFound)
+	}
+	deliveries := make([]Delivery, 0)
+	for i := len(d.deliveries) - 1; i >= 0; i-- {
+		if d.deliveries[i].SubscriptionId == subId {
+			deliveries = append(deliveries, d.copyDelivery(d.deliveries[i]))
+		}
+	}
+	return deliveries, nil
+}
+
+// DeadLetters returns failed deliveries of subscriptions of owner, newest first. Empty owner means any owner.
+func (d *Dispatcher) DeadLetters(owner string) []Delivery {
+	d.Lock()
+	defer d.Unlock()
+
+	deliveries := make([]Delivery, 0, len(d.deadLetters))
+	for i := len(d.deadLetters) - 1; i >= 0; i-- {
+		if owner == "" || d.deadLetters[i].owner == owner {
+			deliveries = append(deliveries, d.copyDelivery(d.deadLetters[i]))
+		}
+	}
+	return deliveries
+}
+
+// Redeliver removes delivery of subscription of owner from dead letters and starts it again with the same payload.
+// Empty owner means any owner.
+func (d *Dispatcher) Redeliver(owner string, deliveryId int) (Delivery, error) {
+	d.Lock()
+	defer d.Unlock()
+
+	for i, delivery := range d.deadLetters {
+		if delivery.Id != deliveryId || (owner != "" && delivery.owner != owner) {
+			continue
+		}
+		sub, ok := d.subs[delivery.SubscriptionId]
+		if !ok {
+			return Delivery{}, fmt.Errorf("webhook with id=%d of delivery %w", delivery.SubscriptionId, ErrNotFound)
+		}
+		d.deadLetters = append(d.deadLetters[:i], d.deadLetters[i+1:]...)
+		delivery.Status = StatusPending
+		go d.deliver(delivery, sub.Secret)
+		return d.copyDelivery(delivery), nil
+	}
+	return Delivery{}, fmt.Errorf("dead letter with id=%d %w", deliveryId, ErrNotFound)
+}
+
+// copyDelivery returns copy of delivery safe to use without lock, must be called with lock held.
+func (d *Dispatcher) copyDelivery(delivery *Delivery) Delivery {
+	c := *delivery
+	c.Attempts = append([]Attempt(nil), delivery.Attempts...)
+	return c
+}
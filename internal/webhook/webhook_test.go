@@ -0,0 +1,351 @@
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/White-AK111/REST/config"
+	"github.com/White-AK111/REST/internal/models"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// secret it's a secret of subscriptions in tests.
+const secret = "s3cret"
+
+// receiver it's a webhook receiver which fails the first failures requests, negative failures fails all requests.
+type receiver struct {
+	sync.Mutex
+	failures int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+// ServeHTTP records request and responds with 500 while receiver fails, 204 after.
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := ioutil.ReadAll(req.Body)
+
+	r.Lock()
+	defer r.Unlock()
+
+	r.requests = append(r.requests, req)
+	r.bodies = append(r.bodies, body)
+	if r.failures != 0 {
+		if r.failures > 0 {
+			r.failures--
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// setFailures sets number of requests receiver fails.
+func (r *receiver) setFailures(n int) {
+	r.Lock()
+	defer r.Unlock()
+
+	r.failures = n
+}
+
+// setup starts receiver failing the first failures requests and returns it with dispatcher subscribed to it
+// by owner alice to task.created events.
+func setup(t *testing.T, failures, maxAttempts int) (*receiver, *Dispatcher, Subscription) {
+	t.Helper()
+	r := &receiver{failures: failures}
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+
+	cfg := &config.Config{}
+	cfg.Webhooks.MaxAttempts = maxAttempts
+	cfg.Webhooks.InitialBackoff = 20 * time.Millisecond
+	cfg.Webhooks.MaxBackoff = 40 * time.Millisecond
+	cfg.Webhooks.Timeout = time.Second
+	cfg.Webhooks.HistorySize = 10
+	cfg.Webhooks.AllowedNetworks = []string{"127.0.0.0/8"}
+	d, err := NewDispatcher(cfg)
+	if err != nil {
+		t.Fatalf("NewDispatcher: %s", err)
+	}
+	d.SetClient(srv.Client())
+	t.Cleanup(d.Close)
+
+	sub, err := d.Subscribe("alice", nil, srv.URL+"/hook", []EventType{TaskCreated}, secret)
+	if err != nil {
+		t.Fatalf("Subscribe: %s", err)
+	}
+	return r, d, sub
+}
+
+// waitStatus waits until the last delivery of subscription has status and returns it.
+func waitStatus(t *testing.T, d *Dispatcher, sub Subscription, status string) Delivery {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		deliveries, err := d.Deliveries("alice", sub.Id)
+		if err != nil {
+			t.Fatalf("Deliveries: %s", err)
+		}
+		if len(deliveries) > 0 && deliveries[0].Status == status {
+			return deliveries[0]
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("delivery isn't %s in time: %+v", status, deliveries)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// statusCodes returns status codes of attempts.
+func statusCodes(attempts []Attempt) []int {
+	codes := make([]int, 0, len(attempts))
+	for _, a := range attempts {
+		codes = append(codes, a.StatusCode)
+	}
+	return codes
+}
+
+func TestSignature(t *testing.T) {
+	r, d, sub := setup(t, 0, 1)
+
+	d.Notify(TaskCreated, models.Task{Id: 7, Text: "report"})
+	delivery := waitStatus(t, d, sub, StatusDelivered)
+
+	r.Lock()
+	defer r.Unlock()
+	if len(r.requests) != 1 {
+		t.Fatalf("receiver got %d requests, want 1", len(r.requests))
+	}
+	req, body := r.requests[0], r.bodies[0]
+
+	if req.Method != http.MethodPost || req.URL.Path != "/hook" {
+		t.Errorf("request is %s %s, want POST /hook", req.Method, req.URL.Path)
+	}
+	if event := req.Header.Get("X-Webhook-Event"); event != string(TaskCreated) {
+		t.Errorf("X-Webhook-Event is %q, want %q", event, TaskCreated)
+	}
+	if id := req.Header.Get("X-Webhook-Delivery"); id != strconv.Itoa(delivery.Id) {
+		t.Errorf("X-Webhook-Delivery is %q, want %d", id, delivery.Id)
+	}
+	timestamp, err := strconv.ParseInt(req.Header.Get("X-Webhook-Timestamp"), 10, 64)
+	if err != nil {
+		t.Fatalf("X-Webhook-Timestamp: %s", err)
+	}
+	if d := time.Since(time.Unix(timestamp, 0)); d < 0 || d > time.Minute {
+		t.Errorf("X-Webhook-Timestamp %d isn't time of delivery", timestamp)
+	}
+
+	signature := req.Header.Get("X-Webhook-Signature")
+	if want := Sign(secret, timestamp, body); signature != want {
+		t.Errorf("X-Webhook-Signature is %q, want %q", signature, want)
+	}
+	if !Verify(secret, timestamp, body, signature) {
+		t.Errorf("signature %q isn't verified", signature)
+	}
+	if Verify("another secret", timestamp, body, signature) || Verify(secret, timestamp+1, body, signature) {
+		t.Errorf("signature %q is verified with another secret or timestamp", signature)
+	}
+
+	var p payload
+	if err = json.Unmarshal(body, &p); err != nil {
+		t.Fatalf("payload: %s", err)
+	}
+	if p.Delivery != delivery.Id || p.Event != TaskCreated || p.Task.Id != 7 {
+		t.Errorf("payload is %+v, want delivery %d of task.created of task 7", p, delivery.Id)
+	}
+}
+
+func TestSignFormat(t *testing.T) {
+	// HMAC-SHA256 of "1635087845.{}" with key "s3cret", e.g. by openssl dgst -sha256 -hmac s3cret.
+	const want = "sha256=9b9817a9f618189226973e1bcb15914538a6b6d38571cf43c3b9e1a23d867006"
+	if got := Sign(secret, 1635087845, []byte("{}")); got != want {
+		t.Errorf("Sign returned %q, want %q", got, want)
+	}
+}
+
+func TestRetryWithBackoff(t *testing.T) {
+	r, d, sub := setup(t, 2, 5)
+
+	d.Notify(TaskCreated, models.Task{Id: 1})
+	delivery := waitStatus(t, d, sub, StatusDelivered)
+
+	codes := statusCodes(delivery.Attempts)
+	if len(codes) != 3 || codes[0] != 500 || codes[1] != 500 || codes[2] != 204 {
+		t.Fatalf("attempts responded with %v, want [500 500 204]", codes)
+	}
+	if delivery.NextAttemptAt != nil {
+		t.Errorf("delivered delivery has next attempt at %s", delivery.NextAttemptAt)
+	}
+	for i, min := range []time.Duration{20 * time.Millisecond, 40 * time.Millisecond} {
+		if gap := delivery.Attempts[i+1].Time.Sub(delivery.Attempts[i].Time); gap < min {
+			t.Errorf("attempt %d is %s after previous one, want backoff at least %s", i+2, gap, min)
+		}
+	}
+	if dead := d.DeadLetters("alice"); len(dead) != 0 {
+		t.Errorf("delivered delivery is in dead letters: %+v", dead)
+	}
+
+	r.Lock()
+	defer r.Unlock()
+	if len(r.requests) != 3 {
+		t.Errorf("receiver got %d requests, want 3", len(r.requests))
+	}
+	for i := 1; i < len(r.bodies); i++ {
+		if string(r.bodies[i]) != string(r.bodies[0]) {
+			t.Errorf("retry %d sent another payload %s, want %s", i, r.bodies[i], r.bodies[0])
+		}
+	}
+}
+
+func TestDeadLetter(t *testing.T) {
+	r, d, sub := setup(t, -1, 3)
+
+	d.Notify(TaskCreated, models.Task{Id: 1})
+	delivery := waitStatus(t, d, sub, StatusFailed)
+
+	if len(delivery.Attempts) != 3 {
+		t.Errorf("failed delivery has %d attempts, want 3", len(delivery.Attempts))
+	}
+	for _, a := range delivery.Attempts {
+		if a.StatusCode != http.StatusInternalServerError || a.Error == "" {
+			t.Errorf("attempt is %+v, want failure with status 500", a)
+		}
+	}
+
+	dead := d.DeadLetters("alice")
+	if len(dead) != 1 || dead[0].Id != delivery.Id {
+		t.Fatalf("dead letters are %+v, want delivery %d", dead, delivery.Id)
+	}
+	if other := d.DeadLetters("bob"); len(other) != 0 {
+		t.Errorf("dead letters of another owner are %+v, want none", other)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	r.Lock()
+	defer r.Unlock()
+	if len(r.requests) != 3 {
+		t.Errorf("receiver got %d requests, want no attempts after the last one", len(r.requests))
+	}
+}
+
+func TestRedeliver(t *testing.T) {
+	r, d, sub := setup(t, -1, 2)
+
+	d.Notify(TaskCreated, models.Task{Id: 1})
+	failed := waitStatus(t, d, sub, StatusFailed)
+
+	if _, err := d.Redeliver("bob", failed.Id); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Redeliver of dead letter of another owner: %v, want %v", err, ErrNotFound)
+	}
+
+	r.setFailures(0)
+	redelivered, err := d.Redeliver("alice", failed.Id)
+	if err != nil {
+		t.Fatalf("Redeliver: %s", err)
+	}
+	if redelivered.Id != failed.Id || redelivered.Status != StatusPending {
+		t.Errorf("Redeliver returned %+v, want pending delivery %d", redelivered, failed.Id)
+	}
+	if dead := d.DeadLetters("alice"); len(dead) != 0 {
+		t.Errorf("redelivered delivery is still in dead letters: %+v", dead)
+	}
+
+	delivery := waitStatus(t, d, sub, StatusDelivered)
+	if codes := statusCodes(delivery.Attempts); len(codes) != 3 || codes[2] != http.StatusNoContent {
+		t.Errorf("attempts responded with %v, want [500 500 204]", codes)
+	}
+	if string(delivery.Payload) != string(failed.Payload) {
+		t.Errorf("redelivery sent payload %s, want %s", delivery.Payload, failed.Payload)
+	}
+
+	if _, err = d.Redeliver("alice", failed.Id); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Redeliver of delivered delivery: %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestRedeliverOfUnsubscribed(t *testing.T) {
+	_, d, sub := setup(t, -1, 1)
+
+	d.Notify(TaskCreated, models.Task{Id: 1})
+	failed := waitStatus(t, d, sub, StatusFailed)
+
+	if err := d.Unsubscribe("alice", sub.Id); err != nil {
+		t.Fatalf("Unsubscribe: %s", err)
+	}
+	if _, err := d.Redeliver("alice", failed.Id); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Redeliver of dead letter of deleted webhook: %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestSubscribeRefusesInternalAddresses(t *testing.T) {
+	d, err := NewDispatcher(&config.Config{})
+	if err != nil {
+		t.Fatalf("NewDispatcher: %s", err)
+	}
+	defer d.Close()
+
+	for _, url := range []string{
+		"http://127.0.0.1/hook", "http://localhost:8080/hook", "http://api.localhost/hook", "http://[::1]/hook",
+		"http://10.0.0.1/hook", "http://192.168.1.1/hook", "http://172.16.0.1/hook", "http://169.254.169.254/latest",
+		"http://0.0.0.0/hook", "http://[fe80::1]/hook", "http://[::ffff:127.0.0.1]/hook",
+	} {
+		if _, err := d.Subscribe("alice", nil, url, []EventType{TaskCreated}, secret); !errors.Is(err, ErrForbiddenAddress) {
+			t.Errorf("Subscribe to %s: %v, want %v", url, err, ErrForbiddenAddress)
+		}
+	}
+	if _, err := d.Subscribe("alice", nil, "https://93.184.216.34/hook", []EventType{TaskCreated}, secret); err != nil {
+		t.Errorf("Subscribe to public address: %s", err)
+	}
+}
+
+func TestAllowedNetworks(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Webhooks.AllowedNetworks = []string{"10.1.0.0/16"}
+	d, err := NewDispatcher(cfg)
+	if err != nil {
+		t.Fatalf("NewDispatcher: %s", err)
+	}
+	defer d.Close()
+
+	if _, err := d.Subscribe("alice", nil, "http://10.1.2.3/hook", []EventType{TaskCreated}, secret); err != nil {
+		t.Errorf("Subscribe to allowed network: %s", err)
+	}
+	if _, err := d.Subscribe("alice", nil, "http://10.2.0.1/hook", []EventType{TaskCreated}, secret); !errors.Is(err, ErrForbiddenAddress) {
+		t.Errorf("Subscribe to another private network: %v, want %v", err, ErrForbiddenAddress)
+	}
+
+	cfg.Webhooks.AllowedNetworks = []string{"10.1.0.0"}
+	if _, err := NewDispatcher(cfg); err == nil {
+		t.Errorf("NewDispatcher accepted bad CIDR")
+	}
+}
+
+func TestDeliveryRefusesInternalAddresses(t *testing.T) {
+	r := &receiver{}
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	d, err := NewDispatcher(&config.Config{})
+	if err != nil {
+		t.Fatalf("NewDispatcher: %s", err)
+	}
+	defer d.Close()
+
+	// Names and redirects resolving to loopback are refused by client of deliveries at connection.
+	resp, err := d.client.Get(srv.URL)
+	if err == nil {
+		resp.Body.Close()
+	}
+	if !errors.Is(err, ErrForbiddenAddress) {
+		t.Errorf("delivery to %s: %v, want %v", srv.URL, err, ErrForbiddenAddress)
+	}
+	r.Lock()
+	defer r.Unlock()
+	if len(r.requests) != 0 {
+		t.Errorf("receiver at loopback got %d requests, want none", len(r.requests))
+	}
+}
@@ -0,0 +1,331 @@
+// Package ws provides WebSocket subscription API for tasks. A client subscribes to task changes with
+// filters by tags and due range, receives matching events and sends create/delete commands over the socket.
+//
+// Messages are JSON objects with field "type":
+//
+//	-> {"type":"subscribe","id":"s1","filter":{"tags":["todo"],"dueFrom":"2021-10-01T00:00:00Z","dueTo":"2021-11-01T00:00:00Z"}}
+//	<- {"type":"subscribed","id":"s1"}
+//	-> {"type":"unsubscribe","id":"s1"}
+//	<- {"type":"unsubscribed","id":"s1"}
+//	-> {"type":"create","requestId":"r1","task":{"text":"buy milk","tags":["todo"],"due":"2021-11-01T15:04:05Z"}}
+//	<- {"type":"result","requestId":"r1","task":{"id":1,...}}
+//	-> {"type":"delete","requestId":"r2","taskId":1}
+//	<- {"type":"result","requestId":"r2"}
+//	<- {"type":"event","subscriptions":["s1"],"event":{"seq":1,"type":"created","task":{...},"time":"..."}}
+//	<- {"type":"error","requestId":"r2","error":"task with id=1 not found"}
+package ws
+
+import (
+	"fmt"
+	"github.com/White-AK111/REST/internal/auth"
+	"github.com/White-AK111/REST/internal/events"
+	"github.com/White-AK111/REST/internal/models"
+	"github.com/White-AK111/REST/internal/recurrence"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	sendBuffer     = 256              // count of outgoing messages buffered for each client
+	eventBuffer    = 256              // count of bus events buffered for each client
+	maxMessageSize = 64 * 1024        // max size of incoming message
+	writeWait      = 10 * time.Second // time allowed to write a message
+	pongWait       = 60 * time.Second // time allowed to read the next pong from client
+	pingPeriod     = pongWait * 9 / 10
+)
+
+// Conn it's a WebSocket connection, implemented by gorilla/websocket and fasthttp/websocket.
+type Conn interface {
+	ReadJSON(v interface{}) error
+	WriteJSON(v interface{}) error
+	WriteControl(messageType int, data []byte, deadline time.Time) error
+	SetReadLimit(limit int64)
+	SetReadDeadline(t time.Time) error
+	SetWriteDeadline(t time.Time) error
+	SetPongHandler(h func(appData string) error)
+	Close() error
+}
+
+// Filter of task events, empty filter matches all tasks.
+type Filter struct {
+	Tags    []string   `json:"tags,omitempty"`    // task has any of tags
+	DueFrom *time.Time `json:"dueFrom,omitempty"` // task is due at or after
+	DueTo   *time.Time `json:"dueTo,omitempty"`   // task is due at or before
+}
+
+// Match reports whether task passes filter.
+func (f Filter) Match(task models.Task) bool {
+	if len(f.Tags) > 0 {
+		found := false
+	tagLoop:
+		for _, want := range f.Tags {
+			for _, tag := range task.Tags {
+				if tag == want {
+					found = true
+					break tagLoop
+				}
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if f.DueFrom != nil && (task.Due.IsZero() || task.Due.Before(*f.DueFrom)) {
+		return false
+	}
+	if f.DueTo != nil && (task.Due.IsZero() || task.Due.After(*f.DueTo)) {
+		return false
+	}
+	return true
+}
+
+// RequestTask it's a task in create command.
+type RequestTask struct {
+	Text      string    `json:"text"`
+	Tags      []string  `json:"tags"`
+	Due       time.Time `json:"due"`
+	RRule     string    `json:"rrule"`
+	ParentId  int       `json:"parentId"`
+	ProjectId int       `json:"projectId"`
+}
+
+// inMessage it's a message from client.
+type inMessage struct {
+	Type      string       `json:"type"`
+	Id        string       `json:"id,omitempty"`
+	RequestId string       `json:"requestId,omitempty"`
+	Filter    Filter       `json:"filter"`
+	Task      *RequestTask `json:"task,omitempty"`
+	TaskId    int          `json:"taskId,omitempty"`
+}
+
+// outMessage it's a message to client.
+type outMessage struct {
+	Type          string        `json:"type"`
+	Id            string        `json:"id,omitempty"`
+	RequestId     string        `json:"requestId,omitempty"`
+	Subscriptions []string      `json:"subscriptions,omitempty"`
+	Event         *events.Event `json:"event,omitempty"`
+	Task          *models.Task  `json:"task,omitempty"`
+	Error         string        `json:"error,omitempty"`
+}
+
+// session it's a state of one client connection.
+type session struct {
+	conn    Conn
+	store   models.Repository
+	visible func(models.Task) bool // filter of events of tasks which client sees, nil for all
+	send    chan outMessage
+	done    chan struct{}
+	once    sync.Once
+
+	mu            sync.Mutex
+	subscriptions map[string]Filter
+}
+
+// Serve runs session of client connection until it's closed, connection is closed on return.
+// A client which doesn't read messages fast enough to keep bounded buffers from overflow is disconnected.
+// Client receives events of tasks accepted by visible, nil visible accepts all tasks.
+func Serve(conn Conn, store models.Repository, bus *events.Bus, visible func(models.Task) bool) {
+	s := &session{
+		conn:          conn,
+		store:         store,
+		visible:       visible,
+		send:          make(chan outMessage, sendBuffer),
+		done:          make(chan struct{}),
+		subscriptions: make(map[string]Filter),
+	}
+	sub := bus.Subscribe(eventBuffer)
+	defer sub.Close()
+
+	go s.writeLoop()
+	go s.eventLoop(sub)
+	s.readLoop()
+	s.close()
+}
+
+// close stops session once, close message is sent to client before closing of connection.
+func (s *session) close() {
+	s.once.Do(func() {
+		close(s.done)
+		_ = s.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(writeWait))
+		_ = s.conn.Close()
+	})
+}
+
+// enqueue puts message into send buffer, slow client is disconnected when buffer is full.
+func (s *session) enqueue(msg outMessage) {
+	select {
+	case s.send <- msg:
+	case <-s.done:
+	default:
+		log.Println("websocket client is too slow, disconnect")
+		s.close()
+	}
+}
+
+// readLoop reads and handles commands of client.
+func (s *session) readLoop() {
+	s.conn.SetReadLimit(maxMessageSize)
+	_ = s.conn.SetReadDeadline(time.Now().Add(pongWait))
+	s.conn.SetPongHandler(func(string) error {
+		return s.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		var msg inMessage
+		if err := s.conn.ReadJSON(&msg); err != nil {
+			// Client has closed connection or sent malformed message.
+			return
+		}
+		s.handle(msg)
+	}
+}
+
+// handle executes one command of client.
+func (s *session) handle(msg inMessage) {
+	switch msg.Type {
+	case "subscribe":
+		if msg.Id == "" {
+			s.enqueue(outMessage{Type: "error", Error: "subscribe expects id"})
+			return
+		}
+		s.mu.Lock()
+		s.subscriptions[msg.Id] = msg.Filter
+		s.mu.Unlock()
+		s.enqueue(outMessage{Type: "subscribed", Id: msg.Id})
+	case "unsubscribe":
+		s.mu.Lock()
+		delete(s.subscriptions, msg.Id)
+		s.mu.Unlock()
+		s.enqueue(outMessage{Type: "unsubscribed", Id: msg.Id})
+	case "create":
+		if msg.Task == nil {
+			s.enqueue(outMessage{Type: "error", RequestId: msg.RequestId, Error: "create expects task"})
+			return
+		}
+		if err := recurrence.Validate(msg.Task.RRule, msg.Task.Due); err != nil {
+			s.enqueue(outMessage{Type: "error", RequestId: msg.RequestId, Error: err.Error()})
+			return
+		}
+		if msg.Task.ParentId != 0 {
+			if _, err := s.store.GetTask(msg.Task.ParentId); err != nil {
+				s.enqueue(outMessage{Type: "error", RequestId: msg.RequestId, Error: "parent " + err.Error()})
+				return
+			}
+		}
+		if msg.Task.ProjectId != 0 {
+			if _, err := s.store.GetProject(msg.Task.ProjectId); err != nil {
+				s.enqueue(outMessage{Type: "error", RequestId: msg.RequestId, Error: err.Error()})
+				return
+			}
+		}
+		id, err := s.store.CreateTask(models.Task{Text: msg.Task.Text, Tags: msg.Task.Tags, Due: msg.Task.Due, RRule: msg.Task.RRule, ParentId: msg.Task.ParentId, ProjectId: msg.Task.ProjectId})
+		if err != nil {
+			s.enqueue(outMessage{Type: "error", RequestId: msg.RequestId, Error: err.Error()})
+			return
+		}
+		task, err := s.store.GetTask(id)
+		if err != nil {
+			s.enqueue(outMessage{Type: "error", RequestId: msg.RequestId, Error: err.Error()})
+			return
+		}
+		s.enqueue(outMessage{Type: "result", RequestId: msg.RequestId, Task: &task})
+	case "delete":
+		if err := s.store.TrashTask(msg.TaskId); err != nil {
+			s.enqueue(outMessage{Type: "error", RequestId: msg.RequestId, Error: err.Error()})
+			return
+		}
+		s.enqueue(outMessage{Type: "result", RequestId: msg.RequestId})
+	default:
+		s.enqueue(outMessage{Type: "error", RequestId: msg.RequestId, Error: fmt.Sprintf("unknown message type %q", msg.Type)})
+	}
+}
+
+// eventLoop sends events matching subscriptions of client.
+func (s *session) eventLoop(sub *events.Subscription) {
+	for {
+		select {
+		case <-s.done:
+			return
+		case e, ok := <-sub.C:
+			if !ok {
+				log.Println("websocket client is too slow to receive events, disconnect")
+				s.close()
+				return
+			}
+			if s.visible != nil && !s.visible(e.Task) {
+				continue
+			}
+			if ids := s.match(e); len(ids) > 0 {
+				s.enqueue(outMessage{Type: "event", Subscriptions: ids, Event: &e})
+			}
+		}
+	}
+}
+
+// match returns sorted ids of subscriptions matching event, cleared event matches all subscriptions.
+func (s *session) match(e events.Event) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var ids []string
+	for id, filter := range s.subscriptions {
+		if e.Type == events.Cleared || filter.Match(e.Task) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// writeLoop writes messages to client and pings it.
+func (s *session) writeLoop() {
+	ticker := time.NewTicker(pingPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case msg := <-s.send:
+			_ = s.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := s.conn.WriteJSON(msg); err != nil {
+				s.close()
+				return
+			}
+		case <-ticker.C:
+			if err := s.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait)); err != nil {
+				s.close()
+				return
+			}
+		}
+	}
+}
+
+// upgrader upgrades HTTP connections, only same origin requests are allowed.
+var upgrader = websocket.Upgrader{ReadBufferSize: 1024, WriteBufferSize: 1024}
+
+// Handler returns handler of WebSocket endpoint for net/http based servers, client works with tasks
+// of principal of upgrade request.
+func Handler(store models.Repository, bus *events.Bus, users *auth.Users) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		principal, err := users.AuthenticateRequest(req)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", auth.Challenge)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		conn, err := upgrader.Upgrade(w, req, nil)
+		if err != nil {
+			// Upgrader has already replied with error.
+			return
+		}
+		Serve(conn, users.Repository(store, principal), bus, users.Visible(principal))
+	})
+}
@@ -0,0 +1,117 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"github.com/White-AK111/REST/internal/jwt"
+	"github.com/gin-gonic/gin"
+	"github.com/valyala/fasthttp"
+	"net/http"
+	"strings"
+)
+
+// claimsValue it's a key of claims in user values of fasthttp request.
+const claimsValue = "jwt.claims"
+
+// challenge returns value of WWW-Authenticate header of response to request with invalid token (RFC 6750).
+func challenge(err error) string {
+	if errors.Is(err, jwt.ErrMissing) {
+		return `Bearer realm="tasks"`
+	}
+	return fmt.Sprintf(`Bearer realm="tasks", error="invalid_token", error_description=%q`, strings.ReplaceAll(err.Error(), `"`, `'`))
+}
+
+// verify returns claims of bearer token of authorization header, nil claims without error if token is accepted
+// by local authentication (e.g. static tokens of users), which is checked by handlers.
+func verify(v *jwt.Verifier, local func(token string) bool, authorization string) (jwt.Claims, error) {
+	token := jwt.Bearer(authorization)
+	if token != "" && local != nil && local(token) {
+		return nil, nil
+	}
+	return v.Verify(token)
+}
+
+// JWT returns middleware for net/http, e.g. stdlib and gorilla routers, which rejects requests without valid
+// JWT bearer token and passes claims of token to next handler in context of request, see jwt.ClaimsFrom. Tokens
+// reported by local are passed without claims, nil verifier passes all requests.
+func JWT(v *jwt.Verifier, local func(token string) bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if v == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			claims, err := verify(v, local, req.Header.Get("Authorization"))
+			if err != nil {
+				w.Header().Set("WWW-Authenticate", challenge(err))
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+			if claims != nil {
+				req = req.WithContext(jwt.WithClaims(req.Context(), claims))
+			}
+			next.ServeHTTP(w, req)
+		})
+	}
+}
+
+// JWTGin returns gin middleware which rejects requests without valid JWT bearer token and passes claims of token
+// to next handlers in context of request, see jwt.ClaimsFrom. Tokens reported by local are passed without claims,
+// nil verifier passes all requests.
+func JWTGin(v *jwt.Verifier, local func(token string) bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if v == nil {
+			c.Next()
+			return
+		}
+		claims, err := verify(v, local, c.GetHeader("Authorization"))
+		if err != nil {
+			c.Header("WWW-Authenticate", challenge(err))
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		if claims != nil {
+			c.Request = c.Request.WithContext(jwt.WithClaims(c.Request.Context(), claims))
+		}
+		c.Next()
+	}
+}
+
+// JWTFast middleware for fasthttp which rejects requests without valid JWT bearer token and passes claims
+// of token to next handler in user values of request, see ClaimsFast. Tokens reported by local are passed without
+// claims, nil verifier passes all requests.
+func JWTFast(v *jwt.Verifier, local func(token string) bool, next fasthttp.RequestHandler) fasthttp.RequestHandler {
+	if v == nil {
+		return next
+	}
+	return func(ctx *fasthttp.RequestCtx) {
+		claims, err := verify(v, local, string(ctx.Request.Header.Peek("Authorization")))
+		if err != nil {
+			ctx.Response.Header.Set("WWW-Authenticate", challenge(err))
+			ctx.Error(err.Error(), http.StatusUnauthorized)
+			return
+		}
+		if claims != nil {
+			ctx.SetUserValue(claimsValue, claims)
+		}
+		next(ctx)
+	}
+}
+
+// ClaimsFast returns claims of token verified by JWTFast.
+func ClaimsFast(ctx *fasthttp.RequestCtx) (jwt.Claims, bool) {
+	claims, ok := ctx.UserValue(claimsValue).(jwt.Claims)
+	return claims, ok
+}
+
+// ClaimsAdapted passes claims of token verified by JWTFast to net/http handler adapted by fasthttpadaptor in context
+// of request, see jwt.ClaimsFrom.
+func ClaimsAdapted(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if ctx, ok := req.Context().(*fasthttp.RequestCtx); ok {
+			if claims, ok := ClaimsFast(ctx); ok {
+				req = req.WithContext(jwt.WithClaims(req.Context(), claims))
+			}
+		}
+		next.ServeHTTP(w, req)
+	})
+}
@@ -2,12 +2,30 @@
 package stdlib_http
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/White-AK111/REST/config"
+	grpcApi "github.com/White-AK111/REST/grpc-api"
+	"github.com/White-AK111/REST/internal/attachment"
+	"github.com/White-AK111/REST/internal/auth"
+	"github.com/White-AK111/REST/internal/bulk"
+	"github.com/White-AK111/REST/internal/codec"
+	"github.com/White-AK111/REST/internal/events"
+	"github.com/White-AK111/REST/internal/gql"
+	"github.com/White-AK111/REST/internal/ical"
 	"github.com/White-AK111/REST/internal/models"
 	"github.com/White-AK111/REST/internal/models/inmemory"
+	"github.com/White-AK111/REST/internal/oidc"
+	"github.com/White-AK111/REST/internal/ownership"
+	"github.com/White-AK111/REST/internal/recurrence"
+	"github.com/White-AK111/REST/internal/session"
+	"github.com/White-AK111/REST/internal/tenant"
+	"github.com/White-AK111/REST/internal/transfer"
+	"github.com/White-AK111/REST/internal/trash"
+	"github.com/White-AK111/REST/internal/webhook"
+	"github.com/White-AK111/REST/internal/ws"
 	"github.com/White-AK111/REST/middleware"
+	"log"
 	"mime"
 	"net/http"
 	"strconv"
@@ -17,30 +35,69 @@ import (
 
 // taskServer struct for server of task/
 type taskServer struct {
-	store models.Repository
+	store   models.Repository
+	bus     *events.Bus
+	files   *attachment.Attachments
+	trash   *trash.Trash
+	guard   *bulk.Guard
+	users   *auth.Users
+	tenants *tenant.Tenants
+
+	principal string         // authenticated user of request
+	tenant    *tenant.Tenant // tenant of request
 }
 
-// NewTaskServerInmemory function initialize a new taskServer.
-func NewTaskServerInmemory() *taskServer {
-	store := inmemory.NewStorage()
-	return &taskServer{store: store}
+// NewTaskServerInmemory function initialize a new taskServer, tenants serve tasks of each tenant by own in-memory
+// storage, policy defines deleting and completing of tasks having open subtasks, content of attachments of default
+// tenant is kept by files, bin purges deleted tasks and permits hard delete, guard confirms bulk delete, users
+// authenticate requests.
+func NewTaskServerInmemory(policy models.SubtaskPolicy, files *attachment.Attachments, bin *trash.Trash, guard *bulk.Guard, users *auth.Users, tenants *tenant.Tenants) (*taskServer, error) {
+	t, err := tenants.Open(files, func() models.Repository { return inmemory.NewStorage(policy) })
+	if err != nil {
+		return nil, err
+	}
+	return &taskServer{store: t.Store(), bus: t.Bus(), files: files, trash: bin, guard: guard, users: users, tenants: tenants}, nil
 }
 
-// renderJSON renders 'v' as JSON and writes it as a response into w.
-func renderJSON(w http.ResponseWriter, v interface{}) {
-	js, err := json.Marshal(v)
+// render renders 'v' in format negotiated by Accept header of req and writes it as a response into w.
+func render(w http.ResponseWriter, req *http.Request, v interface{}) {
+	enc, err := codec.Negotiate(req.Header.Get("Accept"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotAcceptable)
+		return
+	}
+	data, err := enc.Marshal(v)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-	_, err = w.Write(js)
+	w.Header().Set("Content-Type", enc.ContentType())
+	_, err = w.Write(data)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 }
 
+// decodeBody decodes request body into 'v' by Content-Type of req. On error writes response and returns false.
+func decodeBody(w http.ResponseWriter, req *http.Request, v interface{}) bool {
+	dec, err := codec.ForContentType(req.Header.Get("Content-Type"))
+	if errors.Is(err, codec.ErrUnsupportedMediaType) {
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+
+	if err = dec.Decode(req.Body, v); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
 // taskHandler handler for "task" path.
 func (ts *taskServer) taskHandler(w http.ResponseWriter, req *http.Request) {
 	if req.URL.Path == "/task/" {
@@ -69,6 +126,142 @@ func (ts *taskServer) taskHandler(w http.ResponseWriter, req *http.Request) {
 			return
 		}
 
+		if len(pathParts) == 3 && pathParts[2] == "complete" {
+			// Request is "/task/<id>/complete".
+			if req.Method != http.MethodPost {
+				http.Error(w, fmt.Sprintf("expect method POST at /task/<id>/complete, got %v", req.Method), http.StatusMethodNotAllowed)
+				return
+			}
+			ts.completeTaskHandler(w, req, id)
+			return
+		}
+
+		if len(pathParts) == 3 && pathParts[2] == "restore" {
+			// Request is "/task/<id>/restore".
+			if req.Method != http.MethodPost {
+				http.Error(w, fmt.Sprintf("expect method POST at /task/<id>/restore, got %v", req.Method), http.StatusMethodNotAllowed)
+				return
+			}
+			ts.restoreTaskHandler(w, req, id)
+			return
+		}
+
+		if len(pathParts) == 3 && pathParts[2] == "children" {
+			// Request is "/task/<id>/children".
+			if req.Method != http.MethodGet {
+				http.Error(w, fmt.Sprintf("expect method GET at /task/<id>/children, got %v", req.Method), http.StatusMethodNotAllowed)
+				return
+			}
+			ts.childrenHandler(w, req, id)
+			return
+		}
+
+		if len(pathParts) == 3 && pathParts[2] == "dependencies" {
+			// Request is "/task/<id>/dependencies".
+			if req.Method != http.MethodPost {
+				http.Error(w, fmt.Sprintf("expect method POST at /task/<id>/dependencies, got %v", req.Method), http.StatusMethodNotAllowed)
+				return
+			}
+			ts.addDependenciesHandler(w, req, id)
+			return
+		}
+
+		if len(pathParts) == 4 && pathParts[2] == "dependencies" {
+			// Request is "/task/<id>/dependencies/<blocker id>".
+			if req.Method != http.MethodDelete {
+				http.Error(w, fmt.Sprintf("expect method DELETE at /task/<id>/dependencies/<id>, got %v", req.Method), http.StatusMethodNotAllowed)
+				return
+			}
+			blocker, err := strconv.Atoi(pathParts[3])
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			ts.removeDependencyHandler(w, req, id, blocker)
+			return
+		}
+
+		if len(pathParts) == 3 && pathParts[2] == "parent" {
+			// Request is "/task/<id>/parent".
+			if req.Method != http.MethodPut {
+				http.Error(w, fmt.Sprintf("expect method PUT at /task/<id>/parent, got %v", req.Method), http.StatusMethodNotAllowed)
+				return
+			}
+			ts.setParentHandler(w, req, id)
+			return
+		}
+
+		if len(pathParts) == 3 && pathParts[2] == "shares" {
+			// Request is "/task/<id>/shares".
+			if req.Method != http.MethodPut {
+				http.Error(w, fmt.Sprintf("expect method PUT at /task/<id>/shares, got %v", req.Method), http.StatusMethodNotAllowed)
+				return
+			}
+			ts.shareTaskHandler(w, req, id)
+			return
+		}
+
+		if len(pathParts) == 3 && pathParts[2] == "comments" {
+			// Request is "/task/<id>/comments".
+			if req.Method == http.MethodGet {
+				ts.commentsHandler(w, req, id)
+			} else if req.Method == http.MethodPost {
+				ts.addCommentHandler(w, req, id)
+			} else {
+				http.Error(w, fmt.Sprintf("expect method GET or POST at /task/<id>/comments, got %v", req.Method), http.StatusMethodNotAllowed)
+			}
+			return
+		}
+
+		if len(pathParts) == 3 && pathParts[2] == "activity" {
+			// Request is "/task/<id>/activity".
+			if req.Method != http.MethodGet {
+				http.Error(w, fmt.Sprintf("expect method GET at /task/<id>/activity, got %v", req.Method), http.StatusMethodNotAllowed)
+				return
+			}
+			ts.activityHandler(w, req, id)
+			return
+		}
+
+		if len(pathParts) == 3 && pathParts[2] == "attachments" {
+			// Request is "/task/<id>/attachments".
+			if req.Method == http.MethodGet {
+				ts.attachmentsHandler(w, req, id)
+			} else if req.Method == http.MethodPost {
+				ts.uploadAttachmentHandler(w, req, id)
+			} else {
+				http.Error(w, fmt.Sprintf("expect method GET or POST at /task/<id>/attachments, got %v", req.Method), http.StatusMethodNotAllowed)
+			}
+			return
+		}
+
+		if len(pathParts) == 4 && pathParts[2] == "attachments" {
+			// Request is "/task/<id>/attachments/<attachment id>".
+			attachmentId, err := strconv.Atoi(pathParts[3])
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if req.Method == http.MethodGet {
+				ts.getAttachmentHandler(w, req, id, attachmentId)
+			} else if req.Method == http.MethodDelete {
+				ts.deleteAttachmentHandler(w, req, id, attachmentId)
+			} else {
+				http.Error(w, fmt.Sprintf("expect method GET or DELETE at /task/<id>/attachments/<id>, got %v", req.Method), http.StatusMethodNotAllowed)
+			}
+			return
+		}
+
+		if len(pathParts) == 3 && pathParts[2] == "project" {
+			// Request is "/task/<id>/project".
+			if req.Method != http.MethodPut {
+				http.Error(w, fmt.Sprintf("expect method PUT at /task/<id>/project, got %v", req.Method), http.StatusMethodNotAllowed)
+				return
+			}
+			ts.setProjectHandler(w, req, id)
+			return
+		}
+
 		if req.Method == http.MethodDelete {
 			ts.deleteTaskHandler(w, req, id)
 		} else if req.Method == http.MethodGet {
@@ -84,43 +277,60 @@ func (ts *taskServer) taskHandler(w http.ResponseWriter, req *http.Request) {
 func (ts *taskServer) createTaskHandler(w http.ResponseWriter, req *http.Request) {
 	// Types used internally in this handler to (de-)serialize the request and response from/to JSON.
 	type RequestTask struct {
-		Text string    `json:"text"`
-		Tags []string  `json:"tags"`
-		Due  time.Time `json:"due"`
+		Text      string    `json:"text" xml:"text" yaml:"text"`
+		Tags      []string  `json:"tags" xml:"tags>tag" yaml:"tags"`
+		Due       time.Time `json:"due" xml:"due" yaml:"due"`
+		RRule     string    `json:"rrule" xml:"rrule" yaml:"rrule"`
+		ParentId  int       `json:"parentId" xml:"parentId" yaml:"parentId"`
+		ProjectId int       `json:"projectId" xml:"projectId" yaml:"projectId"`
 	}
 
 	type ResponseId struct {
-		Id int `json:"id"`
+		Id int `json:"id" xml:"id" yaml:"id"`
 	}
 
-	// Enforce a JSON Content-Type.
-	contentType := req.Header.Get("Content-Type")
-	mediaType, _, err := mime.ParseMediaType(contentType)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
-	}
-	if mediaType != "application/json" {
-		http.Error(w, "expect application/json Content-Type", http.StatusUnsupportedMediaType)
+	var rt RequestTask
+	if !decodeBody(w, req, &rt) {
 		return
 	}
 
-	dec := json.NewDecoder(req.Body)
-	dec.DisallowUnknownFields()
-	var rt RequestTask
-	if err := dec.Decode(&rt); err != nil {
+	if err := recurrence.Validate(rt.RRule, rt.Due); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if rt.ParentId != 0 {
+		if _, err := ts.store.GetTask(rt.ParentId); err != nil {
+			http.Error(w, "parent "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if rt.ProjectId != 0 {
+		if _, err := ts.store.GetProject(rt.ProjectId); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
 
-	id := ts.store.CreateTask(rt.Text, rt.Tags, rt.Due)
-	renderJSON(w, ResponseId{Id: id})
+	id, err := ts.store.CreateTask(models.Task{Text: rt.Text, Tags: rt.Tags, Due: rt.Due, RRule: rt.RRule, ParentId: rt.ParentId, ProjectId: rt.ProjectId})
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	render(w, req, ResponseId{Id: id})
 }
 
-// getAllTasksHandler handler for GET method without id.
+// getAllTasksHandler handler for GET method without id, ?order=dependency sorts blockers before tasks blocked by them.
 func (ts *taskServer) getAllTasksHandler(w http.ResponseWriter, req *http.Request) {
 	allTasks := ts.store.GetAllTasks()
-	renderJSON(w, allTasks)
+	switch order := req.URL.Query().Get("order"); order {
+	case "":
+	case "dependency":
+		allTasks = models.OrderByDependency(allTasks)
+	default:
+		http.Error(w, fmt.Sprintf("unknown order %q, expect dependency", order), http.StatusBadRequest)
+		return
+	}
+	render(w, req, allTasks)
 }
 
 // getTaskHandler handler for GET method with id.
@@ -131,42 +341,661 @@ func (ts *taskServer) getTaskHandler(w http.ResponseWriter, req *http.Request, i
 		return
 	}
 
-	renderJSON(w, task)
+	render(w, req, task)
 }
 
-// deleteTaskHandler handler for DELETE method with id.
+// parseHard parses query parameter "hard" and checks permission of actor of request for hard delete.
+// On error writes response and returns false.
+func (ts *taskServer) parseHard(w http.ResponseWriter, req *http.Request) (hard bool, ok bool) {
+	hard, err := trash.ParseHard(req.URL.Query().Get("hard"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false, false
+	}
+	if hard {
+		if err = ts.trash.Permit(ts.principal, ts.users.Enabled()); err != nil {
+			http.Error(w, err.Error(), errorStatus(err))
+			return false, false
+		}
+	}
+	return hard, true
+}
+
+// deleteTaskHandler handler for DELETE method with id, moves task with its subtasks to trash, ?hard=true deletes
+// them permanently.
 func (ts *taskServer) deleteTaskHandler(w http.ResponseWriter, req *http.Request, id int) {
-	err := ts.store.DeleteTask(id)
+	hard, ok := ts.parseHard(w, req)
+	if !ok {
+		return
+	}
+
+	var err error
+	if hard {
+		err = ts.store.DeleteTask(id)
+	} else {
+		err = ts.store.TrashTask(id)
+	}
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+		http.Error(w, err.Error(), errorStatus(err))
+	}
+}
+
+// restoreTaskHandler handler for POST method with id, restores task with its subtasks from trash and responds with it.
+func (ts *taskServer) restoreTaskHandler(w http.ResponseWriter, req *http.Request, id int) {
+	if _, err := ts.store.RestoreTask(id); err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	ts.getTaskHandler(w, req, id)
+}
+
+// trashHandler handler for "trash" path, responds with all tasks in trash.
+func (ts *taskServer) trashHandler(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, fmt.Sprintf("expect method GET /trash, got %v", req.Method), http.StatusMethodNotAllowed)
+		return
+	}
+
+	render(w, req, ts.store.GetTrash())
+}
+
+// completeTaskHandler handler for POST method with id, completes task and responds with the next occurrence of recurring task.
+func (ts *taskServer) completeTaskHandler(w http.ResponseWriter, req *http.Request, id int) {
+	type ResponseNext struct {
+		Next *models.Task `json:"next,omitempty" xml:"next,omitempty" yaml:"next,omitempty"`
+	}
+
+	next, ok, err := recurrence.Complete(ts.store, id)
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	var rn ResponseNext
+	if ok {
+		rn.Next = &next
+	}
+	render(w, req, rn)
+}
+
+// childrenHandler handler for GET method with id, responds with subtasks of task.
+func (ts *taskServer) childrenHandler(w http.ResponseWriter, req *http.Request, id int) {
+	children, err := ts.store.GetChildren(id)
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	render(w, req, children)
+}
+
+// addDependenciesHandler handler for POST method with id, makes task blocked by other tasks: {"blockedBy":[<id>,...]}.
+func (ts *taskServer) addDependenciesHandler(w http.ResponseWriter, req *http.Request, id int) {
+	type RequestDependencies struct {
+		BlockedBy []int `json:"blockedBy" xml:"blockedBy>id" yaml:"blockedBy"`
+	}
+
+	var rd RequestDependencies
+	if !decodeBody(w, req, &rd) {
+		return
+	}
+
+	if err := ts.store.AddDependencies(id, rd.BlockedBy); err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	ts.getTaskHandler(w, req, id)
+}
+
+// removeDependencyHandler handler for DELETE method with id and id of blocker, task isn't blocked by it anymore.
+func (ts *taskServer) removeDependencyHandler(w http.ResponseWriter, req *http.Request, id, blocker int) {
+	if err := ts.store.RemoveDependency(id, blocker); err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	ts.getTaskHandler(w, req, id)
+}
+
+// setParentHandler handler for PUT method with id, moves task under another parent: {"parentId":<id>}, 0 makes it top level.
+func (ts *taskServer) setParentHandler(w http.ResponseWriter, req *http.Request, id int) {
+	type RequestParent struct {
+		ParentId int `json:"parentId" xml:"parentId" yaml:"parentId"`
+	}
+
+	var rp RequestParent
+	if !decodeBody(w, req, &rp) {
+		return
+	}
+
+	task, err := ts.store.GetTask(id)
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	task.ParentId = rp.ParentId
+	if err = ts.store.UpdateTask(task); err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
 	}
+
+	ts.getTaskHandler(w, req, id)
 }
 
-// deleteAllTasksHandler handler for DELETE method without id.
+// setProjectHandler handler for PUT method with id, moves task to another project: {"projectId":<id>}, 0 takes it out of project.
+func (ts *taskServer) setProjectHandler(w http.ResponseWriter, req *http.Request, id int) {
+	type RequestTaskProject struct {
+		ProjectId int `json:"projectId" xml:"projectId" yaml:"projectId"`
+	}
+
+	var rp RequestTaskProject
+	if !decodeBody(w, req, &rp) {
+		return
+	}
+
+	task, err := ts.store.GetTask(id)
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	task.ProjectId = rp.ProjectId
+	if err = ts.store.UpdateTask(task); err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	ts.getTaskHandler(w, req, id)
+}
+
+// shareTaskHandler handler for PUT method with id, replaces users whom task is shared with and responds with task:
+// {"shares":[{"user":"<user>","access":"read|write"}]}.
+func (ts *taskServer) shareTaskHandler(w http.ResponseWriter, req *http.Request, id int) {
+	type RequestShares struct {
+		Shares []models.Share `json:"shares" xml:"shares>share" yaml:"shares"`
+	}
+
+	var rs RequestShares
+	if !decodeBody(w, req, &rs) {
+		return
+	}
+	if err := models.ValidateShares(rs.Shares); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := ts.store.ShareTask(id, rs.Shares); err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	ts.getTaskHandler(w, req, id)
+}
+
+// withActor returns handler which authenticates request and serves it by server of principal of request:
+// changes of tasks are logged in activity log with the principal as actor and tasks are scoped to the principal
+// and to tenant of request.
+func (ts *taskServer) withActor(h func(*taskServer, http.ResponseWriter, *http.Request)) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		principal, err := ts.users.AuthenticateRequest(req)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", auth.Challenge)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		t, err := ts.tenants.Tenant(req.Header.Get(tenant.Header))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		h(&taskServer{store: ts.users.Repository(t.Store(), principal), bus: t.Bus(), files: t.Files(), trash: ts.trash, guard: ts.guard, users: ts.users, tenants: ts.tenants, principal: principal, tenant: t}, w, req)
+	}
+}
+
+// commentsHandler handler for GET method with id, responds with page of comments of task: ?offset=<n>&limit=<n>.
+func (ts *taskServer) commentsHandler(w http.ResponseWriter, req *http.Request, id int) {
+	type ResponseComments struct {
+		Total    int              `json:"total" xml:"total" yaml:"total"`
+		Comments []models.Comment `json:"comments" xml:"comments>comment" yaml:"comments"`
+	}
+
+	offset, limit, err := models.ParsePage(req.URL.Query().Get("offset"), req.URL.Query().Get("limit"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	comments, total, err := ts.store.GetComments(id, offset, limit)
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	render(w, req, ResponseComments{Total: total, Comments: comments})
+}
+
+// addCommentHandler handler for POST method with id, adds comment of actor of request to task: {"text":"<text>"}.
+func (ts *taskServer) addCommentHandler(w http.ResponseWriter, req *http.Request, id int) {
+	type RequestComment struct {
+		Text string `json:"text" xml:"text" yaml:"text"`
+	}
+
+	var rc RequestComment
+	if !decodeBody(w, req, &rc) {
+		return
+	}
+	if strings.TrimSpace(rc.Text) == "" {
+		http.Error(w, "expect text of comment", http.StatusBadRequest)
+		return
+	}
+
+	comment, err := ts.store.AddComment(models.Comment{TaskId: id, Author: ts.principal, Text: rc.Text})
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	render(w, req, comment)
+}
+
+// activityHandler handler for GET method with id, responds with page of activity log of task: ?offset=<n>&limit=<n>.
+func (ts *taskServer) activityHandler(w http.ResponseWriter, req *http.Request, id int) {
+	type ResponseActivity struct {
+		Total    int               `json:"total" xml:"total" yaml:"total"`
+		Activity []models.Activity `json:"activity" xml:"activity>entry" yaml:"activity"`
+	}
+
+	offset, limit, err := models.ParsePage(req.URL.Query().Get("offset"), req.URL.Query().Get("limit"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	entries, total, err := ts.store.GetActivity(id, offset, limit)
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	render(w, req, ResponseActivity{Total: total, Activity: entries})
+}
+
+// attachmentsHandler handler for GET method with id, responds with attachments of task.
+func (ts *taskServer) attachmentsHandler(w http.ResponseWriter, req *http.Request, id int) {
+	attachments, err := ts.store.GetAttachments(id)
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	render(w, req, attachments)
+}
+
+// uploadAttachmentHandler handler for POST method with id, attaches file from field "file" of multipart form to task.
+func (ts *taskServer) uploadAttachmentHandler(w http.ResponseWriter, req *http.Request, id int) {
+	if req.ContentLength > ts.files.MaxBodySize() {
+		http.Error(w, attachment.ErrTooLarge.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	req.Body = http.MaxBytesReader(w, req.Body, ts.files.MaxBodySize())
+	file, header, err := req.FormFile(attachment.Field)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("expect file in field %q of multipart form: %s", attachment.Field, err), http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	uploaded, err := ts.files.Upload(ts.store, id, header.Filename, header.Size, file)
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	render(w, req, uploaded)
+}
+
+// getAttachmentHandler handler for GET method with id of task and attachment, responds with content of attachment,
+// Range requests are supported.
+func (ts *taskServer) getAttachmentHandler(w http.ResponseWriter, req *http.Request, id, attachmentId int) {
+	attached, content, err := ts.files.Open(ts.store, id, attachmentId)
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	defer content.Close()
+
+	w.Header().Set("Content-Type", attached.ContentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": attached.Name}))
+	http.ServeContent(w, req, attached.Name, attached.Time, content)
+}
+
+// deleteAttachmentHandler handler for DELETE method with id of task and attachment.
+func (ts *taskServer) deleteAttachmentHandler(w http.ResponseWriter, req *http.Request, id, attachmentId int) {
+	if err := ts.files.Delete(ts.store, id, attachmentId); err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+	}
+}
+
+// deleteAllTasksHandler handler for DELETE method without id, moves tasks selected by ?tag=<tag>&due=<date>
+// to trash, all tasks without filter, ?hard=true deletes them permanently. Request with ?dryRun=true responds
+// with tasks to be deleted and confirmation token, they are deleted by request with the same filter and
+// ?confirm=<token>.
 func (ts *taskServer) deleteAllTasksHandler(w http.ResponseWriter, req *http.Request) {
-	err := ts.store.DeleteAllTasks()
+	hard, ok := ts.parseHard(w, req)
+	if !ok {
+		return
+	}
+	query := req.URL.Query()
+	filter := bulk.Filter{Tag: query.Get("tag"), Due: query.Get("due"), Hard: hard}
+	if filter.Tag != "" && query.Get("recursive") == "true" {
+		filter.Tag = models.TagTree(filter.Tag)
+	}
+	if ts.users.Enabled() {
+		filter.Owner = ts.principal
+	}
+
+	if query.Get("dryRun") == "true" {
+		preview, err := ts.guard.DryRun(ts.store, filter)
+		if err != nil {
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+		render(w, req, preview)
+		return
+	}
+
+	result, err := ts.guard.Delete(ts.store, filter, query.Get("confirm"))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+		http.Error(w, err.Error(), errorStatus(err))
+		return
 	}
+	render(w, req, result)
 }
 
 // tagHandler handler for "tag" path.
 func (ts *taskServer) tagHandler(w http.ResponseWriter, req *http.Request) {
-	if req.Method != http.MethodGet {
-		http.Error(w, fmt.Sprintf("expect method GET /tag/<tag>, got %v", req.Method), http.StatusMethodNotAllowed)
+	if req.URL.Path == "/tag/" {
+		// Request is plain "/tag/", without trailing tag.
+		if req.Method != http.MethodGet {
+			http.Error(w, fmt.Sprintf("expect method GET at /tag/, got %v", req.Method), http.StatusMethodNotAllowed)
+			return
+		}
+		ts.getAllTagsHandler(w, req)
 		return
 	}
 
+	// Hierarchical tag takes the rest of path, like "work/backend/api".
 	path := strings.Trim(req.URL.Path, "/")
-	pathParts := strings.Split(path, "/")
+	pathParts := strings.SplitN(path, "/", 2)
 	if len(pathParts) < 2 {
 		http.Error(w, "expect /tag/<tag> path", http.StatusBadRequest)
 		return
 	}
 	tag := pathParts[1]
 
-	tasks := ts.store.GetTasksByTag(tag)
-	renderJSON(w, tasks)
+	if tag == "merge" && req.Method == http.MethodPost {
+		ts.mergeTagsHandler(w, req)
+		return
+	}
+
+	if req.Method == http.MethodGet {
+		if req.URL.Query().Get("recursive") == "true" {
+			tag = models.TagTree(tag)
+		}
+		tasks := ts.store.GetTasksByTag(tag)
+		render(w, req, tasks)
+	} else if req.Method == http.MethodPut {
+		ts.renameTagHandler(w, req, tag)
+	} else if req.Method == http.MethodDelete {
+		ts.deleteTagHandler(w, req, tag)
+	} else {
+		http.Error(w, fmt.Sprintf("expect method GET, PUT or DELETE at /tag/<tag>, got %v", req.Method), http.StatusMethodNotAllowed)
+	}
+}
+
+// ResponseUpdated it's a response with ids of tasks changed by tag operation.
+type ResponseUpdated struct {
+	Updated []int `json:"updated" xml:"updated>id" yaml:"updated"`
+}
+
+// errorStatus returns HTTP status code of error of repository operation.
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, models.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, models.ErrConflict), errors.Is(err, models.ErrHasSubtasks), errors.Is(err, models.ErrCycle),
+		errors.Is(err, models.ErrBlocked):
+		return http.StatusConflict
+	case errors.Is(err, trash.ErrForbidden), errors.Is(err, bulk.ErrDisabled), errors.Is(err, ownership.ErrForbidden),
+		errors.Is(err, tenant.ErrQuota):
+		return http.StatusForbidden
+	case errors.Is(err, bulk.ErrBadFilter):
+		return http.StatusBadRequest
+	case errors.Is(err, bulk.ErrNoToken):
+		return http.StatusPreconditionRequired
+	case errors.Is(err, bulk.ErrInvalidToken):
+		return http.StatusPreconditionFailed
+	case errors.Is(err, attachment.ErrTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, attachment.ErrUnsupportedType):
+		return http.StatusUnsupportedMediaType
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// renderUpdated renders ids of changed tasks or writes error of tag operation.
+func renderUpdated(w http.ResponseWriter, req *http.Request, ids []int, err error) {
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	if ids == nil {
+		ids = []int{}
+	}
+	render(w, req, ResponseUpdated{Updated: ids})
+}
+
+// getAllTagsHandler handler for GET method without tag, lists all tags with counts of tasks.
+func (ts *taskServer) getAllTagsHandler(w http.ResponseWriter, req *http.Request) {
+	tags := ts.store.GetAllTags()
+	render(w, req, tags)
+}
+
+// renameTagHandler handler for PUT method with tag, renames tag in all tasks: {"name":"<new tag>"}.
+func (ts *taskServer) renameTagHandler(w http.ResponseWriter, req *http.Request, tag string) {
+	type RequestRename struct {
+		Name string `json:"name" xml:"name" yaml:"name"`
+	}
+
+	var rr RequestRename
+	if !decodeBody(w, req, &rr) {
+		return
+	}
+	if rr.Name == "" {
+		http.Error(w, "expect new name of tag", http.StatusBadRequest)
+		return
+	}
+
+	ids, err := ts.store.RenameTag(tag, rr.Name)
+	renderUpdated(w, req, ids, err)
+}
+
+// deleteTagHandler handler for DELETE method with tag, strips tag from all tasks.
+func (ts *taskServer) deleteTagHandler(w http.ResponseWriter, req *http.Request, tag string) {
+	ids, err := ts.store.DeleteTag(tag)
+	renderUpdated(w, req, ids, err)
+}
+
+// mergeTagsHandler handler for POST method at "tag/merge", replaces tags by one tag: {"tags":["a","b"],"into":"c"}.
+func (ts *taskServer) mergeTagsHandler(w http.ResponseWriter, req *http.Request) {
+	type RequestMerge struct {
+		Tags []string `json:"tags" xml:"tags>tag" yaml:"tags"`
+		Into string   `json:"into" xml:"into" yaml:"into"`
+	}
+
+	var rm RequestMerge
+	if !decodeBody(w, req, &rm) {
+		return
+	}
+	if len(rm.Tags) == 0 || rm.Into == "" {
+		http.Error(w, "expect tags to merge and target tag 'into'", http.StatusBadRequest)
+		return
+	}
+
+	ids, err := ts.store.MergeTags(rm.Tags, rm.Into)
+	renderUpdated(w, req, ids, err)
+}
+
+// RequestProject it's a request to create or to update project.
+type RequestProject struct {
+	Name     string `json:"name" xml:"name" yaml:"name"`
+	Archived bool   `json:"archived" xml:"archived" yaml:"archived"`
+}
+
+// projectHandler handler for "project" path.
+func (ts *taskServer) projectHandler(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path == "/project/" {
+		// Request is plain "/project/", without trailing ID.
+		if req.Method == http.MethodPost {
+			ts.createProjectHandler(w, req)
+		} else if req.Method == http.MethodGet {
+			ts.getAllProjectsHandler(w, req)
+		} else {
+			http.Error(w, fmt.Sprintf("expect method GET or POST at /project/, got %v", req.Method), http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	// Request has an ID, as in "/project/<id>".
+	path := strings.Trim(req.URL.Path, "/")
+	pathParts := strings.Split(path, "/")
+	id, err := strconv.Atoi(pathParts[1])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if len(pathParts) == 3 && pathParts[2] == "task" {
+		// Request is "/project/<id>/task/".
+		if req.Method != http.MethodGet {
+			http.Error(w, fmt.Sprintf("expect method GET at /project/<id>/task/, got %v", req.Method), http.StatusMethodNotAllowed)
+			return
+		}
+		ts.projectTasksHandler(w, req, id)
+		return
+	}
+	if len(pathParts) != 2 {
+		http.Error(w, "expect /project/<id> or /project/<id>/task/ path", http.StatusBadRequest)
+		return
+	}
+
+	if req.Method == http.MethodGet {
+		ts.getProjectHandler(w, req, id)
+	} else if req.Method == http.MethodPut {
+		ts.updateProjectHandler(w, req, id)
+	} else if req.Method == http.MethodDelete {
+		ts.deleteProjectHandler(w, req, id)
+	} else {
+		http.Error(w, fmt.Sprintf("expect method GET, PUT or DELETE at /project/<id>, got %v", req.Method), http.StatusMethodNotAllowed)
+	}
+}
+
+// createProjectHandler handler for POST method do create project: {"name":"<name>"}.
+func (ts *taskServer) createProjectHandler(w http.ResponseWriter, req *http.Request) {
+	type ResponseId struct {
+		Id int `json:"id" xml:"id" yaml:"id"`
+	}
+
+	var rp RequestProject
+	if !decodeBody(w, req, &rp) {
+		return
+	}
+	if rp.Name == "" {
+		http.Error(w, "expect name of project", http.StatusBadRequest)
+		return
+	}
+
+	id := ts.store.CreateProject(models.Project{Name: rp.Name, Archived: rp.Archived})
+	render(w, req, ResponseId{Id: id})
+}
+
+// getAllProjectsHandler handler for GET method without id, lists all projects.
+func (ts *taskServer) getAllProjectsHandler(w http.ResponseWriter, req *http.Request) {
+	projects := ts.store.GetAllProjects()
+	render(w, req, projects)
+}
+
+// getProjectHandler handler for GET method with id.
+func (ts *taskServer) getProjectHandler(w http.ResponseWriter, req *http.Request, id int) {
+	project, err := ts.store.GetProject(id)
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	render(w, req, project)
+}
+
+// updateProjectHandler handler for PUT method with id, renames and archives project: {"name":"<name>","archived":true}.
+func (ts *taskServer) updateProjectHandler(w http.ResponseWriter, req *http.Request, id int) {
+	var rp RequestProject
+	if !decodeBody(w, req, &rp) {
+		return
+	}
+	if rp.Name == "" {
+		http.Error(w, "expect name of project", http.StatusBadRequest)
+		return
+	}
+
+	if err := ts.store.UpdateProject(models.Project{Id: id, Name: rp.Name, Archived: rp.Archived}); err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	ts.getProjectHandler(w, req, id)
+}
+
+// deleteProjectHandler handler for DELETE method with id, tasks of project stay without project.
+func (ts *taskServer) deleteProjectHandler(w http.ResponseWriter, req *http.Request, id int) {
+	ids, err := ts.store.DeleteProject(id)
+	renderUpdated(w, req, ids, err)
+}
+
+// projectTasksHandler handler for GET method with id of project, lists tasks of project, also of archived one.
+// Tasks are filtered by tag pattern with ?tag=<tag>[&recursive=true] or by due date with ?due=<yyyy-mm-dd>.
+func (ts *taskServer) projectTasksHandler(w http.ResponseWriter, req *http.Request, id int) {
+	query := req.URL.Query()
+	tag, due := query.Get("tag"), query.Get("due")
+
+	var (
+		tasks []models.Task
+		err   error
+	)
+	switch {
+	case tag != "" && due != "":
+		http.Error(w, "expect only one of 'tag' and 'due'", http.StatusBadRequest)
+		return
+	case tag != "":
+		if query.Get("recursive") == "true" {
+			tag = models.TagTree(tag)
+		}
+		tasks, err = ts.store.GetProjectTasksByTag(id, tag)
+	case due != "":
+		date, parseErr := time.Parse(models.DateLayout, due)
+		if parseErr != nil {
+			http.Error(w, fmt.Sprintf("bad 'due': %s", parseErr), http.StatusBadRequest)
+			return
+		}
+		tasks, err = ts.store.GetProjectTasksByDueDate(id, date.Year(), date.Month(), date.Day())
+	default:
+		tasks, err = ts.store.GetProjectTasks(id)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	render(w, req, tasks)
 }
 
 // dueHandler handler for "due" path.
@@ -178,6 +1007,11 @@ func (ts *taskServer) dueHandler(w http.ResponseWriter, req *http.Request) {
 
 	path := strings.Trim(req.URL.Path, "/")
 	pathParts := strings.Split(path, "/")
+	if len(pathParts) == 1 {
+		// Request is plain "/due/", with range in query.
+		ts.dueRangeHandler(w, req)
+		return
+	}
 
 	badRequestError := func() {
 		http.Error(w, fmt.Sprintf("expect /due/<year>/<month>/<day>, got %v", req.URL.Path), http.StatusBadRequest)
@@ -188,7 +1022,7 @@ func (ts *taskServer) dueHandler(w http.ResponseWriter, req *http.Request) {
 	}
 
 	year, err := strconv.Atoi(pathParts[1])
-	if err != nil {
+	if err != nil || year < models.MinYear || year > models.MaxYear {
 		badRequestError()
 		return
 	}
@@ -204,30 +1038,224 @@ func (ts *taskServer) dueHandler(w http.ResponseWriter, req *http.Request) {
 	}
 
 	tasks := ts.store.GetTasksByDueDate(year, time.Month(month), day)
-	renderJSON(w, tasks)
+	render(w, req, tasks)
+}
+
+// dueRangeHandler handler for "due" path with range of due dates in RFC 3339 format: /due/?from=<time>&to=<time>.
+func (ts *taskServer) dueRangeHandler(w http.ResponseWriter, req *http.Request) {
+	from, err := time.Parse(time.RFC3339, req.URL.Query().Get("from"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("bad 'from': %s", err), http.StatusBadRequest)
+		return
+	}
+	to, err := time.Parse(time.RFC3339, req.URL.Query().Get("to"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("bad 'to': %s", err), http.StatusBadRequest)
+		return
+	}
+	if to.Before(from) {
+		http.Error(w, "'to' must not be before 'from'", http.StatusBadRequest)
+		return
+	}
+
+	tasks := ts.store.GetTasksByDueRange(from, to)
+	render(w, req, tasks)
+}
+
+// searchHandler handler for "search" path, full-text search over text and tags of tasks: /search?q=<words>.
+func (ts *taskServer) searchHandler(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, fmt.Sprintf("expect method GET at /search, got %v", req.Method), http.StatusMethodNotAllowed)
+		return
+	}
+	query := req.URL.Query().Get("q")
+	if strings.TrimSpace(query) == "" {
+		http.Error(w, "expect search query 'q'", http.StatusBadRequest)
+		return
+	}
+
+	tasks := ts.store.SearchTasks(query)
+	render(w, req, tasks)
+}
+
+// exportHandler handler for "export" path, streams all tasks in format from query parameter.
+func (ts *taskServer) exportHandler(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, fmt.Sprintf("expect method GET /export, got %v", req.Method), http.StatusMethodNotAllowed)
+		return
+	}
+
+	format, err := transfer.ParseFormat(req.URL.Query().Get("format"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", format.FileName()))
+	if err = transfer.Export(w, ts.store, format); err != nil {
+		log.Printf("error on export tasks: %s", err)
+	}
+}
+
+// importHandler handler for "import" path, loads tasks from request body.
+func (ts *taskServer) importHandler(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, fmt.Sprintf("expect method POST /import, got %v", req.Method), http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := req.URL.Query()
+	format, opts, err := transfer.ParseImportParams(query.Get("format"), req.Header.Get("Content-Type"), query.Get("preserveIds"), query.Get("onConflict"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tasks, err := transfer.Decode(req.Body, format)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err = ts.tenant.Admit(len(tasks)); err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	result, err := transfer.Load(ts.store, tasks, opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	render(w, req, result)
+}
+
+// calendarHandler handler for "calendar.ics" path.
+func (ts *taskServer) calendarHandler(w http.ResponseWriter, req *http.Request) {
+	if req.Method == http.MethodGet {
+		ts.getCalendarHandler(w, req)
+	} else if req.Method == http.MethodPost {
+		ts.importCalendarHandler(w, req)
+	} else {
+		http.Error(w, fmt.Sprintf("expect method GET or POST at /calendar.ics, got %v", req.Method), http.StatusMethodNotAllowed)
+	}
+}
+
+// getCalendarHandler handler for GET method, renders tasks with due date (optionally filtered by tag) as iCalendar feed.
+func (ts *taskServer) getCalendarHandler(w http.ResponseWriter, req *http.Request) {
+	component, err := ical.ParseComponent(req.URL.Query().Get("component"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var tasks []models.Task
+	if tag := req.URL.Query().Get("tag"); tag != "" {
+		tasks = ts.store.GetTasksByTag(tag)
+	} else {
+		tasks = ts.store.GetAllTasks()
+	}
+
+	w.Header().Set("Content-Type", ical.ContentType)
+	if err = ical.Encode(w, tasks, ical.Options{Component: component, Name: "Tasks"}); err != nil {
+		log.Printf("error on render calendar: %s", err)
+	}
+}
+
+// importCalendarHandler handler for POST method, creates tasks from .ics file in request body.
+func (ts *taskServer) importCalendarHandler(w http.ResponseWriter, req *http.Request) {
+	tasks, err := ical.Decode(req.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err = ts.tenant.Admit(len(tasks)); err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	result, err := transfer.Load(ts.store, tasks, transfer.ImportOptions{})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	render(w, req, result)
 }
 
 // Init function do initialize a new server with parameters from config.yaml.
 func Init(cfg *config.Config) {
 	mux := http.NewServeMux()
 	var server *taskServer
+	policy, err := models.ParseSubtaskPolicy(cfg.Subtasks.Policy)
+	if err != nil {
+		cfg.ErrorLogger.Fatalf("Error on parse subtasks policy: %s\n", err)
+	}
+
+	files, err := attachment.NewFromConfig(cfg)
+	if err != nil {
+		cfg.ErrorLogger.Fatalf("Error on create store of attachments: %s\n", err)
+	}
+
+	bin := trash.New(cfg)
+	guard := bulk.New(cfg)
+	users, err := auth.New(cfg)
+	if err != nil {
+		cfg.ErrorLogger.Fatalf("Error on create authentication: %s\n", err)
+	}
+	tenants, err := tenant.New(cfg)
+	if err != nil {
+		cfg.ErrorLogger.Fatalf("Error on parse tenants resolution: %s\n", err)
+	}
 
 	switch cfg.Server.TypeOfRepository {
 	case "in-memory":
-		server = NewTaskServerInmemory()
+		server, err = NewTaskServerInmemory(policy, files, bin, guard, users, tenants)
+		if err != nil {
+			cfg.ErrorLogger.Fatalf("Error on start tenant: %s\n", err)
+		}
 	default:
 		cfg.ErrorLogger.Fatal("Unknown repository type.")
 	}
 
-	mux.HandleFunc("/task/", server.taskHandler)
-	mux.HandleFunc("/tag/", server.tagHandler)
-	mux.HandleFunc("/due/", server.dueHandler)
+	go bin.RunAll(tenants.Stores)
+
+	// JWT bearer tokens are verified for all routes except admin and login ones
+	jwtAuth := middleware.JWT(users.Verifier(), users.Local)
+	mux.Handle("/task/", jwtAuth(server.withActor((*taskServer).taskHandler)))
+	mux.Handle("/tag/", jwtAuth(server.withActor((*taskServer).tagHandler)))
+	mux.Handle("/due/", jwtAuth(server.withActor((*taskServer).dueHandler)))
+	mux.Handle("/project/", jwtAuth(server.withActor((*taskServer).projectHandler)))
+	mux.Handle("/trash", jwtAuth(server.withActor((*taskServer).trashHandler)))
+	mux.Handle("/search", jwtAuth(server.withActor((*taskServer).searchHandler)))
+	mux.Handle("/export", jwtAuth(server.withActor((*taskServer).exportHandler)))
+	mux.Handle("/import", jwtAuth(server.withActor((*taskServer).importHandler)))
+	mux.Handle("/calendar.ics", jwtAuth(server.withActor((*taskServer).calendarHandler)))
+	graphqlHandler := tenants.PerTenant(func(t *tenant.Tenant) (http.Handler, error) { return gql.NewHandler(t.Store(), users) })
+	webhookHandler := tenants.PerTenant(func(t *tenant.Tenant) (http.Handler, error) { return webhook.Handler(t.Hooks(), users), nil })
+	mux.Handle("/graphql", jwtAuth(graphqlHandler))
+	mux.Handle("/events", jwtAuth(tenants.PerTenant(func(t *tenant.Tenant) (http.Handler, error) { return events.SSEHandler(t.Bus(), users), nil })))
+	mux.Handle("/ws", jwtAuth(tenants.PerTenant(func(t *tenant.Tenant) (http.Handler, error) { return ws.Handler(t.Store(), t.Bus(), users), nil })))
+	mux.Handle("/webhooks", jwtAuth(webhookHandler))
+	mux.Handle("/webhooks/", jwtAuth(webhookHandler))
+	mux.Handle("/admin/tenants", tenant.Handler(tenants))
+	mux.Handle("/admin/tenants/", tenant.Handler(tenants))
+	mux.Handle("/auth/", oidc.Handler(users.Providers(), session.Handler(users.Sessions())))
 
-	handler := middleware.Logging(mux)
+	handler := middleware.Logging(tenants.Handler(mux))
 	handler = middleware.PanicRecovery(handler)
 
+	if cfg.GRPC.Enabled && cfg.GRPC.Multiplex {
+		cfg.ErrorLogger.Printf("Serve gRPC multiplexed with %s server\n", cfg.Server.TypeOfServer)
+		handler = grpcApi.Multiplex(grpcApi.NewServer(tenants, users), handler)
+	} else {
+		grpcApi.Start(cfg, tenants, users)
+	}
+
 	cfg.ErrorLogger.Printf("Start server %s with storage %s on: %s\n", cfg.Server.TypeOfServer, cfg.Server.TypeOfRepository, cfg.Server.ServerAddress+":"+strconv.Itoa(cfg.Server.ServerPort))
-	err := http.ListenAndServe(cfg.Server.ServerAddress+":"+strconv.Itoa(cfg.Server.ServerPort), handler)
+	err = http.ListenAndServe(cfg.Server.ServerAddress+":"+strconv.Itoa(cfg.Server.ServerPort), handler)
 	if err != nil {
 		cfg.ErrorLogger.Fatalf("Error on start server: %s\n", err)
 	}
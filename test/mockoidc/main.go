@@ -0,0 +1,29 @@
+// Mockoidc it's a local mock OpenID Connect provider for manual testing of login by auth.oidc of config, it serves
+// oidctest.Provider. Usage:
+//
+//	go run ./test/mockoidc -addr localhost:5556 -client tasks -secret ""
+package main
+
+import (
+	"flag"
+	"github.com/White-AK111/REST/internal/oidc/oidctest"
+	"log"
+	"net/http"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:5556", "address of provider, issuer is http://<addr>")
+	clientID := flag.String("client", "tasks", "id of registered client")
+	secret := flag.String("secret", "", "secret of registered client, empty for public client")
+	user := flag.String("user", "alice", "user approved without login_hint parameter")
+	flag.Parse()
+
+	p, err := oidctest.New(*clientID, *secret, *user)
+	if err != nil {
+		log.Fatalf("Error on create provider: %s", err)
+	}
+	p.Issuer = "http://" + *addr
+
+	log.Printf("Mock OpenID Connect provider %s, client %q", p.Issuer, p.ClientID)
+	log.Fatal(http.ListenAndServe(*addr, p.Handler()))
+}